@@ -0,0 +1,143 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/flokiorg/go-flokicoin/connmgr"
+	"github.com/flokiorg/go-flokicoin/netaddr"
+)
+
+const (
+	// anchorsFilename is the name of the file in the data directory that
+	// holds the block-relay-only outbound peers connected at shutdown.
+	anchorsFilename = "anchors.json"
+
+	// defaultBlockRelayOutbound is the number of block-relay-only outbound
+	// connections to maintain in addition to the full relay ones.
+	defaultBlockRelayOutbound = 2
+)
+
+// readAnchors returns the addresses stored in the passed anchors file and
+// removes the file, so a node that keeps crashing does not reconnect to the
+// same anchors forever.  Addresses that can't be parsed or are in a network
+// that is not reachable are skipped.  A missing file yields no addresses.
+func readAnchors(path string, amgr *netaddr.AddrManager) []net.Addr {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		srvrLog.Warnf("Unable to read anchors file %s: %v", path, err)
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		srvrLog.Warnf("Unable to remove anchors file %s: %v", path, err)
+	}
+
+	var addrStrs []string
+	if err := json.Unmarshal(data, &addrStrs); err != nil {
+		srvrLog.Warnf("Unable to parse anchors file %s: %v", path, err)
+		return nil
+	}
+
+	var anchors []net.Addr
+	for _, addrStr := range addrStrs {
+		if len(anchors) == defaultBlockRelayOutbound {
+			break
+		}
+
+		host, portStr, err := net.SplitHostPort(addrStr)
+		if err != nil {
+			continue
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			continue
+		}
+		na, err := amgr.HostToNetAddress(host, uint16(port), 0)
+		if err != nil || (netaddr.IsRoutable(na) && !amgr.IsReachable(na)) {
+			srvrLog.Debugf("Skipping anchor %s", addrStr)
+			continue
+		}
+		addr, err := addrStringToNetAddr(addrStr)
+		if err != nil {
+			srvrLog.Debugf("Skipping anchor %s: %v", addrStr, err)
+			continue
+		}
+		anchors = append(anchors, addr)
+	}
+	return anchors
+}
+
+// writeAnchors stores the passed addresses in the anchors file at path.
+func writeAnchors(path string, addrs []string) error {
+	data, err := json.Marshal(addrs)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// saveAnchors stores the block-relay-only outbound peers that completed the
+// handshake in the anchors file so they are reconnected to first on the next
+// start.  It is invoked from the peerHandler goroutine on shutdown.
+func (s *server) saveAnchors(state *peerState) {
+	if s.blockRelayConnManager == nil {
+		return
+	}
+
+	var addrs []string
+	for _, sp := range state.outboundPeers {
+		if sp.BlockRelayOnly() && sp.VerAckReceived() {
+			addrs = append(addrs, sp.Addr())
+		}
+	}
+	if len(addrs) == 0 {
+		return
+	}
+
+	path := anchorsPath()
+	if err := writeAnchors(path, addrs); err != nil {
+		srvrLog.Warnf("Unable to save anchors to %s: %v", path, err)
+		return
+	}
+	srvrLog.Debugf("Saved %d anchors to %s", len(addrs), path)
+}
+
+// anchorsPath returns the path of the anchors file in the data directory.
+func anchorsPath() string {
+	return filepath.Join(cfg.DataDir, anchorsFilename)
+}
+
+// popAnchor returns the next anchor to connect to, or nil once all anchors
+// have been tried.
+//
+// This function is safe for concurrent access.
+func (s *server) popAnchor() net.Addr {
+	s.anchorsMtx.Lock()
+	defer s.anchorsMtx.Unlock()
+
+	if len(s.anchors) == 0 {
+		return nil
+	}
+	addr := s.anchors[0]
+	s.anchors = s.anchors[1:]
+	return addr
+}
+
+// outboundConnManager returns the connection manager that maintains
+// full relay or block-relay-only outbound connections.
+func (s *server) outboundConnManager(blockRelayOnly bool) *connmgr.ConnManager {
+	if blockRelayOnly {
+		return s.blockRelayConnManager
+	}
+	return s.connManager
+}
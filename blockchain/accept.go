@@ -10,6 +10,7 @@ import (
 
 	"github.com/flokiorg/go-flokicoin/chainutil"
 	"github.com/flokiorg/go-flokicoin/database"
+	"github.com/flokiorg/go-flokicoin/wire"
 )
 
 // maybeAcceptBlock potentially accepts a block into the block chain and, if
@@ -63,16 +64,23 @@ func (b *BlockChain) maybeAcceptBlock(block *chainutil.Block, flags BehaviorFlag
 
 	// Create a new block node for the block and add it to the node index. Even
 	// if the block ultimately gets connected to the main chain, it starts out
-	// on a side chain.
-	blockHeader := &block.MsgBlock().Header
-	newNode := newBlockNode(blockHeader, prevNode)
-	newNode.status = statusDataStored
-
-	b.index.AddNode(newNode)
+	// on a side chain.  The node already exists when the header of the block
+	// was accepted ahead of its data, in which case it's only marked as
+	// having its data stored.
+	newNode := b.index.LookupNode(block.Hash())
+	if newNode == nil {
+		blockHeader := &block.MsgBlock().Header
+		newNode = newBlockNode(blockHeader, prevNode)
+		newNode.status = statusDataStored
+		b.index.AddNode(newNode)
+	} else {
+		b.index.SetStatusFlags(newNode, statusDataStored)
+	}
 	err = b.index.flushToDB()
 	if err != nil {
 		return false, err
 	}
+	b.updateBestHeader(newNode)
 
 	// Connect the passed block to the chain while respecting proper chain
 	// selection according to the chain with the most proof of work.  This
@@ -93,3 +101,63 @@ func (b *BlockChain) maybeAcceptBlock(block *chainutil.Block, flags BehaviorFlag
 
 	return isMainChain, nil
 }
+
+// maybeAcceptBlockHeader potentially accepts a block header into the block
+// index without the data of its block and returns the block node for it.  It
+// performs the checks on the header that don't require the block data, both
+// context free and depending on its position within the block chain, so the
+// blocks of a header chain can be downloaded once the headers are known.
+//
+// The new node is only added to the block index in memory, so the callers
+// must flush the block index to the database once they are done accepting
+// headers.
+//
+// The flags are also passed to CheckBlockHeaderSanity and
+// CheckBlockHeaderContext.  See their documentation for how the flags modify
+// their behavior.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) maybeAcceptBlockHeader(header *wire.BlockHeader, flags BehaviorFlags) (*blockNode, error) {
+	// Nothing more to do when the header is already known, unless it's
+	// known to be invalid.
+	blockHash := header.BlockHash()
+	if node := b.index.LookupNode(&blockHash); node != nil {
+		if b.index.NodeStatus(node).KnownInvalid() {
+			str := fmt.Sprintf("block %s is known to be invalid",
+				blockHash)
+			return nil, ruleError(ErrKnownInvalidBlock, str)
+		}
+		return node, nil
+	}
+
+	// The previous block must be known, either with its data or as a
+	// header accepted earlier on, and must not be invalid.
+	prevNode := b.index.LookupNode(&header.PrevBlock)
+	if prevNode == nil {
+		str := fmt.Sprintf("previous block %s is unknown",
+			header.PrevBlock)
+		return nil, ruleError(ErrPreviousBlockUnknown, str)
+	} else if b.index.NodeStatus(prevNode).KnownInvalid() {
+		str := fmt.Sprintf("previous block %s is known to be invalid",
+			header.PrevBlock)
+		return nil, ruleError(ErrInvalidAncestorBlock, str)
+	}
+
+	err := CheckBlockHeaderSanity(header, b.chainParams.PowLimit,
+		b.timeSource, flags)
+	if err != nil {
+		return nil, err
+	}
+	err = CheckBlockHeaderContext(header, prevNode, flags, b, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add a node without any status for the header.  It's marked as
+	// having its data stored once the block is accepted.
+	newNode := newBlockNode(header, prevNode)
+	b.index.AddNode(newNode)
+	b.updateBestHeader(newNode)
+
+	return newNode, nil
+}
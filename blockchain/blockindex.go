@@ -169,6 +169,18 @@ func (node *blockNode) Header() wire.BlockHeader {
 	}
 }
 
+// lastWithData returns the node, or its most recent ancestor, whose block data
+// is stored.  It returns nil when there is none.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (node *blockNode) lastWithData() *blockNode {
+	n := node
+	for n != nil && !n.status.HaveData() {
+		n = n.parent
+	}
+	return n
+}
+
 // invertLowestOne turns the lowest 1 bit in the binary representation of a number into a 0.
 func invertLowestOne(n int32) int32 {
 	return n & (n - 1)
@@ -8,6 +8,7 @@ package blockchain
 
 import (
 	"container/list"
+	"errors"
 	"fmt"
 	"math/big"
 	"sync"
@@ -98,12 +99,14 @@ type BlockChain struct {
 	// separate mutex.
 	checkpoints         []chaincfg.Checkpoint
 	checkpointsByHeight map[int32]*chaincfg.Checkpoint
+	assumeValid         *chainhash.Hash
 	db                  database.DB
 	chainParams         *chaincfg.Params
 	timeSource          MedianTimeSource
 	sigCache            *txscript.SigCache
 	indexManager        IndexManager
 	hashCache           *txscript.HashCache
+	maxReorgDepth       int32
 
 	// The following fields are calculated based upon the provided chain
 	// parameters.  They are also set when the instance is created and
@@ -133,10 +136,39 @@ type BlockChain struct {
 	index     *blockIndex
 	bestChain *chainView
 
+	// bestHeader is the node with the most cumulative work in the block
+	// index that isn't known to be invalid, whether the data of its block
+	// is stored or not.  It's ahead of the best chain when the headers of
+	// blocks are accepted before their data.
+	bestHeader *blockNode
+
 	// The UTXO state holds a cached view of the UTXO state of the chain.
 	// It is protected by the chain lock.
 	utxoCache *utxoCache
 
+	// utxoFlushSignal receives a value when the UTXO cache has enough
+	// dirty entries for FlushDirtyUtxos to write them.
+	utxoFlushSignal chan struct{}
+
+	// snapshotBase is the base block of the UTXO set snapshot the chain was
+	// loaded from, or nil when it wasn't loaded from one.  The blocks up
+	// to it can't be disconnected.  snapshotStatus is the validation
+	// status of the snapshot.  They are protected by the chain lock.
+	snapshotBase   *blockNode
+	snapshotStatus SnapshotStatus
+
+	// approvedReorgs houses the hashes of the blocks whose branches were
+	// approved by the caller, so the reorganizations to them are not
+	// limited by the maximum automatic reorganization depth.  It is
+	// protected by the chain lock.
+	approvedReorgs map[chainhash.Hash]struct{}
+
+	// refusedReorgs houses the hashes of the first blocks of the side
+	// chains whose reorganization was refused for being too deep, so the
+	// refusal is only notified once per side chain.  It is protected by
+	// the chain lock.
+	refusedReorgs map[chainhash.Hash]struct{}
+
 	// These fields are related to handling of orphan blocks.  They are
 	// protected by a combination of the chain lock and the orphan lock.
 	orphanLock   sync.RWMutex
@@ -676,6 +708,10 @@ func (b *BlockChain) connectBlock(node *blockNode, block *chainutil.Block,
 		if err != nil {
 			return err
 		}
+		err = dbPutChainTxCount(dbTx, block.Hash(), state.TotalTxns)
+		if err != nil {
+			return err
+		}
 
 		// Update the transaction spend journal by adding a record for
 		// the block that contains all txos spent by it.
@@ -684,6 +720,14 @@ func (b *BlockChain) connectBlock(node *blockNode, block *chainutil.Block,
 			return err
 		}
 
+		// Add a record for the block to the utxo journal, which allows
+		// the utxo cache to be recovered until the changes made by the
+		// block are flushed.
+		err = dbPutUtxoJournalEntry(dbTx, node, block)
+		if err != nil {
+			return err
+		}
+
 		// Allow the index manager to call each of the currently active
 		// optional indexes with the block being connected so they can
 		// update themselves accordingly.
@@ -723,9 +767,22 @@ func (b *BlockChain) connectBlock(node *blockNode, block *chainutil.Block,
 
 	// Since we may have changed the UTXO cache, we make sure it didn't exceed its
 	// maximum size.  If we're pruned and have flushed already, this will be a no-op.
-	return b.db.Update(func(dbTx database.Tx) error {
+	err = b.db.Update(func(dbTx database.Tx) error {
 		return b.utxoCache.flush(dbTx, FlushIfNeeded, state)
 	})
+	if err != nil {
+		return err
+	}
+
+	// Signal that the dirty entries of the cache should be written in the
+	// background when there are enough of them.
+	if len(b.utxoCache.dirtyEntries) >= b.utxoCache.maxDirtyEntries {
+		select {
+		case b.utxoFlushSignal <- struct{}{}:
+		default:
+		}
+	}
+	return nil
 }
 
 // disconnectBlock handles disconnecting the passed node/block from the end of
@@ -782,6 +839,10 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *chainutil.Block, vi
 		if err != nil {
 			return err
 		}
+		err = dbRemoveChainTxCount(dbTx, block.Hash())
+		if err != nil {
+			return err
+		}
 
 		// Flush the cache on every disconnect.  Since the code for
 		// reorganization modifies the database directly, the cache
@@ -791,6 +852,10 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *chainutil.Block, vi
 		if err != nil {
 			return err
 		}
+		err = dbRemoveUtxoJournalEntry(dbTx, node.height)
+		if err != nil {
+			return err
+		}
 
 		// Update the utxo set using the state of the utxo view.  This
 		// entails restoring all of the utxos spent and removing the new
@@ -1022,6 +1087,19 @@ func (b *BlockChain) verifyReorganizationValidity(detachNodes, attachNodes *list
 		}
 	}
 
+	// The blocks up to the base of the UTXO set snapshot the chain was
+	// loaded from can't be disconnected since their data isn't stored.
+	if detachNodes.Len() != 0 && b.snapshotBase != nil {
+		lastDetachNode := detachNodes.Back().Value.(*blockNode)
+		if lastDetachNode.height <= b.snapshotBase.height {
+			return nil, nil, nil, fmt.Errorf("unable to disconnect "+
+				"block %v at height %d, which is not after the "+
+				"UTXO snapshot base at height %d",
+				lastDetachNode.hash, lastDetachNode.height,
+				b.snapshotBase.height)
+		}
+	}
+
 	// All of the blocks to detach and related spend journal entries needed
 	// to unspend transaction outputs in the blocks being disconnected must
 	// be loaded from the database during the reorg check phase below and
@@ -1278,6 +1356,34 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *chainutil.Block, f
 		return false, nil
 	}
 
+	// The side chain has more cumulative work, but it stays a side chain
+	// when the reorganization would disconnect more blocks of the main chain
+	// than allowed until it is approved.  Notify the caller so it can alert
+	// the operator.
+	if blocked := b.blockedReorg(node); blocked != nil {
+		if !b.firstRefusal(node) {
+			log.Debugf("REORGANIZE REFUSED: Block %v extends a side "+
+				"chain whose reorganization was already refused",
+				node.hash)
+			return false, nil
+		}
+
+		log.Warnf("REORGANIZE REFUSED: Block %v would disconnect %d "+
+			"blocks of the main chain from height %d/block %v, which "+
+			"exceeds the maximum of %d blocks -- the side chain is "+
+			"kept until the reorganization is approved", node.hash,
+			blocked.Depth, blocked.ForkHeight, blocked.ForkHash,
+			b.maxReorgDepth)
+
+		func() {
+			b.chainLock.Unlock()
+			defer b.chainLock.Lock()
+			b.sendNotification(NTChainReorgBlocked, blocked)
+		}()
+
+		return false, nil
+	}
+
 	// We're extending (or creating) a side chain and the cumulative work
 	// for this new side chain is more than the old best chain, so this side
 	// chain needs to become the main chain.  In order to accomplish that,
@@ -1352,6 +1458,62 @@ func (b *BlockChain) BestSnapshot() *BestState {
 	return snapshot
 }
 
+// BestHeader returns the hash and height of the header with the most
+// cumulative work known to the block index that isn't known to be invalid.
+// The data of its block, and of the blocks before it down to the best chain,
+// may not be stored yet when headers are synced ahead of the blocks.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BestHeader() (chainhash.Hash, int32) {
+	b.chainLock.RLock()
+	node := b.bestHeaderNode()
+	b.chainLock.RUnlock()
+	return node.hash, node.height
+}
+
+// bestHeaderNode returns the node of the best header, which is the tip of the
+// best chain unless a header with more cumulative work is known.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) bestHeaderNode() *blockNode {
+	node := b.bestChain.Tip()
+	if b.bestHeader != nil && b.bestHeader.workSum.Cmp(node.workSum) > 0 {
+		node = b.bestHeader
+	}
+	return node
+}
+
+// updateBestHeader sets the passed node as the best header when it has more
+// cumulative work than the current one.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) updateBestHeader(node *blockNode) {
+	if b.bestHeader == nil || node.workSum.Cmp(b.bestHeader.workSum) > 0 {
+		b.bestHeader = node
+	}
+}
+
+// resetBestHeader looks up the best header in the whole block index.  It is
+// used when the validity of blocks changes, which may invalidate the current
+// best header.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) resetBestHeader() {
+	b.bestHeader = b.bestChain.Tip()
+	for _, tip := range b.index.InactiveTips(b.bestChain) {
+		// The descendants of an invalid block are invalid too, so the
+		// most work valid node of the branch is the last one before
+		// the invalid blocks.
+		n := tip
+		for n != nil && n.status.KnownInvalid() {
+			n = n.parent
+		}
+		if n != nil {
+			b.updateBestHeader(n)
+		}
+	}
+}
+
 // TipStatus is the status of a chain tip.
 type TipStatus byte
 
@@ -1373,6 +1535,11 @@ const (
 	// 2: Is not invalid.
 	// 3: Has the block data stored to disk.
 	StatusValidFork
+
+	// StatusHeadersOnly indicates that the tip is not invalid but the
+	// block data of the tip isn't stored yet, such as when its header was
+	// accepted ahead of the block during the initial block download.
+	StatusHeadersOnly
 )
 
 // String returns the status flags as string.
@@ -1384,6 +1551,8 @@ func (ts TipStatus) String() string {
 		return "invalid"
 	case StatusValidFork:
 		return "valid-fork"
+	case StatusHeadersOnly:
+		return "headers-only"
 	}
 	return fmt.Sprintf("unknown: %b", ts)
 }
@@ -1450,6 +1619,10 @@ func (b *BlockChain) ChainTips() []ChainTip {
 		// the bestChain.
 		case tip.status.HaveData():
 			status = StatusValidFork
+
+		// Otherwise only the header of the tip is known.
+		default:
+			status = StatusHeadersOnly
 		}
 
 		chainTip := ChainTip{
@@ -1490,6 +1663,19 @@ func (b *BlockChain) HeaderByHash(hash *chainhash.Hash) (wire.BlockHeader, error
     return hdr, nil
 }
 
+// HeaderCtxByHash returns the header context of the block identified by the
+// passed hash, which may only have its header in the block index.  It returns
+// nil when the block is unknown.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) HeaderCtxByHash(hash *chainhash.Hash) HeaderCtx {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return nil
+	}
+	return node
+}
+
 // MainChainHasBlock returns whether or not the block with the given hash is in
 // the main chain.
 //
@@ -1896,6 +2082,7 @@ func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) error {
 			return fmt.Errorf("Error flushing block index "+
 				"changes to disk: %v", writeErr)
 		}
+		b.resetBestHeader()
 
 		// Return since the block being invalidated is on a side branch.
 		// Nothing else left to do.
@@ -1947,6 +2134,14 @@ func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) error {
 			continue
 		}
 
+		// Only the blocks with their data stored can be connected, so
+		// the branch of a tip whose header was accepted ahead of its
+		// data is considered up to its last block with data.
+		tip = tip.lastWithData()
+		if tip == nil {
+			continue
+		}
+
 		// If we have no best tips, then set this tip as the best tip.
 		if bestTip == nil {
 			bestTip = tip
@@ -1960,6 +2155,7 @@ func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) error {
 	}
 
 	// Return if the best tip is the current tip.
+	b.resetBestHeader()
 	if bestTip == b.bestChain.Tip() {
 		return nil
 	}
@@ -1976,6 +2172,8 @@ func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) error {
 }
 
 // ReconsiderBlock reconsiders the validity of the block with the given hash.
+// Reconsidering a block of a side chain also approves the reorganization to its
+// branch as ApproveReorg does.
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) ReconsiderBlock(hash *chainhash.Hash) error {
@@ -1991,12 +2189,28 @@ func (b *BlockChain) ReconsiderBlock(hash *chainhash.Hash) error {
 			"and thus cannot be reconsidered", hash)
 	}
 
-	// Nothing to do if the given block is already valid.
-	if reconsiderNode.status.KnownValid() {
+	// Nothing to do if the given block is already valid and in the main
+	// chain.
+	inMainChain := b.bestChain.Contains(reconsiderNode)
+	if reconsiderNode.status.KnownValid() && inMainChain {
 		log.Infof("block_hash=%x is valid, nothing to reconsider", hash[:])
 		return nil
 	}
 
+	// Reconsidering a block of a side chain approves the reorganization to
+	// its branch, which may have been refused for being too deep.
+	if !inMainChain {
+		b.approvedReorgs[reconsiderNode.hash] = struct{}{}
+	}
+
+	// Nothing to reconsider if the given block of a side chain is already
+	// valid, but its approved branch may still have to become the main
+	// chain.
+	if reconsiderNode.status.KnownValid() {
+		log.Infof("block_hash=%x is valid, nothing to reconsider", hash[:])
+		return b.reorganizeToBranch(reconsiderNode)
+	}
+
 	// Clear the status of the block being reconsidered.
 	b.index.UnsetStatusFlags(reconsiderNode, statusInvalidAncestor)
 	b.index.UnsetStatusFlags(reconsiderNode, statusValidateFailed)
@@ -2032,6 +2246,19 @@ func (b *BlockChain) ReconsiderBlock(hash *chainhash.Hash) error {
 		}
 	}
 
+	// The blocks of the branch being reconsidered may be valid again, so
+	// its tip may be the best header again.
+	b.resetBestHeader()
+
+	// Only the blocks with their data stored can be connected, so the
+	// branch is reconsidered up to its last block with data.
+	if reconsiderTip != nil {
+		reconsiderTip = reconsiderTip.lastWithData()
+	}
+	if reconsiderTip == nil {
+		return nil
+	}
+
 	// Compare the cumulative work for the branch being reconsidered.
 	bestTipWork := b.bestChain.Tip().workSum
 	if reconsiderTip.workSum.Cmp(bestTipWork) <= 0 {
@@ -2123,6 +2350,14 @@ type Config struct {
 	// checkpoints.
 	Checkpoints []chaincfg.Checkpoint
 
+	// AssumeValid is the hash of a block whose scripts, and those of its
+	// ancestors, are not checked once it's buried deep enough in the best
+	// header chain.  It's typically the AssumeValid block of ChainParams.
+	//
+	// This field can be nil if the caller wishes to check the scripts of
+	// all blocks.
+	AssumeValid *chainhash.Hash
+
 	// TimeSource defines the median time source to use for things such as
 	// block processing and determining whether or not the chain is current.
 	//
@@ -2161,6 +2396,16 @@ type Config struct {
 	// will target for with block files.  Prune at 0 specifies that no
 	// blocks will be deleted.
 	Prune uint64
+
+	// MaxReorgDepth is the maximum number of blocks of the main chain a
+	// reorganization may disconnect automatically.  The blocks of a side
+	// chain that would cause a deeper reorganization are kept on their
+	// side chain, and an NTChainReorgBlocked notification is sent for the
+	// first of them, until the reorganization is approved with ApproveReorg
+	// or ReconsiderBlock.
+	// The reorganizations caused by InvalidateBlock are not limited.
+	// MaxReorgDepth at 0 specifies that there is no limit.
+	MaxReorgDepth int32
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -2200,6 +2445,7 @@ func New(config *Config) (*BlockChain, error) {
 	b := BlockChain{
 		checkpoints:         config.Checkpoints,
 		checkpointsByHeight: checkpointsByHeight,
+		assumeValid:         config.AssumeValid,
 		db:                  config.DB,
 		chainParams:         params,
 		timeSource:          config.TimeSource,
@@ -2210,7 +2456,11 @@ func New(config *Config) (*BlockChain, error) {
 		blocksPerRetarget:   int32(targetTimespan / targetTimePerBlock),
 		index:               newBlockIndex(config.DB, params),
 		utxoCache:           newUtxoCache(config.DB, config.UtxoCacheMaxSize),
+		utxoFlushSignal:     make(chan struct{}, 1),
 		hashCache:           config.HashCache,
+		maxReorgDepth:       config.MaxReorgDepth,
+		approvedReorgs:      make(map[chainhash.Hash]struct{}),
+		refusedReorgs:       make(map[chainhash.Hash]struct{}),
 		bestChain:           newChainView(nil),
 		orphans:             make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
@@ -2233,6 +2483,16 @@ func New(config *Config) (*BlockChain, error) {
 		}
 	}
 
+	// The chain state can't be used while it's being reset.
+	status, err := FetchReindexStatus(config.DB)
+	if err != nil {
+		return nil, err
+	}
+	if status == ReindexResetting {
+		return nil, errors.New("the reset of the chain state was " +
+			"interrupted and must be resumed")
+	}
+
 	// Initialize the chain state from the passed database.  When the db
 	// does not yet contain any chain state, both it and the chain state
 	// will be initialized to contain only the genesis block.
@@ -2245,6 +2505,13 @@ func New(config *Config) (*BlockChain, error) {
 		return nil, err
 	}
 
+	// The blocks before the base of a UTXO set snapshot aren't stored, so
+	// the optional indexes can't be built.
+	if b.snapshotBase != nil && config.IndexManager != nil {
+		return nil, errors.New("optional indexes can't be used with a " +
+			"chain loaded from a UTXO snapshot")
+	}
+
 	// Initialize and catch up all of the currently active optional indexes
 	// as needed.
 	if config.IndexManager != nil {
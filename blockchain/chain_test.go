@@ -6,6 +6,7 @@
 package blockchain
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"reflect"
@@ -16,6 +17,7 @@ import (
 	"github.com/flokiorg/go-flokicoin/chaincfg"
 	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
 	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/database"
 	"github.com/flokiorg/go-flokicoin/wire"
 )
 
@@ -1009,12 +1011,12 @@ func TestChainTips(t *testing.T) {
 			},
 		},
 		{
-			name: "one active chain tip, one unknown chain tip",
+			name: "one active chain tip, one headers-only chain tip",
 			chainTipGen: func() (*BlockChain, map[chainhash.Hash]ChainTip) {
 				// Construct a synthetic block chain with a block index consisting of
 				// the following structure.
 				// 	genesis -> 1 -> 2 -> 3 ... -> 10 -> 11  -> 12  -> 13 (active)
-				//                                      \-> 11a -> 12a (unknown)
+				//                                      \-> 11a -> 12a (headers-only)
 				tip := tstTip
 				chain := newFakeChain(&chaincfg.MainNetParams)
 				branch0Nodes := chainedNodes(chain.bestChain.Genesis(), 13)
@@ -1036,15 +1038,15 @@ func TestChainTips(t *testing.T) {
 					BranchLen: 0,
 					Status:    StatusActive,
 				}
-				unknownTip := ChainTip{
+				headersOnlyTip := ChainTip{
 					Height:    12,
 					BlockHash: (tip(branch1Nodes)).hash,
 					BranchLen: 2,
-					Status:    StatusUnknown,
+					Status:    StatusHeadersOnly,
 				}
 				chainTips := make(map[chainhash.Hash]ChainTip)
 				chainTips[activeTip.BlockHash] = activeTip
-				chainTips[unknownTip.BlockHash] = unknownTip
+				chainTips[headersOnlyTip.BlockHash] = headersOnlyTip
 
 				return chain, chainTips
 			},
@@ -1155,6 +1157,11 @@ func TestChainTips(t *testing.T) {
 					t.Errorf("TestChainTips Fail: Expected string of \"valid-fork\", got \"%s\"",
 						testChainTip.Status.String())
 				}
+			case StatusHeadersOnly:
+				if testChainTip.Status.String() != "headers-only" {
+					t.Errorf("TestChainTips Fail: Expected string of \"headers-only\", got \"%s\"",
+						testChainTip.Status.String())
+				}
 			case StatusUnknown:
 				if testChainTip.Status.String() != fmt.Sprintf("unknown: %b", testChainTip.Status) {
 					t.Errorf("TestChainTips Fail: Expected string of \"unknown\", got \"%s\"",
@@ -1855,3 +1862,230 @@ func TestReconsiderBlock(t *testing.T) {
 		}()
 	}
 }
+
+// TestProcessBlockHeader ensures block headers are accepted into the block
+// index ahead of the data of their blocks and that the blocks are then
+// processed as usual.
+func TestProcessBlockHeader(t *testing.T) {
+	chain, params, tearDown := utxoCacheTestChain("TestProcessBlockHeader")
+	defer tearDown()
+
+	// Create a chain of 3 blocks without processing them.
+	blocks := make([]*chainutil.Block, 0, 3)
+	prev := chainutil.NewBlock(params.GenesisBlock)
+	for i := 0; i < 3; i++ {
+		block, _, err := newBlock(chain, prev, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+		prev = block
+	}
+
+	// A header that doesn't connect to the block index must be rejected.
+	err := chain.ProcessBlockHeader(&blocks[1].MsgBlock().Header, BFNone)
+	if !isRuleError(err, ErrPreviousBlockUnknown) {
+		t.Fatalf("ProcessBlockHeader: unexpected error for header "+
+			"of unknown parent: %v", err)
+	}
+
+	// Accept the headers, twice to ensure known headers are accepted.
+	for i := 0; i < 2; i++ {
+		for _, block := range blocks {
+			header := &block.MsgBlock().Header
+			if err := chain.ProcessBlockHeader(header, BFNone); err != nil {
+				t.Fatalf("ProcessBlockHeader: unexpected error: %v",
+					err)
+			}
+		}
+	}
+
+	// The blocks of the headers must not be known yet while the headers
+	// are, and the best chain must not have moved.
+	tip := blocks[len(blocks)-1]
+	for _, block := range blocks {
+		have, err := chain.HaveBlock(block.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have {
+			t.Fatalf("HaveBlock: block %v of a header-only node is "+
+				"known", block.Hash())
+		}
+	}
+	if best := chain.BestSnapshot(); best.Height != 0 {
+		t.Fatalf("BestSnapshot: got height %d, want 0", best.Height)
+	}
+	bestHash, bestHeight := chain.BestHeader()
+	if bestHash != *tip.Hash() || bestHeight != 3 {
+		t.Fatalf("BestHeader: got %v (height %d), want %v (height 3)",
+			bestHash, bestHeight, tip.Hash())
+	}
+	headersOnlyTip := ChainTip{
+		Height:    3,
+		BlockHash: *tip.Hash(),
+		BranchLen: 3,
+		Status:    StatusHeadersOnly,
+	}
+	if !hasChainTip(chain.ChainTips(), headersOnlyTip) {
+		t.Fatalf("ChainTips: missing headers-only tip %v", tip.Hash())
+	}
+
+	// Process the blocks now that their headers are known.
+	for _, block := range blocks {
+		if _, _, err := chain.ProcessBlock(block, BFNone); err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+	if best := chain.BestSnapshot(); best.Hash != *tip.Hash() {
+		t.Fatalf("BestSnapshot: got tip %v, want %v", best.Hash,
+			tip.Hash())
+	}
+	activeTip := ChainTip{
+		Height:    3,
+		BlockHash: *tip.Hash(),
+		Status:    StatusActive,
+	}
+	if !hasChainTip(chain.ChainTips(), activeTip) {
+		t.Fatalf("ChainTips: missing active tip %v", tip.Hash())
+	}
+
+	// Blocks with their data stored must be rejected as duplicates.
+	_, _, err = chain.ProcessBlock(tip, BFNone)
+	if !isRuleError(err, ErrDuplicateBlock) {
+		t.Fatalf("ProcessBlock: unexpected error for duplicate block: "+
+			"%v", err)
+	}
+}
+
+// TestProcessBlockHeaders ensures a batch of block headers is accepted into the
+// block index and written to the database at once, keeping the headers
+// accepted before a rejected one.
+func TestProcessBlockHeaders(t *testing.T) {
+	chain, params, tearDown := utxoCacheTestChain("TestProcessBlockHeaders")
+	defer tearDown()
+
+	// Create a chain of 3 blocks without processing them.
+	headers := make([]*wire.BlockHeader, 0, 3)
+	prev := chainutil.NewBlock(params.GenesisBlock)
+	for i := 0; i < 3; i++ {
+		block, _, err := newBlock(chain, prev, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, &block.MsgBlock().Header)
+		prev = block
+	}
+
+	// The last header doesn't connect to the previous ones.
+	orphan := *headers[2]
+	orphan.PrevBlock = chainhash.Hash{}
+	batch := []*wire.BlockHeader{headers[0], headers[1], &orphan}
+	err := chain.ProcessBlockHeaders(batch, BFNone)
+	if !isRuleError(err, ErrPreviousBlockUnknown) {
+		t.Fatalf("ProcessBlockHeaders: unexpected error for header "+
+			"of unknown parent: %v", err)
+	}
+
+	// The headers before the rejected one are accepted and written.
+	bestHash, bestHeight := chain.BestHeader()
+	if bestHash != headers[1].BlockHash() || bestHeight != 2 {
+		t.Fatalf("BestHeader: got %v (height %d), want %v (height 2)",
+			bestHash, bestHeight, headers[1].BlockHash())
+	}
+	if dirty := len(chain.index.dirty); dirty != 0 {
+		t.Fatalf("%d block index nodes not written", dirty)
+	}
+
+	// The remaining header is accepted along with the known ones.
+	if err := chain.ProcessBlockHeaders(headers, BFNone); err != nil {
+		t.Fatalf("ProcessBlockHeaders: unexpected error: %v", err)
+	}
+	bestHash, bestHeight = chain.BestHeader()
+	if bestHash != headers[2].BlockHash() || bestHeight != 3 {
+		t.Fatalf("BestHeader: got %v (height %d), want %v (height 3)",
+			bestHash, bestHeight, headers[2].BlockHash())
+	}
+	if dirty := len(chain.index.dirty); dirty != 0 {
+		t.Fatalf("%d block index nodes not written", dirty)
+	}
+}
+
+// TestStoreFetchedBlock ensures the blocks fetched on demand are only stored
+// when they match a known header.
+func TestStoreFetchedBlock(t *testing.T) {
+	chain, params, tearDown := utxoCacheTestChain("TestStoreFetchedBlock")
+	defer tearDown()
+
+	genesis := chainutil.NewBlock(params.GenesisBlock)
+	block, _, err := newBlock(chain, genesis, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasBlock := func() bool {
+		var exists bool
+		err := chain.db.View(func(dbTx database.Tx) error {
+			var err error
+			exists, err = dbTx.HasBlock(block.Hash())
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return exists
+	}
+
+	// A block whose header is unknown must be rejected.
+	if err := chain.StoreFetchedBlock(block); err == nil || hasBlock() {
+		t.Fatal("StoreFetchedBlock: stored a block of an unknown header")
+	}
+
+	// A block whose transactions don't match its header must be rejected.
+	header := &block.MsgBlock().Header
+	if err := chain.ProcessBlockHeader(header, BFNone); err != nil {
+		t.Fatalf("ProcessBlockHeader: unexpected error: %v", err)
+	}
+	serialized, err := block.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tampered wire.MsgBlock
+	if err := tampered.Deserialize(bytes.NewReader(serialized)); err != nil {
+		t.Fatal(err)
+	}
+	tampered.Transactions[0].TxOut[0].Value--
+	err = chain.StoreFetchedBlock(chainutil.NewBlock(&tampered))
+	if !isRuleError(err, ErrBadMerkleRoot) || hasBlock() {
+		t.Fatalf("StoreFetchedBlock: unexpected error for tampered "+
+			"block: %v", err)
+	}
+
+	// The block is stored once it matches its header, without being
+	// connected.
+	if err := chain.StoreFetchedBlock(block); err != nil {
+		t.Fatalf("StoreFetchedBlock: unexpected error: %v", err)
+	}
+	if !hasBlock() {
+		t.Fatal("StoreFetchedBlock: block not stored")
+	}
+	if best := chain.BestSnapshot(); best.Height != 0 {
+		t.Fatalf("BestSnapshot: got height %d, want 0", best.Height)
+	}
+}
+
+// isRuleError returns whether the passed error is a rule error with the passed
+// error code.
+func isRuleError(err error, code ErrorCode) bool {
+	rerr, ok := err.(RuleError)
+	return ok && rerr.ErrorCode == code
+}
+
+// hasChainTip returns whether the passed chain tips contain the passed one.
+func hasChainTip(tips []ChainTip, want ChainTip) bool {
+	for _, tip := range tips {
+		if tip == want {
+			return true
+		}
+	}
+	return false
+}
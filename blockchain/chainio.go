@@ -33,6 +33,11 @@ const (
 	// journal bucket that is used to track all spent transactions for use
 	// in reorgs.
 	latestSpendJournalBucketVersion = 1
+
+	// latestChainTxCountBucketVersion is the current version of the chain
+	// tx count bucket that is used to track the number of transactions in
+	// the main chain up to each block.
+	latestChainTxCountBucketVersion = 1
 )
 
 var (
@@ -72,6 +77,27 @@ var (
 	// unspent transaction output set.
 	utxoSetBucketName = []byte("utxosetv2")
 
+	// utxoJournalBucketName is the name of the db bucket used to house the
+	// changes to the utxo set of the blocks that might not be flushed yet.
+	utxoJournalBucketName = []byte("utxojournal")
+
+	// chainTxCountBucketName is the name of the db bucket used to house
+	// the block hash -> chain tx count index of the main chain.
+	chainTxCountBucketName = []byte("chaintxcountidx")
+
+	// chainTxCountVersionKeyName is the name of the db key used to store
+	// the version of the chain tx count index once it's fully built.
+	chainTxCountVersionKeyName = []byte("chaintxcountversion")
+
+	// snapshotStateKeyName is the name of the db key used to store the
+	// base and validation status of the UTXO set snapshot the chain was
+	// loaded from.
+	snapshotStateKeyName = []byte("utxosnapshotstate")
+
+	// reindexStateKeyName is the name of the db key used to store the
+	// progress of the reindex of the chain state while it's in progress.
+	reindexStateKeyName = []byte("reindexchainstate")
+
 	// auxPowHeaderBucketName is the name of the db bucket used to persist
 	// AuxPoW payloads (wire.AuxPowHeader) by block hash. Values are framed as:
 	//  0x00                      => AuxPoW explicitly nil for this block
@@ -919,6 +945,50 @@ func dbRemoveBlockIndex(dbTx database.Tx, hash *chainhash.Hash, height int32) er
 	return heightIndex.Delete(serializedHeight[:])
 }
 
+// -----------------------------------------------------------------------------
+// The chain tx count index consists of an entry for every block in the main
+// chain with the total number of transactions in the chain up to and including
+// the block.  The blocks before the base of a UTXO set snapshot, and the blocks
+// that were pruned before the index was built, don't have an entry.
+//
+// The key is the block hash and the serialized format for the values is:
+//   <tx count>
+//
+//   Field      Type     Size
+//   tx count   uint64   8 bytes
+// -----------------------------------------------------------------------------
+
+// dbPutChainTxCount uses an existing database transaction to update or add the
+// chain tx count index entry for the provided block hash.
+func dbPutChainTxCount(dbTx database.Tx, hash *chainhash.Hash, txCount uint64) error {
+	var serialized [8]byte
+	byteOrder.PutUint64(serialized[:], txCount)
+	bucket := dbTx.Metadata().Bucket(chainTxCountBucketName)
+	return bucket.Put(hash[:], serialized[:])
+}
+
+// dbRemoveChainTxCount uses an existing database transaction to remove the
+// chain tx count index entry for the provided block hash.
+func dbRemoveChainTxCount(dbTx database.Tx, hash *chainhash.Hash) error {
+	bucket := dbTx.Metadata().Bucket(chainTxCountBucketName)
+	return bucket.Delete(hash[:])
+}
+
+// dbFetchChainTxCount uses an existing database transaction to retrieve the
+// chain tx count for the provided block hash.  It returns false when the block
+// doesn't have an entry in the index.
+func dbFetchChainTxCount(dbTx database.Tx, hash *chainhash.Hash) (uint64, bool) {
+	bucket := dbTx.Metadata().Bucket(chainTxCountBucketName)
+	if bucket == nil {
+		return 0, false
+	}
+	serialized := bucket.Get(hash[:])
+	if len(serialized) != 8 {
+		return 0, false
+	}
+	return byteOrder.Uint64(serialized), true
+}
+
 // dbFetchHeightByHash uses an existing database transaction to retrieve the
 // height for the provided hash from the index.
 func dbFetchHeightByHash(dbTx database.Tx, hash *chainhash.Hash) (int32, error) {
@@ -1153,6 +1223,24 @@ func (b *BlockChain) createChainState() error {
 			return err
 		}
 
+		// Create the bucket that houses the utxo journal.
+		_, err = meta.CreateBucket(utxoJournalBucketName)
+		if err != nil {
+			return err
+		}
+
+		// Create the bucket that houses the chain tx count index and
+		// store its version.
+		_, err = meta.CreateBucket(chainTxCountBucketName)
+		if err != nil {
+			return err
+		}
+		err = dbPutVersion(dbTx, chainTxCountVersionKeyName,
+			latestChainTxCountBucketVersion)
+		if err != nil {
+			return err
+		}
+
 		// Save the genesis block to the block index database.
 		err = dbStoreBlockNode(dbTx, node)
 		if err != nil {
@@ -1165,6 +1253,10 @@ func (b *BlockChain) createChainState() error {
 		if err != nil {
 			return err
 		}
+		err = dbPutChainTxCount(dbTx, &node.hash, numTxns)
+		if err != nil {
+			return err
+		}
 
 		// Store the current best chain state into the database.
 		err = dbPutBestState(dbTx, b.stateSnapshot, node.workSum)
@@ -1294,15 +1386,39 @@ func (b *BlockChain) initChainState() error {
 		}
 		b.bestChain.SetTip(tip)
 
-		// Load the raw block bytes for the best block.
-		blockBytes, err := dbTx.FetchBlock(&state.hash)
+		// The headers of blocks accepted ahead of their data may
+		// extend past the tip.
+		b.resetBestHeader()
+
+		// Load the base of the UTXO set snapshot the chain was loaded
+		// from, if any.
+		baseHash, status, loaded, err := dbFetchSnapshotState(dbTx)
 		if err != nil {
 			return err
 		}
+		if loaded {
+			b.snapshotBase = b.index.LookupNode(&baseHash)
+			if b.snapshotBase == nil {
+				return AssertError(fmt.Sprintf("initChainState: "+
+					"cannot find UTXO snapshot base %s in "+
+					"block index", baseHash))
+			}
+			b.snapshotStatus = status
+		}
+
+		// Load the raw block bytes for the best block.  The data of
+		// the snapshot base isn't stored while it's the tip.
 		var block wire.MsgBlock
-		err = block.Deserialize(bytes.NewReader(blockBytes))
-		if err != nil {
-			return err
+		var blockBytes []byte
+		if tip != b.snapshotBase {
+			blockBytes, err = dbTx.FetchBlock(&state.hash)
+			if err != nil {
+				return err
+			}
+			err = block.Deserialize(bytes.NewReader(blockBytes))
+			if err != nil {
+				return err
+			}
 		}
 
 		// As a final consistency check, we'll run through all the
@@ -1325,9 +1441,12 @@ func (b *BlockChain) initChainState() error {
 		}
 
 		// Initialize the state related to the best block.
-		blockSize := uint64(len(blockBytes))
-		blockWeight := uint64(GetBlockWeight(chainutil.NewBlock(&block)))
-		numTxns := uint64(len(block.Transactions))
+		var blockSize, blockWeight, numTxns uint64
+		if blockBytes != nil {
+			blockSize = uint64(len(blockBytes))
+			blockWeight = uint64(GetBlockWeight(chainutil.NewBlock(&block)))
+			numTxns = uint64(len(block.Transactions))
+		}
 		b.stateSnapshot = newBestState(tip, blockSize, blockWeight,
 			numTxns, state.totalTxns, CalcPastMedianTime(tip))
 
@@ -0,0 +1,131 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/database"
+)
+
+// txRateWindow is the time span of the blocks used to estimate the rate of
+// the transactions of the chain for the verification progress.
+const txRateWindow = 30 * 24 * time.Hour
+
+// ChainTxStats houses the statistics about the transactions of the main chain
+// up to a block, over a window of blocks ending with it.
+type ChainTxStats struct {
+	// Hash, Height and Time identify the final block of the window.
+	Hash   chainhash.Hash
+	Height int32
+	Time   int64
+
+	// TxCount is the total number of transactions in the chain up to and
+	// including the final block of the window.
+	TxCount uint64
+
+	// WindowBlockCount is the number of blocks in the window.
+	WindowBlockCount int32
+
+	// WindowTxCount is the number of transactions in the window.
+	WindowTxCount uint64
+
+	// WindowInterval is the elapsed time in the window, in seconds.
+	WindowInterval int64
+}
+
+// chainTxStats returns the statistics about the transactions of the main chain
+// over the window of the passed number of blocks ending with the passed node.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) chainTxStats(node *blockNode, windowBlocks int32) (*ChainTxStats, error) {
+	if windowBlocks < 0 || windowBlocks > node.height {
+		return nil, fmt.Errorf("window of %d blocks is not between 0 "+
+			"and the block height %d", windowBlocks, node.height)
+	}
+	windowStart := node.Ancestor(node.height - windowBlocks)
+
+	var txCount, startTxCount uint64
+	var ok, startOk bool
+	err := b.db.View(func(dbTx database.Tx) error {
+		txCount, ok = dbFetchChainTxCount(dbTx, &node.hash)
+		startTxCount, startOk = dbFetchChainTxCount(dbTx,
+			&windowStart.hash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok || !startOk {
+		return nil, fmt.Errorf("the chain tx count is not available "+
+			"for the window of %d blocks ending with block %v",
+			windowBlocks, node.hash)
+	}
+
+	return &ChainTxStats{
+		Hash:             node.hash,
+		Height:           node.height,
+		Time:             node.timestamp,
+		TxCount:          txCount,
+		WindowBlockCount: windowBlocks,
+		WindowTxCount:    txCount - startTxCount,
+		WindowInterval:   node.timestamp - windowStart.timestamp,
+	}, nil
+}
+
+// ChainTxStats returns the statistics about the transactions of the main chain
+// over the window of the passed number of blocks ending with the block with the
+// passed hash.  The window can't start before the genesis block, nor before
+// the blocks whose chain tx count isn't known, such as the blocks before the
+// base of a UTXO set snapshot.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainTxStats(hash *chainhash.Hash, windowBlocks int32) (*ChainTxStats, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil || !b.bestChain.Contains(node) {
+		str := fmt.Sprintf("block %s is not in the main chain", hash)
+		return nil, errNotInMainChain(str)
+	}
+	return b.chainTxStats(node, windowBlocks)
+}
+
+// VerificationProgress estimates the fraction of the transactions of the
+// network's chain that were verified.  The number of transactions not yet
+// verified is estimated from the time elapsed since the tip of the main chain
+// and the rate of the transactions of the chain over the blocks of the last 30
+// days before the tip.  It returns false when the rate is not known, such as
+// when the main chain is too short.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) VerificationProgress() (float64, bool) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	tip := b.bestChain.Tip()
+	windowBlocks := int32(txRateWindow / b.chainParams.TargetTimePerBlock)
+	if windowBlocks > tip.height-1 {
+		windowBlocks = tip.height - 1
+	}
+	if windowBlocks <= 0 {
+		return 0, false
+	}
+	stats, err := b.chainTxStats(tip, windowBlocks)
+	if err != nil || stats.WindowInterval <= 0 {
+		return 0, false
+	}
+
+	txRate := float64(stats.WindowTxCount) / float64(stats.WindowInterval)
+	var remainingTxs float64
+	elapsed := b.timeSource.AdjustedTime().Unix() - tip.timestamp
+	if elapsed > 0 {
+		remainingTxs = float64(elapsed) * txRate
+	}
+	return float64(stats.TxCount) / (float64(stats.TxCount) + remainingTxs), true
+}
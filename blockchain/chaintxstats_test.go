@@ -0,0 +1,127 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/flokiorg/go-flokicoin/blockchain/internal/testhelper"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/database"
+)
+
+// TestChainTxStats ensures the chain tx count index follows the main chain as
+// blocks are connected and disconnected, and is rebuilt for existing databases.
+func TestChainTxStats(t *testing.T) {
+	chain, params, tearDown := utxoCacheTestChain("TestChainTxStats")
+	defer tearDown()
+
+	// Create a chain whose last block spends the outputs of its parent, so
+	// it has more than one transaction.
+	genesis := chainutil.NewBlock(params.GenesisBlock)
+	hashes, spendableOuts, err := addBlocks(10, chain, genesis,
+		[]*testhelper.SpendableOut{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, err := chain.BlockByHash(hashes[len(hashes)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip, _, err := addBlock(chain, parent, spendableOuts[len(hashes)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	numTipTxns := uint64(len(tip.Transactions()))
+	if numTipTxns < 2 {
+		t.Fatal("the tip doesn't have any transaction besides its coinbase")
+	}
+
+	best := chain.BestSnapshot()
+	checkStats := func(windowBlocks int32) {
+		t.Helper()
+		stats, err := chain.ChainTxStats(&best.Hash, windowBlocks)
+		if err != nil {
+			t.Fatalf("ChainTxStats: %v", err)
+		}
+		windowStart, err := chain.BlockByHeight(best.Height - windowBlocks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantInterval := tip.MsgBlock().Header.Timestamp.Unix() -
+			windowStart.MsgBlock().Header.Timestamp.Unix()
+		var wantWindowTxns uint64
+		for height := best.Height - windowBlocks + 1; height <= best.Height; height++ {
+			block, err := chain.BlockByHeight(height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantWindowTxns += uint64(len(block.Transactions()))
+		}
+		if stats.Hash != best.Hash || stats.Height != best.Height ||
+			stats.TxCount != best.TotalTxns ||
+			stats.WindowBlockCount != windowBlocks ||
+			stats.WindowTxCount != wantWindowTxns ||
+			stats.WindowInterval != wantInterval {
+
+			t.Fatalf("unexpected stats for a window of %d blocks: %+v",
+				windowBlocks, stats)
+		}
+	}
+	checkStats(0)
+	checkStats(5)
+	checkStats(best.Height)
+	if _, err := chain.ChainTxStats(&best.Hash, best.Height+1); err == nil {
+		t.Fatal("ChainTxStats accepted a window before the genesis block")
+	}
+	if progress, ok := chain.VerificationProgress(); !ok || progress <= 0 ||
+		progress > 1 {
+
+		t.Fatalf("unexpected verification progress %v (%v)", progress, ok)
+	}
+
+	// The count of a disconnected block is removed, and is added again
+	// once the block is connected again.
+	if err := chain.InvalidateBlock(tip.Hash()); err != nil {
+		t.Fatalf("InvalidateBlock: %v", err)
+	}
+	if _, err := chain.ChainTxStats(tip.Hash(), 0); !isNotInMainChainErr(err) {
+		t.Fatalf("unexpected stats error for a disconnected block: %v", err)
+	}
+	var ok bool
+	err = chain.db.View(func(dbTx database.Tx) error {
+		_, ok = dbFetchChainTxCount(dbTx, tip.Hash())
+		return nil
+	})
+	if err != nil || ok {
+		t.Fatalf("the count of a disconnected block is still indexed: %v",
+			err)
+	}
+	stats, err := chain.ChainTxStats(parent.Hash(), 0)
+	if err != nil || stats.TxCount != best.TotalTxns-numTipTxns {
+		t.Fatalf("unexpected stats of the new tip %+v: %v", stats, err)
+	}
+	if err := chain.ReconsiderBlock(tip.Hash()); err != nil {
+		t.Fatalf("ReconsiderBlock: %v", err)
+	}
+	checkStats(5)
+
+	// The index is rebuilt from the best chain state for the databases
+	// created before it.
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if err := meta.DeleteBucket(chainTxCountBucketName); err != nil {
+			return err
+		}
+		return meta.Delete(chainTxCountVersionKeyName)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.maybeUpgradeDbBuckets(nil); err != nil {
+		t.Fatalf("maybeUpgradeDbBuckets: %v", err)
+	}
+	checkStats(best.Height)
+}
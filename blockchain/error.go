@@ -272,9 +272,31 @@ const (
 	// auxpow is not allowed or at a height where auxpow is not allowed.
 	ErrAuxpowNotAllowed
 
+	// ErrAuxpowParentHasOurChainID indicates that an auxpow block was found
+	// whose parent block carries the same chain ID as this chain.
+	ErrAuxpowParentHasOurChainID
+
+	// ErrAuxpowParentChainNotAllowed indicates that an auxpow block was
+	// found whose parent block chain ID is not in the list of parent chains
+	// allowed by the network parameters.
+	ErrAuxpowParentChainNotAllowed
+
+	// ErrAuxpowCoinbaseTooLarge indicates that the parent coinbase
+	// transaction of an auxpow block exceeds the maximum size allowed by the
+	// network parameters.
+	ErrAuxpowCoinbaseTooLarge
+
+	// ErrAuxpowChainMerkleTooHigh indicates that the chain merkle branch of
+	// an auxpow block is higher than allowed by the network parameters.
+	ErrAuxpowChainMerkleTooHigh
+
 	// ErrTimewarpAttack indicates a timewarp attack i.e.
 	// when block's timestamp is too early on diff adjustment block.
 	ErrTimewarpAttack
+
+	// ErrKnownInvalidBlock indicates that a block header was received for
+	// a block that is already known to be invalid.
+	ErrKnownInvalidBlock
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -323,15 +345,20 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrInvalidAncestorBlock:      "ErrInvalidAncestorBlock",
 	ErrPrevBlockNotBest:          "ErrPrevBlockNotBest",
 
-	ErrAuxpowCoinbaseHashNotFound: "ErrAuxpowCoinbaseHashNotFound",
-	ErrAuxpowParentMerkle:         "ErrAuxpowParentMerkle",
-	ErrAuxpowBadHashPosition:      "ErrAuxpowBadHashPosition",
-	ErrAuxpowMalformedCoinbase:    "ErrAuxpowMalformedCoinbase",
-	ErrAuxpowNoHeader:             "ErrAuxpowNoHeader",
-	ErrAuxpowMultipleHeaders:      "ErrAuxpowMultipleHeaders",
-	ErrAuxpowWrongSize:            "ErrAuxpowWrongSize",
-	ErrAuxpowWrongIndex:           "ErrAuxpowWrongIndex",
-	ErrAuxpowBadTx:                "ErrAuxpowBadTx",
+	ErrAuxpowCoinbaseHashNotFound:  "ErrAuxpowCoinbaseHashNotFound",
+	ErrAuxpowParentMerkle:          "ErrAuxpowParentMerkle",
+	ErrAuxpowBadHashPosition:       "ErrAuxpowBadHashPosition",
+	ErrAuxpowMalformedCoinbase:     "ErrAuxpowMalformedCoinbase",
+	ErrAuxpowNoHeader:              "ErrAuxpowNoHeader",
+	ErrAuxpowMultipleHeaders:       "ErrAuxpowMultipleHeaders",
+	ErrAuxpowWrongSize:             "ErrAuxpowWrongSize",
+	ErrAuxpowWrongIndex:            "ErrAuxpowWrongIndex",
+	ErrAuxpowBadTx:                 "ErrAuxpowBadTx",
+	ErrAuxpowParentHasOurChainID:   "ErrAuxpowParentHasOurChainID",
+	ErrAuxpowParentChainNotAllowed: "ErrAuxpowParentChainNotAllowed",
+	ErrAuxpowCoinbaseTooLarge:      "ErrAuxpowCoinbaseTooLarge",
+	ErrAuxpowChainMerkleTooHigh:    "ErrAuxpowChainMerkleTooHigh",
+	ErrKnownInvalidBlock:           "ErrKnownInvalidBlock",
 }
 
 // String returns the ErrorCode as a human-readable name.
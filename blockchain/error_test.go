@@ -59,6 +59,11 @@ func TestErrorCodeStringer(t *testing.T) {
 		{ErrPreviousBlockUnknown, "ErrPreviousBlockUnknown"},
 		{ErrInvalidAncestorBlock, "ErrInvalidAncestorBlock"},
 		{ErrPrevBlockNotBest, "ErrPrevBlockNotBest"},
+		{ErrAuxpowParentHasOurChainID, "ErrAuxpowParentHasOurChainID"},
+		{ErrAuxpowParentChainNotAllowed, "ErrAuxpowParentChainNotAllowed"},
+		{ErrAuxpowCoinbaseTooLarge, "ErrAuxpowCoinbaseTooLarge"},
+		{ErrAuxpowChainMerkleTooHigh, "ErrAuxpowChainMerkleTooHigh"},
+		{ErrKnownInvalidBlock, "ErrKnownInvalidBlock"},
 		{0xffff, "Unknown ErrorCode (65535)"},
 	}
 
@@ -30,6 +30,12 @@ const (
 	// NTBlockDisconnected indicates the associated block was disconnected
 	// from the main chain.
 	NTBlockDisconnected
+
+	// NTChainReorgBlocked indicates a side chain with more cumulative work
+	// than the main chain was not made the main chain because the
+	// reorganization would disconnect more blocks than the maximum
+	// automatic reorganization depth.  It is sent once per side chain.
+	NTChainReorgBlocked
 )
 
 // notificationTypeStrings is a map of notification types back to their constant
@@ -38,6 +44,7 @@ var notificationTypeStrings = map[NotificationType]string{
 	NTBlockAccepted:     "NTBlockAccepted",
 	NTBlockConnected:    "NTBlockConnected",
 	NTBlockDisconnected: "NTBlockDisconnected",
+	NTChainReorgBlocked: "NTChainReorgBlocked",
 }
 
 // String returns the NotificationType in human-readable form.
@@ -54,6 +61,7 @@ func (n NotificationType) String() string {
 //   - NTBlockAccepted:     *chainutil.Block
 //   - NTBlockConnected:    *chainutil.Block
 //   - NTBlockDisconnected: *chainutil.Block
+//   - NTChainReorgBlocked: *ReorgBlocked
 type Notification struct {
 	Type NotificationType
 	Data interface{}
@@ -12,6 +12,7 @@ import (
 	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
 	"github.com/flokiorg/go-flokicoin/chainutil"
 	"github.com/flokiorg/go-flokicoin/database"
+	"github.com/flokiorg/go-flokicoin/wire"
 )
 
 // BehaviorFlags is a bitmask defining tweaks to the normal behavior when
@@ -40,8 +41,18 @@ const (
 // This function is safe for concurrent access.
 func (b *BlockChain) blockExists(hash *chainhash.Hash) (bool, error) {
 	// Check block index first (could be main chain or side chain blocks).
-	if b.index.HaveBlock(hash) {
-		return true, nil
+	// Blocks whose header was accepted ahead of their data don't exist
+	// yet.
+	if node := b.index.LookupNode(hash); node != nil {
+		// The blocks of the main chain up to the base of the UTXO set
+		// snapshot the chain was loaded from are accounted for by the
+		// snapshot even though their data isn't stored.
+		if b.snapshotBase != nil && node.height <= b.snapshotBase.height &&
+			b.bestChain.Contains(node) {
+
+			return true, nil
+		}
+		return b.index.NodeStatus(node).HaveData(), nil
 	}
 
 	// Check in the database.
@@ -130,6 +141,67 @@ func (b *BlockChain) processOrphans(hash *chainhash.Hash, flags BehaviorFlags) e
 	return nil
 }
 
+// ProcessBlockHeader validates the passed block header and adds it to the block
+// index without the data of its block.  This allows the header chain to be
+// synced ahead of the blocks, which are then downloaded and processed with
+// ProcessBlock.  The header must connect to a block, or a header, already in
+// the block index.  Headers already known are accepted as long as they aren't
+// known to be invalid.
+//
+// The flags are passed to the header checks.  See CheckBlockHeaderSanity and
+// CheckBlockHeaderContext for how they modify their behavior.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessBlockHeader(header *wire.BlockHeader, flags BehaviorFlags) error {
+	return b.ProcessBlockHeaders([]*wire.BlockHeader{header}, flags)
+}
+
+// ProcessBlockHeaders validates the passed block headers, each connecting to
+// a block or a header already in the block index, or to the previous header,
+// and adds them to the block index as ProcessBlockHeader does.  The block index
+// is written to the database once for all the headers, so this is preferred to
+// process the many headers of a headers message.
+//
+// The headers accepted before a header is rejected are kept in the block index.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessBlockHeaders(headers []*wire.BlockHeader, flags BehaviorFlags) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	var err error
+	for _, header := range headers {
+		if _, err = b.maybeAcceptBlockHeader(header, flags); err != nil {
+			break
+		}
+	}
+
+	if flushErr := b.index.flushToDB(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// CheckBlockHeader performs the checks ProcessBlockHeader performs on the passed
+// block header as if it extended prevNode, without adding it to the block
+// index.  The previous header doesn't need to be in the block index, which
+// allows a header chain to be validated before it's stored, as long as
+// prevNode provides the ancestors needed by the difficulty and median time
+// checks.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckBlockHeader(header *wire.BlockHeader, prevNode HeaderCtx, flags BehaviorFlags) error {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	err := CheckBlockHeaderSanity(header, b.chainParams.PowLimit,
+		b.timeSource, flags)
+	if err != nil {
+		return err
+	}
+	return CheckBlockHeaderContext(header, prevNode, flags, b, false)
+}
+
 // ProcessBlock is the main workhorse for handling insertion of new blocks into
 // the block chain.  It includes functionality such as rejecting duplicate
 // blocks, ensuring blocks follow all rules, orphan handling, and insertion into
@@ -245,3 +317,39 @@ func (b *BlockChain) ProcessBlock(block *chainutil.Block, flags BehaviorFlags) (
 
 	return isMainChain, false, nil
 }
+
+// StoreFetchedBlock stores the passed block, which was fetched on demand from a
+// peer, such as a block of the main chain whose data was pruned.  The block must
+// match a header already in the block index and pass the context-free sanity
+// checks, but it's only stored so it can be served again, without being
+// connected.  A pruned block stored this way is pruned again along with the
+// block file it's appended to.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) StoreFetchedBlock(block *chainutil.Block) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	blockHash := block.Hash()
+	node := b.index.LookupNode(blockHash)
+	if node == nil {
+		return fmt.Errorf("block %v does not match a known header",
+			blockHash)
+	}
+
+	// Ensure the transactions of the block match its header, including
+	// their witness data.
+	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource,
+		BFNone)
+	if err != nil {
+		return err
+	}
+	if err := ValidateWitnessCommitment(block); err != nil {
+		return err
+	}
+
+	block.SetHeight(node.height)
+	return b.db.Update(func(dbTx database.Tx) error {
+		return dbStoreBlock(dbTx, block)
+	})
+}
@@ -0,0 +1,454 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/database"
+)
+
+// maxReindexBatchSize is the max number of database entries deleted or updated
+// in a single database transaction while resetting the chain state, in order
+// to keep memory usage to reasonable levels.
+const maxReindexBatchSize = 500000
+
+// ReindexStatus identifies the progress of the reindex of the chain state.
+type ReindexStatus byte
+
+const (
+	// ReindexNone indicates the chain state is not being reindexed.
+	ReindexNone ReindexStatus = iota
+
+	// ReindexResetting indicates the chain state is being reset, in which
+	// case it can't be used until the reset is done.
+	ReindexResetting
+
+	// ReindexReplaying indicates the chain state was reset and the blocks
+	// stored in the database are being connected again.
+	ReindexReplaying
+)
+
+// String returns the ReindexStatus as a human-readable name.
+func (s ReindexStatus) String() string {
+	switch s {
+	case ReindexNone:
+		return "none"
+	case ReindexResetting:
+		return "resetting"
+	case ReindexReplaying:
+		return "replaying"
+	}
+	return "unknown"
+}
+
+// dbFetchReindexStatus uses an existing database transaction to retrieve the
+// progress of the reindex of the chain state.
+func dbFetchReindexStatus(dbTx database.Tx) ReindexStatus {
+	serialized := dbTx.Metadata().Get(reindexStateKeyName)
+	if len(serialized) != 1 {
+		return ReindexNone
+	}
+	return ReindexStatus(serialized[0])
+}
+
+// dbPutReindexStatus uses an existing database transaction to store the
+// progress of the reindex of the chain state.  The state is removed when the
+// reindex is done.
+func dbPutReindexStatus(dbTx database.Tx, status ReindexStatus) error {
+	if status == ReindexNone {
+		return dbTx.Metadata().Delete(reindexStateKeyName)
+	}
+	return dbTx.Metadata().Put(reindexStateKeyName, []byte{byte(status)})
+}
+
+// FetchReindexStatus returns the progress of the reindex of the chain state
+// stored in the passed database.  It's used before the chain is created, to
+// resume a reindex that was interrupted.
+func FetchReindexStatus(db database.DB) (ReindexStatus, error) {
+	var status ReindexStatus
+	err := db.View(func(dbTx database.Tx) error {
+		status = dbFetchReindexStatus(dbTx)
+		return nil
+	})
+	return status, err
+}
+
+// deleteBucketEntries removes all the entries of the passed bucket, in multiple
+// database transactions since the bucket can be massive.
+func deleteBucketEntries(db database.DB, bucketName []byte, interrupt <-chan struct{}) error {
+	var totalDeleted uint64
+	for numDeleted := maxReindexBatchSize; numDeleted == maxReindexBatchSize; {
+		numDeleted = 0
+		err := db.Update(func(dbTx database.Tx) error {
+			cursor := dbTx.Metadata().Bucket(bucketName).Cursor()
+			for ok := cursor.First(); ok && numDeleted < maxReindexBatchSize; ok = cursor.Next() {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+				numDeleted++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if numDeleted > 0 {
+			totalDeleted += uint64(numDeleted)
+			log.Infof("Deleted %d entries (%d total) from %s",
+				numDeleted, totalDeleted, bucketName)
+		}
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+	}
+	return nil
+}
+
+// resetBlockIndexStatus clears the valid status of all the blocks in the block
+// index except the genesis block, in multiple database transactions, so their
+// blocks are fully validated again when they are connected.  The blocks known
+// to be invalid are kept invalid.
+func resetBlockIndexStatus(db database.DB, interrupt <-chan struct{}) error {
+	// The keys of the block index start with the height of the block, so
+	// the genesis block is the first one.
+	var lastKey []byte
+	for done := false; !done; {
+		err := db.Update(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(blockIndexBucketName)
+			cursor := bucket.Cursor()
+			ok := cursor.First()
+			if lastKey != nil {
+				ok = cursor.Seek(lastKey) && cursor.Next()
+			} else if ok {
+				// Skip the genesis block.
+				lastKey = copyBytes(cursor.Key())
+				ok = cursor.Next()
+			}
+
+			var keys, values [][]byte
+			for ; ok && len(keys) < maxReindexBatchSize; ok = cursor.Next() {
+				lastKey = copyBytes(cursor.Key())
+				value := cursor.Value()
+				status := blockStatus(value[len(value)-1])
+				if status&statusValid == 0 {
+					continue
+				}
+				row := copyBytes(value)
+				row[len(row)-1] = byte(status &^ statusValid)
+				keys = append(keys, lastKey)
+				values = append(values, row)
+			}
+			done = !ok
+
+			for i, key := range keys {
+				if err := bucket.Put(key, values[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+	}
+	return nil
+}
+
+// copyBytes returns a copy of the passed byte slice, since the keys and values
+// returned by database cursors are only valid during the transaction.
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+// dbCheckAllBlocksStored uses an existing database transaction to return an
+// error when the blocks of the chain are not all stored in the database, which
+// is the case when the chain was loaded from a UTXO snapshot, since the blocks
+// before its base aren't stored, or when blocks were pruned.
+func dbCheckAllBlocksStored(dbTx database.Tx) error {
+	_, _, loaded, err := dbFetchSnapshotState(dbTx)
+	if err != nil {
+		return err
+	}
+	if loaded {
+		return errors.New("the chain was loaded from a UTXO snapshot")
+	}
+	pruned, err := dbTx.BeenPruned()
+	if err != nil {
+		return err
+	}
+	if pruned {
+		return errors.New("the chain was pruned")
+	}
+	return nil
+}
+
+// CheckAllBlocksStored returns an error when the blocks of the chain stored in
+// the passed database are incomplete, because the chain was loaded from a UTXO
+// snapshot or pruned, so the database can't be rebuilt from its blocks.
+func CheckAllBlocksStored(db database.DB) error {
+	return db.View(dbCheckAllBlocksStored)
+}
+
+// ResetChainState resets the chain state stored in the passed database to the
+// genesis block, so the blocks stored in the database can be connected again
+// with ReplayBlocks.  The UTXO set, the spend journal and the main chain
+// indexes are removed, and the blocks are no longer marked as valid, while the
+// ones known to be invalid stay invalid.  The block index and the blocks are
+// kept.
+//
+// The optional indexes must be dropped beforehand since they can't be rolled
+// back without the spend journal.  The reset is resumed when it's called again
+// after being interrupted, and the chain can't be created until it's done.
+func ResetChainState(db database.DB, params *chaincfg.Params, interrupt <-chan struct{}) error {
+	var initialized bool
+	err := db.View(func(dbTx database.Tx) error {
+		initialized = dbTx.Metadata().Get(chainStateKeyName) != nil
+		if !initialized {
+			return nil
+		}
+
+		if err := dbCheckAllBlocksStored(dbTx); err != nil {
+			return fmt.Errorf("the chain state can't be reindexed "+
+				"since %v", err)
+		}
+		return nil
+	})
+	if err != nil || !initialized {
+		return err
+	}
+
+	log.Infof("Resetting the chain state.  This might take a while...")
+	err = db.Update(func(dbTx database.Tx) error {
+		return dbPutReindexStatus(dbTx, ReindexResetting)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The chain tx count index and the utxo journal are missing from the
+	// databases created before them, in which case they're created so
+	// they're rebuilt with the chain state.
+	err = db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		_, err := meta.CreateBucketIfNotExists(chainTxCountBucketName)
+		if err != nil {
+			return err
+		}
+		_, err = meta.CreateBucketIfNotExists(utxoJournalBucketName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	bucketNames := [][]byte{utxoSetBucketName, spendJournalBucketName,
+		hashIndexBucketName, heightIndexBucketName, chainTxCountBucketName,
+		utxoJournalBucketName}
+	for _, bucketName := range bucketNames {
+		if err := deleteBucketEntries(db, bucketName, interrupt); err != nil {
+			return err
+		}
+	}
+	if err := resetBlockIndexStatus(db, interrupt); err != nil {
+		return err
+	}
+
+	// Move the best chain state back to the genesis block, whose coinbase
+	// isn't in the utxo set since it's not spendable.
+	genesisBlock := chainutil.NewBlock(params.GenesisBlock)
+	genesisBlock.SetHeight(0)
+	node := newBlockNode(&genesisBlock.MsgBlock().Header, nil)
+	numTxns := uint64(len(genesisBlock.MsgBlock().Transactions))
+	state := newBestState(node, uint64(genesisBlock.MsgBlock().SerializeSize()),
+		uint64(GetBlockWeight(genesisBlock)), numTxns, numTxns,
+		time.Unix(node.timestamp, 0))
+	return db.Update(func(dbTx database.Tx) error {
+		err := dbPutBlockIndex(dbTx, &node.hash, node.height)
+		if err != nil {
+			return err
+		}
+		err = dbPutChainTxCount(dbTx, &node.hash, numTxns)
+		if err != nil {
+			return err
+		}
+		err = dbPutVersion(dbTx, chainTxCountVersionKeyName,
+			latestChainTxCountBucketVersion)
+		if err != nil {
+			return err
+		}
+		err = dbPutBestState(dbTx, state, node.workSum)
+		if err != nil {
+			return err
+		}
+		err = dbPutUtxoStateConsistency(dbTx, &node.hash)
+		if err != nil {
+			return err
+		}
+		return dbPutReindexStatus(dbTx, ReindexReplaying)
+	})
+}
+
+// bestStoredNode returns the block node with the most work that can be
+// connected to the main chain with the blocks stored in the database, that is,
+// whose ancestors back to the main chain all have their block stored and are
+// not known to be invalid, other than the passed skipped ones.  It returns nil
+// when no such block has more work than the tip of the main chain.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) bestStoredNode(skip map[*blockNode]struct{}) *blockNode {
+	var best *blockNode
+	bestWork := b.bestChain.Tip().workSum
+	for _, tip := range b.index.InactiveTips(b.bestChain) {
+		// Find the last block after which all the blocks back to the
+		// main chain can be connected.
+		fork := b.bestChain.FindFork(tip)
+		var last *blockNode
+		for n := tip; n != nil && n != fork; n = n.parent {
+			status := b.index.NodeStatus(n)
+			if !status.HaveData() || status.KnownInvalid() {
+				last = nil
+				continue
+			}
+			if last == nil {
+				last = n
+			}
+		}
+		if _, ok := skip[last]; ok {
+			continue
+		}
+		if last != nil && last.workSum.Cmp(bestWork) > 0 {
+			best = last
+			bestWork = last.workSum
+		}
+	}
+	return best
+}
+
+// ReplayBlocks connects the blocks stored in the database that have more work
+// than the tip of the main chain, such as after the chain state was reset with
+// ResetChainState.  The blocks are fully validated as they are connected, and
+// the blocks of a branch after an invalid one are skipped, as are the branches
+// the main chain can't be reorganized to for being too deep.  The passed
+// function is called with each block once it's processed, and the replay stops
+// early when the interrupt channel is closed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReplayBlocks(interrupt <-chan struct{}, processed func(*chainutil.Block)) error {
+	refused := make(map[*blockNode]struct{})
+	for {
+		// Find the blocks from the main chain up to the best stored
+		// block.  Each of them is connected or extends a side chain
+		// that becomes the main chain once it has more work.
+		b.chainLock.RLock()
+		target := b.bestStoredNode(refused)
+		var nodes []*blockNode
+		if target != nil {
+			fork := b.bestChain.FindFork(target)
+			nodes = make([]*blockNode, target.height-fork.height)
+			for n := target; n != fork; n = n.parent {
+				nodes[n.height-fork.height-1] = n
+			}
+		}
+		b.chainLock.RUnlock()
+		if target == nil {
+			break
+		}
+
+		log.Infof("Replaying %d blocks from height %d up to block %v",
+			len(nodes), nodes[0].height, target.hash)
+		var invalid bool
+		for _, node := range nodes {
+			if interruptRequested(interrupt) {
+				return errInterruptRequested
+			}
+
+			var block *chainutil.Block
+			err := b.db.View(func(dbTx database.Tx) error {
+				var err error
+				block, err = dbFetchBlockByNode(dbTx, node)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			// Look for the next best branch once a block is found
+			// to be invalid.
+			err = b.replayBlock(node, block)
+			if _, ok := err.(RuleError); ok {
+				log.Warnf("Block %v (height %d) is invalid: %v",
+					node.hash, node.height, err)
+				invalid = true
+				break
+			}
+			if err != nil {
+				return err
+			}
+			processed(block)
+		}
+
+		// The reorganization to the branch is refused when it's too
+		// deep, in which case it's kept as a side chain.
+		b.chainLock.RLock()
+		connected := b.bestChain.Contains(target)
+		b.chainLock.RUnlock()
+		if !connected && !invalid {
+			log.Warnf("Not replaying the side chain up to block %v "+
+				"since the reorganization to it was refused",
+				target.hash)
+			refused[target] = struct{}{}
+		}
+	}
+
+	// The chain state is up to date with the stored blocks.
+	err := b.db.Update(func(dbTx database.Tx) error {
+		return dbPutReindexStatus(dbTx, ReindexNone)
+	})
+	if err != nil {
+		return err
+	}
+	b.chainLock.Lock()
+	b.resetBestHeader()
+	b.chainLock.Unlock()
+	return nil
+}
+
+// replayBlock validates the passed stored block and connects it to the chain
+// the same way as a block that was just received.  The block is marked as
+// invalid when it isn't valid.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) replayBlock(node *blockNode, block *chainutil.Block) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource,
+		BFNone)
+	if err == nil {
+		err = b.checkBlockContext(block, node.parent, BFNone)
+	}
+	if err == nil {
+		_, err = b.connectBestChain(node, block, BFNone)
+	}
+	if _, ok := err.(RuleError); ok && !b.index.NodeStatus(node).KnownInvalid() {
+		b.index.SetStatusFlags(node, statusValidateFailed)
+		if writeErr := b.index.flushToDB(); writeErr != nil {
+			log.Warnf("Error flushing block index changes to "+
+				"disk: %v", writeErr)
+		}
+	}
+	return err
+}
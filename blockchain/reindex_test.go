@@ -0,0 +1,321 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/blockchain/internal/testhelper"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/database"
+)
+
+// TestReindexChainState ensures the chain state reset to the genesis block is
+// rebuilt by replaying the blocks stored in the database.
+func TestReindexChainState(t *testing.T) {
+	chain, params, tearDown := utxoCacheTestChain("TestReindexChainState")
+	defer tearDown()
+
+	tip := chainutil.NewBlock(params.GenesisBlock)
+	_, _, err := addBlocks(10, chain, tip, []*testhelper.SpendableOut{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = chain.FlushUtxoCache(FlushRequired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	best := chain.BestSnapshot()
+	var numEntries int
+	err = chain.db.View(func(dbTx database.Tx) error {
+		cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			numEntries++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ResetChainState(chain.db, params, nil)
+	if err != nil {
+		t.Fatalf("ResetChainState: %v", err)
+	}
+	err = assertNbEntriesOnDisk(chain, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := FetchReindexStatus(chain.db)
+	if err != nil || status != ReindexReplaying {
+		t.Fatalf("unexpected reindex status %v: %v", status, err)
+	}
+
+	// The chain can't be created while the chain state is being reset.
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		return dbPutReindexStatus(dbTx, ReindexResetting)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{
+		DB:               chain.db,
+		ChainParams:      params,
+		TimeSource:       NewMedianTime(),
+		UtxoCacheMaxSize: 10 * 1024 * 1024,
+	}
+	if _, err := New(config); err == nil {
+		t.Fatal("created a chain while its chain state is being reset")
+	}
+	if err := ResetChainState(chain.db, params, nil); err != nil {
+		t.Fatalf("ResetChainState: %v", err)
+	}
+
+	// The chain starts from the genesis block, and is back to its tip
+	// once the stored blocks are replayed.
+	reindexed, err := New(config)
+	if err != nil {
+		t.Fatalf("unable to create the chain: %v", err)
+	}
+	reindexed.TstSetCoinbaseMaturity(1)
+	if height := reindexed.BestSnapshot().Height; height != 0 {
+		t.Fatalf("unexpected height %d after the reset", height)
+	}
+	var numReplayed int
+	err = reindexed.ReplayBlocks(nil, func(*chainutil.Block) {
+		numReplayed++
+	})
+	if err != nil {
+		t.Fatalf("ReplayBlocks: %v", err)
+	}
+	if numReplayed != int(best.Height) {
+		t.Fatalf("replayed %d blocks, want %d", numReplayed, best.Height)
+	}
+	replayedBest := reindexed.BestSnapshot()
+	if replayedBest.Hash != best.Hash || replayedBest.TotalTxns != best.TotalTxns {
+		t.Fatalf("unexpected tip %v with %d txns, want %v with %d txns",
+			replayedBest.Hash, replayedBest.TotalTxns, best.Hash,
+			best.TotalTxns)
+	}
+	status, err = FetchReindexStatus(chain.db)
+	if err != nil || status != ReindexNone {
+		t.Fatalf("unexpected reindex status %v: %v", status, err)
+	}
+	err = reindexed.FlushUtxoCache(FlushRequired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = assertNbEntriesOnDisk(reindexed, numEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCheckAllBlocksStored ensures the chains whose blocks are not all stored
+// can't be reindexed.
+func TestCheckAllBlocksStored(t *testing.T) {
+	chain, params, tearDown := utxoCacheTestChain("TestCheckAllBlocksStored")
+	defer tearDown()
+
+	tip := chainutil.NewBlock(params.GenesisBlock)
+	_, _, err := addBlocks(3, chain, tip, []*testhelper.SpendableOut{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckAllBlocksStored(chain.db); err != nil {
+		t.Fatalf("CheckAllBlocksStored: %v", err)
+	}
+
+	// A chain loaded from a UTXO snapshot lacks the blocks before its
+	// base.
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		return dbPutSnapshotState(dbTx, &chain.BestSnapshot().Hash,
+			SnapshotUnvalidated)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckAllBlocksStored(chain.db); err == nil {
+		t.Fatal("blocks of a chain loaded from a snapshot reported " +
+			"as all stored")
+	}
+	if err := ResetChainState(chain.db, params, nil); err == nil {
+		t.Fatal("reset the chain state of a chain loaded from a " +
+			"snapshot")
+	}
+}
+
+// TestResetBlockIndexStatus ensures resetting the status of the block index
+// clears the valid status of the blocks but keeps the invalid ones invalid.
+func TestResetBlockIndexStatus(t *testing.T) {
+	chain, params, tearDown := utxoCacheTestChain("TestResetBlockIndexStatus")
+	defer tearDown()
+
+	tip := chainutil.NewBlock(params.GenesisBlock)
+	_, _, err := addBlocks(3, chain, tip, []*testhelper.SpendableOut{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.index.flushToDB(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mark the tip as invalid.
+	tipNode := chain.bestChain.Tip()
+	header := tipNode.Header()
+	invalid := newBlockNode(&header, tipNode.parent)
+	invalid.status = statusDataStored | statusValidateFailed
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		return dbStoreBlockNode(dbTx, invalid)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := resetBlockIndexStatus(chain.db, nil); err != nil {
+		t.Fatalf("resetBlockIndexStatus: %v", err)
+	}
+	err = chain.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(blockIndexBucketName)
+		for node := tipNode; node != nil; node = node.parent {
+			key := blockIndexKey(&node.hash, uint32(node.height))
+			_, status, err := deserializeBlockRow(bucket.Get(key))
+			if err != nil {
+				return err
+			}
+
+			want := statusDataStored
+			switch {
+			case node.height == 0:
+				want |= statusValid
+			case node == tipNode:
+				want |= statusValidateFailed
+			}
+			if status != want {
+				t.Errorf("block at height %d: got status %v, "+
+					"want %v", node.height, status, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReplayBlocksMaxReorgDepth ensures the replay skips the side chains the
+// main chain can't be reorganized to for being too deep, and notifies them
+// once.
+func TestReplayBlocksMaxReorgDepth(t *testing.T) {
+	chain, params, tearDown := utxoCacheTestChain("TestReplayBlocksMaxReorgDepth")
+	defer tearDown()
+	chain.maxReorgDepth = 3
+
+	// newAltBlock returns a block extending the passed one whose coinbase
+	// pays the passed extra amount, which makes it differ from the other
+	// blocks at its height and makes it invalid when the amount is
+	// positive.
+	newAltBlock := func(prev *chainutil.Block, extra int64) *chainutil.Block {
+		t.Helper()
+		block, _, err := newBlock(chain, prev, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgBlock := block.MsgBlock()
+		msgBlock.Transactions[0].TxOut[0].Value += extra
+		msgBlock.Header.MerkleRoot = calcMerkleRoot(msgBlock.Transactions)
+		if !testhelper.SolveBlock(&msgBlock.Header) {
+			t.Fatal("unable to solve block")
+		}
+		block = chainutil.NewBlock(msgBlock)
+		block.SetHeight(prev.Height() + 1)
+		if _, _, err := chain.ProcessBlock(block, BFNone); err != nil {
+			t.Fatal(err)
+		}
+		return block
+	}
+	extend := func(prev *chainutil.Block, count int) *chainutil.Block {
+		t.Helper()
+		for i := 0; i < count; i++ {
+			block, _, err := addBlock(chain, prev, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prev = block
+		}
+		return prev
+	}
+
+	// The main chain has 6 blocks, and two side chains forking from block
+	// 1 are refused and thus not validated: one up to block 11 with an
+	// invalid block 10, and one up to block 10.
+	genesis := chainutil.NewBlock(params.GenesisBlock)
+	_, _, err := addBlocks(6, chain, genesis, []*testhelper.SpendableOut{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, err := chain.BlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b9 := extend(newAltBlock(b1, -1), 7)
+	extend(newAltBlock(b9, 1), 1)
+	c10 := extend(newAltBlock(b1, -2), 8)
+	if height := chain.BestSnapshot().Height; height != 6 {
+		t.Fatalf("unexpected height %d before the reset", height)
+	}
+
+	err = ResetChainState(chain.db, params, nil)
+	if err != nil {
+		t.Fatalf("ResetChainState: %v", err)
+	}
+	reindexed, err := New(&Config{
+		DB:               chain.db,
+		ChainParams:      params,
+		TimeSource:       NewMedianTime(),
+		UtxoCacheMaxSize: 10 * 1024 * 1024,
+		MaxReorgDepth:    3,
+	})
+	if err != nil {
+		t.Fatalf("unable to create the chain: %v", err)
+	}
+	reindexed.TstSetCoinbaseMaturity(1)
+	var blocked []*ReorgBlocked
+	reindexed.Subscribe(func(n *Notification) {
+		if n.Type == NTChainReorgBlocked {
+			blocked = append(blocked, n.Data.(*ReorgBlocked))
+		}
+	})
+
+	// The side chain with the most work is replayed up to its invalid
+	// block, and the other one is refused since it would disconnect 8
+	// blocks.
+	done := make(chan error, 1)
+	go func() {
+		done <- reindexed.ReplayBlocks(nil, func(*chainutil.Block) {})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ReplayBlocks: %v", err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("ReplayBlocks did not finish")
+	}
+	if best := reindexed.BestSnapshot(); best.Hash != *b9.Hash() {
+		t.Fatalf("unexpected tip %v (height %d), want %v", best.Hash,
+			best.Height, b9.Hash())
+	}
+	if len(blocked) != 1 || blocked[0].Hash != *c10.Hash() ||
+		blocked[0].Depth != 8 {
+
+		t.Fatalf("unexpected blocked reorganizations %v", blocked)
+	}
+	status, err := FetchReindexStatus(chain.db)
+	if err != nil || status != ReindexNone {
+		t.Fatalf("unexpected reindex status %v: %v", status, err)
+	}
+}
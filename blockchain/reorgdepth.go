@@ -0,0 +1,159 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+)
+
+// ReorgBlocked describes a reorganization of the main chain that was refused
+// because it would have disconnected more blocks than the maximum automatic
+// reorganization depth.  It is the data of the NTChainReorgBlocked
+// notification.
+type ReorgBlocked struct {
+	// Hash and Height identify the tip of the side chain that has more
+	// cumulative work than the main chain.
+	Hash   chainhash.Hash
+	Height int32
+
+	// ForkHash and ForkHeight identify the last block common to the side
+	// chain and the main chain.
+	ForkHash   chainhash.Hash
+	ForkHeight int32
+
+	// TipHash and TipHeight identify the tip of the main chain the side
+	// chain would have replaced.
+	TipHash   chainhash.Hash
+	TipHeight int32
+
+	// Depth is the number of blocks of the main chain the reorganization
+	// would have disconnected.
+	Depth int32
+}
+
+// blockedReorg returns the description of the reorganization to the side chain
+// ending with the passed node when it would disconnect more blocks than the
+// maximum automatic reorganization depth, and no block of the side chain was
+// approved.  It returns nil when the reorganization is allowed.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) blockedReorg(node *blockNode) *ReorgBlocked {
+	if b.maxReorgDepth <= 0 {
+		return nil
+	}
+
+	tip := b.bestChain.Tip()
+	fork := b.bestChain.FindFork(node)
+	if fork == nil || tip.height-fork.height <= b.maxReorgDepth {
+		return nil
+	}
+	for n := node; n != nil && n != fork; n = n.parent {
+		if _, ok := b.approvedReorgs[n.hash]; ok {
+			return nil
+		}
+	}
+
+	return &ReorgBlocked{
+		Hash:       node.hash,
+		Height:     node.height,
+		ForkHash:   fork.hash,
+		ForkHeight: fork.height,
+		TipHash:    tip.hash,
+		TipHeight:  tip.height,
+		Depth:      tip.height - fork.height,
+	}
+}
+
+// firstRefusal records the refusal of the reorganization to the side chain
+// ending with the passed node and returns whether it is the first refusal for
+// that side chain, which is identified by its first block after the fork.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) firstRefusal(node *blockNode) bool {
+	first := node
+	for first.parent != nil && !b.bestChain.Contains(first.parent) {
+		first = first.parent
+	}
+	if _, ok := b.refusedReorgs[first.hash]; ok {
+		return false
+	}
+	b.refusedReorgs[first.hash] = struct{}{}
+	return true
+}
+
+// reorganizeToBranch reorganizes the main chain to the best valid tip of the
+// branch of the passed node when it has more cumulative work than the main
+// chain, regardless of the maximum automatic reorganization depth.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) reorganizeToBranch(node *blockNode) error {
+	var bestTip *blockNode
+	for _, tip := range b.index.InactiveTips(b.bestChain) {
+		if tip.status.KnownInvalid() {
+			continue
+		}
+
+		// Only the blocks with their data stored can be connected, so
+		// the branch is considered up to its last block with data, which
+		// must still include the passed node.
+		tip = tip.lastWithData()
+		if tip == nil || (tip != node && !tip.IsAncestor(node)) {
+			continue
+		}
+		if bestTip == nil || tip.workSum.Cmp(bestTip.workSum) > 0 {
+			bestTip = tip
+		}
+	}
+	if bestTip == nil || bestTip.workSum.Cmp(b.bestChain.Tip().workSum) <= 0 {
+		return nil
+	}
+
+	log.Infof("REORGANIZE: Reorganizing to the approved branch of block %v "+
+		"with tip %v", node.hash, bestTip.hash)
+	detachNodes, attachNodes := b.getReorganizeNodes(bestTip)
+	err := b.reorganizeChain(detachNodes, attachNodes)
+
+	if writeErr := b.index.flushToDB(); writeErr != nil {
+		log.Warnf("Error flushing block index changes to disk: %v", writeErr)
+	}
+
+	return err
+}
+
+// ApproveReorg approves the reorganizations of the main chain to the branch of
+// the block with the given hash, which are no longer limited by the maximum
+// automatic reorganization depth.  The main chain is reorganized to the best
+// valid tip of the branch right away when it has more cumulative work than the
+// main chain, such as when the reorganization was refused before.  Otherwise,
+// the approval applies to the blocks later extending the branch.  Approvals
+// are not persisted across restarts.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ApproveReorg(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("requested block hash of %s is not found "+
+			"and thus its reorganization cannot be approved", hash)
+	}
+	if node.status.KnownInvalid() {
+		return fmt.Errorf("block %s is known to be invalid and thus "+
+			"its reorganization cannot be approved", hash)
+	}
+
+	// Nothing to approve when the block is already in the main chain.
+	if b.bestChain.Contains(node) {
+		return nil
+	}
+
+	log.Infof("Approving the reorganization to the branch of block %v",
+		hash)
+	b.approvedReorgs[node.hash] = struct{}{}
+	return b.reorganizeToBranch(node)
+}
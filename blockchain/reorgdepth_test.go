@@ -0,0 +1,159 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/flokiorg/go-flokicoin/blockchain/internal/testhelper"
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+)
+
+// TestMaxReorgDepth ensures the reorganizations deeper than the maximum
+// automatic reorganization depth are refused and notified until they are
+// approved.
+func TestMaxReorgDepth(t *testing.T) {
+	chain, params, tearDown := utxoCacheTestChain("TestMaxReorgDepth")
+	defer tearDown()
+	chain.maxReorgDepth = 3
+
+	var blocked []*ReorgBlocked
+	chain.Subscribe(func(n *Notification) {
+		if n.Type == NTChainReorgBlocked {
+			blocked = append(blocked, n.Data.(*ReorgBlocked))
+		}
+	})
+
+	assertTip := func(hash *chainhash.Hash) {
+		t.Helper()
+		if best := chain.BestSnapshot(); best.Hash != *hash {
+			t.Fatalf("unexpected tip %v (height %d), want %v",
+				best.Hash, best.Height, hash)
+		}
+	}
+	assertBlocked := func(count int) {
+		t.Helper()
+		if len(blocked) != count {
+			t.Fatalf("got %d blocked reorganization notifications, "+
+				"want %d", len(blocked), count)
+		}
+	}
+	blockByHash := func(hash *chainhash.Hash) *chainutil.Block {
+		t.Helper()
+		block, err := chain.BlockByHash(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return block
+	}
+
+	// Create a chain with 6 blocks.
+	genesis := chainutil.NewBlock(params.GenesisBlock)
+	_, spendableOuts, err := addBlocks(6, chain, genesis,
+		[]*testhelper.SpendableOut{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, err := chain.BlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b3, err := chain.BlockByHeight(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A side chain forking from block 3 disconnects 3 blocks, which is
+	// allowed.
+	altHashes, _, err := addBlocks(4, chain, b3, spendableOuts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTip(altHashes[3])
+	assertBlocked(0)
+	altTip := blockByHash(altHashes[3])
+
+	// A side chain forking from block 1 would disconnect 6 blocks, so it
+	// is kept as a side chain once it has more work.
+	deepHashes, deepOuts, err := addBlocks(7, chain, b1, spendableOuts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTip(altHashes[3])
+	assertBlocked(1)
+	want := ReorgBlocked{
+		Hash:       *deepHashes[6],
+		Height:     8,
+		ForkHash:   *b1.Hash(),
+		ForkHeight: 1,
+		TipHash:    *altHashes[3],
+		TipHeight:  7,
+		Depth:      6,
+	}
+	if *blocked[0] != want {
+		t.Fatalf("unexpected blocked reorganization %+v, want %+v",
+			*blocked[0], want)
+	}
+
+	// Approving the side chain reorganizes to it.
+	if err := chain.ApproveReorg(deepHashes[0]); err != nil {
+		t.Fatalf("ApproveReorg: %v", err)
+	}
+	assertTip(deepHashes[6])
+	deepTip := blockByHash(deepHashes[6])
+
+	// Reconsidering a refused side chain also approves it.
+	forkHashes, _, err := addBlocks(2, chain, altTip, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTip(deepHashes[6])
+	assertBlocked(2)
+	if err := chain.ReconsiderBlock(forkHashes[1]); err != nil {
+		t.Fatalf("ReconsiderBlock: %v", err)
+	}
+	assertTip(forkHashes[1])
+
+	// The approval of a side chain with less work applies to the blocks
+	// later extending it.
+	if err := chain.ApproveReorg(deepHashes[6]); err != nil {
+		t.Fatalf("ApproveReorg: %v", err)
+	}
+	assertTip(forkHashes[1])
+	extHashes, _, err := addBlocks(2, chain, deepTip, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTip(extHashes[1])
+	assertBlocked(2)
+
+	// Reconsidering a valid block of the main chain doesn't reorganize to
+	// a refused side chain forking after it.
+	refusedHashes, _, err := addBlocks(10, chain, blockByHash(deepHashes[0]),
+		deepOuts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTip(extHashes[1])
+
+	// The refusal is notified once for the side chain, not for each of
+	// the blocks with more work extending it.
+	assertBlocked(3)
+	if err := chain.ReconsiderBlock(deepHashes[0]); err != nil {
+		t.Fatalf("ReconsiderBlock: %v", err)
+	}
+	assertTip(extHashes[1])
+
+	// Reconsidering the side chain itself approves it.
+	if err := chain.ReconsiderBlock(refusedHashes[0]); err != nil {
+		t.Fatalf("ReconsiderBlock: %v", err)
+	}
+	assertTip(refusedHashes[9])
+
+	if err := chain.ApproveReorg(&chainhash.Hash{}); err == nil {
+		t.Fatal("ApproveReorg accepted an unknown block")
+	}
+}
@@ -0,0 +1,602 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg"
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/database"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+const (
+	// utxoSnapshotVersion is the current version of the UTXO set snapshot
+	// format.
+	utxoSnapshotVersion = 1
+
+	// utxoSnapshotHeaderSize is the size of the header of a UTXO set
+	// snapshot, which is the magic, version, network, base block hash and
+	// number of coins.
+	utxoSnapshotHeaderSize = 4 + 2 + 4 + chainhash.HashSize + 8
+
+	// maxSnapshotEntrySize is the max size of a serialized utxo entry in a
+	// UTXO set snapshot.  Outputs with scripts larger than the max script
+	// size are unspendable and never stored in the utxo set.
+	maxSnapshotEntrySize = 20000
+
+	// maxSnapshotVLQSize is the max size of a VLQ read from a UTXO set
+	// snapshot, which is enough for any 64-bit value.
+	maxSnapshotVLQSize = 10
+)
+
+// utxoSnapshotMagic is the magic at the start of a UTXO set snapshot.
+var utxoSnapshotMagic = [4]byte{'u', 't', 'x', 'o'}
+
+// SnapshotStatus identifies the validation status of the UTXO set snapshot the
+// chain was loaded from.
+type SnapshotStatus byte
+
+const (
+	// SnapshotUnvalidated indicates the UTXO set of the snapshot wasn't
+	// compared yet with the one built by validating all the blocks up to
+	// its base.
+	SnapshotUnvalidated SnapshotStatus = iota
+
+	// SnapshotValidated indicates the UTXO set of the snapshot matches the
+	// one built by validating all the blocks up to its base.
+	SnapshotValidated
+
+	// SnapshotInvalid indicates the UTXO set of the snapshot doesn't match
+	// the one built by validating all the blocks up to its base.
+	SnapshotInvalid
+)
+
+// snapshotStatusStrings is a map of snapshot statuses back to their constant
+// names for pretty printing.
+var snapshotStatusStrings = map[SnapshotStatus]string{
+	SnapshotUnvalidated: "unvalidated",
+	SnapshotValidated:   "validated",
+	SnapshotInvalid:     "invalid",
+}
+
+// String returns the SnapshotStatus in human-readable form.
+func (s SnapshotStatus) String() string {
+	if str, ok := snapshotStatusStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown SnapshotStatus (%d)", byte(s))
+}
+
+// UtxoSnapshot describes a UTXO set snapshot written or loaded by the chain.
+type UtxoSnapshot struct {
+	// BaseHash and BaseHeight identify the block the UTXO set of the
+	// snapshot is the one after.
+	BaseHash   chainhash.Hash
+	BaseHeight int32
+
+	// CoinsCount is the number of unspent outputs in the snapshot.
+	CoinsCount uint64
+
+	// TxOutSetHash is the double sha256 of the serialized unspent outputs
+	// of the snapshot, which is committed in the chain parameters for the
+	// snapshots that can be loaded.
+	TxOutSetHash chainhash.Hash
+
+	// ChainTxCount is the total number of transactions in the chain up to
+	// and including the base block.
+	ChainTxCount uint64
+}
+
+// SnapshotInfo describes the UTXO set snapshot a chain was loaded from.
+type SnapshotInfo struct {
+	BaseHash   chainhash.Hash
+	BaseHeight int32
+	Status     SnapshotStatus
+}
+
+// serializeSnapshotState returns the serialization of the base hash and status
+// of the UTXO set snapshot the chain was loaded from.
+//
+// The serialized format is:
+//
+//	<base block hash><status>
+//
+//	Field             Type             Size
+//	base block hash   chainhash.Hash   chainhash.HashSize
+//	status            byte             1
+func serializeSnapshotState(baseHash *chainhash.Hash, status SnapshotStatus) []byte {
+	serialized := make([]byte, chainhash.HashSize+1)
+	copy(serialized, baseHash[:])
+	serialized[chainhash.HashSize] = byte(status)
+	return serialized
+}
+
+// dbPutSnapshotState stores the base hash and status of the UTXO set snapshot
+// the chain was loaded from.
+func dbPutSnapshotState(dbTx database.Tx, baseHash *chainhash.Hash, status SnapshotStatus) error {
+	serialized := serializeSnapshotState(baseHash, status)
+	return dbTx.Metadata().Put(snapshotStateKeyName, serialized)
+}
+
+// dbFetchSnapshotState returns the base hash and status of the UTXO set
+// snapshot the chain was loaded from, and false when it wasn't loaded from one.
+func dbFetchSnapshotState(dbTx database.Tx) (chainhash.Hash, SnapshotStatus, bool, error) {
+	serialized := dbTx.Metadata().Get(snapshotStateKeyName)
+	if serialized == nil {
+		return chainhash.Hash{}, 0, false, nil
+	}
+	if len(serialized) != chainhash.HashSize+1 {
+		return chainhash.Hash{}, 0, false, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt UTXO snapshot state",
+		}
+	}
+
+	var baseHash chainhash.Hash
+	copy(baseHash[:], serialized[:chainhash.HashSize])
+	return baseHash, SnapshotStatus(serialized[chainhash.HashSize]), true, nil
+}
+
+// FetchSnapshotStatus returns the validation status of the UTXO set snapshot
+// the chain stored in the passed database was loaded from, and false when it
+// wasn't loaded from one.  It's used before the chain is created, to recover
+// from a snapshot found to be invalid.
+func FetchSnapshotStatus(db database.DB) (SnapshotStatus, bool, error) {
+	var status SnapshotStatus
+	var loaded bool
+	err := db.View(func(dbTx database.Tx) error {
+		var err error
+		_, status, loaded, err = dbFetchSnapshotState(dbTx)
+		return err
+	})
+	return status, loaded, err
+}
+
+// writeSnapshotHeader writes the header of a UTXO set snapshot.
+//
+// The serialized format is:
+//
+//	<magic><version><network><base block hash><number of coins>
+//
+//	Field             Type             Size
+//	magic             [4]byte          4
+//	version           uint16           2
+//	network           uint32           4
+//	base block hash   chainhash.Hash   chainhash.HashSize
+//	number of coins   uint64           8
+func writeSnapshotHeader(w io.Writer, net wire.FlokicoinNet, baseHash *chainhash.Hash, coinsCount uint64) error {
+	var header [utxoSnapshotHeaderSize]byte
+	copy(header[:], utxoSnapshotMagic[:])
+	byteOrder.PutUint16(header[4:], utxoSnapshotVersion)
+	byteOrder.PutUint32(header[6:], uint32(net))
+	copy(header[10:], baseHash[:])
+	byteOrder.PutUint64(header[10+chainhash.HashSize:], coinsCount)
+	_, err := w.Write(header[:])
+	return err
+}
+
+// readSnapshotHeader reads the header of a UTXO set snapshot and returns its
+// network, base block hash and number of coins.
+func readSnapshotHeader(r io.Reader) (wire.FlokicoinNet, chainhash.Hash, uint64, error) {
+	var header [utxoSnapshotHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, chainhash.Hash{}, 0, fmt.Errorf("unable to read "+
+			"the UTXO snapshot header: %v", err)
+	}
+	if !bytes.Equal(header[:4], utxoSnapshotMagic[:]) {
+		return 0, chainhash.Hash{}, 0, errors.New("not a UTXO snapshot")
+	}
+	version := byteOrder.Uint16(header[4:])
+	if version != utxoSnapshotVersion {
+		return 0, chainhash.Hash{}, 0, fmt.Errorf("unsupported UTXO "+
+			"snapshot version %d", version)
+	}
+
+	net := wire.FlokicoinNet(byteOrder.Uint32(header[6:]))
+	var baseHash chainhash.Hash
+	copy(baseHash[:], header[10:10+chainhash.HashSize])
+	coinsCount := byteOrder.Uint64(header[10+chainhash.HashSize:])
+	return net, baseHash, coinsCount, nil
+}
+
+// writeSnapshotCoin writes an unspent output of a UTXO set snapshot from its
+// key and value in the utxo set bucket.
+//
+// The serialized format is:
+//
+//	<outpoint key><entry size><serialized utxo entry>
+//
+//	Field                   Type     Size
+//	outpoint key            []byte   chainhash.HashSize + VLQ
+//	entry size              VLQ      variable
+//	serialized utxo entry   []byte   entry size
+func writeSnapshotCoin(w io.Writer, key, entry []byte) error {
+	var size [maxSnapshotVLQSize]byte
+	n := putVLQ(size[:], uint64(len(entry)))
+	if _, err := w.Write(key); err != nil {
+		return err
+	}
+	if _, err := w.Write(size[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(entry)
+	return err
+}
+
+// readSnapshotVLQ reads a VLQ from a UTXO set snapshot and appends its bytes
+// to the passed buffer.
+func readSnapshotVLQ(r io.ByteReader, buf []byte) (uint64, []byte, error) {
+	start := len(buf)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		buf = append(buf, b)
+		if b&0x80 == 0 {
+			break
+		}
+		if len(buf)-start == maxSnapshotVLQSize {
+			return 0, nil, errors.New("VLQ is too long")
+		}
+	}
+	n, _ := deserializeVLQ(buf[start:])
+	return n, buf, nil
+}
+
+// readSnapshotCoin reads an unspent output of a UTXO set snapshot and returns
+// its key and value in the utxo set bucket, checking the value is a valid utxo
+// entry.
+func readSnapshotCoin(r *bufio.Reader) ([]byte, []byte, error) {
+	key := make([]byte, chainhash.HashSize, chainhash.HashSize+maxSnapshotVLQSize)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, nil, err
+	}
+	index, key, err := readSnapshotVLQ(r, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if index > math.MaxUint32 {
+		return nil, nil, fmt.Errorf("output index %d is out of range",
+			index)
+	}
+
+	size, _, err := readSnapshotVLQ(r, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if size == 0 || size > maxSnapshotEntrySize {
+		return nil, nil, fmt.Errorf("utxo entry size %d is out of range",
+			size)
+	}
+	entry := make([]byte, size)
+	if _, err := io.ReadFull(r, entry); err != nil {
+		return nil, nil, err
+	}
+	if _, err := deserializeUtxoEntry(entry); err != nil {
+		return nil, nil, err
+	}
+	return key, entry, nil
+}
+
+// assumeUTXO returns the UTXO set snapshot committed in the chain parameters
+// for the passed base block, or nil when there is none.
+func (b *BlockChain) assumeUTXO(hash *chainhash.Hash) *chaincfg.AssumeUTXO {
+	for i := range b.chainParams.AssumeUTXO {
+		au := &b.chainParams.AssumeUTXO[i]
+		if au.BlockHash.IsEqual(hash) {
+			return au
+		}
+	}
+	return nil
+}
+
+// DumpUtxoSnapshot writes a snapshot of the UTXO set at the tip of the best
+// chain to the passed writer.  The cache is flushed first, and the UTXO set is
+// then written from a read-only database transaction so blocks can still be
+// connected while it's being written.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DumpUtxoSnapshot(w io.Writer) (*UtxoSnapshot, error) {
+	b.chainLock.Lock()
+	state := b.BestSnapshot()
+	err := b.db.Update(func(dbTx database.Tx) error {
+		return b.utxoCache.flush(dbTx, FlushRequired, state)
+	})
+	if err != nil {
+		b.chainLock.Unlock()
+		return nil, err
+	}
+	dbTx, err := b.db.Begin(false)
+	b.chainLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer dbTx.Rollback()
+
+	// The number of coins is in the header, so count them first.
+	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+	var coinsCount uint64
+	err = utxoBucket.ForEach(func(_, _ []byte) error {
+		coinsCount++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bw := bufio.NewWriter(w)
+	err = writeSnapshotHeader(bw, b.chainParams.Net, &state.Hash, coinsCount)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cursor iterates the coins in the order of their keys, which is
+	// the order they must be loaded in.
+	hasher := sha256.New()
+	cw := io.MultiWriter(bw, hasher)
+	cursor := utxoBucket.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		err := writeSnapshotCoin(cw, cursor.Key(), cursor.Value())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+
+	return &UtxoSnapshot{
+		BaseHash:     state.Hash,
+		BaseHeight:   state.Height,
+		CoinsCount:   coinsCount,
+		TxOutSetHash: chainhash.HashH(hasher.Sum(nil)),
+		ChainTxCount: state.TotalTxns,
+	}, nil
+}
+
+// loadSnapshotCoins reads the coins of a UTXO set snapshot into the passed utxo
+// set bucket and returns the hash of the UTXO set.  The coins must be sorted by
+// key, and the snapshot must end after the last of them.
+func loadSnapshotCoins(r *bufio.Reader, utxoBucket database.Bucket, coinsCount uint64) (chainhash.Hash, error) {
+	hasher := sha256.New()
+	var prevKey []byte
+	for i := uint64(0); i < coinsCount; i++ {
+		key, entry, err := readSnapshotCoin(r)
+		if err != nil {
+			return chainhash.Hash{}, fmt.Errorf("unable to read "+
+				"coin %d of the UTXO snapshot: %v", i, err)
+		}
+		if prevKey != nil && bytes.Compare(key, prevKey) <= 0 {
+			return chainhash.Hash{}, fmt.Errorf("coin %d of the "+
+				"UTXO snapshot is out of order", i)
+		}
+		if err := utxoBucket.Put(key, entry); err != nil {
+			return chainhash.Hash{}, err
+		}
+		if err := writeSnapshotCoin(hasher, key, entry); err != nil {
+			return chainhash.Hash{}, err
+		}
+		prevKey = key
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		return chainhash.Hash{}, errors.New("UTXO snapshot has data " +
+			"after its last coin")
+	}
+
+	return chainhash.HashH(hasher.Sum(nil)), nil
+}
+
+// LoadUtxoSnapshot replaces the UTXO set with the one of the snapshot read from
+// the passed reader and moves the tip of the best chain to its base block.  The
+// base must be one of the snapshots committed in the chain parameters, its
+// header must be known and the best chain must be behind it.  The blocks up to
+// the base are then only assumed valid until the snapshot is validated with
+// ValidateUtxoSnapshot.
+//
+// The UTXO set is replaced in a single database transaction, so the chain is
+// left untouched when the snapshot is invalid or the node stops while loading
+// it.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) LoadUtxoSnapshot(r io.Reader) (*UtxoSnapshot, error) {
+	br := bufio.NewReader(r)
+	net, baseHash, coinsCount, err := readSnapshotHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if net != b.chainParams.Net {
+		return nil, fmt.Errorf("UTXO snapshot is for network %v, not %v",
+			net, b.chainParams.Net)
+	}
+	au := b.assumeUTXO(&baseHash)
+	if au == nil {
+		return nil, fmt.Errorf("UTXO snapshot base %v is not a known "+
+			"snapshot of the %s network", baseHash, b.chainParams.Name)
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if b.indexManager != nil {
+		return nil, errors.New("a UTXO snapshot can't be loaded with " +
+			"optional indexes enabled")
+	}
+	if b.snapshotBase != nil {
+		return nil, fmt.Errorf("the chain was already loaded from the "+
+			"UTXO snapshot at block %v", b.snapshotBase.hash)
+	}
+	base := b.index.LookupNode(&baseHash)
+	if base == nil {
+		return nil, fmt.Errorf("the header of the UTXO snapshot base %v "+
+			"is not known yet", baseHash)
+	}
+	if b.index.NodeStatus(base).KnownInvalid() {
+		return nil, fmt.Errorf("the UTXO snapshot base %v is known to "+
+			"be invalid", baseHash)
+	}
+	if base.height != au.Height {
+		return nil, AssertError(fmt.Sprintf("LoadUtxoSnapshot: base "+
+			"%v is at height %d instead of the committed height %d",
+			baseHash, base.height, au.Height))
+	}
+	tip := b.bestChain.Tip()
+	if tip.height >= base.height {
+		return nil, fmt.Errorf("the best chain at height %d is not "+
+			"behind the UTXO snapshot base at height %d", tip.height,
+			base.height)
+	}
+
+	log.Infof("Loading UTXO snapshot of %d coins at block %v (height %d)",
+		coinsCount, baseHash, base.height)
+
+	state := newBestState(base, 0, 0, 0, au.ChainTxCount,
+		CalcPastMedianTime(base))
+	err = b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if err := meta.DeleteBucket(utxoSetBucketName); err != nil {
+			return err
+		}
+		utxoBucket, err := meta.CreateBucket(utxoSetBucketName)
+		if err != nil {
+			return err
+		}
+
+		txOutSetHash, err := loadSnapshotCoins(br, utxoBucket, coinsCount)
+		if err != nil {
+			return err
+		}
+		if !txOutSetHash.IsEqual(au.TxOutSetHash) {
+			return fmt.Errorf("UTXO snapshot hash %v does not match "+
+				"the committed hash %v", txOutSetHash,
+				au.TxOutSetHash)
+		}
+
+		err = dbPutBestState(dbTx, state, base.workSum)
+		if err != nil {
+			return err
+		}
+		err = dbPutChainTxCount(dbTx, &base.hash, au.ChainTxCount)
+		if err != nil {
+			return err
+		}
+		err = dbPruneUtxoJournal(dbTx, base.height)
+		if err != nil {
+			return err
+		}
+		err = dbPutUtxoStateConsistency(dbTx, &base.hash)
+		if err != nil {
+			return err
+		}
+		return dbPutSnapshotState(dbTx, &base.hash, SnapshotUnvalidated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The entries cached for the previous tip no longer apply, and the
+	// latest checkpoint must be searched again from the new tip.
+	b.utxoCache = newUtxoCache(b.db, b.utxoCache.maxTotalMemoryUsage)
+	b.utxoCache.lastFlushHash = base.hash
+	b.utxoCache.lastFlushTime = time.Now()
+	b.bestChain.SetTip(base)
+	b.checkpointNode = nil
+	b.nextCheckpoint = nil
+	b.snapshotBase = base
+	b.snapshotStatus = SnapshotUnvalidated
+
+	b.stateLock.Lock()
+	b.stateSnapshot = state
+	b.stateLock.Unlock()
+
+	log.Infof("Loaded UTXO snapshot, the chain tip is now block %v "+
+		"(height %d)", base.hash, base.height)
+
+	return &UtxoSnapshot{
+		BaseHash:     base.hash,
+		BaseHeight:   base.height,
+		CoinsCount:   coinsCount,
+		TxOutSetHash: *au.TxOutSetHash,
+		ChainTxCount: au.ChainTxCount,
+	}, nil
+}
+
+// SnapshotInfo returns the UTXO set snapshot the chain was loaded from, or nil
+// when it wasn't loaded from one.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SnapshotInfo() *SnapshotInfo {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	if b.snapshotBase == nil {
+		return nil
+	}
+	return &SnapshotInfo{
+		BaseHash:   b.snapshotBase.hash,
+		BaseHeight: b.snapshotBase.height,
+		Status:     b.snapshotStatus,
+	}
+}
+
+// ValidateUtxoSnapshot compares the UTXO set of the UTXO set snapshot the chain
+// was loaded from with the one of the passed background chain, which must have
+// validated all the blocks up to the snapshot base.  The snapshot is marked as
+// validated when they match, and as invalid with an error returned otherwise.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ValidateUtxoSnapshot(background *BlockChain) error {
+	stats, err := background.DumpUtxoSnapshot(io.Discard)
+	if err != nil {
+		return err
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if b.snapshotBase == nil {
+		return errors.New("the chain was not loaded from a UTXO snapshot")
+	}
+	if stats.BaseHash != b.snapshotBase.hash {
+		return fmt.Errorf("the background chain is at block %v instead "+
+			"of the UTXO snapshot base %v", stats.BaseHash,
+			b.snapshotBase.hash)
+	}
+	au := b.assumeUTXO(&b.snapshotBase.hash)
+	if au == nil {
+		return AssertError(fmt.Sprintf("ValidateUtxoSnapshot: UTXO "+
+			"snapshot base %v is not committed", b.snapshotBase.hash))
+	}
+
+	status := SnapshotValidated
+	if !stats.TxOutSetHash.IsEqual(au.TxOutSetHash) {
+		status = SnapshotInvalid
+	}
+	err = b.db.Update(func(dbTx database.Tx) error {
+		return dbPutSnapshotState(dbTx, &b.snapshotBase.hash, status)
+	})
+	if err != nil {
+		return err
+	}
+	b.snapshotStatus = status
+
+	if status == SnapshotInvalid {
+		return fmt.Errorf("the UTXO set hash %v built by validating the "+
+			"blocks up to %v does not match the UTXO snapshot hash %v",
+			stats.TxOutSetHash, b.snapshotBase.hash, au.TxOutSetHash)
+	}
+	log.Infof("Validated the UTXO snapshot at block %v (height %d)",
+		b.snapshotBase.hash, b.snapshotBase.height)
+	return nil
+}
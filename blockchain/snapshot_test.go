@@ -0,0 +1,211 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/flokiorg/go-flokicoin/blockchain/internal/testhelper"
+	"github.com/flokiorg/go-flokicoin/chaincfg"
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/database"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// TestUtxoSnapshot ensures a UTXO set snapshot dumped from a chain can be
+// loaded into a chain that only has the headers up to its base, which can then
+// connect the next blocks, and that the snapshot is validated against the UTXO
+// set of the source chain.
+func TestUtxoSnapshot(t *testing.T) {
+	src, params, tearDown := utxoCacheTestChain("TestUtxoSnapshot-src")
+	defer tearDown()
+
+	// Create a chain with 10 blocks that spend outputs of the previous
+	// ones.
+	tip := chainutil.NewBlock(params.GenesisBlock)
+	_, spendableOuts, err := addBlocks(10, src, tip, []*testhelper.SpendableOut{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcBest := src.BestSnapshot()
+
+	var buf bytes.Buffer
+	snapshot, err := src.DumpUtxoSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("DumpUtxoSnapshot: %v", err)
+	}
+	if snapshot.BaseHash != srcBest.Hash || snapshot.BaseHeight != 10 {
+		t.Fatalf("unexpected snapshot base %v (height %d), want %v "+
+			"(height 10)", snapshot.BaseHash, snapshot.BaseHeight,
+			srcBest.Hash)
+	}
+	if snapshot.CoinsCount == 0 {
+		t.Fatal("snapshot has no coins")
+	}
+	if snapshot.ChainTxCount != srcBest.TotalTxns {
+		t.Fatalf("unexpected chain tx count %d, want %d",
+			snapshot.ChainTxCount, srcBest.TotalTxns)
+	}
+
+	// The snapshot must be the same when dumped again.
+	var buf2 bytes.Buffer
+	if _, err := src.DumpUtxoSnapshot(&buf2); err != nil {
+		t.Fatalf("DumpUtxoSnapshot: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+		t.Fatal("snapshot differs when dumped again")
+	}
+
+	// Give the headers of the source chain to the destination chain,
+	// whose database is kept apart from the test database root so both
+	// can be torn down.
+	dbPath := filepath.Join(t.TempDir(), "TestUtxoSnapshot-dst")
+	db, err := database.Create(testDbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	dstParams := *params
+	dst, err := New(&Config{
+		DB:               db,
+		ChainParams:      &dstParams,
+		TimeSource:       NewMedianTime(),
+		UtxoCacheMaxSize: 10 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst.TstSetCoinbaseMaturity(1)
+	for height := int32(1); height <= srcBest.Height; height++ {
+		block, err := src.BlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = dst.ProcessBlockHeader(&block.MsgBlock().Header, BFNone)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The snapshot can't be loaded until it's committed in the chain
+	// parameters, nor when its hash doesn't match the committed one.
+	_, err = dst.LoadUtxoSnapshot(bytes.NewReader(buf.Bytes()))
+	if err == nil {
+		t.Fatal("loaded a snapshot that is not committed")
+	}
+	badHash := chainhash.Hash{0x01}
+	dst.chainParams.AssumeUTXO = []chaincfg.AssumeUTXO{{
+		Height:       snapshot.BaseHeight,
+		BlockHash:    &snapshot.BaseHash,
+		TxOutSetHash: &badHash,
+		ChainTxCount: snapshot.ChainTxCount,
+	}}
+	_, err = dst.LoadUtxoSnapshot(bytes.NewReader(buf.Bytes()))
+	if err == nil {
+		t.Fatal("loaded a snapshot that does not match its committed " +
+			"hash")
+	}
+	if dst.BestSnapshot().Height != 0 || dst.SnapshotInfo() != nil {
+		t.Fatal("chain changed after failing to load a snapshot")
+	}
+	err = assertNbEntriesOnDisk(dst, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Load the snapshot with its committed hash.
+	dst.chainParams.AssumeUTXO[0].TxOutSetHash = &snapshot.TxOutSetHash
+	loaded, err := dst.LoadUtxoSnapshot(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadUtxoSnapshot: %v", err)
+	}
+	if loaded.CoinsCount != snapshot.CoinsCount {
+		t.Fatalf("loaded %d coins, want %d", loaded.CoinsCount,
+			snapshot.CoinsCount)
+	}
+	dstBest := dst.BestSnapshot()
+	if dstBest.Hash != srcBest.Hash || dstBest.TotalTxns != srcBest.TotalTxns {
+		t.Fatalf("unexpected tip %v with %d txns, want %v with %d txns",
+			dstBest.Hash, dstBest.TotalTxns, srcBest.Hash,
+			srcBest.TotalTxns)
+	}
+	info := dst.SnapshotInfo()
+	if info == nil || info.BaseHash != srcBest.Hash ||
+		info.Status != SnapshotUnvalidated {
+
+		t.Fatalf("unexpected snapshot info %+v", info)
+	}
+	_, err = dst.LoadUtxoSnapshot(bytes.NewReader(buf.Bytes()))
+	if err == nil {
+		t.Fatal("loaded a snapshot twice")
+	}
+
+	// The chain loaded from the snapshot must be restored as is from the
+	// database.
+	reloaded, err := New(&Config{
+		DB:          dst.db,
+		ChainParams: dst.chainParams,
+		TimeSource:  NewMedianTime(),
+	})
+	if err != nil {
+		t.Fatalf("unable to reload the chain: %v", err)
+	}
+	if reloaded.BestSnapshot().Hash != srcBest.Hash {
+		t.Fatalf("reloaded tip %v, want %v",
+			reloaded.BestSnapshot().Hash, srcBest.Hash)
+	}
+	info = reloaded.SnapshotInfo()
+	if info == nil || info.Status != SnapshotUnvalidated {
+		t.Fatalf("unexpected reloaded snapshot info %+v", info)
+	}
+
+	// The snapshot is invalid when it doesn't match the UTXO set of the
+	// chain that validated the blocks up to its base, and valid when it
+	// does.
+	dst.chainParams.AssumeUTXO[0].TxOutSetHash = &badHash
+	if err := dst.ValidateUtxoSnapshot(src); err == nil {
+		t.Fatal("validated a snapshot that does not match")
+	}
+	status, loadedFromSnapshot, err := FetchSnapshotStatus(dst.db)
+	if err != nil || !loadedFromSnapshot || status != SnapshotInvalid {
+		t.Fatalf("unexpected stored snapshot status %v (loaded %v): %v",
+			status, loadedFromSnapshot, err)
+	}
+	dst.chainParams.AssumeUTXO[0].TxOutSetHash = &snapshot.TxOutSetHash
+	if err := dst.ValidateUtxoSnapshot(src); err != nil {
+		t.Fatalf("ValidateUtxoSnapshot: %v", err)
+	}
+	if info := dst.SnapshotInfo(); info.Status != SnapshotValidated {
+		t.Fatalf("unexpected snapshot status %v", info.Status)
+	}
+
+	// The next block spends outputs of the snapshot and must connect to
+	// both chains.
+	spends := spendableOuts[len(spendableOuts)-1]
+	prev, err := src.BlockByHash(&srcBest.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _, err := addBlock(src, prev, spends)
+	if err != nil {
+		t.Fatal(err)
+	}
+	isMainChain, _, err := dst.ProcessBlock(block, BFNone)
+	if err != nil {
+		t.Fatalf("unable to connect the block after the snapshot "+
+			"base: %v", err)
+	}
+	if !isMainChain {
+		t.Fatal("block after the snapshot base is not in the main chain")
+	}
+	coinbase := wire.OutPoint{Hash: *block.Transactions()[0].Hash()}
+	entry, err := dst.FetchUtxoEntry(coinbase)
+	if err != nil || entry == nil {
+		t.Fatalf("unable to fetch the coinbase output: %v", err)
+	}
+}
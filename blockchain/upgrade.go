@@ -24,6 +24,11 @@ const (
 	// The serialized block index row format is:
 	//   <blocklocation><blockheader>
 	blockHdrOffset = 12
+
+	// maxChainTxCountBatchSize is the max number of chain tx count index
+	// entries added in a single database transaction while the index is
+	// built, in order to keep memory usage to reasonable levels.
+	maxChainTxCountBatchSize = 2000
 )
 
 // errInterruptRequested indicates that an operation was cancelled due
@@ -575,6 +580,81 @@ func upgradeUtxoSetToV2(db database.DB, interrupt <-chan struct{}) error {
 	return nil
 }
 
+// buildChainTxCountIndex builds the chain tx count index for the blocks of the
+// main chain when the database was created before the index.  The counts are
+// derived from the total number of transactions of the best chain state by
+// walking the main chain down from its tip, which stops at the base of a UTXO
+// set snapshot and at the first block that was pruned since the counts of the
+// blocks before them can't be derived.  It is guaranteed to be built if this
+// returns without failure.
+func (b *BlockChain) buildChainTxCountIndex(interrupt <-chan struct{}) error {
+	log.Infof("Building the chain tx count index.  This might take a " +
+		"while...")
+	start := time.Now()
+
+	err := b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		_, err := meta.CreateBucketIfNotExists(chainTxCountBucketName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	node := b.bestChain.Tip()
+	txCount := b.stateSnapshot.TotalTxns
+	var totalIndexed int
+	for node != nil {
+		var numIndexed int
+		err := b.db.Update(func(dbTx database.Tx) error {
+			for ; node != nil && numIndexed < maxChainTxCountBatchSize; numIndexed++ {
+				err := dbPutChainTxCount(dbTx, &node.hash, txCount)
+				if err != nil {
+					return err
+				}
+
+				stored, err := dbTx.HasBlock(&node.hash)
+				if err != nil {
+					return err
+				}
+				if node == b.snapshotBase || !stored {
+					node = nil
+					continue
+				}
+				block, err := dbFetchBlockByNode(dbTx, node)
+				if err != nil {
+					return err
+				}
+				txCount -= uint64(len(block.Transactions()))
+				node = node.parent
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		totalIndexed += numIndexed
+		log.Infof("Indexed %d blocks (%d total)", numIndexed, totalIndexed)
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+	}
+
+	err = b.db.Update(func(dbTx database.Tx) error {
+		return dbPutVersion(dbTx, chainTxCountVersionKeyName,
+			latestChainTxCountBucketVersion)
+	})
+	if err != nil {
+		return err
+	}
+
+	seconds := int64(time.Since(start) / time.Second)
+	log.Infof("Done building the chain tx count index.  Total blocks: %d "+
+		"in %d seconds", totalIndexed, seconds)
+	return nil
+}
+
 // maybeUpgradeDbBuckets checks the database version of the buckets used by this
 // package and performs any needed upgrades to bring them to the latest version.
 //
@@ -582,14 +662,30 @@ func upgradeUtxoSetToV2(db database.DB, interrupt <-chan struct{}) error {
 // this function returns without error.
 func (b *BlockChain) maybeUpgradeDbBuckets(interrupt <-chan struct{}) error {
 	// Load or create bucket versions as needed.
-	var utxoSetVersion uint32
+	var utxoSetVersion, chainTxCountVersion uint32
 	err := b.db.Update(func(dbTx database.Tx) error {
 		// Load the utxo set version from the database or create it and
 		// initialize it to version 1 if it doesn't exist.
 		var err error
 		utxoSetVersion, err = dbFetchOrCreateVersion(dbTx,
 			utxoSetVersionKeyName, 1)
-		return err
+		if err != nil {
+			return err
+		}
+
+		// Create the bucket that houses the utxo journal, which is
+		// missing from the databases created before it.
+		meta := dbTx.Metadata()
+		_, err = meta.CreateBucketIfNotExists(utxoJournalBucketName)
+		if err != nil {
+			return err
+		}
+
+		// The chain tx count version is only stored once the index is
+		// fully built.
+		chainTxCountVersion = dbFetchVersion(dbTx,
+			chainTxCountVersionKeyName)
+		return nil
 	})
 	if err != nil {
 		return err
@@ -602,5 +698,12 @@ func (b *BlockChain) maybeUpgradeDbBuckets(interrupt <-chan struct{}) error {
 		}
 	}
 
+	// Build the chain tx count index if needed.
+	if chainTxCountVersion < latestChainTxCountBucketVersion {
+		if err := b.buildChainTxCountIndex(interrupt); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -185,6 +185,11 @@ const (
 	// block download is complete and it's useful to flush periodically in case
 	// of unforeseen shutdowns.
 	utxoFlushPeriodicInterval = time.Minute * 5
+
+	// maxUtxoFlushBatchSize is the max number of dirty entries written in a
+	// single database transaction by FlushDirtyUtxos, which holds the chain
+	// state lock while each batch is written.
+	maxUtxoFlushBatchSize = 20000
 )
 
 // FlushMode is used to indicate the different urgency types for a flush.
@@ -222,6 +227,20 @@ type utxoCache struct {
 	cachedEntries    mapSlice
 	totalEntryMemory uint64 // Total memory usage in bytes.
 
+	// dirtyEntries is the set of the outpoints whose cached entry deviates
+	// from the database.  The changes made by the blocks whose dirty
+	// entries are not all written yet are kept in the utxo journal.
+	dirtyEntries map[wire.OutPoint]struct{}
+
+	// maxDirtyEntries is the number of dirty entries from which they
+	// should be written to the database by FlushDirtyUtxos.  Twice as many
+	// are written while connecting a block.
+	maxDirtyEntries int
+
+	// flushBatchSize is the max number of dirty entries written in a
+	// single database transaction by FlushDirtyUtxos.
+	flushBatchSize int
+
 	// Below fields are used to indicate when the last flush happened.
 	lastFlushHash chainhash.Hash
 	lastFlushTime time.Time
@@ -247,6 +266,12 @@ func newUtxoCache(db database.DB, maxTotalMemoryUsage uint64) *utxoCache {
 			maxEntries:          []int{numMaxElements},
 			maxTotalMemoryUsage: maxTotalMemoryUsage,
 		},
+		dirtyEntries: make(map[wire.OutPoint]struct{}),
+
+		// Up to a quarter of the entries the cache is allocated for can
+		// be dirty before they're written.
+		maxDirtyEntries: max(numMaxElements/4, 1),
+		flushBatchSize:  maxUtxoFlushBatchSize,
 	}
 }
 
@@ -366,6 +391,7 @@ func (s *utxoCache) addTxOut(outpoint wire.OutPoint, txOut *wire.TxOut, isCoinBa
 
 	s.cachedEntries.put(outpoint, entry, s.totalEntryMemory)
 	s.totalEntryMemory += entry.memoryUsage()
+	s.dirtyEntries[outpoint] = struct{}{}
 
 	return nil
 }
@@ -435,11 +461,13 @@ func (s *utxoCache) addTxIn(txIn *wire.TxIn, stxos *[]SpentTxOut) error {
 		// If the entry is fresh, we will always have it in the cache.
 		s.cachedEntries.delete(txIn.PreviousOutPoint)
 		s.totalEntryMemory -= entry.memoryUsage()
+		delete(s.dirtyEntries, txIn.PreviousOutPoint)
 	} else {
 		// Can leave the entry to be garbage collected as the only purpose
 		// of this entry now is so that the entry on disk can be deleted.
 		entry = nil
 		s.totalEntryMemory -= entry.memoryUsage()
+		s.dirtyEntries[txIn.PreviousOutPoint] = struct{}{}
 	}
 
 	return nil
@@ -531,13 +559,62 @@ func (s *utxoCache) writeCache(dbTx database.Tx, bestState *BestState) error {
 	}
 	s.cachedEntries.deleteMaps()
 	s.totalEntryMemory = 0
+	clear(s.dirtyEntries)
 
 	// When done, store the best state hash in the database to indicate the state
 	// is consistent until that hash.
+	return s.markConsistent(dbTx, bestState)
+}
+
+// writeDirtyEntries writes up to the passed number of dirty entries to the
+// database.  Unlike writeCache, the entries that are still unspent are kept in
+// the cache.  Once no dirty entry is left, the utxo state in the database is
+// consistent with the passed best state.
+func (s *utxoCache) writeDirtyEntries(dbTx database.Tx, maxEntries int, bestState *BestState) error {
+	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+	var numWritten int
+	for outpoint := range s.dirtyEntries {
+		if numWritten >= maxEntries {
+			return nil
+		}
+
+		entry, _ := s.cachedEntries.get(outpoint)
+		if entry == nil || entry.IsSpent() {
+			err := dbDeleteUtxoEntry(utxoBucket, outpoint)
+			if err != nil {
+				return err
+			}
+			s.cachedEntries.delete(outpoint)
+			s.totalEntryMemory -= entry.memoryUsage()
+		} else {
+			err := dbPutUtxoEntry(utxoBucket, outpoint, entry)
+			if err != nil {
+				return err
+			}
+
+			// The entry is now in the database, so it's no longer
+			// fresh and must be deleted from it once spent.
+			entry.packedFlags &^= tfFresh | tfModified
+		}
+		delete(s.dirtyEntries, outpoint)
+		numWritten++
+	}
+
+	return s.markConsistent(dbTx, bestState)
+}
+
+// markConsistent stores the hash of the passed best state in the database to
+// indicate the utxo state is consistent until it, and removes the journal
+// entries of the blocks up to it.
+func (s *utxoCache) markConsistent(dbTx database.Tx, bestState *BestState) error {
 	err := dbPutUtxoStateConsistency(dbTx, &bestState.Hash)
 	if err != nil {
 		return err
 	}
+	err = dbPruneUtxoJournal(dbTx, bestState.Height)
+	if err != nil {
+		return err
+	}
 
 	// The best state is the new last flush hash.
 	s.lastFlushHash = bestState.Hash
@@ -546,6 +623,53 @@ func (s *utxoCache) writeCache(dbTx database.Tx, bestState *BestState) error {
 	return nil
 }
 
+// dirtyFlushNeeded returns whether FlushDirtyUtxos should write the dirty
+// entries, which is when there are too many of them, or when the changes of the
+// blocks after the last flush were not written for the periodic interval.
+func (s *utxoCache) dirtyFlushNeeded(bestState *BestState) bool {
+	if len(s.dirtyEntries) >= s.maxDirtyEntries {
+		return true
+	}
+	return bestState.Hash != s.lastFlushHash &&
+		time.Since(s.lastFlushTime) > utxoFlushPeriodicInterval
+}
+
+// applyUtxoChanges applies the changes recorded in the utxo journal to the
+// cache.  Since the dirty entries might have been partly written to the
+// database before an unclean shutdown, the spent entries are not looked up in
+// the database, and the created entries are not marked fresh.
+func (s *utxoCache) applyUtxoChanges(changes []utxoChange) {
+	for _, change := range changes {
+		outpoint := change.outpoint
+		entry := change.entry
+		if entry != nil {
+			entry.packedFlags |= tfModified
+			s.cachedEntries.put(outpoint, entry, s.totalEntryMemory)
+			s.totalEntryMemory += entry.memoryUsage()
+			s.dirtyEntries[outpoint] = struct{}{}
+			continue
+		}
+
+		entry, _ = s.cachedEntries.get(outpoint)
+		switch {
+		case entry != nil && entry.isFresh():
+			s.cachedEntries.delete(outpoint)
+			s.totalEntryMemory -= entry.memoryUsage()
+			delete(s.dirtyEntries, outpoint)
+			continue
+
+		case entry != nil:
+			entry.Spend()
+
+		default:
+			entry = &UtxoEntry{packedFlags: tfSpent | tfModified}
+			s.cachedEntries.put(outpoint, entry, s.totalEntryMemory)
+			s.totalEntryMemory += entry.memoryUsage()
+		}
+		s.dirtyEntries[outpoint] = struct{}{}
+	}
+}
+
 // flush flushes the UTXO state to the database if a flush is needed with the given flush mode.
 //
 // This function MUST be called with the chain state lock held (for writes).
@@ -582,6 +706,14 @@ func (s *utxoCache) flush(dbTx database.Tx, mode FlushMode, bestState *BestState
 		return s.writeCache(dbTx, bestState)
 	}
 
+	// The dirty entries are written in the background by FlushDirtyUtxos,
+	// unless it doesn't keep them under twice their bound.
+	if mode == FlushIfNeeded && len(s.dirtyEntries) >= 2*s.maxDirtyEntries {
+		log.Debugf("Writing %d dirty UTXO cache entries to disk",
+			len(s.dirtyEntries))
+		return s.writeDirtyEntries(dbTx, len(s.dirtyEntries), bestState)
+	}
+
 	return nil
 }
 
@@ -598,6 +730,54 @@ func (b *BlockChain) FlushUtxoCache(mode FlushMode) error {
 	})
 }
 
+// FlushDirtyUtxos writes the dirty entries of the UTXO cache to the database
+// when there are too many of them, or when the changes of the blocks connected
+// after the last flush were not written for a while.  The entries are written
+// in batches, with the chain state lock only held while each batch is written
+// so blocks can be connected in between.  It stops once as many entries as were
+// dirty when it was called are written, so it returns even while blocks keep
+// being connected, and the utxo state is only marked consistent when no dirty
+// entry is left.  Unlike FlushUtxoCache, the entries that are still unspent are
+// kept in the cache.
+//
+// It returns early without error when the interrupt channel is closed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FlushDirtyUtxos(interrupt <-chan struct{}) error {
+	s := b.utxoCache
+	b.chainLock.Lock()
+	needed := s.dirtyFlushNeeded(b.BestSnapshot())
+	remaining := len(s.dirtyEntries)
+	b.chainLock.Unlock()
+	if !needed {
+		return nil
+	}
+
+	for remaining > 0 && !interruptRequested(interrupt) {
+		var done bool
+		b.chainLock.Lock()
+		err := b.db.Update(func(dbTx database.Tx) error {
+			numDirty := len(s.dirtyEntries)
+			err := s.writeDirtyEntries(dbTx,
+				min(remaining, s.flushBatchSize), b.BestSnapshot())
+			remaining -= numDirty - len(s.dirtyEntries)
+			done = len(s.dirtyEntries) == 0
+			return err
+		})
+		b.chainLock.Unlock()
+		if err != nil || done {
+			return err
+		}
+	}
+	return nil
+}
+
+// UtxoFlushSignal returns a channel that receives a value when the UTXO cache
+// has enough dirty entries for FlushDirtyUtxos to write them.
+func (b *BlockChain) UtxoFlushSignal() <-chan struct{} {
+	return b.utxoFlushSignal
+}
+
 // InitConsistentState checks the consistency status of the utxo state and
 // replays blocks if it lags behind the best state of the blockchain.
 //
@@ -681,22 +861,33 @@ func (b *BlockChain) InitConsistentState(tip *blockNode, interrupt <-chan struct
 	for e := attachNodes.Front(); e != nil; e = e.Next() {
 		node = e.Value.(*blockNode)
 
+		// The changes made by the block are applied from its entry in
+		// the utxo journal, which doesn't need the block nor the
+		// entries it spends.  The blocks connected before the journal
+		// existed are connected again instead.
+		var changes []utxoChange
+		var journaled bool
 		var block *chainutil.Block
 		err := s.db.View(func(dbTx database.Tx) error {
-			block, err = dbFetchBlockByNode(dbTx, node)
-			if err != nil {
+			changes, journaled, err = dbFetchUtxoJournalEntry(dbTx, node)
+			if err != nil || journaled {
 				return err
 			}
 
+			block, err = dbFetchBlockByNode(dbTx, node)
 			return err
 		})
 		if err != nil {
 			return err
 		}
 
-		err = b.utxoCache.connectTransactions(block, nil)
-		if err != nil {
-			return err
+		if journaled {
+			s.applyUtxoChanges(changes)
+		} else {
+			err = b.utxoCache.connectTransactions(block, nil)
+			if err != nil {
+				return err
+			}
 		}
 
 		// Flush the utxo cache if needed.  This will in turn update the
@@ -716,11 +907,13 @@ func (b *BlockChain) InitConsistentState(tip *blockNode, interrupt <-chan struct
 	}
 	log.Debug("UTXO state reconstruction done")
 
-	// Set the last flush hash as it's the default value of 0s.
-	s.lastFlushHash = tip.hash
-	s.lastFlushTime = time.Now()
-
-	return nil
+	// Flush the reconstructed state so the utxo journal only has the
+	// entries of the blocks connected from now on.  This also sets the last
+	// flush hash.
+	return s.db.Update(func(dbTx database.Tx) error {
+		return s.writeCache(dbTx, &BestState{Hash: tip.hash,
+			Height: tip.height})
+	})
 }
 
 // flushNeededAfterPrune returns true if the utxo cache needs to be flushed after a prune
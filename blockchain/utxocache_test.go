@@ -14,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/flokiorg/go-flokicoin/blockchain/internal/testhelper"
 	"github.com/flokiorg/go-flokicoin/chaincfg"
 	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
 	"github.com/flokiorg/go-flokicoin/chainutil"
@@ -386,7 +387,7 @@ func assertNbEntriesOnDisk(chain *BlockChain, expectedNumber int) error {
 
 // utxoCacheTestChain creates a test BlockChain to be used for utxo cache tests.
 // It uses the regression test parameters, a coin matutiry of 1 block and sets
-// the cache size limit to 10 MiB.
+// the cache size limit to 10 MiB, along with the matching dirty entries bound.
 func utxoCacheTestChain(testName string) (*BlockChain, *chaincfg.Params, func()) {
 	params := chaincfg.RegressionNetParams
 	chain, tearDown, err := chainSetup(testName, &params)
@@ -397,6 +398,8 @@ func utxoCacheTestChain(testName string) (*BlockChain, *chaincfg.Params, func())
 	chain.TstSetCoinbaseMaturity(1)
 	chain.utxoCache.maxTotalMemoryUsage = 10 * 1024 * 1024
 	chain.utxoCache.cachedEntries.maxTotalMemoryUsage = chain.utxoCache.maxTotalMemoryUsage
+	chain.utxoCache.maxDirtyEntries = calculateMinEntries(
+		int(chain.utxoCache.maxTotalMemoryUsage), bucketSize+avgEntrySize) / 4
 
 	return chain, &params, tearDown
 }
@@ -964,3 +967,390 @@ func TestInitConsistentState(t *testing.T) {
 			blocks[len(blocks)-1].Height())
 	}
 }
+
+// utxoSetOnDisk returns the serialized entries of the utxo set in the database
+// by their key.
+func utxoSetOnDisk(t *testing.T, db database.DB) map[string]string {
+	t.Helper()
+
+	entries := make(map[string]string)
+	err := db.View(func(dbTx database.Tx) error {
+		cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			entries[string(cursor.Key())] = string(cursor.Value())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// numUtxoJournalEntries returns the number of entries in the utxo journal.
+func numUtxoJournalEntries(t *testing.T, db database.DB) int {
+	t.Helper()
+
+	var num int
+	err := db.View(func(dbTx database.Tx) error {
+		cursor := dbTx.Metadata().Bucket(utxoJournalBucketName).Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			num++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return num
+}
+
+// TestFlushDirtyUtxos ensures the dirty entries of the cache are written in
+// batches once there are enough of them, keeping the unspent entries cached.
+func TestFlushDirtyUtxos(t *testing.T) {
+	chain, params, tearDown := utxoCacheTestChain("TestFlushDirtyUtxos")
+	defer tearDown()
+	cache := chain.utxoCache
+
+	tip := chainutil.NewBlock(params.GenesisBlock)
+	_, _, err := addBlocks(5, chain, tip, []*testhelper.SpendableOut{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	best := chain.BestSnapshot()
+	numDirty := len(cache.dirtyEntries)
+	if numDirty == 0 {
+		t.Fatal("connecting blocks didn't leave any dirty entry")
+	}
+	if num := numUtxoJournalEntries(t, chain.db); num != int(best.Height) {
+		t.Fatalf("%d utxo journal entries, want %d", num, best.Height)
+	}
+
+	// Nothing is written while there are few dirty entries and the last
+	// flush is recent.
+	if err := chain.FlushDirtyUtxos(nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.dirtyEntries) != numDirty {
+		t.Fatalf("%d dirty entries left, want %d",
+			len(cache.dirtyEntries), numDirty)
+	}
+
+	// Connecting a block with too many dirty entries signals they should
+	// be written, which leaves the utxo state consistent with the tip.
+	cache.maxDirtyEntries = numDirty
+	tipBlock, err := chain.BlockByHash(&best.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := addBlocks(1, chain, tipBlock, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-chain.UtxoFlushSignal():
+	default:
+		t.Fatal("no signal to flush the dirty entries")
+	}
+	best = chain.BestSnapshot()
+	if err := chain.FlushDirtyUtxos(nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.dirtyEntries) != 0 {
+		t.Fatalf("%d dirty entries left", len(cache.dirtyEntries))
+	}
+	if err := assertConsistencyState(chain, &best.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if num := numUtxoJournalEntries(t, chain.db); num != 0 {
+		t.Fatalf("%d utxo journal entries left", num)
+	}
+	var numCached int
+	for _, m := range cache.cachedEntries.maps {
+		for _, entry := range m {
+			if entry != nil {
+				numCached++
+			}
+		}
+	}
+	if numCached == 0 {
+		t.Fatal("the written entries were evicted from the cache")
+	}
+	if err := assertNbEntriesOnDisk(chain, numCached); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestUtxoJournalRecovery ensures the utxo state is recovered from the utxo
+// journal after an unclean shutdown that happened while the dirty entries of
+// the cache were being written.
+func TestUtxoJournalRecovery(t *testing.T) {
+	// The utxo set is recovered in a first chain, which is torn down before
+	// the reference chain is created since they share the test db root.
+	var blocks []*chainutil.Block
+	var got map[string]string
+	func() {
+		chain, params, tearDown := utxoCacheTestChain("TestUtxoJournalRecovery")
+		defer tearDown()
+
+		// Create a chain whose last block spends the outputs of its
+		// parent.
+		genesis := chainutil.NewBlock(params.GenesisBlock)
+		hashes, spendableOuts, err := addBlocks(10, chain, genesis,
+			[]*testhelper.SpendableOut{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parent, err := chain.BlockByHash(hashes[len(hashes)-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		tip, _, err := addBlock(chain, parent, spendableOuts[len(hashes)-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		best := chain.BestSnapshot()
+
+		// Write some of the dirty entries, as an interrupted background
+		// flush would, and drop the cache.
+		err = chain.db.Update(func(dbTx database.Tx) error {
+			return chain.utxoCache.writeDirtyEntries(dbTx, 3, best)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = assertConsistencyState(chain, params.GenesisHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := &Config{
+			DB:               chain.db,
+			ChainParams:      params,
+			TimeSource:       NewMedianTime(),
+			UtxoCacheMaxSize: 10 * 1024 * 1024,
+		}
+		recovered, err := New(config)
+		if err != nil {
+			t.Fatalf("unable to recover the chain: %v", err)
+		}
+		err = assertConsistencyState(recovered, &best.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if num := numUtxoJournalEntries(t, chain.db); num != 0 {
+			t.Fatalf("%d utxo journal entries left", num)
+		}
+
+		for height := int32(1); height < best.Height; height++ {
+			block, err := recovered.BlockByHeight(height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks = append(blocks, block)
+		}
+		blocks = append(blocks, tip)
+		got = utxoSetOnDisk(t, chain.db)
+	}()
+	if t.Failed() {
+		return
+	}
+	assertReferenceUtxoSet(t, "TestUtxoJournalRecoveryRef", blocks, got)
+}
+
+// assertReferenceUtxoSet ensures the passed utxo set matches the one of a chain
+// that connected the passed blocks without interruption.
+func assertReferenceUtxoSet(t *testing.T, testName string,
+	blocks []*chainutil.Block, got map[string]string) {
+
+	t.Helper()
+
+	ref, _, tearDown := utxoCacheTestChain(testName)
+	defer tearDown()
+	for _, block := range blocks {
+		if _, _, err := ref.ProcessBlock(block, BFNone); err != nil {
+			t.Fatalf("unable to process block %v: %v", block.Hash(), err)
+		}
+	}
+	if err := ref.FlushUtxoCache(FlushRequired); err != nil {
+		t.Fatal(err)
+	}
+	want := utxoSetOnDisk(t, ref.db)
+	if len(want) == 0 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %d utxos, want %d matching utxos", len(got),
+			len(want))
+	}
+}
+
+// TestUtxoJournalRecoveryBetweenBatches ensures the utxo state is recovered
+// from the utxo journal after an unclean shutdown between two batches of dirty
+// entries, with a block connected in between as FlushDirtyUtxos allows.
+func TestUtxoJournalRecoveryBetweenBatches(t *testing.T) {
+	var blocks []*chainutil.Block
+	var got map[string]string
+	func() {
+		chain, params, tearDown := utxoCacheTestChain(
+			"TestUtxoJournalRecoveryBetweenBatches")
+		defer tearDown()
+		cache := chain.utxoCache
+
+		genesis := chainutil.NewBlock(params.GenesisBlock)
+		hashes, spendableOuts, err := addBlocks(10, chain, genesis,
+			[]*testhelper.SpendableOut{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parent, err := chain.BlockByHash(hashes[len(hashes)-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The first batch writes all the dirty entries but one.
+		best := chain.BestSnapshot()
+		err = chain.db.Update(func(dbTx database.Tx) error {
+			return cache.writeDirtyEntries(dbTx,
+				len(cache.dirtyEntries)-1, best)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A block spending some of the written entries is connected
+		// before the second batch, after which the node stops without
+		// writing the entries left.
+		tip, _, err := addBlock(chain, parent, spendableOuts[len(hashes)-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cache.dirtyEntries) < 2 {
+			t.Fatalf("%d dirty entries, want at least 2",
+				len(cache.dirtyEntries))
+		}
+		best = chain.BestSnapshot()
+		err = chain.db.Update(func(dbTx database.Tx) error {
+			return cache.writeDirtyEntries(dbTx, 1, best)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = assertConsistencyState(chain, params.GenesisHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if num := numUtxoJournalEntries(t, chain.db); num != int(best.Height) {
+			t.Fatalf("%d utxo journal entries, want %d", num,
+				best.Height)
+		}
+
+		config := &Config{
+			DB:               chain.db,
+			ChainParams:      params,
+			TimeSource:       NewMedianTime(),
+			UtxoCacheMaxSize: 10 * 1024 * 1024,
+		}
+		recovered, err := New(config)
+		if err != nil {
+			t.Fatalf("unable to recover the chain: %v", err)
+		}
+		err = assertConsistencyState(recovered, &best.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if num := numUtxoJournalEntries(t, chain.db); num != 0 {
+			t.Fatalf("%d utxo journal entries left", num)
+		}
+
+		for height := int32(1); height < best.Height; height++ {
+			block, err := recovered.BlockByHeight(height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks = append(blocks, block)
+		}
+		blocks = append(blocks, tip)
+		got = utxoSetOnDisk(t, chain.db)
+	}()
+	if t.Failed() {
+		return
+	}
+	assertReferenceUtxoSet(t, "TestUtxoJournalRecoveryBetweenBatchesRef",
+		blocks, got)
+}
+
+// TestFlushDirtyUtxosConcurrent ensures the dirty entries written in the
+// background by FlushDirtyUtxos, in batches interleaved with the blocks being
+// connected, leave the same utxo set as a chain that wrote them all at once.
+func TestFlushDirtyUtxosConcurrent(t *testing.T) {
+	var blocks []*chainutil.Block
+	var got map[string]string
+	func() {
+		chain, params, tearDown := utxoCacheTestChain(
+			"TestFlushDirtyUtxosConcurrent")
+		defer tearDown()
+		cache := chain.utxoCache
+
+		// Every block signals its dirty entries should be written, in
+		// batches small enough for blocks to be connected in between.
+		cache.maxDirtyEntries = 1
+		cache.flushBatchSize = 2
+
+		quit := make(chan struct{})
+		flushErr := make(chan error, 1)
+		go func() {
+			for {
+				select {
+				case <-chain.UtxoFlushSignal():
+					err := chain.FlushDirtyUtxos(quit)
+					if err != nil {
+						flushErr <- err
+						return
+					}
+
+				case <-quit:
+					flushErr <- nil
+					return
+				}
+			}
+		}()
+
+		genesis := chainutil.NewBlock(params.GenesisBlock)
+		_, _, err := addBlocks(20, chain, genesis,
+			[]*testhelper.SpendableOut{})
+		close(quit)
+		if err := <-flushErr; err != nil {
+			t.Fatalf("unable to write the dirty entries: %v", err)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The entries left dirty are written once the blocks are all
+		// connected, which leaves the utxo state consistent with the
+		// tip.
+		best := chain.BestSnapshot()
+		if err := chain.FlushDirtyUtxos(nil); err != nil {
+			t.Fatal(err)
+		}
+		if len(cache.dirtyEntries) != 0 {
+			t.Fatalf("%d dirty entries left", len(cache.dirtyEntries))
+		}
+		if err := assertConsistencyState(chain, &best.Hash); err != nil {
+			t.Fatal(err)
+		}
+		if num := numUtxoJournalEntries(t, chain.db); num != 0 {
+			t.Fatalf("%d utxo journal entries left", num)
+		}
+
+		for height := int32(1); height <= best.Height; height++ {
+			block, err := chain.BlockByHeight(height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks = append(blocks, block)
+		}
+		got = utxoSetOnDisk(t, chain.db)
+	}()
+	if t.Failed() {
+		return
+	}
+	assertReferenceUtxoSet(t, "TestFlushDirtyUtxosConcurrentRef", blocks,
+		got)
+}
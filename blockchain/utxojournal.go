@@ -0,0 +1,257 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"encoding/binary"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/database"
+	"github.com/flokiorg/go-flokicoin/txscript"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// -----------------------------------------------------------------------------
+// The utxo journal is a write-ahead journal of the changes to the utxo set made
+// by the blocks of the main chain connected since the utxo state was last
+// consistent in the database.  The entry of a block is written along with the
+// block, and the entries of the blocks whose changes were all flushed are
+// removed.  This allows the utxo cache to be recovered from the journal after
+// an unclean shutdown, including while its dirty entries were being written in
+// several database transactions.
+//
+// The key is the height of the block serialized as a big-endian uint32 so the
+// entries are iterated in order.  The serialized format for the values is:
+//
+//   <block hash><num changes><change 1><change 2>...
+//
+//   Field          Type             Size
+//   block hash     chainhash.Hash   chainhash.HashSize
+//   num changes    VLQ              variable
+//   changes        []utxoChange     variable
+//
+// The serialized format for each change is:
+//
+//   <tx hash><output index><entry size><entry>
+//
+//   Field          Type             Size
+//   tx hash        chainhash.Hash   chainhash.HashSize
+//   output index   VLQ              variable
+//   entry size     VLQ              variable
+//   entry          []byte           entry size
+//
+// The entry uses the format of the utxo set entries, and is empty for a spent
+// output.  The changes are in the order they are made by the block.
+// -----------------------------------------------------------------------------
+
+// utxoChange is a change to the utxo set recorded in the utxo journal.  The
+// entry is nil for a spent output.
+type utxoChange struct {
+	outpoint wire.OutPoint
+	entry    *UtxoEntry
+}
+
+// blockUtxoChanges returns the changes to the utxo set made by the passed block
+// in order, which are the outputs it spends and the outputs it creates that
+// are not provably unspendable.
+func blockUtxoChanges(block *chainutil.Block) []utxoChange {
+	var changes []utxoChange
+	for _, tx := range block.Transactions() {
+		isCoinBase := IsCoinBase(tx)
+		if !isCoinBase {
+			for _, txIn := range tx.MsgTx().TxIn {
+				changes = append(changes, utxoChange{
+					outpoint: txIn.PreviousOutPoint,
+				})
+			}
+		}
+
+		prevOut := wire.OutPoint{Hash: *tx.Hash()}
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+
+			prevOut.Index = uint32(txOutIdx)
+			entry := &UtxoEntry{
+				amount:      txOut.Value,
+				pkScript:    txOut.PkScript,
+				blockHeight: block.Height(),
+			}
+			if isCoinBase {
+				entry.packedFlags = tfCoinBase
+			}
+			changes = append(changes, utxoChange{
+				outpoint: prevOut,
+				entry:    entry,
+			})
+		}
+	}
+	return changes
+}
+
+// serializeUtxoJournalEntry returns the journal entry of the block with the
+// passed hash and changes to the utxo set, serialized to the format described
+// above.
+func serializeUtxoJournalEntry(hash *chainhash.Hash, changes []utxoChange) ([]byte, error) {
+	serializedEntries := make([][]byte, len(changes))
+	size := chainhash.HashSize + serializeSizeVLQ(uint64(len(changes)))
+	for i, change := range changes {
+		if change.entry != nil {
+			serialized, err := serializeUtxoEntry(change.entry)
+			if err != nil {
+				return nil, err
+			}
+			serializedEntries[i] = serialized
+		}
+
+		entrySize := uint64(len(serializedEntries[i]))
+		size += chainhash.HashSize +
+			serializeSizeVLQ(uint64(change.outpoint.Index)) +
+			serializeSizeVLQ(entrySize) + int(entrySize)
+	}
+
+	serialized := make([]byte, size)
+	offset := copy(serialized, hash[:])
+	offset += putVLQ(serialized[offset:], uint64(len(changes)))
+	for i, change := range changes {
+		offset += copy(serialized[offset:], change.outpoint.Hash[:])
+		offset += putVLQ(serialized[offset:], uint64(change.outpoint.Index))
+		offset += putVLQ(serialized[offset:],
+			uint64(len(serializedEntries[i])))
+		offset += copy(serialized[offset:], serializedEntries[i])
+	}
+	return serialized, nil
+}
+
+// deserializeUtxoJournalEntry decodes the block hash and the changes to the
+// utxo set of the passed serialized journal entry.
+func deserializeUtxoJournalEntry(serialized []byte) (*chainhash.Hash, []utxoChange, error) {
+	if len(serialized) < chainhash.HashSize {
+		return nil, nil, errDeserialize("unexpected end of data for " +
+			"the block hash")
+	}
+	var hash chainhash.Hash
+	copy(hash[:], serialized)
+	offset := chainhash.HashSize
+
+	numChanges, bytesRead := deserializeVLQ(serialized[offset:])
+	offset += bytesRead
+	if bytesRead == 0 {
+		return nil, nil, errDeserialize("unexpected end of data for " +
+			"the number of changes")
+	}
+
+	// Each change takes at least the size of a hash and two bytes.
+	if numChanges > uint64(len(serialized)-offset)/(chainhash.HashSize+2) {
+		return nil, nil, errDeserialize("too many changes for the " +
+			"size of the data")
+	}
+	changes := make([]utxoChange, numChanges)
+	for i := range changes {
+		change := &changes[i]
+		if len(serialized[offset:]) < chainhash.HashSize {
+			return nil, nil, errDeserialize("unexpected end of " +
+				"data for the tx hash of a change")
+		}
+		copy(change.outpoint.Hash[:], serialized[offset:])
+		offset += chainhash.HashSize
+
+		index, bytesRead := deserializeVLQ(serialized[offset:])
+		offset += bytesRead
+		entrySize, sizeBytesRead := deserializeVLQ(serialized[offset:])
+		offset += sizeBytesRead
+		if bytesRead == 0 || sizeBytesRead == 0 ||
+			entrySize > uint64(len(serialized)-offset) {
+
+			return nil, nil, errDeserialize("unexpected end of " +
+				"data for a change")
+		}
+		change.outpoint.Index = uint32(index)
+		if entrySize == 0 {
+			continue
+		}
+
+		entry, err := deserializeUtxoEntry(
+			serialized[offset : offset+int(entrySize)])
+		if err != nil {
+			return nil, nil, err
+		}
+		change.entry = entry
+		offset += int(entrySize)
+	}
+	return &hash, changes, nil
+}
+
+// utxoJournalKey returns the key of the journal entry of the block at the
+// passed height.
+func utxoJournalKey(height int32) []byte {
+	var key [4]byte
+	binary.BigEndian.PutUint32(key[:], uint32(height))
+	return key[:]
+}
+
+// dbPutUtxoJournalEntry uses an existing database transaction to add the
+// journal entry with the changes to the utxo set made by the passed block.
+func dbPutUtxoJournalEntry(dbTx database.Tx, node *blockNode, block *chainutil.Block) error {
+	serialized, err := serializeUtxoJournalEntry(&node.hash,
+		blockUtxoChanges(block))
+	if err != nil {
+		return err
+	}
+	bucket := dbTx.Metadata().Bucket(utxoJournalBucketName)
+	return bucket.Put(utxoJournalKey(node.height), serialized)
+}
+
+// dbFetchUtxoJournalEntry uses an existing database transaction to retrieve
+// the changes to the utxo set made by the passed block from its journal entry.
+// It returns false when the journal doesn't have an entry for the block.
+func dbFetchUtxoJournalEntry(dbTx database.Tx, node *blockNode) ([]utxoChange, bool, error) {
+	bucket := dbTx.Metadata().Bucket(utxoJournalBucketName)
+	if bucket == nil {
+		return nil, false, nil
+	}
+	serialized := bucket.Get(utxoJournalKey(node.height))
+	if serialized == nil {
+		return nil, false, nil
+	}
+
+	hash, changes, err := deserializeUtxoJournalEntry(serialized)
+	if err != nil {
+		return nil, false, err
+	}
+	if *hash != node.hash {
+		return nil, false, nil
+	}
+	return changes, true, nil
+}
+
+// dbRemoveUtxoJournalEntry uses an existing database transaction to remove the
+// journal entry of the block at the passed height.
+func dbRemoveUtxoJournalEntry(dbTx database.Tx, height int32) error {
+	bucket := dbTx.Metadata().Bucket(utxoJournalBucketName)
+	return bucket.Delete(utxoJournalKey(height))
+}
+
+// dbPruneUtxoJournal uses an existing database transaction to remove the
+// journal entries of the blocks up to and including the passed height, whose
+// changes are all in the utxo set of the database.
+func dbPruneUtxoJournal(dbTx database.Tx, height int32) error {
+	bucket := dbTx.Metadata().Bucket(utxoJournalBucketName)
+	if bucket == nil {
+		return nil
+	}
+	cursor := bucket.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		if int32(binary.BigEndian.Uint32(cursor.Key())) > height {
+			break
+		}
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -54,6 +54,12 @@ const (
 	// block of a difficulty adjustment period is allowed to
 	// be earlier than the last block of the previous period (BIP94).
 	maxTimeWarp = 600 * time.Second
+
+	// assumeValidMinBurial is the minimum amount of time, measured in the
+	// proof of work of blocks at the difficulty of the best header, the
+	// assumed valid block must be buried under in the best header chain
+	// for the scripts of its ancestors to be skipped.
+	assumeValidMinBurial = 14 * 24 * time.Hour
 )
 
 var (
@@ -406,10 +412,62 @@ func checkAuxpowPolicy(header *wire.BlockHeader, height int32, params *chaincfg.
 		// Parent block in auxpow must not have the same chain ID as the child.
 		if header.AuxPow() {
 			if header.AuxPowHeader != nil && header.AuxPowHeader.ParentBlockHeader.GetChainID() == chainID {
-				return ruleError(ErrAuxpowNotAllowed, "Aux POW parent has our chain ID")
+				return ruleError(ErrAuxpowParentHasOurChainID, "Aux POW parent has our chain ID")
 			}
 		}
 	}
+
+	if header.AuxPow() && header.AuxPowHeader != nil {
+		if err := checkAuxpowParentPolicy(header.AuxPowHeader, params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAuxpowParentPolicy ensures the parent chain data embedded in an AuxPoW
+// header satisfies the parent-chain limits configured in the network
+// parameters.  The structural limits enforced by wire.AuxPowHeader.Check act
+// as an upper bound for the configurable ones.
+func checkAuxpowParentPolicy(aph *wire.AuxPowHeader, params *chaincfg.Params) error {
+	parentChainID := aph.ParentBlockHeader.GetChainID()
+	if len(params.AuxpowAllowedParentChainIds) > 0 {
+		allowed := false
+		for _, id := range params.AuxpowAllowedParentChainIds {
+			if id == parentChainID {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			str := fmt.Sprintf("aux POW parent chain ID %d is not "+
+				"an allowed parent chain (allowed: %v)",
+				parentChainID, params.AuxpowAllowedParentChainIds)
+			return ruleError(ErrAuxpowParentChainNotAllowed, str)
+		}
+	}
+
+	maxCoinbaseSize := params.AuxpowMaxCoinbaseTxSize
+	if maxCoinbaseSize <= 0 || maxCoinbaseSize > wire.MaxCoinbaseTxSize {
+		maxCoinbaseSize = wire.MaxCoinbaseTxSize
+	}
+	if size := aph.CoinbaseTx.SerializeSize(); size > maxCoinbaseSize {
+		str := fmt.Sprintf("aux POW parent coinbase size of %d bytes "+
+			"exceeds the max allowed size of %d", size, maxCoinbaseSize)
+		return ruleError(ErrAuxpowCoinbaseTooLarge, str)
+	}
+
+	maxMerkleHeight := params.AuxpowMaxChainMerkleHeight
+	if maxMerkleHeight == 0 || maxMerkleHeight > wire.MaxChainBranchHashes {
+		maxMerkleHeight = wire.MaxChainBranchHashes
+	}
+	if height := aph.BlockChainBranch.Size(); height > uint(maxMerkleHeight) {
+		str := fmt.Sprintf("aux POW chain merkle branch height of %d "+
+			"exceeds the max allowed height of %d", height,
+			maxMerkleHeight)
+		return ruleError(ErrAuxpowChainMerkleTooHigh, str)
+	}
+
 	return nil
 }
 
@@ -1115,6 +1173,36 @@ func CheckTransactionInputs(tx *chainutil.Tx, txHeight int32, utxoView *UtxoView
 	return txFeeInLoki, nil
 }
 
+// isAssumedValid returns whether the scripts of the block of the passed node
+// are assumed to be valid, which is the case when it's the assumed valid block
+// or one of its ancestors and the assumed valid block is buried under at least
+// assumeValidMinBurial worth of work in the best header chain.  All of the
+// other consensus rules are still checked for such blocks.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) isAssumedValid(node *blockNode) bool {
+	if b.assumeValid == nil {
+		return false
+	}
+	assumed := b.index.LookupNode(b.assumeValid)
+	if assumed == nil || assumed.Ancestor(node.height) != node {
+		return false
+	}
+	best := b.bestHeaderNode()
+	if best.Ancestor(assumed.height) != assumed {
+		return false
+	}
+
+	// Convert the work on top of the assumed valid block to the time it
+	// takes to produce at the difficulty of the best header, which can't
+	// be faked without spending that much work.
+	work := new(big.Int).Sub(best.workSum, assumed.workSum)
+	work.Mul(work, big.NewInt(int64(b.chainParams.TargetTimePerBlock/time.Second)))
+	work.Div(work, CalcWork(best.bits))
+	minBurial := big.NewInt(int64(assumeValidMinBurial / time.Second))
+	return work.Cmp(minBurial) >= 0
+}
+
 // checkConnectBlock performs several checks to confirm connecting the passed
 // block to the chain represented by the passed view does not violate any rules.
 // In addition, the passed view is updated to spend all of the referenced
@@ -1296,11 +1384,15 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *chainutil.Block,
 	// transactions are included in the merkle root hash and any changes
 	// will therefore be detected by the next checkpoint).  This is a huge
 	// optimization because running the scripts is the most time consuming
-	// portion of block handling.
+	// portion of block handling.  The scripts aren't run either for the
+	// assumed valid block and its ancestors, which the whole network has
+	// accepted long ago once it's buried deep enough.
 	checkpoint := b.LatestCheckpoint()
 	runScripts := true
 	if checkpoint != nil && node.height <= checkpoint.Height {
 		runScripts = false
+	} else if b.isAssumedValid(node) {
+		runScripts = false
 	}
 
 	// Blocks created after the BIP0016 activation time need to have the
@@ -6,6 +6,7 @@
 package blockchain
 
 import (
+	"encoding/binary"
 	"math"
 	"math/big"
 	"reflect"
@@ -15,6 +16,7 @@ import (
 	"github.com/flokiorg/go-flokicoin/chaincfg"
 	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
 	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/txscript"
 	"github.com/flokiorg/go-flokicoin/wire"
 )
 
@@ -577,3 +579,276 @@ var Block100000 = wire.MsgBlock{
 		},
 	},
 }
+
+// auxpowChainIndex mirrors the pseudo-random slot selection used by merged
+// mining to place a chain within the chain merkle tree.
+func auxpowChainIndex(nonce uint32, chainID int32, height uint32) uint32 {
+	rand := nonce
+	rand = rand*1103515245 + 12345
+	rand += uint32(chainID)
+	rand = rand*1103515245 + 12345
+	return rand % (1 << height)
+}
+
+// attachAuxPow turns the passed block into a merged-mined block by attaching
+// an AuxPoW header whose parent block carries the provided chain ID.  The
+// chain merkle branch is padded to the requested height and the parent
+// coinbase signature script is padded with extra bytes when requested.  The
+// parent header is solved against the target of the child block.
+func attachAuxPow(t *testing.T, block *wire.MsgBlock, chainID, parentChainID int32,
+	merkleHeight uint32, coinbasePad int) *chainutil.Block {
+
+	t.Helper()
+
+	header := &block.Header
+	header.SetAuxPow(true)
+	header.SetChainID(chainID)
+	childHash := header.BlockHash()
+
+	// Build the chain merkle branch placing the child at the slot expected
+	// for its chain ID.
+	const mmNonce = uint32(7)
+	branch := wire.MerkleBranch{
+		Hashes:   make([]chainhash.Hash, merkleHeight),
+		SideMask: auxpowChainIndex(mmNonce, chainID, merkleHeight),
+	}
+	for i := range branch.Hashes {
+		branch.Hashes[i][0] = byte(i + 1)
+	}
+	root, err := branch.DetermineRoot(&childHash)
+	if err != nil {
+		t.Fatalf("unable to determine chain merkle root: %v", err)
+	}
+	for i, j := 0, len(root)-1; i < j; i, j = i+1, j-1 {
+		root[i], root[j] = root[j], root[i]
+	}
+
+	// The parent coinbase commits to the chain merkle root followed by the
+	// merkle tree size and nonce.
+	var params [8]byte
+	binary.LittleEndian.PutUint32(params[0:4], 1<<merkleHeight)
+	binary.LittleEndian.PutUint32(params[4:8], mmNonce)
+	script := make([]byte, 0, len(wire.PchMergedMiningHeader)+
+		chainhash.HashSize+len(params)+coinbasePad)
+	script = append(script, wire.PchMergedMiningHeader...)
+	script = append(script, root[:]...)
+	script = append(script, params[:]...)
+	script = append(script, make([]byte, coinbasePad)...)
+
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		SignatureScript: script,
+		Sequence:        wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+
+	aph := &wire.AuxPowHeader{
+		CoinbaseTx:       *coinbase,
+		BlockChainBranch: branch,
+		ParentBlockHeader: wire.ParentAuxPowHeader{
+			Version:    parentChainID<<16 | 1,
+			MerkleRoot: coinbase.TxHash(),
+			Timestamp:  header.Timestamp,
+			Bits:       header.Bits,
+		},
+	}
+
+	// Grind the parent nonce until the parent satisfies the child target.
+	target := CompactToBig(header.Bits)
+	for {
+		hash := aph.ParentBlockHeader.BlockPoWHash()
+		if HashToBig(&hash).Cmp(target) <= 0 {
+			break
+		}
+		aph.ParentBlockHeader.Nonce++
+	}
+	header.AuxPowHeader = aph
+
+	return chainutil.NewBlock(block)
+}
+
+// TestAuxpowParentPolicy ensures merged-mined blocks violating the AuxPoW
+// parent chain policy configured in the chain parameters are rejected with
+// distinct error codes while conforming blocks are accepted.
+func TestAuxpowParentPolicy(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.AuxpowHeightEffective = 1
+	params.AuxpowAllowedParentChainIds = []int32{0, 0x05}
+	params.AuxpowMaxCoinbaseTxSize = 500
+	params.AuxpowMaxChainMerkleHeight = 2
+
+	chain, teardownFunc, err := chainSetup("auxpowparentpolicy", &params)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	chainID := params.AuxpowChainId
+	genesis := chainutil.NewBlock(params.GenesisBlock)
+
+	tests := []struct {
+		name          string
+		parentChainID int32
+		merkleHeight  uint32
+		coinbasePad   int
+		accept        bool
+		wantCode      ErrorCode
+	}{{
+		name:          "parent has our chain id",
+		parentChainID: chainID,
+		wantCode:      ErrAuxpowParentHasOurChainID,
+	}, {
+		name:          "parent chain not allowed",
+		parentChainID: 0x07,
+		wantCode:      ErrAuxpowParentChainNotAllowed,
+	}, {
+		name:          "parent coinbase too large",
+		parentChainID: 0x05,
+		coinbasePad:   1000,
+		wantCode:      ErrAuxpowCoinbaseTooLarge,
+	}, {
+		name:          "chain merkle branch too high",
+		parentChainID: 0,
+		merkleHeight:  3,
+		wantCode:      ErrAuxpowChainMerkleTooHigh,
+	}, {
+		name:          "allowed parent within limits",
+		parentChainID: 0x05,
+		merkleHeight:  2,
+		coinbasePad:   100,
+		accept:        true,
+	}}
+
+	for _, test := range tests {
+		template, _, err := newBlock(chain, genesis, nil)
+		if err != nil {
+			t.Fatalf("%s: unable to create block: %v", test.name, err)
+		}
+		msgBlock := template.MsgBlock()
+		msgBlock.Header.Version = 4
+		msgBlock.Header.Nonce = 0
+		block := attachAuxPow(t, msgBlock, chainID, test.parentChainID,
+			test.merkleHeight, test.coinbasePad)
+		block.SetHeight(1)
+
+		_, _, err = chain.ProcessBlock(block, BFNone)
+		if test.accept {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+
+		rerr, ok := err.(RuleError)
+		if !ok {
+			t.Fatalf("%s: unexpected error type -- got %T (%v), "+
+				"want RuleError", test.name, err, err)
+		}
+		if rerr.ErrorCode != test.wantCode {
+			t.Fatalf("%s: unexpected error code -- got %v, want %v",
+				test.name, rerr.ErrorCode, test.wantCode)
+		}
+	}
+}
+
+// TestIsAssumedValid ensures the scripts of a block are only assumed to be
+// valid when it's the assumed valid block or one of its ancestors, and the
+// assumed valid block is buried deep enough in the best header chain.
+func TestIsAssumedValid(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain := newFakeChain(params)
+
+	// Create a chain long enough to bury a block under the min amount of
+	// work, along with a side chain forking from it.
+	burialBlocks := int32(assumeValidMinBurial / params.TargetTimePerBlock)
+	node := chain.bestChain.Tip()
+	blockTime := node.Header().Timestamp
+	nodes := []*blockNode{node}
+	for i := int32(0); i < burialBlocks+100; i++ {
+		blockTime = blockTime.Add(params.TargetTimePerBlock)
+		node = newFakeNode(node, 1, params.PowLimitBits, blockTime)
+		chain.index.AddNode(node)
+		nodes = append(nodes, node)
+	}
+	sideNode := nodes[10]
+	var sideNodes []*blockNode
+	for i := 0; i < 20; i++ {
+		sideNode = newFakeNode(sideNode, 2, params.PowLimitBits,
+			sideNode.Header().Timestamp.Add(time.Second))
+		chain.index.AddNode(sideNode)
+		sideNodes = append(sideNodes, sideNode)
+	}
+	unknownHash := chainhash.Hash{0x01}
+
+	tests := []struct {
+		name        string
+		assumeValid *chainhash.Hash
+		bestHeader  *blockNode
+		node        *blockNode
+		want        bool
+	}{{
+		name:       "no assumed valid block",
+		bestHeader: nodes[len(nodes)-1],
+		node:       nodes[20],
+		want:       false,
+	}, {
+		name:        "unknown assumed valid block",
+		assumeValid: &unknownHash,
+		bestHeader:  nodes[len(nodes)-1],
+		node:        nodes[20],
+		want:        false,
+	}, {
+		name:        "ancestor of buried assumed valid block",
+		assumeValid: &nodes[30].hash,
+		bestHeader:  nodes[len(nodes)-1],
+		node:        nodes[20],
+		want:        true,
+	}, {
+		name:        "buried assumed valid block",
+		assumeValid: &nodes[30].hash,
+		bestHeader:  nodes[len(nodes)-1],
+		node:        nodes[30],
+		want:        true,
+	}, {
+		name:        "descendant of assumed valid block",
+		assumeValid: &nodes[30].hash,
+		bestHeader:  nodes[len(nodes)-1],
+		node:        nodes[31],
+		want:        false,
+	}, {
+		name:        "side chain block",
+		assumeValid: &nodes[30].hash,
+		bestHeader:  nodes[len(nodes)-1],
+		node:        sideNodes[9],
+		want:        false,
+	}, {
+		name:        "exactly buried assumed valid block",
+		assumeValid: &nodes[30].hash,
+		bestHeader:  nodes[30+burialBlocks],
+		node:        nodes[20],
+		want:        true,
+	}, {
+		name:        "not buried deep enough",
+		assumeValid: &nodes[30].hash,
+		bestHeader:  nodes[30+burialBlocks-1],
+		node:        nodes[20],
+		want:        false,
+	}, {
+		name:        "assumed valid block not in best header chain",
+		assumeValid: &sideNodes[19].hash,
+		bestHeader:  nodes[len(nodes)-1],
+		node:        sideNodes[9],
+		want:        false,
+	}}
+
+	for _, test := range tests {
+		chain.assumeValid = test.assumeValid
+		chain.bestHeader = test.bestHeader
+		got := chain.isAssumedValid(test.node)
+		if got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
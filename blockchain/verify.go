@@ -0,0 +1,324 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/database"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// VerifyLevel identifies how thorough the checks done by VerifyChain are.  Each
+// level also does the checks of the levels below it.
+type VerifyLevel int32
+
+const (
+	// VerifyLevelRead ensures each block can be loaded from the database.
+	VerifyLevelRead VerifyLevel = iota
+
+	// VerifyLevelSanity performs the context-free sanity checks on each
+	// block.
+	VerifyLevelSanity
+
+	// VerifyLevelUndo ensures the spend journal entry of each block can be
+	// loaded from the database and matches the inputs of the block.
+	VerifyLevelUndo
+
+	// VerifyLevelDisconnect disconnects the blocks from a view of the UTXO
+	// set in memory, using their spend journal entries.
+	VerifyLevelDisconnect
+
+	// VerifyLevelReconnect connects the disconnected blocks again with full
+	// validation, and ensures the resulting view matches the UTXO set.
+	VerifyLevelReconnect
+
+	// MaxVerifyLevel is the most thorough level of checks.
+	MaxVerifyLevel = VerifyLevelReconnect
+)
+
+// String returns the VerifyLevel as a human-readable name.
+func (l VerifyLevel) String() string {
+	switch l {
+	case VerifyLevelRead:
+		return "read"
+	case VerifyLevelSanity:
+		return "sanity"
+	case VerifyLevelUndo:
+		return "undo"
+	case VerifyLevelDisconnect:
+		return "disconnect"
+	case VerifyLevelReconnect:
+		return "reconnect"
+	}
+	return fmt.Sprintf("unknown level %d", int32(l))
+}
+
+// VerifyError identifies the block that failed the checks of VerifyChain, the
+// level of the failed check, and why it failed.
+type VerifyError struct {
+	Hash   chainhash.Hash
+	Height int32
+	Level  VerifyLevel
+	Err    error
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("block %v (height %d) failed the %v check: %v",
+		e.Hash, e.Height, e.Level, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// verifyError creates a VerifyError for the passed block node.
+func verifyError(node *blockNode, level VerifyLevel, err error) *VerifyError {
+	return &VerifyError{
+		Hash:   node.hash,
+		Height: node.height,
+		Level:  level,
+		Err:    err,
+	}
+}
+
+// viewEntriesMemoryUsage returns the memory used by the entries of the view for
+// the outputs created and spent by the passed block.  The entries of the
+// outputs created and spent within the disconnected blocks are counted twice,
+// which overestimates the memory used by the view.
+func viewEntriesMemoryUsage(view *UtxoViewpoint, block *chainutil.Block) uint64 {
+	var size uint64
+	for txIdx, tx := range block.Transactions() {
+		prevOut := wire.OutPoint{Hash: *tx.Hash()}
+		for txOutIdx := range tx.MsgTx().TxOut {
+			prevOut.Index = uint32(txOutIdx)
+			size += view.entries[prevOut].memoryUsage()
+		}
+		if txIdx == 0 {
+			continue
+		}
+		for _, txIn := range tx.MsgTx().TxIn {
+			size += view.entries[txIn.PreviousOutPoint].memoryUsage()
+		}
+	}
+	return size
+}
+
+// compareUtxoView ensures the entries of the passed view match the entries of
+// the UTXO cache.  The view must be for the tip of the main chain.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) compareUtxoView(view *UtxoViewpoint) error {
+	outpoints := make([]wire.OutPoint, 0, len(view.entries))
+	for outpoint := range view.entries {
+		outpoints = append(outpoints, outpoint)
+	}
+	entries, err := b.utxoCache.fetchEntries(outpoints)
+	if err != nil {
+		return err
+	}
+
+	for i, outpoint := range outpoints {
+		viewEntry, entry := view.entries[outpoint], entries[i]
+		viewSpent := viewEntry == nil || viewEntry.IsSpent()
+		spent := entry == nil || entry.IsSpent()
+		switch {
+		case viewSpent && spent:
+			continue
+
+		case viewSpent:
+			return fmt.Errorf("output %v is in the UTXO set but "+
+				"is spent after reconnecting the blocks",
+				outpoint)
+
+		case spent:
+			return fmt.Errorf("output %v is missing from the "+
+				"UTXO set", outpoint)
+		}
+
+		if viewEntry.Amount() != entry.Amount() ||
+			!bytes.Equal(viewEntry.PkScript(), entry.PkScript()) ||
+			viewEntry.BlockHeight() != entry.BlockHeight() ||
+			viewEntry.IsCoinBase() != entry.IsCoinBase() {
+
+			return fmt.Errorf("output %v of the UTXO set does not "+
+				"match the output created by its block",
+				outpoint)
+		}
+	}
+	return nil
+}
+
+// VerifyChain checks the blocks of the main chain down from its tip, up to the
+// passed number of blocks, or all the blocks when it's not positive.  The level
+// selects the checks done for each block, and levels above MaxVerifyLevel are
+// clamped to it.  The blocks are only disconnected and reconnected while their
+// view of the UTXO set fits in the memory left by the UTXO cache, and the
+// blocks that are not stored, because they were pruned or come before the base
+// of a UTXO set snapshot, are not checked.
+//
+// It returns the number of blocks checked, and a VerifyError for the first
+// block that failed a check.  The checks are stopped early when the interrupt
+// channel is closed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) VerifyChain(level VerifyLevel, depth int32, interrupt <-chan struct{}) (int32, error) {
+	// The chain can't change while its blocks are disconnected from the
+	// view of the UTXO set.
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if level > MaxVerifyLevel {
+		level = MaxVerifyLevel
+	}
+	tip := b.bestChain.Tip()
+	if depth <= 0 || depth > tip.height {
+		depth = tip.height
+	}
+	stopHeight := tip.height - depth
+	if b.snapshotBase != nil && stopHeight < b.snapshotBase.height {
+		stopHeight = b.snapshotBase.height
+	}
+
+	var pruned bool
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		pruned, err = dbTx.BeenPruned()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	log.Infof("Verifying %d blocks at level %d (%v)", tip.height-stopHeight,
+		level, level)
+
+	// Walk the main chain down from its tip, disconnecting the blocks from
+	// a view of the UTXO set as long as it fits in memory.
+	view := NewUtxoViewpoint()
+	view.SetBestHash(&tip.hash)
+	var viewSize uint64
+	var disconnected []*chainutil.Block
+	disconnecting := level >= VerifyLevelDisconnect
+	var numChecked int32
+	for node := tip; node.height > stopHeight; node = node.parent {
+		if interruptRequested(interrupt) {
+			return numChecked, errInterruptRequested
+		}
+
+		// Level 0 loads the block, unless it was pruned.
+		var block *chainutil.Block
+		var stored bool
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			stored, err = dbTx.HasBlock(&node.hash)
+			if err != nil || !stored {
+				return err
+			}
+			block, err = dbFetchBlockByNode(dbTx, node)
+			return err
+		})
+		if err == nil && !stored {
+			if pruned {
+				log.Infof("Stopping the verification at height "+
+					"%d since the blocks from there were "+
+					"pruned", node.height)
+				break
+			}
+			err = errors.New("block is not stored")
+		}
+		if err != nil {
+			return numChecked, verifyError(node, VerifyLevelRead, err)
+		}
+
+		// Level 1 performs the context-free sanity checks.
+		if level >= VerifyLevelSanity {
+			err := checkBlockSanity(block, b.chainParams.PowLimit,
+				b.timeSource, BFNone)
+			if err != nil {
+				return numChecked, verifyError(node,
+					VerifyLevelSanity, err)
+			}
+		}
+
+		// Level 2 loads the spend journal entry of the block.
+		var stxos []SpentTxOut
+		if level >= VerifyLevelUndo {
+			err := b.db.View(func(dbTx database.Tx) error {
+				var err error
+				stxos, err = dbFetchSpendJournalEntry(dbTx, block)
+				return err
+			})
+			if err == nil && len(stxos) != countSpentOutputs(block) {
+				err = fmt.Errorf("spend journal entry has %d "+
+					"spent outputs instead of %d", len(stxos),
+					countSpentOutputs(block))
+			}
+			if err != nil {
+				return numChecked, verifyError(node,
+					VerifyLevelUndo, err)
+			}
+		}
+
+		// Level 3 disconnects the block from the view.
+		if disconnecting {
+			maxSize := b.utxoCache.maxTotalMemoryUsage
+			if viewSize+b.utxoCache.totalMemoryUsage() > maxSize {
+				log.Infof("Stopping the disconnection of the "+
+					"blocks at height %d since the UTXO set "+
+					"view doesn't fit in memory", node.height)
+				disconnecting = false
+			}
+		}
+		if disconnecting {
+			err := view.fetchInputUtxos(b.utxoCache, block)
+			if err == nil {
+				err = view.disconnectTransactions(b.db, block,
+					stxos)
+			}
+			if err != nil {
+				return numChecked, verifyError(node,
+					VerifyLevelDisconnect, err)
+			}
+			viewSize += viewEntriesMemoryUsage(view, block)
+			disconnected = append(disconnected, block)
+		}
+
+		numChecked++
+	}
+
+	// Level 4 connects the disconnected blocks again, from the oldest one,
+	// and then ensures the view matches the UTXO set at the tip.
+	if level >= VerifyLevelReconnect && len(disconnected) > 0 {
+		for i := len(disconnected) - 1; i >= 0; i-- {
+			if interruptRequested(interrupt) {
+				return numChecked, errInterruptRequested
+			}
+
+			block := disconnected[i]
+			node := b.index.LookupNode(block.Hash())
+			block.SetHeight(node.height)
+			err := b.checkConnectBlock(node, block, view, nil)
+			if err != nil {
+				return numChecked, verifyError(node,
+					VerifyLevelReconnect, err)
+			}
+		}
+		if err := b.compareUtxoView(view); err != nil {
+			return numChecked, verifyError(tip,
+				VerifyLevelReconnect, err)
+		}
+	}
+
+	log.Infof("Verified %d blocks at level %d (%v)", numChecked, level,
+		level)
+	return numChecked, nil
+}
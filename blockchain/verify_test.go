@@ -0,0 +1,91 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/flokiorg/go-flokicoin/blockchain/internal/testhelper"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/database"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// TestVerifyChain ensures VerifyChain checks the requested number of blocks and
+// reports the first block that fails the checks of the requested level.
+func TestVerifyChain(t *testing.T) {
+	chain, params, tearDown := utxoCacheTestChain("TestVerifyChain")
+	defer tearDown()
+
+	// Create a chain whose tip spends the outputs of its parent.
+	genesis := chainutil.NewBlock(params.GenesisBlock)
+	hashes, spendableOuts, err := addBlocks(10, chain, genesis,
+		[]*testhelper.SpendableOut{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, err := chain.BlockByHash(hashes[len(hashes)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip, _, err := addBlock(chain, parent, spendableOuts[len(hashes)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countSpentOutputs(tip) == 0 {
+		t.Fatal("the tip doesn't spend any output")
+	}
+
+	// The whole chain and the last blocks are verified at every level.
+	for level := VerifyLevelRead; level <= MaxVerifyLevel+1; level++ {
+		numChecked, err := chain.VerifyChain(level, 0, nil)
+		if err != nil || numChecked != 11 {
+			t.Fatalf("level %v: checked %d blocks: %v", level,
+				numChecked, err)
+		}
+	}
+	numChecked, err := chain.VerifyChain(MaxVerifyLevel, 3, nil)
+	if err != nil || numChecked != 3 {
+		t.Fatalf("checked %d blocks: %v", numChecked, err)
+	}
+
+	// An output of the UTXO set that doesn't match the output created by
+	// its block is only detected once the blocks are reconnected.
+	outpoint := wire.OutPoint{Hash: *tip.Transactions()[0].Hash()}
+	entry, err := chain.FetchUtxoEntry(outpoint)
+	if err != nil || entry == nil {
+		t.Fatalf("unable to fetch the tip coinbase output: %v", err)
+	}
+	entry.amount++
+	if _, err := chain.VerifyChain(VerifyLevelDisconnect, 0, nil); err != nil {
+		t.Fatalf("unexpected disconnect failure: %v", err)
+	}
+	_, err = chain.VerifyChain(VerifyLevelReconnect, 0, nil)
+	var verifyErr *VerifyError
+	if !errors.As(err, &verifyErr) || verifyErr.Level != VerifyLevelReconnect ||
+		verifyErr.Hash != *tip.Hash() {
+
+		t.Fatalf("unexpected reconnect failure: %v", err)
+	}
+	entry.amount--
+
+	// A missing spend journal entry is reported for its block.
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		return dbRemoveSpendJournalEntry(dbTx, tip.Hash())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.VerifyChain(VerifyLevelSanity, 0, nil); err != nil {
+		t.Fatalf("unexpected sanity failure: %v", err)
+	}
+	_, err = chain.VerifyChain(VerifyLevelUndo, 0, nil)
+	if !errors.As(err, &verifyErr) || verifyErr.Level != VerifyLevelUndo ||
+		verifyErr.Hash != *tip.Hash() || verifyErr.Height != 11 {
+
+		t.Fatalf("unexpected undo failure: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/msgcapture"
+	"github.com/flokiorg/go-flokicoin/peer"
+)
+
+// captureDirname is the name of the directory in the data directory that holds
+// the messages captured with --capturemessages.
+const captureDirname = "capture"
+
+// messageCapture writes the messages exchanged with a peer to a file in the
+// capture directory named after the address of the peer.  Each message is
+// appended as a record in the format of the msgcapture package, with the
+// payload exactly as it was exchanged on the wire.  The cmd/msgdump utility
+// decodes the files.
+type messageCapture struct {
+	mtx  sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+
+	// failed is set once the file could not be opened or written, after
+	// which nothing is captured anymore for the peer.
+	failed bool
+}
+
+// captureFilename returns the name of the capture file for the passed peer
+// address, with the characters that aren't safe in file names replaced.
+func captureFilename(addr string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, addr)
+	return name + ".dat"
+}
+
+// write appends the passed raw wire message, header included, received from
+// or sent to the peer to the capture file, which is created on the first
+// message.  The bytes read before a failure that don't hold a whole message
+// header are not captured.
+//
+// This function is safe for concurrent access.
+func (c *messageCapture) write(p *peer.Peer, sent bool, raw []byte) {
+	rec, ok := msgcapture.RecordFromRaw(time.Now(), sent, raw)
+	if !ok {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.failed {
+		return
+	}
+	if c.file == nil {
+		dir := filepath.Join(cfg.DataDir, captureDirname)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			srvrLog.Errorf("Unable to create capture directory: %v", err)
+			c.failed = true
+			return
+		}
+		path := filepath.Join(dir, captureFilename(p.Addr()))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|
+			os.O_WRONLY, 0600)
+		if err != nil {
+			srvrLog.Errorf("Unable to open capture file: %v", err)
+			c.failed = true
+			return
+		}
+		c.file = file
+		c.w = bufio.NewWriter(file)
+	}
+
+	err := msgcapture.WriteRecord(c.w, rec)
+	if err == nil {
+		err = c.w.Flush()
+	}
+	if err != nil {
+		srvrLog.Errorf("Unable to capture messages for %v: %v", p, err)
+		c.failed = true
+	}
+}
+
+// close closes the capture file.
+//
+// This function is safe for concurrent access.
+func (c *messageCapture) close() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.file != nil {
+		c.file.Close()
+		c.file = nil
+	}
+	c.failed = true
+}
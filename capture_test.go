@@ -0,0 +1,27 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+// TestCaptureFilename ensures the capture file names derived from peer
+// addresses only contain characters that are safe in file names.
+func TestCaptureFilename(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"127.0.0.1:15212", "127.0.0.1_15212.dat"},
+		{"[2001:db8::1]:15212", "_2001_db8__1__15212.dat"},
+		{"abcdefghijklmnop.onion:15212", "abcdefghijklmnop.onion_15212.dat"},
+		{"../../etc/passwd", ".._.._etc_passwd.dat"},
+	}
+	for _, test := range tests {
+		if got := captureFilename(test.addr); got != test.want {
+			t.Errorf("captureFilename(%q): got %q, want %q",
+				test.addr, got, test.want)
+		}
+	}
+}
@@ -13,22 +13,32 @@ import (
 	"github.com/flokiorg/go-flokicoin/wire"
 )
 
+// genesisMessage is the timestamp message embedded in the coinbase of every
+// standard network genesis block.
+const genesisMessage = "Twitter 12/Sep/2021 Floki has arrived"
+
+// genesisOutputScript is the output script paid by the coinbase of every
+// standard network genesis block.
+const genesisOutputScript = "4104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac"
+
 func generateGenesisCoinbaseTx() *wire.MsgTx {
-	pszTimestamp := "Twitter 12/Sep/2021 Floki has arrived"
-	pszTimestampBytes := []byte(pszTimestamp)
-	timestampLength := byte(len(pszTimestampBytes))
+	outputScript, _ := hex.DecodeString(genesisOutputScript)
+	return GenesisCoinbaseTx(genesisMessage, int64(1000*1e8), outputScript)
+}
+
+// GenesisCoinbaseTx returns the coinbase transaction of a genesis block which
+// embeds the passed message in its signature script and pays reward to
+// pkScript.  The signature script layout matches the one used by the standard
+// networks so custom networks can reproduce their genesis blocks.
+func GenesisCoinbaseTx(message string, reward int64, pkScript []byte) *wire.MsgTx {
+	msgBytes := []byte(message)
 
 	// Construct the coinbase script signature
 	coinbaseScriptSig := append(
-		[]byte{0x04, 0xff, 0xff, 0x00, 0x1d, 0x01, 0x04},         // Initial script prefix
-		append([]byte{timestampLength}, pszTimestampBytes...)..., // Length prefix + pszTimestamp
+		[]byte{0x04, 0xff, 0xff, 0x00, 0x1d, 0x01, 0x04},    // Initial script prefix
+		append([]byte{byte(len(msgBytes))}, msgBytes...)..., // Length prefix + message
 	)
 
-	genesisReward := int64(1000 * 1e8)
-
-	genesisOutputScript := "4104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac"
-	outputScript, _ := hex.DecodeString(genesisOutputScript)
-
 	return &wire.MsgTx{
 		Version: 1,
 		TxIn: []*wire.TxIn{
@@ -43,8 +53,8 @@ func generateGenesisCoinbaseTx() *wire.MsgTx {
 		},
 		TxOut: []*wire.TxOut{
 			{
-				Value:    genesisReward,
-				PkScript: outputScript,
+				Value:    reward,
+				PkScript: pkScript,
 			},
 		},
 		LockTime: 0,
@@ -76,6 +76,23 @@ type Checkpoint struct {
 	Hash   *chainhash.Hash
 }
 
+// AssumeUTXO identifies a UTXO set snapshot a node can be bootstrapped from
+// before it has validated the blocks up to the snapshot base.  The snapshot is
+// only accepted when the hash of its serialized coins matches TxOutSetHash.
+type AssumeUTXO struct {
+	// Height and BlockHash identify the block at the tip of the chain the
+	// UTXO set was taken at, which is the base of the snapshot.
+	Height    int32
+	BlockHash *chainhash.Hash
+
+	// TxOutSetHash is the hash of the serialized coins of the snapshot.
+	TxOutSetHash *chainhash.Hash
+
+	// ChainTxCount is the total number of transactions in the chain up to
+	// and including the base block.
+	ChainTxCount uint64
+}
+
 // DNSSeed identifies a DNS seed.
 type DNSSeed struct {
 	// Host defines the hostname of the seed.
@@ -228,6 +245,18 @@ type Params struct {
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints []Checkpoint
 
+	// AssumeValid is the hash of a block whose ancestors, and itself, are
+	// assumed to have valid scripts once it's buried deep enough in the
+	// best header chain.  Only the blocks past the final checkpoint are
+	// affected, so it must be later than that checkpoint to skip anything.
+	// Nil means the scripts of all the blocks past the final checkpoint are
+	// checked.
+	AssumeValid *chainhash.Hash
+
+	// AssumeUTXO holds the UTXO set snapshots that can be loaded to
+	// bootstrap a node, ordered from oldest to newest.
+	AssumeUTXO []AssumeUTXO
+
 	// These fields are related to voting on consensus rule changes as
 	// defined by BIP0009.
 	//
@@ -272,6 +301,21 @@ type Params struct {
 	AuxpowHeightEffective int32
 	AuxpowStrictChainId   bool
 
+	// AuxpowAllowedParentChainIds restricts the chain IDs a merged-mining
+	// parent block may carry.  An empty list allows any parent chain other
+	// than our own.
+	AuxpowAllowedParentChainIds []int32
+
+	// AuxpowMaxCoinbaseTxSize is the maximum serialized size of the parent
+	// coinbase transaction embedded in an AuxPoW header.  A value of zero
+	// falls back to wire.MaxCoinbaseTxSize.
+	AuxpowMaxCoinbaseTxSize int
+
+	// AuxpowMaxChainMerkleHeight is the maximum height of the chain merkle
+	// branch (the number of merged-mined chains is bounded by 2^height).  A
+	// value of zero falls back to wire.MaxChainBranchHashes.
+	AuxpowMaxChainMerkleHeight uint32
+
 	// Block height at which Digishield difficulty retargeting rules take effect.
 	// Before this height, legacy retargeting is used.
 	// At and after this height, per-block Digishield adjustments with
@@ -332,6 +376,14 @@ var MainNetParams = Params{
 		{209771, newHashFromStr("43a0a4fe88a45567302803d6d8db2579309ac67514954cefc9b68e341e0e1802")},
 	},
 
+	// The scripts of the blocks up to the final checkpoint, 209771, are
+	// never checked.  There is no default since no block past that
+	// checkpoint has been vetted as accepted by the whole network yet, and
+	// the checkpoint itself would skip nothing, so the scripts of all the
+	// blocks past it are checked.  It should be set along with the next
+	// checkpoint.
+	AssumeValid: nil,
+
 	// Consensus rule change deployments.
 	//
 	// Version-bits signaling guidelines for BitNumber to avoid overlap:
@@ -0,0 +1,526 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chaincfg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// ErrInvalidParams describes an error where a network definition loaded from a
+// parameters file is incomplete or inconsistent.
+var ErrInvalidParams = errors.New("invalid network parameters")
+
+// DeploymentNames maps the names of the consensus deployments, as reported by
+// getblockchaininfo and used in parameters files and version bits overrides,
+// to their index in Params.Deployments.
+var DeploymentNames = map[string]int{
+	"dummy":                DeploymentTestDummy,
+	"dummy-min-activation": DeploymentTestDummyMinActivation,
+	"csv":                  DeploymentCSV,
+	"segwit":               DeploymentSegwit,
+	"taproot":              DeploymentTaproot,
+}
+
+// GenesisDefinition describes how to construct the genesis block of a network
+// defined in a parameters file.  The coinbase transaction is built with
+// GenesisCoinbaseTx.
+type GenesisDefinition struct {
+	// Version, Timestamp, Bits and Nonce populate the genesis block header.
+	// Timestamp is expressed in seconds since the unix epoch.
+	Version   int32  `json:"version"`
+	Timestamp int64  `json:"timestamp"`
+	Bits      uint32 `json:"bits"`
+	Nonce     uint32 `json:"nonce"`
+
+	// Message is embedded in the coinbase signature script.
+	Message string `json:"message"`
+
+	// Reward is the value of the coinbase output in loki.
+	Reward int64 `json:"reward"`
+
+	// OutputScript is the hex-encoded script paid by the coinbase.
+	OutputScript string `json:"outputscript"`
+
+	// Hash is the expected hash of the resulting genesis block.  It is
+	// optional, but when set the constructed block must match it.
+	Hash string `json:"hash,omitempty"`
+}
+
+// DeploymentDefinition describes a consensus deployment in a parameters file.
+// StartTime and EndTime are median time past values in seconds since the unix
+// epoch, where zero means always started and never expiring respectively.
+type DeploymentDefinition struct {
+	BitNumber                 uint8  `json:"bitnumber"`
+	StartTime                 int64  `json:"starttime"`
+	EndTime                   int64  `json:"endtime"`
+	MinActivationHeight       uint32 `json:"minactivationheight,omitempty"`
+	CustomActivationThreshold uint32 `json:"customactivationthreshold,omitempty"`
+}
+
+// CheckpointDefinition describes a checkpoint in a parameters file.
+type CheckpointDefinition struct {
+	Height int32  `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// AssumeUTXODefinition describes a UTXO set snapshot in a parameters file.
+type AssumeUTXODefinition struct {
+	Height       int32  `json:"height"`
+	BlockHash    string `json:"blockhash"`
+	TxOutSetHash string `json:"txoutsethash"`
+	ChainTxCount uint64 `json:"chaintxcount"`
+}
+
+// AuxPowDefinition describes the merged mining parameters in a parameters file.
+type AuxPowDefinition struct {
+	ChainID               int32   `json:"chainid"`
+	HeightEffective       int32   `json:"heighteffective"`
+	StrictChainID         bool    `json:"strictchainid"`
+	AllowedParentChainIDs []int32 `json:"allowedparentchainids,omitempty"`
+	MaxCoinbaseTxSize     int     `json:"maxcoinbasetxsize,omitempty"`
+	MaxChainMerkleHeight  uint32  `json:"maxchainmerkleheight,omitempty"`
+}
+
+// ParamsFile is the on-disk representation of a network definition.  It is
+// decoded from JSON by LoadParams and converted into a Params with ToParams.
+//
+// Durations are expressed in seconds, PowLimit is a big-endian hex string and
+// the HD key identifiers are 4-byte hex strings.
+type ParamsFile struct {
+	Name        string    `json:"name"`
+	Net         uint32    `json:"net"`
+	DefaultPort string    `json:"defaultport"`
+	DNSSeeds    []DNSSeed `json:"dnsseeds,omitempty"`
+
+	Genesis GenesisDefinition `json:"genesis"`
+
+	PowLimit                   string `json:"powlimit"`
+	PowLimitBits               uint32 `json:"powlimitbits"`
+	PoWNoRetargeting           bool   `json:"pownoretargeting"`
+	BIP0034Height              int32  `json:"bip0034height"`
+	BIP0065Height              int32  `json:"bip0065height"`
+	BIP0066Height              int32  `json:"bip0066height"`
+	CoinbaseMaturity           uint16 `json:"coinbasematurity"`
+	SubsidyReductionInterval   int32  `json:"subsidyreductioninterval"`
+	TargetTimespan             int64  `json:"targettimespan"`
+	TargetTimePerBlock         int64  `json:"targettimeperblock"`
+	RetargetAdjustmentFactor   int64  `json:"retargetadjustmentfactor"`
+	ReduceMinDifficulty        bool   `json:"reducemindifficulty"`
+	GenerateSupported          bool   `json:"generatesupported"`
+	DigishieldActivationHeight int32  `json:"digishieldactivationheight"`
+
+	Checkpoints []CheckpointDefinition `json:"checkpoints,omitempty"`
+	AssumeValid string                 `json:"assumevalid,omitempty"`
+	AssumeUTXO  []AssumeUTXODefinition `json:"assumeutxo,omitempty"`
+
+	RuleChangeActivationThreshold uint32                          `json:"rulechangeactivationthreshold"`
+	MinerConfirmationWindow       uint32                          `json:"minerconfirmationwindow"`
+	Deployments                   map[string]DeploymentDefinition `json:"deployments,omitempty"`
+
+	AuxPow AuxPowDefinition `json:"auxpow"`
+
+	RelayNonStdTxs bool `json:"relaynonstdtxs"`
+
+	Bech32HRPSegwit         string `json:"bech32hrpsegwit"`
+	PubKeyHashAddrID        byte   `json:"pubkeyhashaddrid"`
+	ScriptHashAddrID        byte   `json:"scripthashaddrid"`
+	PrivateKeyID            byte   `json:"privatekeyid"`
+	WitnessPubKeyHashAddrID byte   `json:"witnesspubkeyhashaddrid"`
+	WitnessScriptHashAddrID byte   `json:"witnessscripthashaddrid"`
+	HDPrivateKeyID          string `json:"hdprivatekeyid"`
+	HDPublicKeyID           string `json:"hdpublickeyid"`
+	HDCoinType              uint32 `json:"hdcointype"`
+}
+
+// invalidParams returns an error wrapping ErrInvalidParams with the passed
+// description.
+func invalidParams(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidParams, fmt.Sprintf(format, args...))
+}
+
+// decodeHDKeyID decodes a 4-byte hex-encoded HD key identifier.
+func decodeHDKeyID(field, s string) ([4]byte, error) {
+	var id [4]byte
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != 4 {
+		return id, invalidParams("%s must be 4 hex-encoded bytes", field)
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// GenesisBlock constructs the genesis block described by the definition.
+func (g *GenesisDefinition) GenesisBlock() (*wire.MsgBlock, error) {
+	pkScript, err := hex.DecodeString(g.OutputScript)
+	if err != nil {
+		return nil, invalidParams("genesis output script: %v", err)
+	}
+	if g.Reward < 0 {
+		return nil, invalidParams("genesis reward must not be negative")
+	}
+
+	coinbase := GenesisCoinbaseTx(g.Message, g.Reward, pkScript)
+	return &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:    g.Version,
+			PrevBlock:  chainhash.Hash{},
+			MerkleRoot: coinbase.TxHash(),
+			Timestamp:  time.Unix(g.Timestamp, 0),
+			Bits:       g.Bits,
+			Nonce:      g.Nonce,
+		},
+		Transactions: []*wire.MsgTx{coinbase},
+	}, nil
+}
+
+// ToParams converts the definition into network parameters and validates them.
+// The returned parameters are not registered; callers are expected to pass them
+// to Register before use.
+func (f *ParamsFile) ToParams() (*Params, error) {
+	genesis, err := f.Genesis.GenesisBlock()
+	if err != nil {
+		return nil, err
+	}
+	genesisHash := genesis.BlockHash()
+	if f.Genesis.Hash != "" {
+		want, err := chainhash.NewHashFromStr(f.Genesis.Hash)
+		if err != nil {
+			return nil, invalidParams("genesis hash: %v", err)
+		}
+		if !want.IsEqual(&genesisHash) {
+			return nil, invalidParams("genesis block hash %v does "+
+				"not match the expected hash %v", genesisHash, want)
+		}
+	}
+
+	powLimit, ok := new(big.Int).SetString(
+		strings.TrimPrefix(f.PowLimit, "0x"), 16,
+	)
+	if !ok {
+		return nil, invalidParams("powlimit must be a hex-encoded integer")
+	}
+
+	hdPrivateKeyID, err := decodeHDKeyID("hdprivatekeyid", f.HDPrivateKeyID)
+	if err != nil {
+		return nil, err
+	}
+	hdPublicKeyID, err := decodeHDKeyID("hdpublickeyid", f.HDPublicKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints := make([]Checkpoint, 0, len(f.Checkpoints))
+	for _, cp := range f.Checkpoints {
+		hash, err := chainhash.NewHashFromStr(cp.Hash)
+		if err != nil {
+			return nil, invalidParams("checkpoint at height %d: %v",
+				cp.Height, err)
+		}
+		checkpoints = append(checkpoints, Checkpoint{
+			Height: cp.Height,
+			Hash:   hash,
+		})
+	}
+
+	var assumeValid *chainhash.Hash
+	if f.AssumeValid != "" {
+		assumeValid, err = chainhash.NewHashFromStr(f.AssumeValid)
+		if err != nil {
+			return nil, invalidParams("assumevalid: %v", err)
+		}
+	}
+
+	assumeUTXO := make([]AssumeUTXO, 0, len(f.AssumeUTXO))
+	for _, au := range f.AssumeUTXO {
+		blockHash, err := chainhash.NewHashFromStr(au.BlockHash)
+		if err != nil {
+			return nil, invalidParams("assumeutxo at height %d: %v",
+				au.Height, err)
+		}
+		txOutSetHash, err := chainhash.NewHashFromStr(au.TxOutSetHash)
+		if err != nil {
+			return nil, invalidParams("assumeutxo at height %d: %v",
+				au.Height, err)
+		}
+		assumeUTXO = append(assumeUTXO, AssumeUTXO{
+			Height:       au.Height,
+			BlockHash:    blockHash,
+			TxOutSetHash: txOutSetHash,
+			ChainTxCount: au.ChainTxCount,
+		})
+	}
+
+	params := &Params{
+		Name:                          f.Name,
+		Net:                           wire.FlokicoinNet(f.Net),
+		DefaultPort:                   f.DefaultPort,
+		DNSSeeds:                      f.DNSSeeds,
+		GenesisBlock:                  genesis,
+		GenesisHash:                   &genesisHash,
+		PowLimit:                      powLimit,
+		PowLimitBits:                  f.PowLimitBits,
+		PoWNoRetargeting:              f.PoWNoRetargeting,
+		BIP0034Height:                 f.BIP0034Height,
+		BIP0065Height:                 f.BIP0065Height,
+		BIP0066Height:                 f.BIP0066Height,
+		CoinbaseMaturity:              f.CoinbaseMaturity,
+		SubsidyReductionInterval:      f.SubsidyReductionInterval,
+		TargetTimespan:                time.Duration(f.TargetTimespan) * time.Second,
+		TargetTimePerBlock:            time.Duration(f.TargetTimePerBlock) * time.Second,
+		RetargetAdjustmentFactor:      f.RetargetAdjustmentFactor,
+		ReduceMinDifficulty:           f.ReduceMinDifficulty,
+		GenerateSupported:             f.GenerateSupported,
+		Checkpoints:                   checkpoints,
+		AssumeValid:                   assumeValid,
+		AssumeUTXO:                    assumeUTXO,
+		RuleChangeActivationThreshold: f.RuleChangeActivationThreshold,
+		MinerConfirmationWindow:       f.MinerConfirmationWindow,
+		RelayNonStdTxs:                f.RelayNonStdTxs,
+		Bech32HRPSegwit:               f.Bech32HRPSegwit,
+		PubKeyHashAddrID:              f.PubKeyHashAddrID,
+		ScriptHashAddrID:              f.ScriptHashAddrID,
+		PrivateKeyID:                  f.PrivateKeyID,
+		WitnessPubKeyHashAddrID:       f.WitnessPubKeyHashAddrID,
+		WitnessScriptHashAddrID:       f.WitnessScriptHashAddrID,
+		HDPrivateKeyID:                hdPrivateKeyID,
+		HDPublicKeyID:                 hdPublicKeyID,
+		HDCoinType:                    f.HDCoinType,
+		AuxpowChainId:                 f.AuxPow.ChainID,
+		AuxpowHeightEffective:         f.AuxPow.HeightEffective,
+		AuxpowStrictChainId:           f.AuxPow.StrictChainID,
+		AuxpowAllowedParentChainIds:   f.AuxPow.AllowedParentChainIDs,
+		AuxpowMaxCoinbaseTxSize:       f.AuxPow.MaxCoinbaseTxSize,
+		AuxpowMaxChainMerkleHeight:    f.AuxPow.MaxChainMerkleHeight,
+		DigishieldActivationHeight:    f.DigishieldActivationHeight,
+	}
+
+	for name := range f.Deployments {
+		if _, ok := DeploymentNames[name]; !ok {
+			return nil, invalidParams("unknown deployment %q", name)
+		}
+	}
+
+	// Deployments that are not listed default to the regression test
+	// network bit assignments and are always available for vote.
+	for name, id := range DeploymentNames {
+		def, ok := f.Deployments[name]
+		if !ok {
+			def = DeploymentDefinition{
+				BitNumber: RegressionNetParams.Deployments[id].BitNumber,
+			}
+		}
+
+		var startTime, endTime time.Time
+		if def.StartTime != 0 {
+			startTime = time.Unix(def.StartTime, 0)
+		}
+		if def.EndTime != 0 {
+			endTime = time.Unix(def.EndTime, 0)
+		}
+		params.Deployments[id] = ConsensusDeployment{
+			BitNumber:                 def.BitNumber,
+			MinActivationHeight:       def.MinActivationHeight,
+			CustomActivationThreshold: def.CustomActivationThreshold,
+			DeploymentStarter:         NewMedianTimeDeploymentStarter(startTime),
+			DeploymentEnder:           NewMedianTimeDeploymentEnder(endTime),
+		}
+	}
+	if err := validateParams(params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// validateParams checks the passed parameters for values that would prevent a
+// node from operating on the network they define.
+func validateParams(p *Params) error {
+	switch {
+	case p.Name == "":
+		return invalidParams("name must be set")
+	case p.Net == 0:
+		return invalidParams("net magic must be set")
+	case p.GenesisBlock.Header.Bits == 0:
+		return invalidParams("genesis bits must be set")
+	case p.PowLimit.Sign() <= 0:
+		return invalidParams("powlimit must be positive")
+	case p.PowLimitBits == 0:
+		return invalidParams("powlimitbits must be set")
+	case p.SubsidyReductionInterval <= 0:
+		return invalidParams("subsidyreductioninterval must be positive")
+	case p.TargetTimePerBlock <= 0:
+		return invalidParams("targettimeperblock must be positive")
+	case p.TargetTimespan < p.TargetTimePerBlock:
+		return invalidParams("targettimespan must not be shorter " +
+			"than targettimeperblock")
+	case p.RetargetAdjustmentFactor <= 0:
+		return invalidParams("retargetadjustmentfactor must be positive")
+	case p.MinerConfirmationWindow == 0:
+		return invalidParams("minerconfirmationwindow must be positive")
+	case p.RuleChangeActivationThreshold == 0 ||
+		p.RuleChangeActivationThreshold > p.MinerConfirmationWindow:
+		return invalidParams("rulechangeactivationthreshold must be " +
+			"between 1 and minerconfirmationwindow")
+	case p.AuxpowChainId < 0 || p.AuxpowChainId > wire.ChainIDMask>>16:
+		return invalidParams("auxpow chain id must be between 0 and %d",
+			wire.ChainIDMask>>16)
+	case p.AuxpowHeightEffective < 0:
+		return invalidParams("auxpow effective height must not be negative")
+	case p.Bech32HRPSegwit == "" ||
+		p.Bech32HRPSegwit != strings.ToLower(p.Bech32HRPSegwit):
+		return invalidParams("bech32hrpsegwit must be a non-empty " +
+			"lowercase string")
+	case p.PubKeyHashAddrID == p.ScriptHashAddrID:
+		return invalidParams("pubkeyhashaddrid and scripthashaddrid " +
+			"must differ")
+	case bytes.Equal(p.HDPrivateKeyID[:], p.HDPublicKeyID[:]):
+		return invalidParams("hdprivatekeyid and hdpublickeyid must differ")
+	}
+
+	// The genesis block must match its hash and have a valid proof of
+	// work, as any other block.
+	header := &p.GenesisBlock.Header
+	if p.GenesisHash == nil || header.BlockHash() != *p.GenesisHash {
+		return invalidParams("genesis hash does not match the genesis " +
+			"block header")
+	}
+	target := compactToBig(header.Bits)
+	if target.Sign() <= 0 || target.Cmp(p.PowLimit) > 0 {
+		return invalidParams("genesis target difficulty of %064x must "+
+			"be positive and not higher than powlimit", target)
+	}
+	powHash := header.BlockPoWHash()
+	if hashToBig(&powHash).Cmp(target) > 0 {
+		return invalidParams("genesis proof of work hash %v is higher "+
+			"than the target difficulty of %064x", powHash, target)
+	}
+
+	port, err := strconv.ParseUint(p.DefaultPort, 10, 16)
+	if err != nil || port == 0 {
+		return invalidParams("defaultport must be a valid port number")
+	}
+
+	for i := 1; i < len(p.Checkpoints); i++ {
+		if p.Checkpoints[i].Height <= p.Checkpoints[i-1].Height {
+			return invalidParams("checkpoints must be ordered by " +
+				"strictly increasing height")
+		}
+	}
+	for i := range p.AssumeUTXO {
+		if p.AssumeUTXO[i].Height <= 0 {
+			return invalidParams("assumeutxo heights must be " +
+				"positive")
+		}
+		if i > 0 && p.AssumeUTXO[i].Height <= p.AssumeUTXO[i-1].Height {
+			return invalidParams("assumeutxo snapshots must be " +
+				"ordered by strictly increasing height")
+		}
+	}
+
+	return ValidateDeploymentBits(p)
+}
+
+// ValidateDeploymentBits ensures no two deployments of the passed parameters
+// share a version bit and that none of them uses a bit reserved for the AuxPoW
+// flag (8), the AuxPoW chain ID (16-21) or the version bits top mask (29-31).
+// The returned error wraps ErrInvalidParams.
+func ValidateDeploymentBits(p *Params) error {
+	var bits uint32
+	for id, d := range p.Deployments {
+		bit := d.BitNumber
+		if bit == 8 || (bit >= 16 && bit <= 21) || bit >= 29 {
+			return invalidParams("deployment %d uses reserved version "+
+				"bit %d", id, bit)
+		}
+		if bits&(1<<bit) != 0 {
+			return invalidParams("deployment %d reuses version bit %d",
+				id, bit)
+		}
+		bits |= 1 << bit
+	}
+
+	return nil
+}
+
+// LoadParams decodes a JSON network definition from r and returns the validated
+// parameters it describes.
+func LoadParams(r io.Reader) (*Params, error) {
+	var f ParamsFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("unable to decode JSON network "+
+			"parameters: %w", err)
+	}
+	return f.ToParams()
+}
+
+// LoadParamsFile reads the JSON network definition at path and returns the
+// validated parameters it describes.
+func LoadParamsFile(path string) (*Params, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return LoadParams(file)
+}
+
+// compactToBig is a copy of the blockchain.CompactToBig function, which can't
+// be imported without a circular dependency.
+func compactToBig(compact uint32) *big.Int {
+	// Extract the mantissa, sign bit, and exponent.
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	// Since the base for the exponent is 256, the exponent can be treated
+	// as the number of bytes to represent the full 256-bit number.  So,
+	// treat the exponent as the number of bytes and shift the mantissa
+	// right or left accordingly.  This is equivalent to:
+	// N = mantissa * 256^(exponent-3)
+	var bn *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		bn = big.NewInt(int64(mantissa))
+	} else {
+		bn = big.NewInt(int64(mantissa))
+		bn.Lsh(bn, 8*(exponent-3))
+	}
+
+	// Make it negative if the sign bit is set.
+	if isNegative {
+		bn = bn.Neg(bn)
+	}
+
+	return bn
+}
+
+// hashToBig is a copy of the blockchain.HashToBig function, which can't be
+// imported without a circular dependency.
+func hashToBig(hash *chainhash.Hash) *big.Int {
+	// A Hash is in little-endian, but the big package wants the bytes in
+	// big-endian, so reverse them.
+	buf := *hash
+	blen := len(buf)
+	for i := 0; i < blen/2; i++ {
+		buf[i], buf[blen-1-i] = buf[blen-1-i], buf[i]
+	}
+
+	return new(big.Int).SetBytes(buf[:])
+}
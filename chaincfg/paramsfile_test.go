@@ -0,0 +1,323 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chaincfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+)
+
+// regTestParamsFile returns a parameters file definition which reproduces the
+// genesis block and main consensus values of the regression test network.
+func regTestParamsFile() ParamsFile {
+	return ParamsFile{
+		Name:        "privnet",
+		Net:         0xfeedf10c,
+		DefaultPort: "26212",
+		Genesis: GenesisDefinition{
+			Version:      1,
+			Timestamp:    1735376054,
+			Bits:         0x207fffff,
+			Nonce:        2083236894,
+			Message:      genesisMessage,
+			Reward:       1000 * 1e8,
+			OutputScript: genesisOutputScript,
+			Hash:         RegressionNetParams.GenesisHash.String(),
+		},
+		PowLimit:                      regressionPowLimit.Text(16),
+		PowLimitBits:                  0x207fffff,
+		PoWNoRetargeting:              true,
+		BIP0034Height:                 100000000,
+		BIP0065Height:                 1351,
+		BIP0066Height:                 1251,
+		CoinbaseMaturity:              100,
+		SubsidyReductionInterval:      150,
+		TargetTimespan:                60,
+		TargetTimePerBlock:            60,
+		RetargetAdjustmentFactor:      4,
+		ReduceMinDifficulty:           true,
+		GenerateSupported:             true,
+		RuleChangeActivationThreshold: 1,
+		MinerConfirmationWindow:       3,
+		Deployments: map[string]DeploymentDefinition{
+			"taproot": {BitNumber: 2, StartTime: 1700000000},
+			"dummy":   {BitNumber: 28, StartTime: 1600000000},
+		},
+		AuxPow: AuxPowDefinition{
+			ChainID:               0x22,
+			HeightEffective:       10,
+			StrictChainID:         true,
+			AllowedParentChainIDs: []int32{0, 1},
+		},
+		Bech32HRPSegwit:  "fcpn",
+		PubKeyHashAddrID: 0x70,
+		ScriptHashAddrID: 0xc5,
+		PrivateKeyID:     0xf0,
+		HDPrivateKeyID:   "04358395",
+		HDPublicKeyID:    "043587d0",
+		HDCoinType:       1,
+		AssumeUTXO: []AssumeUTXODefinition{{
+			Height:       110,
+			BlockHash:    "6affe030b7965ab538f820a56ef56c8149b7dc1d1c144af57113be080db7c397",
+			TxOutSetHash: "ab72ba2a3f8ab48ad8d5bc30bbc2fe2c0b5ad8d8c1c7d9b2e1e0c9f00df59c4c",
+			ChainTxCount: 111,
+		}},
+	}
+}
+
+// TestLoadParams ensures a JSON network definition is decoded into the
+// expected parameters, including the constructed genesis block.
+func TestLoadParams(t *testing.T) {
+	raw, err := json.Marshal(regTestParamsFile())
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	params, err := LoadParams(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("LoadParams: %v", err)
+	}
+
+	if !params.GenesisHash.IsEqual(RegressionNetParams.GenesisHash) {
+		t.Fatalf("genesis hash: got %v, want %v", params.GenesisHash,
+			RegressionNetParams.GenesisHash)
+	}
+	gotRoot := params.GenesisBlock.Header.MerkleRoot
+	if gotRoot != RegressionNetParams.GenesisBlock.Header.MerkleRoot {
+		t.Fatalf("genesis merkle root: got %v, want %v", gotRoot,
+			RegressionNetParams.GenesisBlock.Header.MerkleRoot)
+	}
+	if params.PowLimit.Cmp(regressionPowLimit) != 0 {
+		t.Fatalf("powlimit: got %x, want %x", params.PowLimit,
+			regressionPowLimit)
+	}
+	if params.TargetTimePerBlock != time.Minute {
+		t.Fatalf("target time per block: got %v, want %v",
+			params.TargetTimePerBlock, time.Minute)
+	}
+	if params.AuxpowChainId != 0x22 || params.AuxpowHeightEffective != 10 ||
+		len(params.AuxpowAllowedParentChainIds) != 2 {
+
+		t.Fatalf("unexpected auxpow params: chain id %d, height %d, "+
+			"parents %v", params.AuxpowChainId,
+			params.AuxpowHeightEffective,
+			params.AuxpowAllowedParentChainIds)
+	}
+	if params.HDPublicKeyID != [4]byte{0x04, 0x35, 0x87, 0xd0} {
+		t.Fatalf("hd public key id: got %x", params.HDPublicKeyID)
+	}
+
+	if len(params.AssumeUTXO) != 1 || params.AssumeUTXO[0].Height != 110 ||
+		params.AssumeUTXO[0].ChainTxCount != 111 {
+
+		t.Fatalf("unexpected assumeutxo params: %v", params.AssumeUTXO)
+	}
+
+	// Listed deployments use the provided values while the others fall
+	// back to the regression test bit assignments.
+	taproot := params.Deployments[DeploymentTaproot]
+	starter := taproot.DeploymentStarter.(*MedianTimeDeploymentStarter)
+	if !starter.StartTime().Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("taproot start time: got %v", starter.StartTime())
+	}
+	dummy := params.Deployments[DeploymentTestDummy]
+	starter = dummy.DeploymentStarter.(*MedianTimeDeploymentStarter)
+	if !starter.StartTime().Equal(time.Unix(1600000000, 0)) {
+		t.Fatalf("dummy start time: got %v", starter.StartTime())
+	}
+	for id, d := range params.Deployments {
+		want := RegressionNetParams.Deployments[id].BitNumber
+		if d.BitNumber != want {
+			t.Fatalf("deployment %d: got bit %d, want %d", id,
+				d.BitNumber, want)
+		}
+		if d.DeploymentStarter == nil || d.DeploymentEnder == nil {
+			t.Fatalf("deployment %d: missing starter or ender", id)
+		}
+	}
+}
+
+// TestLoadParamsInvalid ensures inconsistent network definitions are rejected.
+func TestLoadParamsInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(f *ParamsFile)
+	}{
+		{
+			name:   "missing name",
+			modify: func(f *ParamsFile) { f.Name = "" },
+		},
+		{
+			name:   "missing net",
+			modify: func(f *ParamsFile) { f.Net = 0 },
+		},
+		{
+			name:   "bad port",
+			modify: func(f *ParamsFile) { f.DefaultPort = "port" },
+		},
+		{
+			name:   "genesis hash mismatch",
+			modify: func(f *ParamsFile) { f.Genesis.Nonce++ },
+		},
+		{
+			name: "genesis target above powlimit",
+			modify: func(f *ParamsFile) {
+				f.PowLimit = "7fffff"
+			},
+		},
+		{
+			name: "genesis proof of work not met",
+			modify: func(f *ParamsFile) {
+				// Find a nonce for which the genesis block
+				// doesn't meet its target.
+				f.Genesis.Hash = ""
+				target := compactToBig(f.Genesis.Bits)
+				for ; ; f.Genesis.Nonce++ {
+					genesis, err := f.Genesis.GenesisBlock()
+					if err != nil {
+						t.Fatal(err)
+					}
+					hash := genesis.Header.BlockPoWHash()
+					if hashToBig(&hash).Cmp(target) > 0 {
+						return
+					}
+				}
+			},
+		},
+		{
+			name:   "bad output script",
+			modify: func(f *ParamsFile) { f.Genesis.OutputScript = "zz" },
+		},
+		{
+			name:   "bad powlimit",
+			modify: func(f *ParamsFile) { f.PowLimit = "xyz" },
+		},
+		{
+			name:   "zero subsidy interval",
+			modify: func(f *ParamsFile) { f.SubsidyReductionInterval = 0 },
+		},
+		{
+			name:   "timespan shorter than spacing",
+			modify: func(f *ParamsFile) { f.TargetTimespan = 30 },
+		},
+		{
+			name: "threshold above window",
+			modify: func(f *ParamsFile) {
+				f.RuleChangeActivationThreshold = 4
+			},
+		},
+		{
+			name:   "chain id out of range",
+			modify: func(f *ParamsFile) { f.AuxPow.ChainID = 64 },
+		},
+		{
+			name:   "uppercase hrp",
+			modify: func(f *ParamsFile) { f.Bech32HRPSegwit = "FCPN" },
+		},
+		{
+			name: "same address ids",
+			modify: func(f *ParamsFile) {
+				f.ScriptHashAddrID = f.PubKeyHashAddrID
+			},
+		},
+		{
+			name:   "short hd key id",
+			modify: func(f *ParamsFile) { f.HDPrivateKeyID = "0435" },
+		},
+		{
+			name: "unknown deployment",
+			modify: func(f *ParamsFile) {
+				f.Deployments["nosuchfork"] = DeploymentDefinition{}
+			},
+		},
+		{
+			name: "deployment not named as in getblockchaininfo",
+			modify: func(f *ParamsFile) {
+				f.Deployments["testdummy"] = DeploymentDefinition{}
+			},
+		},
+		{
+			name: "reserved version bit",
+			modify: func(f *ParamsFile) {
+				f.Deployments["taproot"] = DeploymentDefinition{
+					BitNumber: 16,
+				}
+			},
+		},
+		{
+			name: "duplicate version bit",
+			modify: func(f *ParamsFile) {
+				f.Deployments["taproot"] = DeploymentDefinition{
+					BitNumber: 1,
+				}
+			},
+		},
+		{
+			name: "unordered checkpoints",
+			modify: func(f *ParamsFile) {
+				hash := RegressionNetParams.GenesisHash.String()
+				f.Checkpoints = []CheckpointDefinition{
+					{Height: 10, Hash: hash},
+					{Height: 5, Hash: hash},
+				}
+			},
+		},
+		{
+			name: "unordered assumeutxo snapshots",
+			modify: func(f *ParamsFile) {
+				f.AssumeUTXO = append(f.AssumeUTXO,
+					f.AssumeUTXO[0])
+			},
+		},
+		{
+			name: "invalid assumeutxo hash",
+			modify: func(f *ParamsFile) {
+				f.AssumeUTXO[0].TxOutSetHash = "xyz"
+			},
+		},
+		{
+			name: "invalid assumevalid hash",
+			modify: func(f *ParamsFile) {
+				f.AssumeValid = "xyz"
+			},
+		},
+	}
+
+	for _, test := range tests {
+		f := regTestParamsFile()
+		test.modify(&f)
+
+		_, err := f.ToParams()
+		if !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: got error %v, want %v", test.name, err,
+				ErrInvalidParams)
+		}
+	}
+
+	// The genesis hash must match the genesis block header.
+	f := regTestParamsFile()
+	params, err := f.ToParams()
+	if err != nil {
+		t.Fatalf("ToParams: %v", err)
+	}
+	params.GenesisHash = &chainhash.Hash{}
+	if err := validateParams(params); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("genesis hash mismatch: got error %v, want %v", err,
+			ErrInvalidParams)
+	}
+
+	// Unknown fields are rejected so typos don't silently fall back to
+	// zero values.
+	_, err = LoadParams(strings.NewReader(`{"nmae": "privnet"}`))
+	if err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
@@ -53,6 +53,19 @@ func NewAddNodeCmd(addr string, subCmd AddNodeSubCmd) *AddNodeCmd {
 	}
 }
 
+// ApproveReorgCmd defines the approvereorg JSON-RPC command.
+type ApproveReorgCmd struct {
+	BlockHash string
+}
+
+// NewApproveReorgCmd returns a new instance which can be used to issue an
+// approvereorg JSON-RPC command.
+func NewApproveReorgCmd(blockHash string) *ApproveReorgCmd {
+	return &ApproveReorgCmd{
+		BlockHash: blockHash,
+	}
+}
+
 // TransactionInput represents the inputs to a transaction.  Specifically a
 // transaction hash and output number pair.
 type TransactionInput struct {
@@ -127,6 +140,19 @@ func NewDeriveAddressesCmd(descriptor string, descriptorRange *DescriptorRange)
 	}
 }
 
+// DumpTxOutSetCmd defines the dumptxoutset JSON-RPC command.
+type DumpTxOutSetCmd struct {
+	Path string
+}
+
+// NewDumpTxOutSetCmd returns a new instance which can be used to issue a
+// dumptxoutset JSON-RPC command.
+func NewDumpTxOutSetCmd(path string) *DumpTxOutSetCmd {
+	return &DumpTxOutSetCmd{
+		Path: path,
+	}
+}
+
 // ChangeType defines the different output types to use for the change address
 // of a transaction built by the node.
 type ChangeType string
@@ -262,6 +288,21 @@ func NewGetBlockFilterCmd(blockHash string, filterType *FilterTypeName) *GetBloc
 	}
 }
 
+// GetBlockFromPeerCmd defines the getblockfrompeer JSON-RPC command.
+type GetBlockFromPeerCmd struct {
+	BlockHash string
+	PeerID    int32
+}
+
+// NewGetBlockFromPeerCmd returns a new instance which can be used to issue a
+// getblockfrompeer JSON-RPC command.
+func NewGetBlockFromPeerCmd(blockHash string, peerID int32) *GetBlockFromPeerCmd {
+	return &GetBlockFromPeerCmd{
+		BlockHash: blockHash,
+		PeerID:    peerID,
+	}
+}
+
 // GetBlockHashCmd defines the getblockhash JSON-RPC command.
 type GetBlockHashCmd struct {
 	Index int64
@@ -279,10 +320,14 @@ func NewGetBlockHashCmd(index int64) *GetBlockHashCmd {
 type GetBlockHeaderCmd struct {
 	Hash    string
 	Verbose *bool `jsonrpcdefault:"true"`
+	AuxPow  *bool `jsonrpcdefault:"false"`
 }
 
 // NewGetBlockHeaderCmd returns a new instance which can be used to issue a
 // getblockheader JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
 func NewGetBlockHeaderCmd(hash string, verbose *bool) *GetBlockHeaderCmd {
 	return &GetBlockHeaderCmd{
 		Hash:    hash,
@@ -290,6 +335,20 @@ func NewGetBlockHeaderCmd(hash string, verbose *bool) *GetBlockHeaderCmd {
 	}
 }
 
+// NewGetBlockHeaderAuxPowCmd returns a new instance which can be used to issue
+// a getblockheader JSON-RPC command that also sets whether the AuxPoW of the
+// header is decoded.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetBlockHeaderAuxPowCmd(hash string, verbose *bool, auxPow *bool) *GetBlockHeaderCmd {
+	return &GetBlockHeaderCmd{
+		Hash:    hash,
+		Verbose: verbose,
+		AuxPow:  auxPow,
+	}
+}
+
 // HashOrHeight defines a type that can be used as hash_or_height value in JSON-RPC commands.
 type HashOrHeight struct {
 	Value interface{}
@@ -769,6 +828,19 @@ func NewInvalidateBlockCmd(blockHash string) *InvalidateBlockCmd {
 	}
 }
 
+// LoadTxOutSetCmd defines the loadtxoutset JSON-RPC command.
+type LoadTxOutSetCmd struct {
+	Path string
+}
+
+// NewLoadTxOutSetCmd returns a new instance which can be used to issue a
+// loadtxoutset JSON-RPC command.
+func NewLoadTxOutSetCmd(path string) *LoadTxOutSetCmd {
+	return &LoadTxOutSetCmd{
+		Path: path,
+	}
+}
+
 // PingCmd defines the ping JSON-RPC command.
 type PingCmd struct{}
 
@@ -1156,15 +1228,57 @@ type CreateAuxBlockResult struct {
 // SubmitAuxBlockResult is simply a boolean: true if accepted, false otherwise.
 type SubmitAuxBlockResult bool
 
+// GetAuxPowInfoCmd defines the getauxpowinfo JSON-RPC command.
+type GetAuxPowInfoCmd struct {
+	NBlocks   *int32 `jsonrpcdefault:"1440"`
+	BlockHash *string
+}
+
+// NewGetAuxPowInfoCmd returns a new instance which can be used to issue a
+// getauxpowinfo JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetAuxPowInfoCmd(nBlocks *int32, blockHash *string) *GetAuxPowInfoCmd {
+	return &GetAuxPowInfoCmd{
+		NBlocks:   nBlocks,
+		BlockHash: blockHash,
+	}
+}
+
+// AuxPowParentChainResult models the merged-mining statistics of a single
+// parent chain in the getauxpowinfo result.
+type AuxPowParentChainResult struct {
+	ChainID int32   `json:"chainid"`
+	Blocks  int32   `json:"blocks"`
+	Share   float64 `json:"share"`
+}
+
+// GetAuxPowInfoResult models the data from the getauxpowinfo command.
+type GetAuxPowInfoResult struct {
+	ChainID           int32                     `json:"chainid"`
+	ActivationHeight  int32                     `json:"activationheight"`
+	WindowStartHeight int32                     `json:"windowstartheight"`
+	WindowEndHeight   int32                     `json:"windowendheight"`
+	WindowEndHash     string                    `json:"windowendhash"`
+	WindowBlocks      int32                     `json:"windowblocks"`
+	AuxPowBlocks      int32                     `json:"auxpowblocks"`
+	NativeBlocks      int32                     `json:"nativeblocks"`
+	AuxPowShare       float64                   `json:"auxpowshare"`
+	ParentChains      []AuxPowParentChainResult `json:"parentchains"`
+}
+
 func init() {
 	// No special flags for commands in this file.
 	flags := UsageFlag(0)
 
 	MustRegisterCmd("addnode", (*AddNodeCmd)(nil), flags)
+	MustRegisterCmd("approvereorg", (*ApproveReorgCmd)(nil), flags)
 	MustRegisterCmd("createrawtransaction", (*CreateRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decoderawtransaction", (*DecodeRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decodescript", (*DecodeScriptCmd)(nil), flags)
 	MustRegisterCmd("deriveaddresses", (*DeriveAddressesCmd)(nil), flags)
+	MustRegisterCmd("dumptxoutset", (*DumpTxOutSetCmd)(nil), flags)
 	MustRegisterCmd("fundrawtransaction", (*FundRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("getaddednodeinfo", (*GetAddedNodeInfoCmd)(nil), flags)
 	MustRegisterCmd("getbestblockhash", (*GetBestBlockHashCmd)(nil), flags)
@@ -1172,6 +1286,7 @@ func init() {
 	MustRegisterCmd("getblockchaininfo", (*GetBlockChainInfoCmd)(nil), flags)
 	MustRegisterCmd("getblockcount", (*GetBlockCountCmd)(nil), flags)
 	MustRegisterCmd("getblockfilter", (*GetBlockFilterCmd)(nil), flags)
+	MustRegisterCmd("getblockfrompeer", (*GetBlockFromPeerCmd)(nil), flags)
 	MustRegisterCmd("getblockhash", (*GetBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblockheader", (*GetBlockHeaderCmd)(nil), flags)
 	MustRegisterCmd("getblockstats", (*GetBlockStatsCmd)(nil), flags)
@@ -1179,6 +1294,7 @@ func init() {
 	MustRegisterCmd("getblocktemplate", (*GetBlockTemplateCmd)(nil), flags)
 	MustRegisterCmd("createauxblock", (*CreateAuxBlockCmd)(nil), flags)
 	MustRegisterCmd("submitauxblock", (*SubmitAuxBlockCmd)(nil), flags)
+	MustRegisterCmd("getauxpowinfo", (*GetAuxPowInfoCmd)(nil), flags)
 
 	MustRegisterCmd("getcfilter", (*GetCFilterCmd)(nil), flags)
 	MustRegisterCmd("getcfilterheader", (*GetCFilterHeaderCmd)(nil), flags)
@@ -1209,6 +1325,7 @@ func init() {
 	MustRegisterCmd("getwork", (*GetWorkCmd)(nil), flags)
 	MustRegisterCmd("help", (*HelpCmd)(nil), flags)
 	MustRegisterCmd("invalidateblock", (*InvalidateBlockCmd)(nil), flags)
+	MustRegisterCmd("loadtxoutset", (*LoadTxOutSetCmd)(nil), flags)
 	MustRegisterCmd("ping", (*PingCmd)(nil), flags)
 	MustRegisterCmd("preciousblock", (*PreciousBlockCmd)(nil), flags)
 	MustRegisterCmd("reconsiderblock", (*ReconsiderBlockCmd)(nil), flags)
@@ -44,6 +44,19 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"addnode","params":["127.0.0.1","remove"],"id":1}`,
 			unmarshalled: &chainjson.AddNodeCmd{Addr: "127.0.0.1", SubCmd: chainjson.ANRemove},
 		},
+		{
+			name: "approvereorg",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("approvereorg", "123")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewApproveReorgCmd("123")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"approvereorg","params":["123"],"id":1}`,
+			unmarshalled: &chainjson.ApproveReorgCmd{
+				BlockHash: "123",
+			},
+		},
 		{
 			name: "createrawtransaction",
 			newCmd: func() (interface{}, error) {
@@ -267,6 +280,19 @@ func TestChainSvrCmds(t *testing.T) {
 				Range:      &chainjson.DescriptorRange{Value: []int{0, 2}},
 			},
 		},
+		{
+			name: "dumptxoutset",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("dumptxoutset", "utxo.dat")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewDumpTxOutSetCmd("utxo.dat")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"dumptxoutset","params":["utxo.dat"],"id":1}`,
+			unmarshalled: &chainjson.DumpTxOutSetCmd{
+				Path: "utxo.dat",
+			},
+		},
 		{
 			name: "getaddednodeinfo",
 			newCmd: func() (interface{}, error) {
@@ -403,6 +429,20 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getblockfilter","params":["0000afaf","basic"],"id":1}`,
 			unmarshalled: &chainjson.GetBlockFilterCmd{"0000afaf", chainjson.NewFilterTypeName(chainjson.FilterTypeBasic)},
 		},
+		{
+			name: "getblockfrompeer",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getblockfrompeer", "123", 5)
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetBlockFromPeerCmd("123", 5)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockfrompeer","params":["123",5],"id":1}`,
+			unmarshalled: &chainjson.GetBlockFromPeerCmd{
+				BlockHash: "123",
+				PeerID:    5,
+			},
+		},
 		{
 			name: "getblockhash",
 			newCmd: func() (interface{}, error) {
@@ -426,6 +466,22 @@ func TestChainSvrCmds(t *testing.T) {
 			unmarshalled: &chainjson.GetBlockHeaderCmd{
 				Hash:    "123",
 				Verbose: chainjson.Bool(true),
+				AuxPow:  chainjson.Bool(false),
+			},
+		},
+		{
+			name: "getblockheader optional auxpow",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getblockheader", "123", true, true)
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetBlockHeaderAuxPowCmd("123", chainjson.Bool(true), chainjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockheader","params":["123",true,true],"id":1}`,
+			unmarshalled: &chainjson.GetBlockHeaderCmd{
+				Hash:    "123",
+				Verbose: chainjson.Bool(true),
+				AuxPow:  chainjson.Bool(true),
 			},
 		},
 		{
@@ -646,6 +702,33 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: chainjson.String("0000afaf"),
 			},
 		},
+		{
+			name: "getauxpowinfo",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getauxpowinfo")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetAuxPowInfoCmd(nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getauxpowinfo","params":[],"id":1}`,
+			unmarshalled: &chainjson.GetAuxPowInfoCmd{
+				NBlocks: chainjson.Int32(1440),
+			},
+		},
+		{
+			name: "getauxpowinfo optional nblocks and blockhash",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getauxpowinfo", chainjson.Int32(100), chainjson.String("0000afaf"))
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetAuxPowInfoCmd(chainjson.Int32(100), chainjson.String("0000afaf"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getauxpowinfo","params":[100,"0000afaf"],"id":1}`,
+			unmarshalled: &chainjson.GetAuxPowInfoCmd{
+				NBlocks:   chainjson.Int32(100),
+				BlockHash: chainjson.String("0000afaf"),
+			},
+		},
 		{
 			name: "getconnectioncount",
 			newCmd: func() (interface{}, error) {
@@ -1027,6 +1110,19 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "loadtxoutset",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("loadtxoutset", "utxo.dat")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewLoadTxOutSetCmd("utxo.dat")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"loadtxoutset","params":["utxo.dat"],"id":1}`,
+			unmarshalled: &chainjson.LoadTxOutSetCmd{
+				Path: "utxo.dat",
+			},
+		},
 		{
 			name: "ping",
 			newCmd: func() (interface{}, error) {
@@ -21,18 +21,19 @@ import (
 // the verbose flag is set.  When the verbose flag is not set, getblockheader
 // returns a hex-encoded string.
 type GetBlockHeaderVerboseResult struct {
-	Hash          string  `json:"hash"`
-	Confirmations int64   `json:"confirmations"`
-	Height        int32   `json:"height"`
-	Version       int32   `json:"version"`
-	VersionHex    string  `json:"versionHex"`
-	MerkleRoot    string  `json:"merkleroot"`
-	Time          int64   `json:"time"`
-	Nonce         uint64  `json:"nonce"`
-	Bits          string  `json:"bits"`
-	Difficulty    float64 `json:"difficulty"`
-	PreviousHash  string  `json:"previousblockhash,omitempty"`
-	NextHash      string  `json:"nextblockhash,omitempty"`
+	Hash          string        `json:"hash"`
+	Confirmations int64         `json:"confirmations"`
+	Height        int32         `json:"height"`
+	Version       int32         `json:"version"`
+	VersionHex    string        `json:"versionHex"`
+	MerkleRoot    string        `json:"merkleroot"`
+	Time          int64         `json:"time"`
+	Nonce         uint64        `json:"nonce"`
+	Bits          string        `json:"bits"`
+	Difficulty    float64       `json:"difficulty"`
+	PreviousHash  string        `json:"previousblockhash,omitempty"`
+	NextHash      string        `json:"nextblockhash,omitempty"`
+	AuxPow        *AuxPowResult `json:"auxpow,omitempty"`
 }
 
 // GetBlockStatsResult models the data from the getblockstats command.
@@ -104,6 +105,25 @@ type AuxPowResult struct {
 	MerkleBranch      []string       `json:"merklebranch"`
 	ChainMerkleBranch []string       `json:"chainmerklebranch"`
 	ParentBlock       string         `json:"parentblock"`
+
+	// ParentHeader is only populated when the decoded form of the AuxPoW
+	// payload is requested.
+	ParentHeader *AuxPowParentHeaderResult `json:"parentheader,omitempty"`
+}
+
+// AuxPowParentHeaderResult models the decoded parent block header of an
+// AuxPoW payload.
+type AuxPowParentHeaderResult struct {
+	Hash         string `json:"hash"`
+	PoWHash      string `json:"powhash"`
+	ChainID      int32  `json:"chainid"`
+	Version      int32  `json:"version"`
+	VersionHex   string `json:"versionHex"`
+	PreviousHash string `json:"previousblockhash"`
+	MerkleRoot   string `json:"merkleroot"`
+	Time         int64  `json:"time"`
+	Bits         string `json:"bits"`
+	Nonce        uint32 `json:"nonce"`
 }
 
 type AuxPowTxResult struct {
@@ -167,9 +187,9 @@ type GetChainTxStatsResult struct {
 	WindowFinalBlockHash   string  `json:"window_final_block_hash"`
 	WindowFinalBlockHeight int32   `json:"window_final_block_height"`
 	WindowBlockCount       int32   `json:"window_block_count"`
-	WindowTxCount          int32   `json:"window_tx_count"`
-	WindowInterval         int32   `json:"window_interval"`
-	TxRate                 float64 `json:"txrate"`
+	WindowTxCount          int32   `json:"window_tx_count,omitempty"`
+	WindowInterval         int32   `json:"window_interval,omitempty"`
+	TxRate                 float64 `json:"txrate,omitempty"`
 }
 
 // CreateMultiSigResult models the data returned from the createmultisig
@@ -492,27 +512,28 @@ type GetNodeAddressesResult struct {
 
 // GetPeerInfoResult models the data returned from the getpeerinfo command.
 type GetPeerInfoResult struct {
-	ID             int32   `json:"id"`
-	Addr           string  `json:"addr"`
-	AddrLocal      string  `json:"addrlocal,omitempty"`
-	Services       string  `json:"services"`
-	RelayTxes      bool    `json:"relaytxes"`
-	LastSend       int64   `json:"lastsend"`
-	LastRecv       int64   `json:"lastrecv"`
-	BytesSent      uint64  `json:"bytessent"`
-	BytesRecv      uint64  `json:"bytesrecv"`
-	ConnTime       int64   `json:"conntime"`
-	TimeOffset     int64   `json:"timeoffset"`
-	PingTime       float64 `json:"pingtime"`
-	PingWait       float64 `json:"pingwait,omitempty"`
-	Version        uint32  `json:"version"`
-	SubVer         string  `json:"subver"`
-	Inbound        bool    `json:"inbound"`
-	StartingHeight int32   `json:"startingheight"`
-	CurrentHeight  int32   `json:"currentheight,omitempty"`
-	BanScore       int32   `json:"banscore"`
-	FeeFilter      int64   `json:"feefilter"`
-	SyncNode       bool    `json:"syncnode"`
+	ID             int32    `json:"id"`
+	Addr           string   `json:"addr"`
+	AddrLocal      string   `json:"addrlocal,omitempty"`
+	Services       string   `json:"services"`
+	RelayTxes      bool     `json:"relaytxes"`
+	LastSend       int64    `json:"lastsend"`
+	LastRecv       int64    `json:"lastrecv"`
+	BytesSent      uint64   `json:"bytessent"`
+	BytesRecv      uint64   `json:"bytesrecv"`
+	ConnTime       int64    `json:"conntime"`
+	TimeOffset     int64    `json:"timeoffset"`
+	PingTime       float64  `json:"pingtime"`
+	PingWait       float64  `json:"pingwait,omitempty"`
+	Version        uint32   `json:"version"`
+	SubVer         string   `json:"subver"`
+	Inbound        bool     `json:"inbound"`
+	StartingHeight int32    `json:"startingheight"`
+	CurrentHeight  int32    `json:"currentheight,omitempty"`
+	BanScore       int32    `json:"banscore"`
+	FeeFilter      int64    `json:"feefilter"`
+	SyncNode       bool     `json:"syncnode"`
+	Permissions    []string `json:"permissions"`
 }
 
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
@@ -608,11 +629,59 @@ func (g *GetTxOutSetInfoResult) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// DumpTxOutSetResult models the data from the dumptxoutset command.
+type DumpTxOutSetResult struct {
+	CoinsWritten uint64 `json:"coins_written"`
+	BaseHash     string `json:"base_hash"`
+	BaseHeight   int32  `json:"base_height"`
+	Path         string `json:"path"`
+	TxOutSetHash string `json:"txoutset_hash"`
+	ChainTxCount uint64 `json:"nchaintx"`
+}
+
+// LoadTxOutSetResult models the data from the loadtxoutset command.
+type LoadTxOutSetResult struct {
+	CoinsLoaded uint64 `json:"coins_loaded"`
+	TipHash     string `json:"tip_hash"`
+	BaseHeight  int32  `json:"base_height"`
+	Path        string `json:"path"`
+}
+
+// VerifyChainFailure models the block that failed the checks of the
+// verifychain command.
+type VerifyChainFailure struct {
+	Hash       string `json:"hash"`
+	Height     int32  `json:"height"`
+	CheckLevel int32  `json:"checklevel"`
+	Check      string `json:"check"`
+	Reason     string `json:"reason"`
+}
+
+// VerifyChainResult models the data from the verifychain command.
+type VerifyChainResult struct {
+	Verified      bool                `json:"verified"`
+	CheckLevel    int32               `json:"checklevel"`
+	BlocksChecked int32               `json:"blockschecked"`
+	Failure       *VerifyChainFailure `json:"failure,omitempty"`
+}
+
 // GetNetTotalsResult models the data returned from the getnettotals command.
 type GetNetTotalsResult struct {
-	TotalBytesRecv uint64 `json:"totalbytesrecv"`
-	TotalBytesSent uint64 `json:"totalbytessent"`
-	TimeMillis     int64  `json:"timemillis"`
+	TotalBytesRecv uint64                         `json:"totalbytesrecv"`
+	TotalBytesSent uint64                         `json:"totalbytessent"`
+	TimeMillis     int64                          `json:"timemillis"`
+	UploadTarget   GetNetTotalsUploadTargetResult `json:"uploadtarget"`
+}
+
+// GetNetTotalsUploadTargetResult models the upload target data returned from
+// the getnettotals command.
+type GetNetTotalsUploadTargetResult struct {
+	Timeframe             int64  `json:"timeframe"`
+	Target                uint64 `json:"target"`
+	TargetReached         bool   `json:"target_reached"`
+	ServeHistoricalBlocks bool   `json:"serve_historical_blocks"`
+	BytesLeftInCycle      uint64 `json:"bytes_left_in_cycle"`
+	TimeLeftInCycle       int64  `json:"time_left_in_cycle"`
 }
 
 // ScriptSig models a signature script.  It is defined separately since it only
@@ -32,6 +32,12 @@ const (
 	// disconnected.
 	FilteredBlockDisconnectedNtfnMethod = "filteredblockdisconnected"
 
+	// ChainReorgBlockedNtfnMethod is the method used for notifications
+	// from the chain server that a side chain with more work than the main
+	// chain was not made the main chain because the reorganization would
+	// be deeper than the configured maximum.
+	ChainReorgBlockedNtfnMethod = "chainreorgblocked"
+
 	// RecvTxNtfnMethod is the legacy, deprecated method used for
 	// notifications from the chain server that a transaction which pays to
 	// a registered address has been processed.
@@ -154,6 +160,34 @@ func NewFilteredBlockDisconnectedNtfn(height int32, header string) *FilteredBloc
 	}
 }
 
+// ChainReorgBlockedNtfn defines the chainreorgblocked JSON-RPC notification.
+type ChainReorgBlockedNtfn struct {
+	Hash       string
+	Height     int32
+	ForkHash   string
+	ForkHeight int32
+	TipHash    string
+	TipHeight  int32
+	Depth      int32
+}
+
+// NewChainReorgBlockedNtfn returns a new instance which can be used to issue a
+// chainreorgblocked JSON-RPC notification.
+func NewChainReorgBlockedNtfn(hash string, height int32, forkHash string,
+	forkHeight int32, tipHash string, tipHeight int32,
+	depth int32) *ChainReorgBlockedNtfn {
+
+	return &ChainReorgBlockedNtfn{
+		Hash:       hash,
+		Height:     height,
+		ForkHash:   forkHash,
+		ForkHeight: forkHeight,
+		TipHash:    tipHash,
+		TipHeight:  tipHeight,
+		Depth:      depth,
+	}
+}
+
 // BlockDetails describes details of a tx in a block.
 type BlockDetails struct {
 	Height int32  `json:"height"`
@@ -295,6 +329,7 @@ func init() {
 	MustRegisterCmd(BlockDisconnectedNtfnMethod, (*BlockDisconnectedNtfn)(nil), flags)
 	MustRegisterCmd(FilteredBlockConnectedNtfnMethod, (*FilteredBlockConnectedNtfn)(nil), flags)
 	MustRegisterCmd(FilteredBlockDisconnectedNtfnMethod, (*FilteredBlockDisconnectedNtfn)(nil), flags)
+	MustRegisterCmd(ChainReorgBlockedNtfnMethod, (*ChainReorgBlockedNtfn)(nil), flags)
 	MustRegisterCmd(RecvTxNtfnMethod, (*RecvTxNtfn)(nil), flags)
 	MustRegisterCmd(RedeemingTxNtfnMethod, (*RedeemingTxNtfn)(nil), flags)
 	MustRegisterCmd(RescanFinishedNtfnMethod, (*RescanFinishedNtfn)(nil), flags)
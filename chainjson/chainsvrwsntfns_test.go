@@ -89,6 +89,25 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Header: "header",
 			},
 		},
+		{
+			name: "chainreorgblocked",
+			newNtfn: func() (interface{}, error) {
+				return chainjson.NewCmd("chainreorgblocked", "123", 100008, "456", 100001, "789", 100007, 6)
+			},
+			staticNtfn: func() interface{} {
+				return chainjson.NewChainReorgBlockedNtfn("123", 100008, "456", 100001, "789", 100007, 6)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"chainreorgblocked","params":["123",100008,"456",100001,"789",100007,6],"id":null}`,
+			unmarshalled: &chainjson.ChainReorgBlockedNtfn{
+				Hash:       "123",
+				Height:     100008,
+				ForkHash:   "456",
+				ForkHeight: 100001,
+				TipHash:    "789",
+				TipHeight:  100007,
+				Depth:      6,
+			},
+		},
 		{
 			name: "recvtx",
 			newNtfn: func() (interface{}, error) {
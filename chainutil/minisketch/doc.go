@@ -0,0 +1,28 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package minisketch provides an API for building, merging and decoding PinSketch
+set sketches compatible with the minisketch library over its 32-bit field.
+
+# Set sketches
+
+A sketch with a given capacity summarizes a set of non-zero 32-bit elements in
+4 bytes per unit of capacity, regardless of the size of the set.  Merging the
+sketches of two sets yields the sketch of their symmetric difference, which can
+be decoded as long as it has no more elements than the capacity.  This allows
+two parties to find the differences between their sets while only sending data
+proportional to the number of differences.
+
+# Sketch use in Flokicoin
+
+Sketches are used by transaction relay through set reconciliation (BIP330),
+where peers reconcile the sets of 32-bit short transaction ids they are about
+to announce to each other instead of flooding the announcements.
+
+The elements are the elements of GF(2^32) defined by the irreducible polynomial
+x^32 + x^7 + x^3 + x^2 + 1 and a sketch of capacity c is serialized as its c odd
+power sums, each as 4 little-endian bytes, as done by minisketch.
+*/
+package minisketch
@@ -0,0 +1,223 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package minisketch
+
+// fieldModulus holds the low terms x^7 + x^3 + x^2 + 1 of the irreducible
+// polynomial defining GF(2^32).
+const fieldModulus = 0x8d
+
+// mul returns the product of a and b in GF(2^32).
+func mul(a, b uint32) uint32 {
+	var r uint32
+	for b != 0 {
+		if b&1 != 0 {
+			r ^= a
+		}
+		b >>= 1
+
+		// Multiply a by x, reducing x^32 by the modulus.
+		if a&0x80000000 != 0 {
+			a = a<<1 ^ fieldModulus
+		} else {
+			a <<= 1
+		}
+	}
+	return r
+}
+
+// sqr returns the square of a in GF(2^32).
+func sqr(a uint32) uint32 {
+	return mul(a, a)
+}
+
+// inv returns the multiplicative inverse of the non-zero element a in
+// GF(2^32), computed as a^(2^32-2).
+func inv(a uint32) uint32 {
+	// a^(2^32-2) = a^2 * a^4 * ... * a^(2^31).
+	r := uint32(1)
+	p := a
+	for i := 1; i < 32; i++ {
+		p = sqr(p)
+		r = mul(r, p)
+	}
+	return r
+}
+
+// poly is a polynomial over GF(2^32) with the coefficient of x^i at index i.
+// Polynomials are kept trimmed so the last coefficient is non-zero, and the
+// zero polynomial is empty.
+type poly []uint32
+
+// trim removes the leading zero coefficients of the polynomial.
+func (p poly) trim() poly {
+	for len(p) > 0 && p[len(p)-1] == 0 {
+		p = p[:len(p)-1]
+	}
+	return p
+}
+
+// degree returns the degree of the polynomial, or -1 for the zero polynomial.
+func (p poly) degree() int {
+	return len(p) - 1
+}
+
+// monic returns the polynomial divided by its leading coefficient.
+func (p poly) monic() poly {
+	if len(p) == 0 || p[len(p)-1] == 1 {
+		return p
+	}
+	f := inv(p[len(p)-1])
+	r := make(poly, len(p))
+	for i, c := range p {
+		r[i] = mul(c, f)
+	}
+	return r
+}
+
+// add returns the sum of the polynomials.
+func (p poly) add(q poly) poly {
+	if len(p) < len(q) {
+		p, q = q, p
+	}
+	r := make(poly, len(p))
+	copy(r, p)
+	for i, c := range q {
+		r[i] ^= c
+	}
+	return r.trim()
+}
+
+// mod returns the remainder of the division of p by the non-zero polynomial
+// m.
+func (p poly) mod(m poly) poly {
+	_, r := p.divMod(m)
+	return r
+}
+
+// divMod returns the quotient and remainder of the division of p by the
+// non-zero polynomial m.
+func (p poly) divMod(m poly) (poly, poly) {
+	if len(p) < len(m) {
+		return nil, p
+	}
+
+	r := make(poly, len(p))
+	copy(r, p)
+	q := make(poly, len(p)-len(m)+1)
+	lead := inv(m[len(m)-1])
+	for i := len(r) - 1; i >= len(m)-1; i-- {
+		if r[i] == 0 {
+			continue
+		}
+		f := mul(r[i], lead)
+		shift := i - (len(m) - 1)
+		q[shift] = f
+		for j, c := range m {
+			r[shift+j] ^= mul(c, f)
+		}
+	}
+	return q.trim(), r[:len(m)-1].trim()
+}
+
+// sqrMod returns the square of p modulo m.  Squaring is linear in
+// characteristic 2, so only the coefficients are squared.
+func (p poly) sqrMod(m poly) poly {
+	r := make(poly, 2*len(p))
+	for i, c := range p {
+		r[2*i] = sqr(c)
+	}
+	return r.trim().mod(m)
+}
+
+// gcd returns the monic greatest common divisor of the polynomials.
+func gcd(a, b poly) poly {
+	for len(b) > 0 {
+		a, b = b, a.mod(b)
+	}
+	return a.monic()
+}
+
+// berlekampMassey returns the shortest connection polynomial generating the
+// passed sequence, and its length.
+func berlekampMassey(s []uint32) (poly, int) {
+	c := make(poly, 1, len(s)+1)
+	c[0] = 1
+	b := poly{1}
+	l, m := 0, 1
+	bInv := uint32(1)
+
+	for n := range s {
+		// Compute the discrepancy between the sequence and the
+		// current connection polynomial.
+		d := s[n]
+		for i := 1; i <= l && i < len(c); i++ {
+			d ^= mul(c[i], s[n-i])
+		}
+		if d == 0 {
+			m++
+			continue
+		}
+
+		// c -= d/b * x^m * b.
+		f := mul(d, bInv)
+		t := make(poly, len(c))
+		copy(t, c)
+		if need := len(b) + m; len(c) < need {
+			c = append(c, make(poly, need-len(c))...)
+		}
+		for i, coef := range b {
+			c[i+m] ^= mul(coef, f)
+		}
+
+		if 2*l <= n {
+			l = n + 1 - l
+			b = t
+			bInv = inv(d)
+			m = 1
+		} else {
+			m++
+		}
+	}
+	return c.trim(), l
+}
+
+// findRoots appends the roots of the monic polynomial p to roots, assuming p
+// splits into distinct linear factors.  The polynomial is split with the
+// Berlekamp trace algorithm using the elements x^k for k >= basis, which are
+// enough to separate any two distinct roots.  It returns false when p can't be
+// fully split.
+func findRoots(p poly, basis int, roots []uint32) ([]uint32, bool) {
+	switch p.degree() {
+	case 0:
+		return roots, true
+	case 1:
+		// x + c has the root c in characteristic 2.
+		return append(roots, p[0]), true
+	}
+
+	for ; basis < 32; basis++ {
+		// Compute the trace map Tr(a*x) = sum((a*x)^(2^i)) modulo p,
+		// whose value at each root of p is either 0 or 1.
+		t := poly{0, uint32(1) << basis}.mod(p)
+		trace := t
+		for i := 1; i < 32; i++ {
+			t = t.sqrMod(p)
+			trace = trace.add(t)
+		}
+
+		g := gcd(p, trace)
+		if g.degree() <= 0 || g.degree() == p.degree() {
+			continue
+		}
+		q, _ := p.divMod(g)
+
+		var ok bool
+		if roots, ok = findRoots(g, basis+1, roots); !ok {
+			return roots, false
+		}
+		return findRoots(q.monic(), basis+1, roots)
+	}
+	return roots, false
+}
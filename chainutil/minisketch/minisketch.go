@@ -0,0 +1,149 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package minisketch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ElementSize is the size in bytes of a serialized sketch element, so a sketch
+// of capacity c is serialized in c*ElementSize bytes.
+const ElementSize = 4
+
+// ErrDecode signifies that a sketch can't be decoded, usually because the
+// sketched set difference has more elements than its capacity.
+var ErrDecode = errors.New("sketch can't be decoded")
+
+// Sketch is a PinSketch of a set of non-zero 32-bit elements.  Adding an
+// element that is already in the set removes it, which makes the sketch of
+// the symmetric difference of two sets the merge of their sketches.
+type Sketch struct {
+	// syndromes holds the odd power sums of the elements of the set, so
+	// syndromes[i] is the sum of e^(2i+1) for each element e.
+	syndromes []uint32
+}
+
+// New returns an empty sketch which can decode up to capacity elements.
+func New(capacity int) *Sketch {
+	return &Sketch{syndromes: make([]uint32, capacity)}
+}
+
+// Capacity returns the maximum number of elements the sketch can decode.
+func (s *Sketch) Capacity() int {
+	return len(s.syndromes)
+}
+
+// Add adds the passed element to the sketched set, or removes it when it was
+// already added.  Zero is not a valid element and is ignored.
+func (s *Sketch) Add(element uint32) {
+	if element == 0 {
+		return
+	}
+
+	sq := sqr(element)
+	power := element
+	for i := range s.syndromes {
+		s.syndromes[i] ^= power
+		power = mul(power, sq)
+	}
+}
+
+// Merge merges the passed sketch into the sketch, which then sketches the
+// symmetric difference of both sets.  The capacity of the sketch is reduced to
+// the one of the passed sketch when it is lower.
+func (s *Sketch) Merge(other *Sketch) {
+	if len(other.syndromes) < len(s.syndromes) {
+		s.syndromes = s.syndromes[:len(other.syndromes)]
+	}
+	for i := range s.syndromes {
+		s.syndromes[i] ^= other.syndromes[i]
+	}
+}
+
+// Serialize returns the serialized sketch.
+func (s *Sketch) Serialize() []byte {
+	b := make([]byte, len(s.syndromes)*ElementSize)
+	for i, syndrome := range s.syndromes {
+		binary.LittleEndian.PutUint32(b[i*ElementSize:], syndrome)
+	}
+	return b
+}
+
+// Deserialize returns the sketch serialized in the passed bytes.  Its capacity
+// is determined by their length.
+func Deserialize(b []byte) (*Sketch, error) {
+	if len(b)%ElementSize != 0 {
+		return nil, fmt.Errorf("serialized sketch length %d is not a "+
+			"multiple of %d", len(b), ElementSize)
+	}
+
+	s := New(len(b) / ElementSize)
+	for i := range s.syndromes {
+		s.syndromes[i] = binary.LittleEndian.Uint32(b[i*ElementSize:])
+	}
+	return s, nil
+}
+
+// Decode returns the elements of the sketched set.  It returns ErrDecode when
+// the set can't be recovered, which is always the case when it has more
+// elements than the capacity of the sketch.
+func (s *Sketch) Decode() ([]uint32, error) {
+	// Recover all the power sums from the odd ones, since the sum of
+	// e^(2i) is the square of the sum of e^i in characteristic 2.
+	sums := make([]uint32, 2*len(s.syndromes))
+	for i := range sums {
+		power := i + 1
+		if power%2 == 1 {
+			sums[i] = s.syndromes[power/2]
+		} else {
+			sums[i] = sqr(sums[power/2-1])
+		}
+	}
+
+	// The shortest linear recurrence generating the power sums has the
+	// connection polynomial prod(1 - e*x) over the elements e.
+	conn, n := berlekampMassey(sums)
+	if n > len(s.syndromes) || conn.degree() != n {
+		return nil, ErrDecode
+	}
+
+	// The elements are the roots of the reversed connection polynomial
+	// prod(x - e), which must split into distinct linear factors.  That is
+	// the case when it divides x^(2^32) - x.
+	locator := make(poly, len(conn))
+	for i, c := range conn {
+		locator[len(conn)-1-i] = c
+	}
+	locator = locator.monic()
+	if n > 0 {
+		x := poly{0, 1}.mod(locator)
+		p := x
+		for i := 0; i < 32; i++ {
+			p = p.sqrMod(locator)
+		}
+		if len(p.add(x)) != 0 {
+			return nil, ErrDecode
+		}
+	}
+
+	elements, ok := findRoots(locator, 0, make([]uint32, 0, n))
+	if !ok || len(elements) != n {
+		return nil, ErrDecode
+	}
+
+	// Make sure the elements produce the sketch.
+	check := New(len(s.syndromes))
+	for _, e := range elements {
+		check.Add(e)
+	}
+	for i, syndrome := range check.syndromes {
+		if syndrome != s.syndromes[i] {
+			return nil, ErrDecode
+		}
+	}
+	return elements, nil
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package minisketch
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// TestField ensures the field arithmetic reduces by the minisketch modulus.
+func TestField(t *testing.T) {
+	tests := []struct {
+		a, b, want uint32
+	}{
+		{0, 0x12345678, 0},
+		{1, 0x12345678, 0x12345678},
+		{2, 3, 6},
+		{3, 3, 5},
+		{0x80000000, 2, fieldModulus},
+		{0x80000000, 4, fieldModulus << 1},
+	}
+	for _, test := range tests {
+		if got := mul(test.a, test.b); got != test.want {
+			t.Errorf("mul(%#x, %#x): got %#x, want %#x", test.a,
+				test.b, got, test.want)
+		}
+		if got := mul(test.b, test.a); got != test.want {
+			t.Errorf("mul(%#x, %#x): got %#x, want %#x", test.b,
+				test.a, got, test.want)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		a := rng.Uint32() | 1
+		if got := mul(a, inv(a)); got != 1 {
+			t.Fatalf("%#x * inv(%#x) = %#x, want 1", a, a, got)
+		}
+	}
+}
+
+// TestSerialize ensures sketches are serialized as their odd power sums in
+// little endian.
+func TestSerialize(t *testing.T) {
+	s := New(3)
+	s.Add(2)
+	want := []byte{
+		0x02, 0x00, 0x00, 0x00, // x
+		0x08, 0x00, 0x00, 0x00, // x^3
+		0x20, 0x00, 0x00, 0x00, // x^5
+	}
+	got := s.Serialize()
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+
+	s2, err := Deserialize(got)
+	if err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if s2.Capacity() != 3 || !bytes.Equal(s2.Serialize(), want) {
+		t.Fatalf("unexpected deserialized sketch %x", s2.Serialize())
+	}
+
+	if _, err := Deserialize(make([]byte, 5)); err == nil {
+		t.Fatal("Deserialize: expected error for truncated sketch")
+	}
+}
+
+// TestDecode ensures the symmetric difference of two sets is recovered from
+// their merged sketches when it fits the capacity, and decoding fails
+// otherwise.
+func TestDecode(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	randomElements := func(n int) []uint32 {
+		elements := make([]uint32, n)
+		for i := range elements {
+			elements[i] = rng.Uint32() | 1
+		}
+		return elements
+	}
+
+	tests := []struct {
+		name     string
+		capacity int
+		common   int
+		onlyA    int
+		onlyB    int
+		wantFail bool
+	}{
+		{name: "empty", capacity: 4},
+		{name: "no difference", capacity: 4, common: 50},
+		{name: "single", capacity: 1, common: 10, onlyA: 1},
+		{name: "both sides", capacity: 10, common: 100, onlyA: 4, onlyB: 6},
+		{name: "large", capacity: 100, common: 500, onlyA: 50, onlyB: 30},
+		{name: "over capacity", capacity: 8, common: 20, onlyA: 10,
+			onlyB: 10, wantFail: true},
+	}
+
+	for _, test := range tests {
+		common := randomElements(test.common)
+		onlyA := randomElements(test.onlyA)
+		onlyB := randomElements(test.onlyB)
+
+		a, b := New(test.capacity), New(test.capacity)
+		for _, e := range common {
+			a.Add(e)
+			b.Add(e)
+		}
+		for _, e := range onlyA {
+			a.Add(e)
+		}
+		for _, e := range onlyB {
+			b.Add(e)
+		}
+
+		a.Merge(b)
+		got, err := a.Decode()
+		if test.wantFail {
+			if err != ErrDecode {
+				t.Errorf("%s: got %v, want ErrDecode", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Decode: %v", test.name, err)
+			continue
+		}
+
+		want := append(append([]uint32{}, onlyA...), onlyB...)
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d elements, want %d", test.name,
+				len(got), len(want))
+			continue
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%s: got %x, want %x", test.name, got, want)
+				break
+			}
+		}
+	}
+}
+
+// TestMergeCapacity ensures merging with a smaller sketch reduces the capacity
+// while keeping the sketch decodable.
+func TestMergeCapacity(t *testing.T) {
+	a, b := New(8), New(4)
+	a.Add(5)
+	a.Add(7)
+	b.Add(7)
+	b.Add(11)
+	a.Merge(b)
+	if a.Capacity() != 4 {
+		t.Fatalf("got capacity %d, want 4", a.Capacity())
+	}
+	got, err := a.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	if len(got) != 2 || got[0] != 5 || got[1] != 11 {
+		t.Fatalf("got %v, want [5 11]", got)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/blockchain"
+	"github.com/flokiorg/go-flokicoin/chaincfg"
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/wire"
+	flags "github.com/jessevdk/go-flags"
+)
+
+type config struct {
+	Message      string  `short:"m" long:"message" description:"Timestamp message to embed in the genesis coinbase (required)"`
+	OutputScript string  `short:"s" long:"outputscript" description:"Hex-encoded script paid by the genesis coinbase (required)"`
+	Reward       float64 `short:"r" long:"reward" description:"Genesis coinbase reward in FLC"`
+	Bits         string  `short:"b" long:"bits" description:"Compact difficulty target of the genesis block (eg. 0x1e0ffff0)"`
+	Version      int32   `short:"v" long:"version" description:"Block version of the genesis block"`
+	Timestamp    int64   `short:"t" long:"timestamp" description:"Unix timestamp of the genesis block (default: current time)"`
+	Name         string  `short:"n" long:"name" description:"Variable name prefix used in the generated Go snippet"`
+	Format       string  `short:"f" long:"format" description:"Output format" choice:"go" choice:"json" choice:"all"`
+	Workers      int     `short:"w" long:"workers" description:"Number of goroutines used to search for the nonce (default: number of CPUs)"`
+}
+
+func main() {
+	cfg := config{
+		Reward:  1000,
+		Bits:    "0x207fffff",
+		Version: 1,
+		Name:    "privNet",
+		Format:  "all",
+	}
+	parser := flags.NewParser(&cfg, flags.Default)
+	_, err := parser.Parse()
+	if err != nil {
+		if e, ok := err.(*flags.Error); !ok || e.Type != flags.ErrHelp {
+			parser.WriteHelp(os.Stderr)
+		}
+		return
+	}
+
+	if cfg.Message == "" || cfg.OutputScript == "" {
+		fmt.Fprintln(os.Stderr, "the message and output script must be specified")
+		parser.WriteHelp(os.Stderr)
+		os.Exit(1)
+	}
+	if len(cfg.Message) > 0xff {
+		fmt.Fprintln(os.Stderr, "the message must not exceed 255 bytes")
+		os.Exit(1)
+	}
+	pkScript, err := hex.DecodeString(cfg.OutputScript)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid output script: %v\n", err)
+		os.Exit(1)
+	}
+	reward, err := chainutil.NewAmount(cfg.Reward)
+	if err != nil || reward < 0 {
+		fmt.Fprintf(os.Stderr, "invalid reward: %v\n", cfg.Reward)
+		os.Exit(1)
+	}
+	bits, err := strconv.ParseUint(cfg.Bits, 0, 32)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid bits: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Timestamp == 0 {
+		cfg.Timestamp = time.Now().Unix()
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+
+	def := chaincfg.GenesisDefinition{
+		Version:      cfg.Version,
+		Timestamp:    cfg.Timestamp,
+		Bits:         uint32(bits),
+		Message:      cfg.Message,
+		Reward:       int64(reward),
+		OutputScript: hex.EncodeToString(pkScript),
+	}
+	block, err := def.GenesisBlock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot build genesis block: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Searching for a nonce with %d workers, target "+
+		"%064x\n", cfg.Workers, blockchain.CompactToBig(def.Bits))
+	start := time.Now()
+	solveGenesis(&block.Header, cfg.Workers)
+	fmt.Fprintf(os.Stderr, "Found nonce %d (timestamp %d) in %v\n",
+		block.Header.Nonce, block.Header.Timestamp.Unix(),
+		time.Since(start).Round(time.Millisecond))
+
+	hash := block.BlockHash()
+	def.Timestamp = block.Header.Timestamp.Unix()
+	def.Nonce = block.Header.Nonce
+	def.Hash = hash.String()
+
+	if cfg.Format == "go" || cfg.Format == "all" {
+		writeGoSnippet(os.Stdout, cfg.Name, block, &def)
+	}
+	if cfg.Format == "json" || cfg.Format == "all" {
+		if err := writeJSON(os.Stdout, &def); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot encode json: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// solveGenesis searches for a nonce that makes the Scrypt proof of work hash of
+// the passed header meet its target and updates the header with it.  When the
+// whole nonce space is exhausted the timestamp is advanced by a second and the
+// search starts again.
+func solveGenesis(header *wire.BlockHeader, workers int) {
+	// sgResult is used by the solver goroutines to send results.
+	type sgResult struct {
+		found bool
+		nonce uint32
+	}
+
+	target := blockchain.CompactToBig(header.Bits)
+	for {
+		quit := make(chan struct{})
+		results := make(chan sgResult, workers)
+		solver := func(hdr wire.BlockHeader, startNonce, stopNonce uint32) {
+			// The header is passed by value so each solver works on
+			// its own copy.
+			for n := uint64(startNonce); n <= uint64(stopNonce); n++ {
+				select {
+				case <-quit:
+					return
+				default:
+				}
+
+				hdr.Nonce = uint32(n)
+				hash := hdr.BlockPoWHash()
+				if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+					results <- sgResult{true, hdr.Nonce}
+					return
+				}
+			}
+			results <- sgResult{false, 0}
+		}
+
+		noncesPerWorker := math.MaxUint32 / uint32(workers)
+		for i := uint32(0); i < uint32(workers); i++ {
+			rangeStart := noncesPerWorker * i
+			rangeStop := rangeStart + noncesPerWorker - 1
+			if i == uint32(workers)-1 {
+				rangeStop = math.MaxUint32
+			}
+			go solver(*header, rangeStart, rangeStop)
+		}
+		for i := 0; i < workers; i++ {
+			result := <-results
+			if result.found {
+				close(quit)
+				header.Nonce = result.nonce
+				return
+			}
+		}
+		close(quit)
+
+		header.Timestamp = header.Timestamp.Add(time.Second)
+	}
+}
+
+// formatHashBytes returns the passed hash as a Go byte slice literal body in
+// the layout used by chaincfg/genesis.go.
+func formatHashBytes(hash *chainhash.Hash) string {
+	var b strings.Builder
+	for i, v := range hash {
+		if i%8 == 0 {
+			b.WriteString("\t")
+		}
+		fmt.Fprintf(&b, "0x%02x,", v)
+		if i%8 == 7 {
+			b.WriteString("\n")
+		} else {
+			b.WriteString(" ")
+		}
+	}
+	return b.String()
+}
+
+// writeGoSnippet writes the genesis block definitions in the layout used by
+// chaincfg/genesis.go so they can be pasted into that file.
+func writeGoSnippet(w io.Writer, name string, block *wire.MsgBlock,
+	def *chaincfg.GenesisDefinition) {
+
+	hash := block.BlockHash()
+	merkleRoot := block.Header.MerkleRoot
+	target := blockchain.CompactToBig(block.Header.Bits)
+
+	fmt.Fprintf(w, "// %sGenesisHash is the hash of the first block in "+
+		"the block chain for the\n// %s network (genesis block).\n",
+		name, name)
+	fmt.Fprintf(w, "var %sGenesisHash = chainhash.Hash([chainhash.HashSize]byte{\n%s}) // %v\n\n",
+		name, formatHashBytes(&hash), hash)
+
+	fmt.Fprintf(w, "// %sGenesisMerkleRoot is the hash of the first "+
+		"transaction in the genesis\n// block for the %s network.\n",
+		name, name)
+	fmt.Fprintf(w, "var %sGenesisMerkleRoot = chainhash.Hash([chainhash.HashSize]byte{\n%s}) // %v\n\n",
+		name, formatHashBytes(&merkleRoot), merkleRoot)
+
+	fmt.Fprintf(w, "// %sGenesisOutputScript is the script paid by the "+
+		"coinbase of the %s\n// genesis block.\n", name, name)
+	fmt.Fprintf(w, "var %sGenesisOutputScript, _ = hex.DecodeString(\"%s\")\n\n",
+		name, def.OutputScript)
+
+	fmt.Fprintf(w, "// %sGenesisBlock defines the genesis block of the "+
+		"block chain which serves\n// as the public transaction ledger "+
+		"for the %s network.\n", name, name)
+	fmt.Fprintf(w, "var %sGenesisBlock = wire.MsgBlock{\n", name)
+	fmt.Fprintf(w, "\tHeader: wire.BlockHeader{\n")
+	fmt.Fprintf(w, "\t\tVersion:    %d,\n", block.Header.Version)
+	fmt.Fprintf(w, "\t\tPrevBlock:  chainhash.Hash{},\n")
+	fmt.Fprintf(w, "\t\tMerkleRoot: %sGenesisMerkleRoot,\n", name)
+	fmt.Fprintf(w, "\t\tTimestamp:  time.Unix(%d, 0), // %s\n",
+		block.Header.Timestamp.Unix(),
+		block.Header.Timestamp.UTC().Format("2 Jan 2006 15:04:05 -0700 MST"))
+	fmt.Fprintf(w, "\t\tBits:       0x%08x, // %d [%064x]\n",
+		block.Header.Bits, block.Header.Bits, target)
+	fmt.Fprintf(w, "\t\tNonce:      %d,\n", block.Header.Nonce)
+	fmt.Fprintf(w, "\t},\n")
+	fmt.Fprintf(w, "\tTransactions: []*wire.MsgTx{GenesisCoinbaseTx(\n")
+	fmt.Fprintf(w, "\t\t%q, %d, %sGenesisOutputScript,\n", def.Message,
+		def.Reward, name)
+	fmt.Fprintf(w, "\t)},\n")
+	fmt.Fprintf(w, "}\n\n")
+}
+
+// writeJSON writes the genesis section of a chain parameters file as accepted
+// by lokid --chainparams.
+func writeJSON(w io.Writer, def *chaincfg.GenesisDefinition) error {
+	out := struct {
+		Genesis *chaincfg.GenesisDefinition `json:"genesis"`
+	}{def}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
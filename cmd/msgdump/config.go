@@ -0,0 +1,52 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/flokiorg/go-flokicoin/wire"
+	flags "github.com/jessevdk/go-flags"
+)
+
+// config defines the configuration options for msgdump.
+//
+// See loadConfig for details on the configuration load process.
+type config struct {
+	Commands        []string `short:"c" long:"command" description:"Only show messages with the specified command -- May be specified multiple times"`
+	ProtocolVersion uint32   `short:"p" long:"pver" description:"Protocol version used to decode the messages"`
+	Summary         bool     `short:"s" long:"summary" description:"Only show the time, direction, command and size of each message"`
+}
+
+// loadConfig initializes and parses the config using command line options.
+// The remaining arguments are the capture files to decode.
+func loadConfig() (*config, []string, error) {
+	// Default config.
+	cfg := config{
+		ProtocolVersion: wire.ProtocolVersion,
+	}
+
+	// Parse command line options.
+	parser := flags.NewParser(&cfg, flags.Default)
+	parser.Usage = "[OPTIONS] capture-file..."
+	remainingArgs, err := parser.Parse()
+	if err != nil {
+		if e, ok := err.(*flags.Error); !ok || e.Type != flags.ErrHelp {
+			parser.WriteHelp(os.Stderr)
+		}
+		return nil, nil, err
+	}
+
+	if len(remainingArgs) == 0 {
+		str := "%s: At least one capture file must be specified"
+		err := fmt.Errorf(str, "loadConfig")
+		fmt.Fprintln(os.Stderr, err)
+		parser.WriteHelp(os.Stderr)
+		return nil, nil, err
+	}
+
+	return &cfg, remainingArgs, nil
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/msgcapture"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// record is a message read from a capture file written by lokid with
+// --capturemessages.
+type record struct {
+	*msgcapture.Record
+
+	// peer is the peer the message was exchanged with, named after the
+	// capture file.
+	peer string
+}
+
+// readCapture returns the records of the passed capture file.  The records
+// read before an error are returned along with it, so a file truncated by a
+// crash can still be decoded.
+func readCapture(path string) ([]record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	peer := strings.TrimSuffix(filepath.Base(path), ".dat")
+	r := bufio.NewReader(f)
+	var records []record
+	for {
+		rec, err := msgcapture.ReadRecord(r)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("%s: unable to read record "+
+				"%d: %v", path, len(records), err)
+		}
+		records = append(records, record{Record: rec, peer: peer})
+	}
+}
+
+// decodeMessage decodes the passed record with the wire package.  The payload
+// is framed as a regular wire message so it goes through the same checks as
+// the messages read from peers.
+func decodeMessage(rec *record, pver uint32) (wire.Message, error) {
+	var buf bytes.Buffer
+	var hdr [24]byte
+	binary.LittleEndian.PutUint32(hdr[:4], uint32(wire.MainNet))
+	copy(hdr[4:4+wire.CommandSize], rec.Command)
+	binary.LittleEndian.PutUint32(hdr[16:20], uint32(len(rec.Payload)))
+	copy(hdr[20:], chainhash.DoubleHashB(rec.Payload)[:4])
+	buf.Write(hdr[:])
+	buf.Write(rec.Payload)
+
+	_, msg, _, err := wire.ReadMessageWithEncodingN(&buf, pver,
+		wire.MainNet, wire.WitnessEncoding)
+	return msg, err
+}
+
+// realMain is the real main function for the utility.  It is necessary to work
+// around the fact that deferred functions do not run when os.Exit() is called.
+func realMain() error {
+	cfg, files, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// Read the records of all the files, sorting them by time so the
+	// messages exchanged with several peers are shown in order.
+	var records []record
+	var readErr error
+	for _, file := range files {
+		fileRecords, err := readCapture(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			readErr = errors.New("unable to read all capture files")
+		}
+		records = append(records, fileRecords...)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+
+	commands := make(map[string]struct{}, len(cfg.Commands))
+	for _, command := range cfg.Commands {
+		commands[command] = struct{}{}
+	}
+
+	for i := range records {
+		rec := &records[i]
+		if _, ok := commands[rec.Command]; len(commands) > 0 && !ok {
+			continue
+		}
+
+		direction := "recv"
+		if rec.Sent {
+			direction = "sent"
+		}
+		fmt.Printf("%s %s %s %s (%d bytes)\n",
+			rec.Time.UTC().Format("2006-01-02 15:04:05.000000"),
+			direction, rec.peer, rec.Command, len(rec.Payload))
+		if cfg.Summary {
+			continue
+		}
+
+		msg, err := decodeMessage(rec, cfg.ProtocolVersion)
+		if err != nil {
+			fmt.Printf("unable to decode message: %v\n%s\n", err,
+				spew.Sdump(rec.Payload))
+			continue
+		}
+		fmt.Println(spew.Sdump(msg))
+	}
+
+	return readErr
+}
+
+func main() {
+	if err := realMain(); err != nil {
+		os.Exit(1)
+	}
+}
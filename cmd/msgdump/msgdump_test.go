@@ -0,0 +1,128 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg"
+	"github.com/flokiorg/go-flokicoin/msgcapture"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// TestCaptureRoundTrip ensures the messages captured the way lokid does with
+// --capturemessages are read back and decoded as they were exchanged.
+func TestCaptureRoundTrip(t *testing.T) {
+	pver := wire.ProtocolVersion
+	rawMessage := func(msg wire.Message) []byte {
+		var buf bytes.Buffer
+		err := wire.WriteMessage(&buf, msg, pver, wire.MainNet)
+		if err != nil {
+			t.Fatalf("WriteMessage: unexpected err: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	// A ping with a truncated payload fails to decode, but is captured
+	// as it was received anyway.
+	malformed := rawMessage(wire.NewMsgPing(1))
+	malformed = malformed[:len(malformed)-3]
+
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	headers := wire.NewMsgHeaders()
+	headers.AddBlockHeader(&genesis.Header)
+	tests := []struct {
+		sent bool
+		raw  []byte
+		msg  wire.Message
+	}{
+		{sent: true, raw: rawMessage(wire.NewMsgPing(1)),
+			msg: wire.NewMsgPing(1)},
+		{sent: false, raw: rawMessage(headers), msg: headers},
+		{sent: false, raw: rawMessage(genesis), msg: genesis},
+		{sent: false, raw: malformed},
+	}
+
+	path := filepath.Join(t.TempDir(), "127.0.0.1_15212.dat")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.UnixMicro(time.Now().UnixMicro())
+	for i, test := range tests {
+		when := start.Add(time.Duration(i) * time.Second)
+		rec, ok := msgcapture.RecordFromRaw(when, test.sent, test.raw)
+		if !ok {
+			t.Fatalf("#%d: RecordFromRaw: no record", i)
+		}
+		if err := msgcapture.WriteRecord(f, rec); err != nil {
+			t.Fatalf("#%d: WriteRecord: unexpected err: %v", i, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := readCapture(path)
+	if err != nil {
+		t.Fatalf("readCapture: unexpected err: %v", err)
+	}
+	if len(records) != len(tests) {
+		t.Fatalf("got %d records, want %d", len(records), len(tests))
+	}
+	for i, test := range tests {
+		rec := &records[i]
+		when := start.Add(time.Duration(i) * time.Second)
+		if rec.peer != "127.0.0.1_15212" || !rec.Time.Equal(when) ||
+			rec.Sent != test.sent {
+
+			t.Fatalf("#%d: unexpected record %v %v %v", i, rec.peer,
+				rec.Time, rec.Sent)
+		}
+		if !bytes.Equal(rec.Payload, test.raw[wire.MessageHeaderSize:]) {
+			t.Fatalf("#%d: payload %x, want %x", i, rec.Payload,
+				test.raw[wire.MessageHeaderSize:])
+		}
+
+		msg, err := decodeMessage(rec, pver)
+		if test.msg == nil {
+			if err == nil {
+				t.Fatalf("#%d: decoded malformed message", i)
+			}
+			if rec.Command != wire.CmdPing {
+				t.Fatalf("#%d: got command %q, want %q", i,
+					rec.Command, wire.CmdPing)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("#%d: decodeMessage: unexpected err: %v", i, err)
+		}
+		if !reflect.DeepEqual(msg, test.msg) {
+			t.Fatalf("#%d: decoded %v, want %v", i, msg, test.msg)
+		}
+	}
+
+	// A record truncated by a crash is reported along with the records
+	// read before it.
+	f, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(make([]byte, msgcapture.RecordHeaderSize-1)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	records, err = readCapture(path)
+	if err == nil || len(records) != len(tests) {
+		t.Fatalf("got %d records and err %v for a truncated file",
+			len(records), err)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"os"
 	"path/filepath"
@@ -30,6 +31,7 @@ import (
 	"github.com/flokiorg/go-flokicoin/database"
 	_ "github.com/flokiorg/go-flokicoin/database/ffldb"
 	"github.com/flokiorg/go-flokicoin/mempool"
+	"github.com/flokiorg/go-flokicoin/netaddr"
 	"github.com/flokiorg/go-flokicoin/peer"
 	"github.com/flokiorg/go-flokicoin/wire"
 	"github.com/flokiorg/go-socks/socks"
@@ -103,6 +105,7 @@ type config struct {
 	AddrIndex            bool          `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
 	AgentBlacklist       []string      `long:"agentblacklist" description:"A comma separated list of user-agent substrings which will cause lokid to reject any peers whose user-agent contains any of the blacklisted substrings."`
 	AgentWhitelist       []string      `long:"agentwhitelist" description:"A comma separated list of user-agent substrings which will cause lokid to require all peers' user-agents to contain one of the whitelisted substrings. The blacklist is applied before the whitelist, and an empty whitelist will allow all agents that do not fail the blacklist."`
+	AssumeValid          string        `long:"assumevalid" description:"Skip the script checks of this block and its ancestors once it's buried deep enough in the best header chain, defaulting to the one of the network if any -- 0 checks the scripts of all blocks"`
 	BanDuration          time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold         uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
 	BlockMaxSize         uint32        `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
@@ -111,11 +114,14 @@ type config struct {
 	BlockMinWeight       uint32        `long:"blockminweight" description:"Minimum block weight to be used when creating a block"`
 	BlockPrioritySize    uint32        `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
 	BlocksOnly           bool          `long:"blocksonly" description:"Do not accept transactions from remote peers."`
+	CaptureMessages      bool          `long:"capturemessages" description:"Write every message sent to and received from each peer to a file per peer in the capture directory of the data directory -- Use the msgdump utility to decode them"`
+	ChainParams          string        `long:"chainparams" description:"Path to a JSON file defining the parameters of a private network to use instead of one of the standard networks -- other formats such as TOML are not supported"`
 	ConfigFile           string        `short:"C" long:"configfile" description:"Path to configuration file"`
 	ConnectPeers         []string      `long:"connect" description:"Connect only to the specified peers at startup"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
 	MemoryProfile        string        `long:"memprofile" description:"Write memory profile to the specified file"`
 	TraceProfile         string        `long:"traceprofile" description:"Write execution trace to the specified file"`
+	CJDNSReachable       bool          `long:"cjdnsreachable" description:"Treat IPv6 addresses in fc00::/8 as reachable CJDNS addresses rather than private addresses -- Requires a running CJDNS node"`
 	DataDir              string        `short:"b" long:"datadir" description:"Directory to store data"`
 	DbType               string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
 	DebugLevel           string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
@@ -125,10 +131,13 @@ type config struct {
 	ExternalIPs          []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
 	Generate             bool          `long:"generate" description:"Generate (mine) flokicoins using the CPU"`
 	FreeTxRelayLimit     float64       `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
+	I2PSAM               string        `long:"i2psam" description:"I2P SAM bridge used to connect to I2P peers and accept incoming I2P connections (eg. 127.0.0.1:7656)"`
 	Listeners            []string      `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 15212, testnet: 25212)"`
 	LogDir               string        `long:"logdir" description:"Directory to log output."`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
 	MaxPeers             int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
+	MaxReorgDepth        int32         `long:"maxreorgdepth" description:"Max number of blocks of the best chain a reorganization may disconnect automatically -- Deeper reorganizations are refused until they are approved with the approvereorg or reconsiderblock RPCs, 0 means no limit"`
+	MaxUploadTarget      uint64        `long:"maxuploadtarget" description:"Try to keep the data sent to peers under the given target in MiB per 24h -- Historical blocks are no longer served to non-whitelisted peers once it is reached, 0 means no limit"`
 	MiningAddrs          []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
 	MinRelayTxFee        float64       `long:"minrelaytxfee" description:"The minimum transaction fee in FLC/kB to be considered a non-zero fee."`
 	DisableBanning       bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
@@ -146,12 +155,15 @@ type config struct {
 	OnionProxy           string        `long:"onion" description:"Connect to tor hidden services via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	OnionProxyPass       string        `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
 	OnionProxyUser       string        `long:"onionuser" description:"Username for onion proxy server"`
+	OnlyNet              []string      `long:"onlynet" description:"Make automatic outbound connections only to the given network (ipv4, ipv6, onion, i2p or cjdns) -- Can be specified multiple times"`
 	Profile              string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
 	Proxy                string        `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	ProxyPass            string        `long:"proxypass" default-mask:"-" description:"Password for proxy server"`
 	ProxyUser            string        `long:"proxyuser" description:"Username for proxy server"`
 	Prune                uint64        `long:"prune" description:"Prune already validated blocks from the database. Must specify a target size in MiB (minimum value of 1536, default value of 0 will disable pruning)"`
 	RegressionTest       bool          `long:"regtest" description:"Use the regression test network"`
+	Reindex              bool          `long:"reindex" description:"Rebuild the block database from its block files on start up -- The blocks are validated again and the optional indexes are rebuilt"`
+	ReindexChainState    bool          `long:"reindex-chainstate" description:"Rebuild the UTXO set on start up by validating again the blocks already in the block database -- The optional indexes are rebuilt"`
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
 	RejectReplacement    bool          `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
 	RelayNonStd          bool          `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
@@ -172,21 +184,29 @@ type config struct {
 	SigNetChallenge      string        `long:"signetchallenge" description:"Connect to a custom signet network defined by this challenge instead of using the global default signet test network -- Can be specified multiple times"`
 	SigNetSeedNode       []string      `long:"signetseednode" description:"Specify a seed node for the signet network instead of using the global default signet network seed nodes"`
 	TestNet3             bool          `long:"testnet" description:"Use the test network"`
+	TorControl           string        `long:"torcontrol" description:"Tor control port used to publish an onion service for incoming connections (eg. 127.0.0.1:9051)"`
 	TorIsolation         bool          `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
+	TorPassword          string        `long:"torpassword" default-mask:"-" description:"Password for the Tor control port -- Cookie authentication is used when not set"`
 	TrickleInterval      time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
 	UtxoCacheMaxSizeMiB  uint          `long:"utxocachemaxsize" description:"The maximum size in MiB of the UTXO cache"`
 	TxIndex              bool          `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
+	TxReconciliation     bool          `long:"txreconciliation" description:"Relay transactions through set reconciliation (BIP330) with the peers that support it instead of announcing every transaction to them -- Transactions are still announced right away to a few outbound peers"`
 	UserAgentComments    []string      `long:"uacomment" description:"Comment to add to the user agent -- See BIP 14 for more information."`
 	Upnp                 bool          `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
+	VBParams             []string      `long:"vbparams" description:"Override the version bits parameters of a deployment on regtest or simnet.  Format: '<deployment>:<start>:<end>[:<minactivationheight>[:<bit>]]' where start and end are unix times of the median time past, 0 meaning always started or never expiring -- Can be specified multiple times"`
 	ShowVersion          bool          `short:"V" long:"version" description:"Display version information and exit"`
-	Whitelists           []string      `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
+	WhiteBinds           []string      `long:"whitebind" description:"Add an interface/port to listen for connections whose peers are granted permissions, optionally prefixed with comma-separated permissions and @ (eg. relay,mempool@127.0.0.1:15300) -- Permissions: noban, relay, forcerelay, download, mempool or all, defaulting to noban, relay, download and mempool"`
+	Whitelists           []string      `long:"whitelist" description:"Add an IP network or IP whose peers are granted permissions, optionally prefixed with comma-separated permissions and @ (eg. 192.168.1.0/24, ::1 or noban@10.0.0.0/8) -- See --whitebind for the permissions"`
 	lookup               func(string) ([]net.IP, error)
 	oniondial            func(string, string, time.Duration) (net.Conn, error)
 	dial                 func(string, string, time.Duration) (net.Conn, error)
 	addCheckpoints       []chaincfg.Checkpoint
+	assumeValid          *chainhash.Hash
 	miningAddrs          []chainutil.Address
 	minRelayTxFee        chainutil.Amount
-	whitelists           []*net.IPNet
+	onlyNets             []netaddr.Network
+	whiteBinds           []whiteBind
+	whitelists           []whitelistNet
 }
 
 // serviceOptions defines the configuration options for the daemon as a service on
@@ -386,6 +406,78 @@ func parseCheckpoints(checkpointStrings []string) ([]chaincfg.Checkpoint, error)
 	return checkpoints, nil
 }
 
+// applyVBParams parses the version bits override strings and applies them to
+// the deployments of the passed chain parameters.  Each override has the syntax
+// <deployment>:<start>:<end>[:<minactivationheight>[:<bit>]].
+func applyVBParams(chainParams *chaincfg.Params, overrides []string) error {
+	for _, override := range overrides {
+		parts := strings.Split(override, ":")
+		if len(parts) < 3 || len(parts) > 5 {
+			return fmt.Errorf("unable to parse vbparams %q -- use the "+
+				"syntax <deployment>:<start>:<end>"+
+				"[:<minactivationheight>[:<bit>]]", override)
+		}
+
+		id, ok := chaincfg.DeploymentNames[parts[0]]
+		if !ok {
+			return fmt.Errorf("unable to parse vbparams %q due to "+
+				"unknown deployment %q", override, parts[0])
+		}
+		deployment := chainParams.Deployments[id]
+
+		start, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || start < 0 {
+			return fmt.Errorf("unable to parse vbparams %q due to "+
+				"malformed start time", override)
+		}
+		end, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil || end < 0 {
+			return fmt.Errorf("unable to parse vbparams %q due to "+
+				"malformed end time", override)
+		}
+		if start != 0 && end != 0 && end <= start {
+			return fmt.Errorf("unable to parse vbparams %q -- the "+
+				"end time must be after the start time", override)
+		}
+
+		if len(parts) > 3 {
+			height, err := strconv.ParseUint(parts[3], 10, 32)
+			if err != nil {
+				return fmt.Errorf("unable to parse vbparams %q due "+
+					"to malformed min activation height",
+					override)
+			}
+			deployment.MinActivationHeight = uint32(height)
+		}
+		if len(parts) > 4 {
+			bit, err := strconv.ParseUint(parts[4], 10, 8)
+			if err != nil {
+				return fmt.Errorf("unable to parse vbparams %q due "+
+					"to malformed bit", override)
+			}
+			deployment.BitNumber = uint8(bit)
+		}
+
+		// A zero time is interpreted by the median time starter and
+		// ender as always started and never expiring respectively.
+		var startTime, endTime time.Time
+		if start != 0 {
+			startTime = time.Unix(start, 0)
+		}
+		if end != 0 {
+			endTime = time.Unix(end, 0)
+		}
+		deployment.DeploymentStarter =
+			chaincfg.NewMedianTimeDeploymentStarter(startTime)
+		deployment.DeploymentEnder =
+			chaincfg.NewMedianTimeDeploymentEnder(endTime)
+
+		chainParams.Deployments[id] = deployment
+	}
+
+	return chaincfg.ValidateDeploymentBits(chainParams)
+}
+
 // fileExists reports whether the named file or directory exists.
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -491,7 +583,8 @@ func loadConfig() (*config, []string, error) {
 	// Load additional config from file.
 	var configFileError error
 	parser := newConfigParser(&cfg, &serviceOpts, flags.Default)
-	if !(preCfg.RegressionTest || preCfg.SimNet || preCfg.SigNet) ||
+	if !(preCfg.RegressionTest || preCfg.SimNet || preCfg.SigNet ||
+		preCfg.ChainParams != "") ||
 		preCfg.ConfigFile != defaultConfigFile {
 
 		if _, err := os.Stat(preCfg.ConfigFile); os.IsNotExist(err) {
@@ -605,16 +698,66 @@ func loadConfig() (*config, []string, error) {
 		)
 		activeNetParams.Params = &chainParams
 	}
+	if cfg.ChainParams != "" {
+		numNets++
+		chainParams, err := chaincfg.LoadParamsFile(
+			cleanAndExpandPath(cfg.ChainParams),
+		)
+		if err != nil {
+			str := "%s: Unable to load chain parameters: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			return nil, nil, err
+		}
+
+		// Register the network so addresses and keys using its
+		// encoding magics are recognized by library packages.
+		if err := chaincfg.Register(chainParams); err != nil {
+			str := "%s: Unable to register network %q: %v"
+			err := fmt.Errorf(str, funcName, chainParams.Name, err)
+			fmt.Fprintln(os.Stderr, err)
+			return nil, nil, err
+		}
+		activeNetParams = newCustomNetParams(chainParams)
+	}
 	if numNets > 1 {
-		str := "%s: The testnet, regtest, segnet, signet and simnet " +
-			"params can't be used together -- choose one of the " +
-			"five"
+		str := "%s: The testnet, regtest, segnet, signet, simnet and " +
+			"chainparams params can't be used together -- choose " +
+			"one of the six"
 		err := fmt.Errorf(str, funcName)
 		fmt.Fprintln(os.Stderr, err)
 		fmt.Fprintln(os.Stderr, usageMessage)
 		return nil, nil, err
 	}
 
+	// Version bits overrides are only allowed on the test networks that
+	// are used by integration tests.  The parameters are copied first so
+	// the package level network definitions are left untouched.
+	if len(cfg.VBParams) > 0 {
+		if activeNetParams.Net != wire.TestNet &&
+			activeNetParams.Net != wire.SimNet {
+
+			str := "%s: vbparams may only be used with regtest or simnet"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+
+		chainParams := *activeNetParams.Params
+		activeNetParams = &params{
+			Params:  &chainParams,
+			rpcPort: activeNetParams.rpcPort,
+		}
+		if err := applyVBParams(&chainParams, cfg.VBParams); err != nil {
+			str := "%s: Error parsing vbparams: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// If mainnet is active, then we won't allow the stall handler to be
 	// disabled.
 	if activeNetParams.Params.Net == wire.MainNet && cfg.DisableStallHandler {
@@ -708,18 +851,27 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
-	// Validate any given whitelisted IP addresses and networks.
+	// Validate any given whitelisted IP addresses and networks along with
+	// the permissions granted to them.
 	if len(cfg.Whitelists) > 0 {
 		var ip net.IP
-		cfg.whitelists = make([]*net.IPNet, 0, len(cfg.Whitelists))
+		cfg.whitelists = make([]whitelistNet, 0, len(cfg.Whitelists))
 
-		for _, addr := range cfg.Whitelists {
+		for _, entry := range cfg.Whitelists {
+			perms, addr, err := splitPermissions(entry)
+			if err != nil {
+				str := "%s: The whitelist value of '%s' is invalid: %v"
+				err := fmt.Errorf(str, funcName, entry, err)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
 			_, ipnet, err := net.ParseCIDR(addr)
 			if err != nil {
 				ip = net.ParseIP(addr)
 				if ip == nil {
 					str := "%s: The whitelist value of '%s' is invalid"
-					err = fmt.Errorf(str, funcName, addr)
+					err = fmt.Errorf(str, funcName, entry)
 					fmt.Fprintln(os.Stderr, err)
 					fmt.Fprintln(os.Stderr, usageMessage)
 					return nil, nil, err
@@ -736,7 +888,31 @@ func loadConfig() (*config, []string, error) {
 					Mask: net.CIDRMask(bits, bits),
 				}
 			}
-			cfg.whitelists = append(cfg.whitelists, ipnet)
+			cfg.whitelists = append(cfg.whitelists, whitelistNet{
+				ipnet: ipnet,
+				perms: perms,
+			})
+		}
+	}
+
+	// Validate any given whitebind listen addresses along with the
+	// permissions granted to their peers.
+	if len(cfg.WhiteBinds) > 0 {
+		cfg.whiteBinds = make([]whiteBind, 0, len(cfg.WhiteBinds))
+		for _, entry := range cfg.WhiteBinds {
+			perms, addr, err := splitPermissions(entry)
+			if err != nil {
+				str := "%s: The whitebind value of '%s' is invalid: %v"
+				err := fmt.Errorf(str, funcName, entry, err)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+			addr = normalizeAddress(addr, activeNetParams.DefaultPort)
+			cfg.whiteBinds = append(cfg.whiteBinds, whiteBind{
+				addr:  addr,
+				perms: perms,
+			})
 		}
 	}
 
@@ -750,9 +926,10 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
-	// --proxy or --connect without --listen disables listening.
+	// --proxy or --connect without --listen or --whitebind disables
+	// listening.
 	if (cfg.Proxy != "" || len(cfg.ConnectPeers) > 0) &&
-		len(cfg.Listeners) == 0 {
+		len(cfg.Listeners) == 0 && len(cfg.whiteBinds) == 0 {
 		cfg.DisableListen = true
 	}
 
@@ -764,12 +941,17 @@ func loadConfig() (*config, []string, error) {
 	// Add the default listener if none were specified. The default
 	// listener is all addresses on the listen port for the network
 	// we are to connect to.
-	if len(cfg.Listeners) == 0 {
+	if len(cfg.Listeners) == 0 && len(cfg.whiteBinds) == 0 {
 		cfg.Listeners = []string{
 			net.JoinHostPort("", activeNetParams.DefaultPort),
 		}
 	}
 
+	// The whitebind addresses are listened on like any other.
+	for _, wb := range cfg.whiteBinds {
+		cfg.Listeners = append(cfg.Listeners, wb.addr)
+	}
+
 	// Check to make sure limited and admin users don't have the same username
 	if cfg.RPCUser == cfg.RPCLimitUser && cfg.RPCUser != "" {
 		str := "%s: --rpcuser and --rpclimituser must not specify the " +
@@ -868,6 +1050,16 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The max reorganization depth can't be negative.
+	if cfg.MaxReorgDepth < 0 {
+		str := "%s: The maxreorgdepth option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxReorgDepth)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the block priority and minimum block sizes to max block size.
 	cfg.BlockPrioritySize = minUint32(cfg.BlockPrioritySize, cfg.BlockMaxSize)
 	cfg.BlockMinSize = minUint32(cfg.BlockMinSize, cfg.BlockMaxSize)
@@ -934,6 +1126,25 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --reindex and --reindex-chainstate do not mix.
+	if cfg.Reindex && cfg.ReindexChainState {
+		err := fmt.Errorf("%s: the --reindex and --reindex-chainstate "+
+			"options may not be activated at the same time -- "+
+			"--reindex also rebuilds the chain state", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The blocks can only be read from the block files of ffldb.
+	if cfg.Reindex && cfg.DbType != "ffldb" {
+		err := fmt.Errorf("%s: the --reindex option requires the "+
+			"ffldb database type", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	cfg.miningAddrs = make([]chainutil.Address, 0, len(cfg.MiningAddrs))
 	for _, strAddr := range cfg.MiningAddrs {
@@ -1026,6 +1237,104 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Publishing an onion service requires accepting incoming
+	// connections and a valid control port address.
+	if cfg.TorControl != "" {
+		if cfg.NoOnion {
+			err := fmt.Errorf("%s: the --noonion and --torcontrol "+
+				"options may not be activated at the same time",
+				funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.DisableListen {
+			err := fmt.Errorf("%s: the --torcontrol option requires "+
+				"listening for incoming connections -- use "+
+				"--listen when --proxy or --connect are set",
+				funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if _, _, err := net.SplitHostPort(cfg.TorControl); err != nil {
+			str := "%s: Tor control address '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, cfg.TorControl, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// The I2P SAM bridge address must be valid.
+	if cfg.I2PSAM != "" {
+		if _, _, err := net.SplitHostPort(cfg.I2PSAM); err != nil {
+			str := "%s: I2P SAM address '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, cfg.I2PSAM, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// The upload target is given in MiB and must fit in bytes.
+	if cfg.MaxUploadTarget > math.MaxUint64>>20 {
+		str := "%s: The maxuploadtarget option may not be more than %d " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, uint64(math.MaxUint64>>20),
+			cfg.MaxUploadTarget)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The upload target must be larger than what is kept to relay the new
+	// blocks of a whole cycle, or historical blocks would never be served.
+	minTarget := minUploadTarget(activeNetParams.TargetTimePerBlock)
+	if cfg.MaxUploadTarget != 0 && cfg.MaxUploadTarget < minTarget {
+		str := "%s: The maxuploadtarget option may not be less than %d " +
+			"for the active network -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, minTarget, cfg.MaxUploadTarget)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Parse the networks outbound connections are restricted to and make
+	// sure each of them can be reached.
+	for _, name := range cfg.OnlyNet {
+		n, err := netaddr.ParseNetwork(strings.ToLower(name))
+		if err != nil {
+			str := "%s: The onlynet option '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, name, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+
+		var reason string
+		switch {
+		case n == netaddr.NetworkOnion && cfg.NoOnion:
+			reason = "--noonion is specified"
+		case n == netaddr.NetworkOnion && cfg.OnionProxy == "" &&
+			cfg.Proxy == "":
+			reason = "neither --onion nor --proxy is specified"
+		case n == netaddr.NetworkI2P && cfg.I2PSAM == "":
+			reason = "--i2psam is not specified"
+		case n == netaddr.NetworkCJDNS && !cfg.CJDNSReachable:
+			reason = "--cjdnsreachable is not specified"
+		}
+		if reason != "" {
+			str := "%s: The onlynet network '%s' is not reachable " +
+				"since %s"
+			err := fmt.Errorf(str, funcName, name, reason)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.onlyNets = append(cfg.onlyNets, n)
+	}
+
 	// Check the checkpoints for syntax errors.
 	cfg.addCheckpoints, err = parseCheckpoints(cfg.AddCheckpoints)
 	if err != nil {
@@ -1036,6 +1345,24 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Parse the assumed valid block, which defaults to the one of the
+	// network and is disabled with 0.
+	cfg.assumeValid = activeNetParams.AssumeValid
+	switch cfg.AssumeValid {
+	case "":
+	case "0":
+		cfg.assumeValid = nil
+	default:
+		cfg.assumeValid, err = chainhash.NewHashFromStr(cfg.AssumeValid)
+		if err != nil {
+			str := "%s: Error parsing assumevalid: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Tor stream isolation requires either proxy or onion proxy to be set.
 	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
 		str := "%s: Tor stream isolation requires either proxy or " +
@@ -1255,12 +1582,20 @@ func createDefaultConfigFile(destinationPath string) error {
 // dial function depending on the address and configuration options.  For
 // example, .onion addresses will be dialed using the onion specific proxy if
 // one was specified, but will otherwise use the normal dial function (which
-// could itself use a proxy or not).
+// could itself use a proxy or not).  CJDNS addresses are always dialed directly
+// since proxies cannot reach them.
 func dial(addr net.Addr) (net.Conn, error) {
 	if strings.Contains(addr.String(), ".onion:") {
 		return cfg.oniondial(addr.Network(), addr.String(),
 			defaultConnectTimeout)
 	}
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok && cfg.CJDNSReachable {
+		na := wire.NewNetAddressIPPort(tcpAddr.IP, 0, 0)
+		if netaddr.IsCJDNSRange(na) && !netaddr.IsOnionCatTor(na) {
+			return net.DialTimeout(addr.Network(), addr.String(),
+				defaultConnectTimeout)
+		}
+	}
 	return cfg.dial(addr.Network(), addr.String(), defaultConnectTimeout)
 }
 
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"testing"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg"
 )
 
 var (
@@ -69,3 +73,74 @@ func TestCreateDefaultConfigFile(t *testing.T) {
 		t.Error("Could not find rpcpass in generated default config file.")
 	}
 }
+
+// TestApplyVBParams ensures version bits overrides are parsed and applied to
+// the targeted deployment only, and that malformed overrides are rejected.
+func TestApplyVBParams(t *testing.T) {
+	chainParams := chaincfg.RegressionNetParams
+	err := applyVBParams(&chainParams, []string{
+		"taproot:1700000000:1800000000:500:3",
+		"csv:0:1",
+	})
+	if err != nil {
+		t.Fatalf("applyVBParams: %v", err)
+	}
+
+	taproot := chainParams.Deployments[chaincfg.DeploymentTaproot]
+	starter := taproot.DeploymentStarter.(*chaincfg.MedianTimeDeploymentStarter)
+	ender := taproot.DeploymentEnder.(*chaincfg.MedianTimeDeploymentEnder)
+	if !starter.StartTime().Equal(time.Unix(1700000000, 0)) ||
+		!ender.EndTime().Equal(time.Unix(1800000000, 0)) {
+
+		t.Fatalf("taproot times: got %v-%v", starter.StartTime(),
+			ender.EndTime())
+	}
+	if taproot.MinActivationHeight != 500 || taproot.BitNumber != 3 {
+		t.Fatalf("taproot: got min activation height %d bit %d",
+			taproot.MinActivationHeight, taproot.BitNumber)
+	}
+
+	csv := chainParams.Deployments[chaincfg.DeploymentCSV]
+	starter = csv.DeploymentStarter.(*chaincfg.MedianTimeDeploymentStarter)
+	if !starter.StartTime().IsZero() {
+		t.Fatalf("csv start time: got %v, want zero", starter.StartTime())
+	}
+	wantBit := chaincfg.RegressionNetParams.Deployments[chaincfg.DeploymentCSV].BitNumber
+	if csv.BitNumber != wantBit {
+		t.Fatalf("csv bit: got %d, want %d", csv.BitNumber, wantBit)
+	}
+
+	// The package level parameters must not be modified.
+	regTaproot := chaincfg.RegressionNetParams.Deployments[chaincfg.DeploymentTaproot]
+	if regTaproot.BitNumber == 3 || regTaproot.DeploymentStarter == taproot.DeploymentStarter {
+		t.Fatal("regtest parameters were modified")
+	}
+
+	invalid := []string{
+		"taproot",
+		"taproot:0",
+		"unknown:0:0",
+		"taproot:x:0",
+		"taproot:0:-1",
+		"taproot:20:10",
+		"taproot:0:0:x",
+		"taproot:0:0:0:300",
+		"taproot:0:0:0:1:9",
+		"taproot:0:0:0:16",
+		"taproot:0:0:0:0",
+	}
+	for _, override := range invalid {
+		chainParams := chaincfg.RegressionNetParams
+		err := applyVBParams(&chainParams, []string{override})
+		if err == nil {
+			t.Errorf("%q: expected error", override)
+		}
+	}
+
+	chainParams = chaincfg.RegressionNetParams
+	err = applyVBParams(&chainParams, []string{"taproot:0:0:0:1"})
+	if !errors.Is(err, chaincfg.ErrInvalidParams) {
+		t.Fatalf("duplicate bit: got %v, want %v", err,
+			chaincfg.ErrInvalidParams)
+	}
+}
@@ -0,0 +1,578 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// i2pSAMVersion is the version of the SAM protocol spoken with the
+	// SAM bridge.
+	i2pSAMVersion = "3.1"
+
+	// i2pSignatureType is the signature type of generated destinations.
+	// Type 7 is EdDSA-SHA512-Ed25519.
+	i2pSignatureType = 7
+
+	// i2pSAMTimeout is the maximum time to wait for a reply from the SAM
+	// bridge.  Creating a session builds tunnels which may take a while.
+	i2pSAMTimeout = 3 * time.Minute
+
+	// i2pRetryInterval is the time to wait before accepting connections
+	// again after the session could not be created.
+	i2pRetryInterval = time.Minute
+
+	// i2pMaxLineLen is the maximum length of a reply line from the SAM
+	// bridge.  It comfortably holds a private key.
+	i2pMaxLineLen = 16384
+
+	// i2pDestinationMinLen is the length of a destination without its
+	// certificate payload: a 256 byte public key, a 128 byte signing key
+	// and a 3 byte certificate header.
+	i2pDestinationMinLen = 387
+
+	// I2PAddrSuffix is the suffix of I2P host names.
+	I2PAddrSuffix = ".b32.i2p"
+)
+
+var (
+	// i2pBase64 is the base64 alphabet used by I2P.  It replaces the '+'
+	// and '/' characters of the standard alphabet with '-' and '~'.
+	i2pBase64 = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+		"abcdefghijklmnopqrstuvwxyz0123456789-~")
+
+	// i2pBase32 is the encoding of the destination hash in I2P host names.
+	i2pBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	// ErrI2PInvalidReply indicates the SAM bridge returned a reply in an
+	// unexpected format.
+	ErrI2PInvalidReply = errors.New("invalid i2p sam reply")
+
+	// ErrI2PInvalidDestination indicates an I2P destination or private
+	// key could not be decoded.
+	ErrI2PInvalidDestination = errors.New("invalid i2p destination")
+
+	// ErrI2PSessionClosed indicates the session was closed.
+	ErrI2PSessionClosed = errors.New("i2p session closed")
+)
+
+// I2PError describes an error result returned by the SAM bridge.
+type I2PError struct {
+	Command string
+	Result  string
+	Message string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e I2PError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("i2p %s failed: %s (%s)", e.Command,
+			e.Result, e.Message)
+	}
+	return fmt.Sprintf("i2p %s failed: %s", e.Command, e.Result)
+}
+
+// I2PAddr is the address of an I2P destination.  I2P streams created through
+// SAM v3.1 have no ports, so the port is always zero.
+type I2PAddr struct {
+	// Host is the base32 encoded destination hash with the .b32.i2p
+	// suffix.
+	Host string
+}
+
+// Network returns the network name of the address.
+//
+// This is part of the net.Addr interface.
+func (a *I2PAddr) Network() string {
+	return "i2p"
+}
+
+// String returns the address in host:port form.
+//
+// This is part of the net.Addr interface.
+func (a *I2PAddr) String() string {
+	return net.JoinHostPort(a.Host, "0")
+}
+
+// Ensure I2PAddr implements the net.Addr interface.
+var _ net.Addr = (*I2PAddr)(nil)
+
+// i2pBridgeAddr describes the SAM bridge of a session whose destination is
+// not known yet.
+type i2pBridgeAddr string
+
+// Network returns the network name of the address.
+//
+// This is part of the net.Addr interface.
+func (a i2pBridgeAddr) Network() string {
+	return "i2p"
+}
+
+// String returns a description of the SAM bridge.
+//
+// This is part of the net.Addr interface.
+func (a i2pBridgeAddr) String() string {
+	return "I2P via SAM bridge " + string(a)
+}
+
+// i2pConn is an I2P stream.  It reports the I2P destinations as its local and
+// remote addresses.
+type i2pConn struct {
+	net.Conn
+	localAddr  *I2PAddr
+	remoteAddr *I2PAddr
+}
+
+// LocalAddr returns the destination of the session.
+func (c *i2pConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+// RemoteAddr returns the destination of the remote peer.
+func (c *i2pConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// I2PConfig holds the configuration options related to an I2P session.
+type I2PConfig struct {
+	// SAMAddr is the address of the SAM bridge of the I2P router.
+	SAMAddr string
+
+	// PrivateKey is the private key of the destination in the I2P base64
+	// encoding.  A new destination is generated when it is empty.
+	PrivateKey string
+
+	// OnSession is invoked with the private key and the address of the
+	// destination each time a session is created.  It may be used to
+	// persist a newly generated key and to advertise the address.
+	OnSession func(privateKey string, addr *I2PAddr)
+}
+
+// I2PSession is a SAM v3.1 stream session.  It dials I2P destinations and
+// accepts incoming streams for a persistent destination.  The session is
+// created on first use and recreated if the SAM bridge drops it.
+//
+// I2PSession implements the net.Listener interface so it can be handed to the
+// connection manager along with the regular listeners.
+type I2PSession struct {
+	cfg I2PConfig
+	id  string
+
+	mtx        sync.Mutex
+	control    net.Conn
+	myAddr     *I2PAddr
+	pending    map[net.Conn]struct{}
+	closed     bool
+	createLock sync.Mutex
+	quit       chan struct{}
+}
+
+// Ensure I2PSession implements the net.Listener interface.
+var _ net.Listener = (*I2PSession)(nil)
+
+// NewI2PSession returns a new I2P session using the passed configuration.  No
+// connection to the SAM bridge is made until the session is first used.
+func NewI2PSession(cfg *I2PConfig) *I2PSession {
+	var id [5]byte
+	rand.Read(id[:])
+	return &I2PSession{
+		cfg:     *cfg,
+		id:      hex.EncodeToString(id[:]),
+		pending: make(map[net.Conn]struct{}),
+		quit:    make(chan struct{}),
+	}
+}
+
+// Dial opens a stream to the I2P destination at addr.
+func (s *I2PSession) Dial(addr *I2PAddr, timeout time.Duration) (net.Conn, error) {
+	myAddr, err := s.ensureSession()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.hello(timeout)
+	if err != nil {
+		return nil, err
+	}
+	s.trackPending(conn, true)
+	defer s.trackPending(conn, false)
+
+	// Resolve the full destination since SAM v3.1 does not accept base32
+	// addresses in STREAM CONNECT.
+	reply, err := samCommand(conn, "NAMING LOOKUP NAME="+addr.Host)
+	if err == nil {
+		err = checkSAMResult("NAMING LOOKUP", reply)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	dest := reply["VALUE"]
+	if dest == "" {
+		conn.Close()
+		return nil, ErrI2PInvalidReply
+	}
+
+	reply, err = samCommand(conn, fmt.Sprintf("STREAM CONNECT ID=%s "+
+		"DESTINATION=%s SILENT=false", s.id, dest))
+	if err == nil {
+		err = checkSAMResult("STREAM CONNECT", reply)
+	}
+	if err != nil {
+		conn.Close()
+		s.checkSessionError(err)
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &i2pConn{
+		Conn:       conn,
+		localAddr:  myAddr,
+		remoteAddr: &I2PAddr{Host: addr.Host},
+	}, nil
+}
+
+// Accept waits for and returns the next incoming stream.  Failures to reach
+// the SAM bridge are retried until the session is closed.
+//
+// This is part of the net.Listener interface.
+func (s *I2PSession) Accept() (net.Conn, error) {
+	for {
+		conn, err := s.accept()
+		if err == nil {
+			return conn, nil
+		}
+		if s.isClosed() {
+			return nil, ErrI2PSessionClosed
+		}
+		log.Debugf("Unable to accept I2P connection via %s: %v",
+			s.cfg.SAMAddr, err)
+
+		select {
+		case <-time.After(i2pRetryInterval):
+		case <-s.quit:
+			return nil, ErrI2PSessionClosed
+		}
+	}
+}
+
+// accept waits for a single incoming stream.
+func (s *I2PSession) accept() (net.Conn, error) {
+	myAddr, err := s.ensureSession()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.hello(i2pSAMTimeout)
+	if err != nil {
+		return nil, err
+	}
+	s.trackPending(conn, true)
+	defer s.trackPending(conn, false)
+
+	reply, err := samCommand(conn, fmt.Sprintf("STREAM ACCEPT ID=%s "+
+		"SILENT=false", s.id))
+	if err == nil {
+		err = checkSAMResult("STREAM ACCEPT", reply)
+	}
+	if err != nil {
+		conn.Close()
+		s.checkSessionError(err)
+		return nil, err
+	}
+
+	// The destination of the remote peer is sent once a stream arrives,
+	// which may take arbitrarily long.
+	conn.SetDeadline(time.Time{})
+	line, err := readSAMLine(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	dest, _, _ := strings.Cut(line, " ")
+	remoteAddr, err := i2pDestinationAddr(dest)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &i2pConn{
+		Conn:       conn,
+		localAddr:  myAddr,
+		remoteAddr: remoteAddr,
+	}, nil
+}
+
+// Close closes the session, unblocking any pending Accept.
+//
+// This is part of the net.Listener interface.
+func (s *I2PSession) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.quit)
+	for conn := range s.pending {
+		conn.Close()
+	}
+	if s.control != nil {
+		s.control.Close()
+		s.control = nil
+	}
+	return nil
+}
+
+// Addr returns the address of the session destination.  The SAM bridge is
+// described instead until the session has been created.
+//
+// This is part of the net.Listener interface.
+func (s *I2PSession) Addr() net.Addr {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.myAddr == nil {
+		return i2pBridgeAddr(s.cfg.SAMAddr)
+	}
+	return s.myAddr
+}
+
+// isClosed returns whether the session was closed.
+func (s *I2PSession) isClosed() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.closed
+}
+
+// trackPending adds or removes a connection that is still negotiating with the
+// SAM bridge so it can be closed when the session is.
+func (s *I2PSession) trackPending(conn net.Conn, add bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if add {
+		s.pending[conn] = struct{}{}
+		if s.closed {
+			conn.Close()
+		}
+		return
+	}
+	delete(s.pending, conn)
+}
+
+// checkSessionError drops the session when the SAM bridge no longer knows its
+// ID so it is recreated on next use.
+func (s *I2PSession) checkSessionError(err error) {
+	var samErr I2PError
+	if !errors.As(err, &samErr) || samErr.Result != "INVALID_ID" {
+		return
+	}
+
+	s.mtx.Lock()
+	if s.control != nil {
+		s.control.Close()
+		s.control = nil
+	}
+	s.mtx.Unlock()
+}
+
+// ensureSession creates the session when it does not exist yet and returns
+// the address of its destination.
+func (s *I2PSession) ensureSession() (*I2PAddr, error) {
+	s.createLock.Lock()
+	defer s.createLock.Unlock()
+
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		return nil, ErrI2PSessionClosed
+	}
+	if s.control != nil {
+		myAddr := s.myAddr
+		s.mtx.Unlock()
+		return myAddr, nil
+	}
+	s.mtx.Unlock()
+
+	control, err := s.hello(i2pSAMTimeout)
+	if err != nil {
+		return nil, err
+	}
+	s.trackPending(control, true)
+	defer s.trackPending(control, false)
+
+	privateKey := s.cfg.PrivateKey
+	if privateKey == "" {
+		reply, err := samCommand(control, fmt.Sprintf("DEST GENERATE "+
+			"SIGNATURE_TYPE=%d", i2pSignatureType))
+		if err != nil {
+			control.Close()
+			return nil, err
+		}
+		privateKey = reply["PRIV"]
+	}
+	myAddr, err := i2pPrivateKeyAddr(privateKey)
+	if err != nil {
+		control.Close()
+		return nil, err
+	}
+
+	reply, err := samCommand(control, fmt.Sprintf("SESSION CREATE "+
+		"STYLE=STREAM ID=%s DESTINATION=%s SIGNATURE_TYPE=%d", s.id,
+		privateKey, i2pSignatureType))
+	if err == nil {
+		err = checkSAMResult("SESSION CREATE", reply)
+	}
+	if err != nil {
+		control.Close()
+		return nil, err
+	}
+	control.SetDeadline(time.Time{})
+
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		control.Close()
+		return nil, ErrI2PSessionClosed
+	}
+	s.cfg.PrivateKey = privateKey
+	s.control = control
+	s.myAddr = myAddr
+	s.mtx.Unlock()
+
+	// The session lives as long as the control connection.  Watch it so
+	// the session is recreated once the SAM bridge drops it.
+	go func() {
+		for {
+			if _, err := readSAMLine(control); err != nil {
+				break
+			}
+		}
+		s.mtx.Lock()
+		if s.control == control {
+			s.control = nil
+		}
+		s.mtx.Unlock()
+		control.Close()
+	}()
+
+	log.Infof("I2P session created for %s", myAddr.Host)
+	if s.cfg.OnSession != nil {
+		s.cfg.OnSession(privateKey, myAddr)
+	}
+	return myAddr, nil
+}
+
+// hello connects to the SAM bridge and negotiates the protocol version.  The
+// returned connection has a deadline of timeout for the following commands.
+func (s *I2PSession) hello(timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", s.cfg.SAMAddr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	reply, err := samCommand(conn, fmt.Sprintf("HELLO VERSION MIN=%s MAX=%s",
+		i2pSAMVersion, i2pSAMVersion))
+	if err == nil {
+		err = checkSAMResult("HELLO", reply)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// samCommand sends cmd to the SAM bridge and returns the arguments of its
+// reply.  Replies use the same KEY=VALUE format as the Tor control protocol.
+func samCommand(conn net.Conn, cmd string) (map[string]string, error) {
+	if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
+		return nil, err
+	}
+	line, err := readSAMLine(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first two words of the reply repeat the command, eg.
+	// "HELLO REPLY" or "STREAM STATUS".
+	words := strings.SplitN(line, " ", 3)
+	if len(words) < 3 {
+		return nil, ErrI2PInvalidReply
+	}
+	return parseTorReplyArgs(words[2]), nil
+}
+
+// checkSAMResult returns an I2PError when the reply to command does not
+// report success.
+func checkSAMResult(command string, reply map[string]string) error {
+	if reply["RESULT"] == "OK" {
+		return nil
+	}
+	return I2PError{
+		Command: command,
+		Result:  reply["RESULT"],
+		Message: reply["MESSAGE"],
+	}
+}
+
+// readSAMLine reads a single line from the SAM bridge.  It reads a byte at a
+// time to avoid consuming stream data following the line.
+func readSAMLine(conn net.Conn) (string, error) {
+	var line []byte
+	var b [1]byte
+	for len(line) < i2pMaxLineLen {
+		if _, err := conn.Read(b[:]); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return strings.TrimRight(string(line), "\r"), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", ErrI2PInvalidReply
+}
+
+// i2pDestinationAddr returns the address of the base64 encoded destination.
+func i2pDestinationAddr(dest string) (*I2PAddr, error) {
+	raw, err := i2pBase64.DecodeString(dest)
+	if err != nil || len(raw) < i2pDestinationMinLen {
+		return nil, ErrI2PInvalidDestination
+	}
+	hash := sha256.Sum256(raw)
+	host := strings.ToLower(i2pBase32.EncodeToString(hash[:]))
+	return &I2PAddr{Host: host + I2PAddrSuffix}, nil
+}
+
+// i2pPrivateKeyAddr returns the address of the destination of the base64
+// encoded private key.  The key starts with the destination, whose length
+// depends on its certificate.
+func i2pPrivateKeyAddr(privateKey string) (*I2PAddr, error) {
+	raw, err := i2pBase64.DecodeString(privateKey)
+	if err != nil || len(raw) < i2pDestinationMinLen {
+		return nil, ErrI2PInvalidDestination
+	}
+	certLen := binary.BigEndian.Uint16(raw[i2pDestinationMinLen-2:])
+	destLen := i2pDestinationMinLen + int(certLen)
+	if len(raw) < destLen {
+		return nil, ErrI2PInvalidDestination
+	}
+	return i2pDestinationAddr(i2pBase64.EncodeToString(raw[:destLen]))
+}
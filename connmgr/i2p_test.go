@@ -0,0 +1,214 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testI2PDestination returns a base64 encoded destination with a key
+// certificate followed by filler private key material when withKey is set.
+func testI2PDestination(fill byte, withKey bool) string {
+	dest := bytes.Repeat([]byte{fill}, i2pDestinationMinLen+4)
+	dest[i2pDestinationMinLen-3] = 5
+	dest[i2pDestinationMinLen-2] = 0
+	dest[i2pDestinationMinLen-1] = 4
+	if withKey {
+		dest = append(dest, bytes.Repeat([]byte{0xee}, 64)...)
+	}
+	return i2pBase64.EncodeToString(dest)
+}
+
+// mockSAM is a SAM bridge which generates a destination, creates sessions,
+// resolves a single peer and serves streams to and from it.
+type mockSAM struct {
+	listener net.Listener
+	priv     string
+	peerDest string
+	peerHost string
+}
+
+// newMockSAM starts a mock SAM bridge.
+func newMockSAM(t *testing.T) *mockSAM {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	peerDest := testI2PDestination(0x11, false)
+	peerAddr, err := i2pDestinationAddr(peerDest)
+	if err != nil {
+		t.Fatalf("peer destination: %v", err)
+	}
+	m := &mockSAM{
+		listener: listener,
+		priv:     testI2PDestination(0x22, true),
+		peerDest: peerDest,
+		peerHost: peerAddr.Host,
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+	return m
+}
+
+// serve handles a single SAM connection.
+func (m *mockSAM) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		line, err := readSAMLine(conn)
+		if err != nil {
+			return
+		}
+
+		var reply string
+		switch {
+		case line == "HELLO VERSION MIN=3.1 MAX=3.1":
+			reply = "HELLO REPLY RESULT=OK VERSION=3.1"
+
+		case strings.HasPrefix(line, "DEST GENERATE "):
+			reply = "DEST REPLY PUB=x PRIV=" + m.priv
+
+		case strings.HasPrefix(line, "SESSION CREATE "):
+			if !strings.Contains(line, "DESTINATION="+m.priv+" ") {
+				reply = "SESSION STATUS RESULT=INVALID_KEY"
+				break
+			}
+			reply = "SESSION STATUS RESULT=OK DESTINATION=" + m.priv
+
+		case line == "NAMING LOOKUP NAME="+m.peerHost:
+			reply = "NAMING REPLY RESULT=OK NAME=" + m.peerHost +
+				" VALUE=" + m.peerDest
+
+		case strings.HasPrefix(line, "NAMING LOOKUP "):
+			reply = "NAMING REPLY RESULT=KEY_NOT_FOUND"
+
+		case strings.HasPrefix(line, "STREAM CONNECT "):
+			conn.Write([]byte("STREAM STATUS RESULT=OK\n"))
+			io.Copy(conn, conn)
+			return
+
+		case strings.HasPrefix(line, "STREAM ACCEPT "):
+			conn.Write([]byte("STREAM STATUS RESULT=OK\n" +
+				m.peerDest + " FROM_PORT=0 TO_PORT=0\nhello"))
+			io.Copy(io.Discard, conn)
+			return
+
+		default:
+			reply = "ERROR RESULT=I2P_ERROR MESSAGE=\"unknown command\""
+		}
+		if _, err := conn.Write([]byte(reply + "\n")); err != nil {
+			return
+		}
+	}
+}
+
+// TestI2PSession ensures a session is created with a generated destination
+// and streams can be dialed and accepted.
+func TestI2PSession(t *testing.T) {
+	sam := newMockSAM(t)
+
+	var gotKey string
+	var gotAddr *I2PAddr
+	session := NewI2PSession(&I2PConfig{
+		SAMAddr: sam.listener.Addr().String(),
+		OnSession: func(privateKey string, addr *I2PAddr) {
+			gotKey = privateKey
+			gotAddr = addr
+		},
+	})
+	defer session.Close()
+
+	conn, err := session.Dial(&I2PAddr{Host: sam.peerHost}, time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if gotKey != sam.priv {
+		t.Fatalf("unexpected private key %q", gotKey)
+	}
+	wantAddr, _ := i2pPrivateKeyAddr(sam.priv)
+	if gotAddr == nil || gotAddr.Host != wantAddr.Host ||
+		!strings.HasSuffix(gotAddr.Host, I2PAddrSuffix) {
+
+		t.Fatalf("unexpected session address %v", gotAddr)
+	}
+	if session.Addr().String() != wantAddr.Host+":0" {
+		t.Fatalf("unexpected listener address %v", session.Addr())
+	}
+	if conn.RemoteAddr().String() != sam.peerHost+":0" {
+		t.Fatalf("unexpected remote address %v", conn.RemoteAddr())
+	}
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("unexpected echo %q: %v", buf, err)
+	}
+	conn.Close()
+
+	conn, err = session.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if conn.RemoteAddr().String() != sam.peerHost+":0" {
+		t.Fatalf("unexpected remote address %v", conn.RemoteAddr())
+	}
+	buf = make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("unexpected stream data %q: %v", buf, err)
+	}
+	conn.Close()
+
+	_, err = session.Dial(&I2PAddr{Host: "unknown" + I2PAddrSuffix}, time.Second)
+	var samErr I2PError
+	if !errors.As(err, &samErr) || samErr.Result != "KEY_NOT_FOUND" {
+		t.Fatalf("got %v, want KEY_NOT_FOUND", err)
+	}
+
+	// A closed session unblocks and refuses further use.
+	session.Close()
+	if _, err := session.Accept(); !errors.Is(err, ErrI2PSessionClosed) {
+		t.Fatalf("got %v, want %v", err, ErrI2PSessionClosed)
+	}
+}
+
+// TestI2PSessionKey ensures a configured private key is used for the session
+// and invalid keys are rejected.
+func TestI2PSessionKey(t *testing.T) {
+	sam := newMockSAM(t)
+
+	session := NewI2PSession(&I2PConfig{
+		SAMAddr:    sam.listener.Addr().String(),
+		PrivateKey: sam.priv,
+	})
+	if _, err := session.ensureSession(); err != nil {
+		t.Fatalf("session: %v", err)
+	}
+	session.Close()
+
+	session = NewI2PSession(&I2PConfig{
+		SAMAddr:    sam.listener.Addr().String(),
+		PrivateKey: "AAAA",
+	})
+	defer session.Close()
+	_, err := session.ensureSession()
+	if !errors.Is(err, ErrI2PInvalidDestination) {
+		t.Fatalf("got %v, want %v", err, ErrI2PInvalidDestination)
+	}
+}
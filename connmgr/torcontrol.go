@@ -0,0 +1,432 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// torControlDialTimeout is the maximum time to wait for the Tor
+	// control port to accept a connection.
+	torControlDialTimeout = 10 * time.Second
+
+	// torCookieLen is the length of the Tor authentication cookie.
+	torCookieLen = 32
+
+	// torSafeCookieServerKey and torSafeCookieClientKey are the HMAC keys
+	// used by the SAFECOOKIE authentication method.
+	torSafeCookieServerKey = "Tor safe cookie authentication server-to-controller hash"
+	torSafeCookieClientKey = "Tor safe cookie authentication controller-to-server hash"
+
+	// TorOnionKeyTypeV3 is the key type prefix of ED25519-V3 onion service
+	// private keys as returned by ADD_ONION.
+	TorOnionKeyTypeV3 = "ED25519-V3"
+)
+
+var (
+	// ErrTorControlAuthMethod indicates the Tor control port does not
+	// offer an authentication method the controller can use.
+	ErrTorControlAuthMethod = errors.New("no supported tor control " +
+		"authentication method")
+
+	// ErrTorControlServerHash indicates the server hash returned during
+	// SAFECOOKIE authentication does not match the cookie, meaning the
+	// control port is not the Tor instance owning the cookie file.
+	ErrTorControlServerHash = errors.New("tor control server hash " +
+		"mismatch")
+
+	// ErrTorControlInvalidReply indicates the Tor control port returned a
+	// reply in an unexpected format.
+	ErrTorControlInvalidReply = errors.New("invalid tor control reply")
+)
+
+// TorControlError describes an error reply returned by the Tor control port.
+type TorControlError struct {
+	Code    int
+	Message string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e TorControlError) Error() string {
+	return fmt.Sprintf("tor control error %d: %s", e.Code, e.Message)
+}
+
+// torReply is a reply to a Tor control command.  Each element of lines holds
+// the text of one reply line without the status code and separator.
+type torReply struct {
+	code  int
+	lines []string
+}
+
+// OnionService describes an onion service created through the control port.
+type OnionService struct {
+	// ServiceID is the onion address without the .onion suffix.
+	ServiceID string
+
+	// PrivateKey is the private key of the service in the
+	// <KeyType>:<KeyBlob> form accepted by ADD_ONION.
+	PrivateKey string
+}
+
+// Address returns the .onion host name of the service.
+func (s *OnionService) Address() string {
+	return s.ServiceID + ".onion"
+}
+
+// TorController is a minimal client for the Tor control protocol that is able
+// to authenticate and publish ephemeral onion services.  Onion services added
+// through a controller are removed by Tor once its connection is closed.
+type TorController struct {
+	addr     string
+	password string
+
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewTorController returns a controller for the Tor control port listening at
+// addr.  When password is not empty HASHEDPASSWORD authentication is used,
+// otherwise SAFECOOKIE or COOKIE authentication is attempted depending on the
+// methods offered by Tor.
+func NewTorController(addr, password string) *TorController {
+	return &TorController{
+		addr:     addr,
+		password: password,
+	}
+}
+
+// Connect dials the control port and authenticates.
+func (c *TorController) Connect() error {
+	conn, err := net.DialTimeout("tcp", c.addr, torControlDialTimeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+
+	if err := c.authenticate(); err != nil {
+		c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection to the control port.  Any onion service added
+// through the controller is removed by Tor.
+func (c *TorController) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Wait blocks until the connection to the control port is closed, discarding
+// any asynchronous event sent by Tor.  It returns the error that caused the
+// connection to be closed.
+func (c *TorController) Wait() error {
+	for {
+		if _, err := c.readReply(); err != nil {
+			return err
+		}
+	}
+}
+
+// AddOnion publishes an onion service mapping virtPort to target.  An
+// existing service is restored when privateKey is not empty, otherwise a new
+// ED25519-V3 key is generated and returned in the service.
+func (c *TorController) AddOnion(privateKey string, virtPort uint16,
+	target string) (*OnionService, error) {
+
+	if privateKey == "" {
+		privateKey = "NEW:" + TorOnionKeyTypeV3
+	}
+	cmd := fmt.Sprintf("ADD_ONION %s Port=%d,%s", privateKey, virtPort,
+		target)
+	reply, err := c.command(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &OnionService{}
+	for _, line := range reply.lines {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "ServiceID":
+			service.ServiceID = value
+		case "PrivateKey":
+			service.PrivateKey = value
+		}
+	}
+	if service.ServiceID == "" {
+		return nil, ErrTorControlInvalidReply
+	}
+	if service.PrivateKey == "" && !strings.HasPrefix(privateKey, "NEW:") {
+		service.PrivateKey = privateKey
+	}
+
+	return service, nil
+}
+
+// authenticate queries the authentication methods offered by the control
+// port and authenticates with the most suitable one.
+func (c *TorController) authenticate() error {
+	reply, err := c.command("PROTOCOLINFO 1")
+	if err != nil {
+		return err
+	}
+
+	var methods []string
+	var cookieFile string
+	for _, line := range reply.lines {
+		if !strings.HasPrefix(line, "AUTH ") {
+			continue
+		}
+		args := parseTorReplyArgs(line[len("AUTH "):])
+		methods = strings.Split(args["METHODS"], ",")
+		cookieFile = args["COOKIEFILE"]
+	}
+	hasMethod := func(method string) bool {
+		for _, m := range methods {
+			if m == method {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case c.password != "" && hasMethod("HASHEDPASSWORD"):
+		_, err = c.command("AUTHENTICATE " + quoteTorString(c.password))
+
+	case hasMethod("SAFECOOKIE") && cookieFile != "":
+		err = c.authenticateSafeCookie(cookieFile)
+
+	case hasMethod("COOKIE") && cookieFile != "":
+		var cookie []byte
+		cookie, err = readTorCookie(cookieFile)
+		if err == nil {
+			_, err = c.command("AUTHENTICATE " +
+				hex.EncodeToString(cookie))
+		}
+
+	case hasMethod("NULL"):
+		_, err = c.command("AUTHENTICATE")
+
+	default:
+		err = ErrTorControlAuthMethod
+	}
+	return err
+}
+
+// authenticateSafeCookie performs the SAFECOOKIE challenge-response which
+// proves knowledge of the cookie without disclosing it, and ensures the
+// control port belongs to the Tor instance that wrote the cookie file.
+func (c *TorController) authenticateSafeCookie(cookieFile string) error {
+	cookie, err := readTorCookie(cookieFile)
+	if err != nil {
+		return err
+	}
+
+	clientNonce := make([]byte, 32)
+	if _, err := rand.Read(clientNonce); err != nil {
+		return err
+	}
+	reply, err := c.command("AUTHCHALLENGE SAFECOOKIE " +
+		hex.EncodeToString(clientNonce))
+	if err != nil {
+		return err
+	}
+	if len(reply.lines) == 0 ||
+		!strings.HasPrefix(reply.lines[0], "AUTHCHALLENGE ") {
+
+		return ErrTorControlInvalidReply
+	}
+	args := parseTorReplyArgs(reply.lines[0][len("AUTHCHALLENGE "):])
+	serverHash, err := hex.DecodeString(args["SERVERHASH"])
+	if err != nil {
+		return ErrTorControlInvalidReply
+	}
+	serverNonce, err := hex.DecodeString(args["SERVERNONCE"])
+	if err != nil {
+		return ErrTorControlInvalidReply
+	}
+
+	msg := make([]byte, 0, len(cookie)+len(clientNonce)+len(serverNonce))
+	msg = append(msg, cookie...)
+	msg = append(msg, clientNonce...)
+	msg = append(msg, serverNonce...)
+	if !hmac.Equal(serverHash, torSafeCookieHash(torSafeCookieServerKey, msg)) {
+		return ErrTorControlServerHash
+	}
+
+	clientHash := torSafeCookieHash(torSafeCookieClientKey, msg)
+	_, err = c.command("AUTHENTICATE " + hex.EncodeToString(clientHash))
+	return err
+}
+
+// command sends cmd to the control port and returns its reply.  Replies with
+// an error status are returned as a TorControlError.
+func (c *TorController) command(cmd string) (*torReply, error) {
+	if _, err := c.conn.Write([]byte(cmd + "\r\n")); err != nil {
+		return nil, err
+	}
+
+	for {
+		reply, err := c.readReply()
+		if err != nil {
+			return nil, err
+		}
+
+		// Asynchronous events may arrive at any time and are not a
+		// response to the command.
+		if reply.code == 650 {
+			continue
+		}
+		if reply.code < 200 || reply.code > 299 {
+			return nil, TorControlError{
+				Code:    reply.code,
+				Message: strings.Join(reply.lines, " "),
+			}
+		}
+		return reply, nil
+	}
+}
+
+// readReply reads a single, possibly multi-line, reply from the control port.
+func (c *TorController) readReply() (*torReply, error) {
+	reply := &torReply{}
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) < 4 {
+			return nil, ErrTorControlInvalidReply
+		}
+
+		code, err := strconv.Atoi(line[:3])
+		if err != nil {
+			return nil, ErrTorControlInvalidReply
+		}
+		reply.code = code
+		reply.lines = append(reply.lines, line[4:])
+
+		switch line[3] {
+		case ' ':
+			return reply, nil
+
+		case '-':
+
+		case '+':
+			// Data replies continue until a line containing a
+			// single period.  The data itself is not used.
+			for {
+				data, err := c.reader.ReadString('\n')
+				if err != nil {
+					return nil, err
+				}
+				if strings.TrimRight(data, "\r\n") == "." {
+					break
+				}
+			}
+
+		default:
+			return nil, ErrTorControlInvalidReply
+		}
+	}
+}
+
+// torSafeCookieHash returns the HMAC-SHA256 of msg using key.
+func torSafeCookieHash(key string, msg []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+// readTorCookie reads the authentication cookie written by Tor.
+func readTorCookie(path string) ([]byte, error) {
+	cookie, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(cookie) != torCookieLen {
+		return nil, fmt.Errorf("tor cookie file %s has unexpected "+
+			"length %d", path, len(cookie))
+	}
+	return cookie, nil
+}
+
+// quoteTorString returns s as a quoted string for use in control commands.
+func quoteTorString(s string) string {
+	var b bytes.Buffer
+	b.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// parseTorReplyArgs parses the space separated KEY=VALUE arguments of a reply
+// line.  Values may be quoted strings with backslash escapes.
+func parseTorReplyArgs(s string) map[string]string {
+	args := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+
+		// Skip positional arguments preceding the next KEY=VALUE.
+		if sp := strings.IndexByte(s, ' '); sp >= 0 && sp < eq {
+			s = s[sp:]
+			continue
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+
+		var value strings.Builder
+		if strings.HasPrefix(s, "\"") {
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			s = s[min(i+1, len(s)):]
+		} else {
+			end := strings.IndexByte(s, ' ')
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(s[:end])
+			s = s[end:]
+		}
+		args[key] = value.String()
+	}
+	return args
+}
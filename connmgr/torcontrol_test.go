@@ -0,0 +1,274 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	// testServiceID and testPrivateKey are the onion service returned by
+	// the mock Tor control port.
+	testServiceID  = "vww6ybal4bd7szmgncyruucpgfkqahzddi37ktceo3ah7ngmcopnpyyd"
+	testPrivateKey = "ED25519-V3:cHJpdmF0ZWtleQ=="
+)
+
+// mockTorControl is a Tor control port which serves a single connection and
+// records the commands it receives.
+type mockTorControl struct {
+	listener   net.Listener
+	methods    string
+	cookieFile string
+	cookie     []byte
+	password   string
+
+	// badServerHash makes the SAFECOOKIE challenge return an invalid
+	// server hash.
+	badServerHash bool
+
+	commands chan string
+}
+
+// newMockTorControl starts a mock Tor control port offering the passed
+// authentication methods.
+func newMockTorControl(t *testing.T, methods string) *mockTorControl {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	cookie := bytes.Repeat([]byte{0x42}, torCookieLen)
+	cookieFile := filepath.Join(t.TempDir(), "control_auth_cookie")
+	if err := os.WriteFile(cookieFile, cookie, 0600); err != nil {
+		t.Fatalf("write cookie: %v", err)
+	}
+
+	m := &mockTorControl{
+		listener:   listener,
+		methods:    methods,
+		cookieFile: cookieFile,
+		cookie:     cookie,
+		password:   "hunter2",
+		commands:   make(chan string, 10),
+	}
+	t.Cleanup(func() { listener.Close() })
+	return m
+}
+
+// serve handles a single control connection.
+func (m *mockTorControl) serve() {
+	conn, err := m.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var clientNonce []byte
+	serverNonce := bytes.Repeat([]byte{0x24}, 32)
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		m.commands <- line
+
+		var reply string
+		switch {
+		case line == "PROTOCOLINFO 1":
+			reply = fmt.Sprintf("250-PROTOCOLINFO 1\r\n"+
+				"250-AUTH METHODS=%s COOKIEFILE=\"%s\"\r\n"+
+				"250-VERSION Tor=\"0.4.8.9\"\r\n250 OK\r\n",
+				m.methods, m.cookieFile)
+
+		case strings.HasPrefix(line, "AUTHCHALLENGE SAFECOOKIE "):
+			clientNonce, _ = hex.DecodeString(line[25:])
+			msg := append(append(append([]byte{}, m.cookie...),
+				clientNonce...), serverNonce...)
+			serverHash := torSafeCookieHash(torSafeCookieServerKey, msg)
+			if m.badServerHash {
+				serverHash[0] ^= 0xff
+			}
+			reply = fmt.Sprintf("250 AUTHCHALLENGE SERVERHASH=%x "+
+				"SERVERNONCE=%x\r\n", serverHash, serverNonce)
+
+		case strings.HasPrefix(line, "AUTHENTICATE"):
+			arg := strings.TrimPrefix(line, "AUTHENTICATE ")
+			msg := append(append(append([]byte{}, m.cookie...),
+				clientNonce...), serverNonce...)
+			valid := arg == quoteTorString(m.password) ||
+				arg == hex.EncodeToString(m.cookie) ||
+				arg == hex.EncodeToString(torSafeCookieHash(
+					torSafeCookieClientKey, msg))
+			if valid {
+				reply = "250 OK\r\n"
+			} else {
+				reply = "515 Authentication failed\r\n"
+			}
+
+		case strings.HasPrefix(line, "ADD_ONION NEW:ED25519-V3 "):
+			reply = "650 STATUS_CLIENT NOTICE CIRCUIT_ESTABLISHED\r\n" +
+				"250-ServiceID=" + testServiceID + "\r\n" +
+				"250-PrivateKey=" + testPrivateKey + "\r\n" +
+				"250 OK\r\n"
+
+		case strings.HasPrefix(line, "ADD_ONION "+testPrivateKey+" "):
+			reply = "250-ServiceID=" + testServiceID + "\r\n" +
+				"250 OK\r\n"
+
+		default:
+			reply = "510 Unrecognized command\r\n"
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+// TestTorControlAuth ensures the controller picks the expected authentication
+// method and completes the handshake.
+func TestTorControlAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		methods  string
+		password string
+		wantAuth string
+	}{
+		{
+			name:     "safecookie",
+			methods:  "COOKIE,SAFECOOKIE",
+			wantAuth: "AUTHCHALLENGE SAFECOOKIE ",
+		},
+		{
+			name:     "cookie",
+			methods:  "COOKIE",
+			wantAuth: "AUTHENTICATE 4242",
+		},
+		{
+			name:     "password",
+			methods:  "HASHEDPASSWORD,SAFECOOKIE",
+			password: "hunter2",
+			wantAuth: "AUTHENTICATE \"hunter2\"",
+		},
+	}
+
+	for _, test := range tests {
+		mock := newMockTorControl(t, test.methods)
+		go mock.serve()
+
+		c := NewTorController(mock.listener.Addr().String(), test.password)
+		if err := c.Connect(); err != nil {
+			t.Fatalf("%s: connect: %v", test.name, err)
+		}
+		c.Close()
+
+		<-mock.commands
+		if cmd := <-mock.commands; !strings.HasPrefix(cmd, test.wantAuth) {
+			t.Fatalf("%s: got auth command %q, want prefix %q",
+				test.name, cmd, test.wantAuth)
+		}
+	}
+}
+
+// TestTorControlAuthFailures ensures authentication errors are reported.
+func TestTorControlAuthFailures(t *testing.T) {
+	// A server hash that does not match the cookie must abort the
+	// handshake before the client hash is disclosed.
+	mock := newMockTorControl(t, "SAFECOOKIE")
+	mock.badServerHash = true
+	go mock.serve()
+	c := NewTorController(mock.listener.Addr().String(), "")
+	if err := c.Connect(); !errors.Is(err, ErrTorControlServerHash) {
+		t.Fatalf("got %v, want %v", err, ErrTorControlServerHash)
+	}
+
+	// A wrong password is rejected by the control port.
+	mock = newMockTorControl(t, "HASHEDPASSWORD")
+	go mock.serve()
+	c = NewTorController(mock.listener.Addr().String(), "wrong")
+	var ctlErr TorControlError
+	if err := c.Connect(); !errors.As(err, &ctlErr) || ctlErr.Code != 515 {
+		t.Fatalf("got %v, want tor control error 515", err)
+	}
+
+	// No usable method.
+	mock = newMockTorControl(t, "HASHEDPASSWORD")
+	go mock.serve()
+	c = NewTorController(mock.listener.Addr().String(), "")
+	if err := c.Connect(); !errors.Is(err, ErrTorControlAuthMethod) {
+		t.Fatalf("got %v, want %v", err, ErrTorControlAuthMethod)
+	}
+}
+
+// TestTorControlAddOnion ensures new and restored onion services are parsed
+// from the ADD_ONION reply.
+func TestTorControlAddOnion(t *testing.T) {
+	mock := newMockTorControl(t, "SAFECOOKIE")
+	go mock.serve()
+
+	c := NewTorController(mock.listener.Addr().String(), "")
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+
+	service, err := c.AddOnion("", 15212, "127.0.0.1:15212")
+	if err != nil {
+		t.Fatalf("add onion: %v", err)
+	}
+	if service.ServiceID != testServiceID ||
+		service.PrivateKey != testPrivateKey {
+
+		t.Fatalf("unexpected service %+v", service)
+	}
+	if service.Address() != testServiceID+".onion" {
+		t.Fatalf("unexpected address %s", service.Address())
+	}
+
+	// Restoring the service with its key keeps the key in the result
+	// even though Tor does not echo it back.
+	service, err = c.AddOnion(testPrivateKey, 15212, "127.0.0.1:15212")
+	if err != nil {
+		t.Fatalf("restore onion: %v", err)
+	}
+	if service.PrivateKey != testPrivateKey {
+		t.Fatalf("got private key %q, want %q", service.PrivateKey,
+			testPrivateKey)
+	}
+
+	_, err = c.AddOnion("RSA1024:abc", 15212, "127.0.0.1:15212")
+	var ctlErr TorControlError
+	if !errors.As(err, &ctlErr) || ctlErr.Code != 510 {
+		t.Fatalf("got %v, want tor control error 510", err)
+	}
+}
+
+// TestParseTorReplyArgs ensures quoted and unquoted reply arguments are
+// parsed.
+func TestParseTorReplyArgs(t *testing.T) {
+	args := parseTorReplyArgs(`METHODS=COOKIE,SAFECOOKIE ` +
+		`COOKIEFILE="/var/lib/tor/a \"b\"\\c" extra KEY=v`)
+	want := map[string]string{
+		"METHODS":    "COOKIE,SAFECOOKIE",
+		"COOKIEFILE": `/var/lib/tor/a "b"\c`,
+		"KEY":        "v",
+	}
+	for k, v := range want {
+		if args[k] != v {
+			t.Errorf("%s: got %q, want %q", k, args[k], v)
+		}
+	}
+}
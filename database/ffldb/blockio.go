@@ -9,6 +9,7 @@
 package ffldb
 
 import (
+	"bufio"
 	"container/list"
 	"encoding/binary"
 	"fmt"
@@ -811,3 +812,82 @@ func newBlockStore(basePath string, network wire.FlokicoinNet) (*blockStore, err
 	store.deleteFileFunc = store.deleteFile
 	return store, nil
 }
+
+// ScanBlockFiles reads the blocks stored in the flat block files of the
+// database at the passed path, in the order they were written, and calls the
+// passed function with each serialized block.  It doesn't rely on the metadata
+// of the database, so the blocks can be recovered when it's corrupted.  The
+// rest of a file is skipped once one of its records is truncated, fails its
+// checksum, or is for another network, since the next records can't be
+// located reliably.
+func ScanBlockFiles(dbPath string, network wire.FlokicoinNet, fn func(rawBlock []byte) error) error {
+	files, err := filepath.Glob(filepath.Join(dbPath, "*"+blockFileExtension))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, filePath := range files {
+		if err := scanBlockFile(filePath, network, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanBlockFile reads the blocks stored in the passed flat block file and
+// calls the passed function with each serialized block.  See ScanBlockFiles.
+//
+// Format: <network><block length><serialized block><checksum>
+func scanBlockFile(filePath string, network wire.FlokicoinNet, fn func(rawBlock []byte) error) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var offset int64
+	for {
+		var header [8]byte
+		_, err := io.ReadFull(r, header[:])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			log.Warnf("Skipping the truncated record at offset %d of "+
+				"block file %s", offset, filePath)
+			return nil
+		}
+
+		serializedNet := byteOrder.Uint32(header[:4])
+		blockLen := byteOrder.Uint32(header[4:8])
+		if serializedNet != uint32(network) || blockLen > maxBlockFileSize {
+			log.Warnf("Skipping the rest of block file %s from the "+
+				"invalid record at offset %d", filePath, offset)
+			return nil
+		}
+
+		record := make([]byte, blockLen+4)
+		if _, err := io.ReadFull(r, record); err != nil {
+			log.Warnf("Skipping the truncated record at offset %d of "+
+				"block file %s", offset, filePath)
+			return nil
+		}
+
+		hasher := crc32.New(castagnoli)
+		_, _ = hasher.Write(header[:])
+		_, _ = hasher.Write(record[:blockLen])
+		serializedChecksum := binary.BigEndian.Uint32(record[blockLen:])
+		if hasher.Sum32() != serializedChecksum {
+			log.Warnf("Skipping the rest of block file %s from the "+
+				"corrupt record at offset %d", filePath, offset)
+			return nil
+		}
+
+		if err := fn(record[:blockLen]); err != nil {
+			return err
+		}
+		offset += int64(len(header)) + int64(len(record))
+	}
+}
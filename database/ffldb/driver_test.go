@@ -474,3 +474,77 @@ func TestInterface(t *testing.T) {
 		testInterface(t, db)
 	})
 }
+
+// TestScanBlockFiles ensures the blocks stored in the flat block files of a
+// database are read back in order without its metadata, and that a truncated
+// record at the end of a file is skipped.
+func TestScanBlockFiles(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database to run tests against.
+	dbPath := t.TempDir()
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+
+	// Store the test blocks across several block files.
+	blocks, err := loadBlocks(t, blockDataFile, blockDataNet)
+	if err != nil {
+		t.Fatalf("loadBlocks: Unexpected error: %v", err)
+	}
+	ffldb.TstRunWithMaxBlockFileSize(db, 2048, func() {
+		err = db.Update(func(tx database.Tx) error {
+			for i, block := range blocks {
+				err := tx.StoreBlock(block)
+				if err != nil {
+					return fmt.Errorf("StoreBlock #%d: unexpected "+
+						"error: %v", i, err)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Append a truncated record to the last block file.
+	files, err := filepath.Glob(filepath.Join(dbPath, "*.fdb"))
+	if err != nil || len(files) < 2 {
+		t.Fatalf("expected several block files, got %d: %v", len(files),
+			err)
+	}
+	f, err := os.OpenFile(files[len(files)-1], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0x01, 0x02, 0x03}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var scanned [][]byte
+	err = ffldb.ScanBlockFiles(dbPath, blockDataNet, func(rawBlock []byte) error {
+		scanned = append(scanned, rawBlock)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ScanBlockFiles: unexpected error: %v", err)
+	}
+	if len(scanned) != len(blocks) {
+		t.Fatalf("scanned %d blocks, want %d", len(scanned), len(blocks))
+	}
+	for i, block := range blocks {
+		want, err := block.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(scanned[i], want) {
+			t.Fatalf("block #%d differs from the stored block", i)
+		}
+	}
+}
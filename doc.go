@@ -30,6 +30,11 @@ Application Options:
 	    --addrindex             Maintain a full address-based transaction index
 	                            which makes the searchrawtransactions RPC
 	                            available
+	    --assumevalid=          Skip the script checks of this block and its
+	                            ancestors once it's buried deep enough in the
+	                            best header chain, defaulting to the one of the
+	                            network if any -- 0 checks the scripts of all
+	                            blocks
 	    --banduration=          How long to ban misbehaving peers.  Valid time
 	                            units are {s, m, h}.  Minimum 1 second (default:
 	                            24h0m0s)
@@ -47,6 +52,17 @@ Application Options:
 	                            transactions when creating a block (default:
 	                            50000)
 	    --blocksonly            Do not accept transactions from remote peers.
+	    --capturemessages       Write every message sent to and received from
+	                            each peer to a file per peer in the capture
+	                            directory of the data directory -- Use the
+	                            msgdump utility to decode them
+	    --chainparams=          Path to a JSON file defining the parameters of a
+	                            private network to use instead of one of the
+	                            standard networks -- other formats such as TOML
+	                            are not supported
+	    --cjdnsreachable        Treat IPv6 addresses in fc00::/8 as reachable
+	                            CJDNS addresses rather than private addresses --
+	                            Requires a running CJDNS node
 	-C, --configfile=           Path to configuration file
 	    --connect=              Connect only to the specified peers at startup
 	    --cpuprofile=           Write CPU profile to the specified file
@@ -70,6 +86,9 @@ Application Options:
 	    --externalip=           Add an ip to the list of local addresses we claim
 	                            to listen on to peers
 	    --generate              Generate (mine) flokicoins using the CPU
+	    --i2psam=               I2P SAM bridge used to connect to I2P peers and
+	                            accept incoming I2P connections (eg.
+	                            127.0.0.1:7656)
 	    --limitfreerelay=       Limit relay of transactions with no transaction
 	                            fee to the given amount in thousands of bytes per
 	                            minute (default: 15)
@@ -80,6 +99,16 @@ Application Options:
 	    --maxorphantx=          Max number of orphan transactions to keep in
 	                            memory (default: 100)
 	    --maxpeers=             Max number of inbound and outbound peers
+	    --maxreorgdepth=        Max number of blocks of the best chain a
+	                            reorganization may disconnect automatically --
+	                            Deeper reorganizations are refused until they
+	                            are approved with the approvereorg or
+	                            reconsiderblock RPCs, 0 means no limit
+	    --maxuploadtarget=      Try to keep the data sent to peers under the
+	                            given target in MiB per 24h -- Historical blocks
+	                            are no longer served to peers without the
+	                            download permission
+	                            once it is reached, 0 means no limit
 	                            (default: 125)
 	    --miningaddr=           Add the specified payment address to the list of
 	                            addresses to use for generated blocks -- At least
@@ -111,12 +140,21 @@ Application Options:
 	                            (eg. 127.0.0.1:9050)
 	    --onionpass=            Password for onion proxy server
 	    --onionuser=            Username for onion proxy server
+	    --onlynet=              Make automatic outbound connections only to the
+	                            given network (ipv4, ipv6, onion, i2p or cjdns)
+	                            -- Can be specified multiple times
 	    --profile=              Enable HTTP profiling on given port -- NOTE port
 	                            must be between 1024 and 65536
 	    --proxy=                Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)
 	    --proxypass=            Password for proxy server
 	    --proxyuser=            Username for proxy server
 	    --regtest               Use the regression test network
+	    --reindex               Rebuild the block database from its block files on
+	                            start up -- The blocks are validated again and
+	                            the optional indexes are rebuilt
+	    --reindex-chainstate    Rebuild the UTXO set on start up by validating
+	                            again the blocks already in the block database --
+	                            The optional indexes are rebuilt
 	    --rejectnonstd          Reject non-standard transactions regardless of
 	                            the default settings for the active network.
 	    --relaynonstd           Relay non-standard transactions regardless of the
@@ -142,19 +180,45 @@ Application Options:
 	                            verification cache (default: 100000)
 	    --simnet                Use the simulation test network
 	    --testnet               Use the test network
+	    --torcontrol=           Tor control port used to publish an onion
+	                            service for incoming connections (eg.
+	                            127.0.0.1:9051)
 	    --torisolation          Enable Tor stream isolation by randomizing user
 	                            credentials for each connection.
+	    --torpassword=          Password for the Tor control port -- Cookie
+	                            authentication is used when not set
 	    --trickleinterval=      Minimum time between attempts to send new
 	                            inventory to a connected peer (default: 10s)
 	    --txindex               Maintain a full hash-based transaction index
 	                            which makes all transactions available via the
 	                            getrawtransaction RPC
+	    --txreconciliation      Relay transactions through set reconciliation
+	                            (BIP330) with the peers that support it instead
+	                            of announcing every transaction to them --
+	                            Transactions are still announced right away to a
+	                            few outbound peers
 	    --uacomment=            Comment to add to the user agent -- See BIP 14
 	                            for more information.
 	    --upnp                  Use UPnP to map our listening port outside of NAT
+	    --vbparams=             Override the version bits parameters of a
+	                            deployment on regtest or simnet.  Format:
+	                            '<deployment>:<start>:<end>[:<minactivationheight>[:<bit>]]'
+	                            where start and end are unix times of the median
+	                            time past, 0 meaning always started or never
+	                            expiring -- Can be specified multiple times
 	-V, --version               Display version information and exit
-	    --whitelist=            Add an IP network or IP that will not be banned.
-	                            (eg. 192.168.1.0/24 or ::1)
+	    --whitebind=            Add an interface/port to listen for connections
+	                            whose peers are granted permissions, optionally
+	                            prefixed with comma-separated permissions and @
+	                            (eg. relay,mempool@127.0.0.1:15300) --
+	                            Permissions: noban, relay, forcerelay, download,
+	                            mempool or all, defaulting to noban, relay,
+	                            download and mempool
+	    --whitelist=            Add an IP network or IP whose peers are granted
+	                            permissions, optionally prefixed with
+	                            comma-separated permissions and @ (eg.
+	                            192.168.1.0/24, ::1 or noban@10.0.0.0/8) -- See
+	                            --whitebind for the permissions
 
 Help Options:
 
@@ -0,0 +1,248 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/netaddr"
+)
+
+const (
+	// evictProtectNetGroups is the number of inbound peers in distinct
+	// network groups protected from eviction.  An attacker has to control
+	// many network groups to avoid losing its connections.
+	evictProtectNetGroups = 4
+
+	// evictProtectPing is the number of inbound peers with the lowest
+	// ping times protected from eviction.
+	evictProtectPing = 8
+
+	// evictProtectTxRelay is the number of inbound peers that most
+	// recently relayed a new transaction protected from eviction.
+	evictProtectTxRelay = 4
+
+	// evictProtectBlockRelay is the number of inbound peers that most
+	// recently relayed a new block protected from eviction.
+	evictProtectBlockRelay = 4
+)
+
+// evictionCandidate holds the details of an inbound peer used to decide
+// whether it is evicted to make room for a new inbound peer.
+type evictionCandidate struct {
+	id            int32
+	connected     time.Time
+	minPing       time.Duration
+	lastTxTime    time.Time
+	lastBlockTime time.Time
+	relayTxs      bool
+	bloomFilter   bool
+	keyedNetGroup uint64
+	network       netaddr.Network
+	isLocal       bool
+}
+
+// isDisadvantaged returns whether the candidate is connected through a
+// network whose peers tend to have higher ping times and would otherwise
+// rarely be protected by them.
+func (c *evictionCandidate) isDisadvantaged() bool {
+	switch c.network {
+	case netaddr.NetworkOnion, netaddr.NetworkI2P, netaddr.NetworkCJDNS:
+		return true
+	}
+	return c.isLocal
+}
+
+// protectCandidates removes up to n candidates from the end of the slice after
+// sorting it with less, which must order the most deserving candidates last.
+func protectCandidates(candidates []evictionCandidate, n int,
+	less func(a, b *evictionCandidate) bool) []evictionCandidate {
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return less(&candidates[i], &candidates[j])
+	})
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	return candidates[:len(candidates)-n]
+}
+
+// olderConnection orders candidates by descending connection time so the
+// longest connected candidates are last.
+func olderConnection(a, b *evictionCandidate) bool {
+	return a.connected.After(b.connected)
+}
+
+// selectPeerToEvict returns the id of the inbound peer to evict among the
+// passed candidates, or false when every candidate is protected.
+//
+// Candidates are protected in several rounds, each on a criterion an attacker
+// can't easily game: distinct network groups, low ping times, recent relay of
+// new transactions and blocks, and finally the longest connections, reserving
+// part of those for peers on networks such as Tor and I2P.  Among the rest, the
+// most recently connected peer in the network group with the most connections
+// is evicted.
+//
+// The candidates slice is reordered.
+func selectPeerToEvict(candidates []evictionCandidate) (int32, bool) {
+	// Protect peers in distinct network groups.  The groups are keyed
+	// with a local secret so an attacker can't predict which of them are
+	// protected.
+	candidates = protectCandidates(candidates, evictProtectNetGroups,
+		func(a, b *evictionCandidate) bool {
+			return a.keyedNetGroup < b.keyedNetGroup
+		})
+
+	// Protect peers with the lowest ping times.  Peers without a ping
+	// time are the least deserving.
+	candidates = protectCandidates(candidates, evictProtectPing,
+		func(a, b *evictionCandidate) bool {
+			if a.minPing == 0 || b.minPing == 0 {
+				return a.minPing == 0 && b.minPing != 0
+			}
+			return a.minPing > b.minPing
+		})
+
+	// Protect peers that recently relayed new transactions, preferring
+	// peers that relay transactions without a bloom filter.
+	candidates = protectCandidates(candidates, evictProtectTxRelay,
+		func(a, b *evictionCandidate) bool {
+			if !a.lastTxTime.Equal(b.lastTxTime) {
+				return a.lastTxTime.Before(b.lastTxTime)
+			}
+			if a.relayTxs != b.relayTxs {
+				return b.relayTxs
+			}
+			if a.bloomFilter != b.bloomFilter {
+				return a.bloomFilter
+			}
+			return olderConnection(a, b)
+		})
+
+	// Protect peers that recently relayed new blocks.
+	candidates = protectCandidates(candidates, evictProtectBlockRelay,
+		func(a, b *evictionCandidate) bool {
+			if !a.lastBlockTime.Equal(b.lastBlockTime) {
+				return a.lastBlockTime.Before(b.lastBlockTime)
+			}
+			return olderConnection(a, b)
+		})
+
+	// Protect half of the remaining peers by connection time.  Up to a
+	// quarter of them are reserved for the longest connected peers on
+	// disadvantaged networks, and slots those peers don't use go to the
+	// other longest connected peers.
+	protectTotal := len(candidates) / 2
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := &candidates[i], &candidates[j]
+		if a.isDisadvantaged() != b.isDisadvantaged() {
+			return b.isDisadvantaged()
+		}
+		return olderConnection(a, b)
+	})
+	protected := 0
+	for protected < protectTotal/2 && len(candidates) > 0 &&
+		candidates[len(candidates)-1].isDisadvantaged() {
+
+		candidates = candidates[:len(candidates)-1]
+		protected++
+	}
+	candidates = protectCandidates(candidates, protectTotal-protected,
+		olderConnection)
+
+	if len(candidates) == 0 {
+		return 0, false
+	}
+
+	// Evict the most recently connected peer in the network group with
+	// the most connections.  Ties are broken by the group with the most
+	// recent connection.
+	type netGroup struct {
+		count  int
+		newest *evictionCandidate
+	}
+	groups := make(map[uint64]*netGroup)
+	for i := range candidates {
+		c := &candidates[i]
+		group, ok := groups[c.keyedNetGroup]
+		if !ok {
+			group = &netGroup{newest: c}
+			groups[c.keyedNetGroup] = group
+		}
+		group.count++
+		if c.connected.After(group.newest.connected) {
+			group.newest = c
+		}
+	}
+	var worst *netGroup
+	for i := range candidates {
+		group := groups[candidates[i].keyedNetGroup]
+		if worst == nil || group.count > worst.count ||
+			(group.count == worst.count &&
+				group.newest.connected.After(worst.newest.connected)) {
+
+			worst = group
+		}
+	}
+	return worst.newest.id, true
+}
+
+// keyedNetGroup returns the network group of the passed peer hashed with the
+// server's eviction key.
+func (s *server) keyedNetGroup(sp *serverPeer) uint64 {
+	var key [8]byte
+	binary.LittleEndian.PutUint64(key[:], s.evictionKey)
+
+	h := fnv.New64a()
+	h.Write(key[:])
+	h.Write([]byte(netaddr.GroupKey(sp.NA())))
+	return h.Sum64()
+}
+
+// evictInboundPeer disconnects an inbound peer to make room for a new inbound
+// peer when the maximum number of peers is reached.  It returns false when
+// every inbound peer is protected from eviction.  Peers with the noban
+// permission are never evicted.  It is invoked from the peerHandler goroutine.
+func (s *server) evictInboundPeer(state *peerState) bool {
+	candidates := make([]evictionCandidate, 0, len(state.inboundPeers))
+	peers := make(map[int32]*serverPeer, len(state.inboundPeers))
+	for _, sp := range state.inboundPeers {
+		// Skip peers that are already disconnecting, such as a peer
+		// evicted earlier that is not removed yet.
+		if sp.permissions.has(permNoBan) || !sp.Connected() || sp.NA() == nil {
+			continue
+		}
+
+		na := sp.NA()
+		lna := na.ToLegacy()
+		candidates = append(candidates, evictionCandidate{
+			id:            sp.ID(),
+			connected:     sp.TimeConnected(),
+			minPing:       time.Duration(sp.MinPingMicros()) * time.Microsecond,
+			lastTxTime:    time.Unix(0, atomic.LoadInt64(&sp.lastTxTime)),
+			lastBlockTime: time.Unix(0, atomic.LoadInt64(&sp.lastBlockTime)),
+			relayTxs:      !sp.relayTxDisabled(),
+			bloomFilter:   sp.filter.IsLoaded(),
+			keyedNetGroup: s.keyedNetGroup(sp),
+			network:       netaddr.NetworkOf(na),
+			isLocal:       lna != nil && netaddr.IsLocal(lna),
+		})
+		peers[sp.ID()] = sp
+	}
+
+	id, ok := selectPeerToEvict(candidates)
+	if !ok {
+		return false
+	}
+	sp := peers[id]
+	srvrLog.Infof("Max peers reached [%d] - evicting inbound peer %s",
+		cfg.MaxPeers, sp)
+	sp.Disconnect()
+	return true
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/netaddr"
+)
+
+// testEvictionCandidates returns n inbound candidates connected one minute
+// apart, so higher ids are younger.  The first 20 are in distinct network
+// groups while the others share a single group.
+func testEvictionCandidates(n int) []evictionCandidate {
+	base := time.Unix(1700000000, 0)
+	candidates := make([]evictionCandidate, n)
+	for i := range candidates {
+		candidates[i] = evictionCandidate{
+			id:        int32(i),
+			connected: base.Add(time.Duration(i) * time.Minute),
+			network:   netaddr.NetworkIPv4,
+		}
+		if i < 20 {
+			candidates[i].keyedNetGroup = uint64(i + 1)
+		}
+	}
+	return candidates
+}
+
+// TestSelectPeerToEvict ensures inbound peers are protected from eviction by
+// network group, ping time, recent relay, network and uptime, and the youngest
+// peer of the largest network group is evicted otherwise.
+func TestSelectPeerToEvict(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		num       int
+		modify    func(candidates []evictionCandidate)
+		wantID    int32
+		wantEvict bool
+	}{{
+		name:      "no candidates",
+		num:       0,
+		wantEvict: false,
+	}, {
+		name:      "all candidates protected",
+		num:       20,
+		wantEvict: false,
+	}, {
+		name:      "youngest in largest network group",
+		num:       30,
+		wantID:    29,
+		wantEvict: true,
+	}, {
+		name: "lowest ping protected",
+		num:  30,
+		modify: func(candidates []evictionCandidate) {
+			candidates[29].minPing = time.Millisecond
+		},
+		wantID:    28,
+		wantEvict: true,
+	}, {
+		name: "recent transaction relay protected",
+		num:  30,
+		modify: func(candidates []evictionCandidate) {
+			candidates[29].lastTxTime = now
+		},
+		wantID:    28,
+		wantEvict: true,
+	}, {
+		name: "recent block relay protected",
+		num:  30,
+		modify: func(candidates []evictionCandidate) {
+			candidates[29].lastBlockTime = now
+		},
+		wantID:    28,
+		wantEvict: true,
+	}, {
+		name: "disadvantaged networks protected",
+		num:  30,
+		modify: func(candidates []evictionCandidate) {
+			candidates[28].network = netaddr.NetworkOnion
+			candidates[29].isLocal = true
+		},
+		wantID:    27,
+		wantEvict: true,
+	}, {
+		name: "disadvantaged reservation limited",
+		num:  30,
+		modify: func(candidates []evictionCandidate) {
+			// Only two of the five protected slots are reserved,
+			// so the youngest of three i2p peers is evicted.
+			candidates[27].network = netaddr.NetworkI2P
+			candidates[28].network = netaddr.NetworkI2P
+			candidates[29].network = netaddr.NetworkI2P
+		},
+		wantID:    29,
+		wantEvict: true,
+	}, {
+		name: "largest network group evicted first",
+		num:  30,
+		modify: func(candidates []evictionCandidate) {
+			// Move the youngest peer to a smaller group.
+			candidates[29].keyedNetGroup = candidates[0].keyedNetGroup
+		},
+		wantID:    28,
+		wantEvict: true,
+	}}
+
+	for _, test := range tests {
+		candidates := testEvictionCandidates(test.num)
+		if test.modify != nil {
+			test.modify(candidates)
+		}
+		id, ok := selectPeerToEvict(candidates)
+		if ok != test.wantEvict {
+			t.Errorf("%s: got evict %v, want %v", test.name, ok,
+				test.wantEvict)
+			continue
+		}
+		if ok && id != test.wantID {
+			t.Errorf("%s: got evicted id %d, want %d", test.name, id,
+				test.wantID)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flokiorg/go-flokicoin/connmgr"
+	"github.com/flokiorg/go-flokicoin/netaddr"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// i2pKeyFilename is the name of the file in the data directory that holds the
+// private key of the I2P destination.  Reusing the key keeps the .b32.i2p
+// address stable across restarts.
+const i2pKeyFilename = "i2p_private_key"
+
+// errI2PDisabled is returned when dialing an I2P address without a configured
+// SAM bridge.
+var errI2PDisabled = errors.New("i2p has been disabled")
+
+// newI2PSession returns an I2P session using the SAM bridge configured with
+// --i2psam, or nil when I2P is not enabled.  The destination key is persisted
+// in the data directory and, when listening, the destination is advertised as
+// a local address once the session is created.
+func newI2PSession(amgr *netaddr.AddrManager, services wire.ServiceFlag) (*connmgr.I2PSession, error) {
+	if cfg.I2PSAM == "" {
+		return nil, nil
+	}
+
+	keyFile := filepath.Join(cfg.DataDir, i2pKeyFilename)
+	key, err := os.ReadFile(keyFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	savedKey := strings.TrimSpace(string(key))
+
+	onSession := func(privateKey string, addr *connmgr.I2PAddr) {
+		if privateKey != savedKey {
+			err := os.WriteFile(keyFile, []byte(privateKey+"\n"), 0600)
+			if err != nil {
+				srvrLog.Warnf("Unable to save I2P private key to "+
+					"%s: %v", keyFile, err)
+			} else {
+				savedKey = privateKey
+			}
+		}
+
+		if cfg.DisableListen {
+			return
+		}
+		na, err := amgr.HostToNetAddress(addr.Host, 0, services)
+		if err != nil {
+			srvrLog.Warnf("Unable to parse I2P address %s: %v",
+				addr.Host, err)
+			return
+		}
+		if err := amgr.AddLocalAddress(na, netaddr.ManualPrio); err != nil {
+			srvrLog.Warnf("Unable to add I2P address %s: %v",
+				addr.Host, err)
+		}
+	}
+
+	return connmgr.NewI2PSession(&connmgr.I2PConfig{
+		SAMAddr:    cfg.I2PSAM,
+		PrivateKey: savedKey,
+		OnSession:  onSession,
+	}), nil
+}
+
+// dialPeer connects to the passed peer address.  I2P addresses are dialed
+// through the SAM session while all other addresses use dial.
+func (s *server) dialPeer(addr net.Addr) (net.Conn, error) {
+	if i2pAddr, ok := addr.(*connmgr.I2PAddr); ok {
+		if s.i2pSession == nil {
+			return nil, errI2PDisabled
+		}
+		return s.i2pSession.Dial(i2pAddr, defaultConnectTimeout)
+	}
+	return dial(addr)
+}
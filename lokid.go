@@ -120,6 +120,14 @@ func fmain(serverChan chan<- *server) error {
 		return nil
 	}
 
+	// Move the block database aside to rebuild it from its block files
+	// when requested.
+	reindexPath, err := prepareReindex()
+	if err != nil {
+		flcdLog.Errorf("%v", err)
+		return err
+	}
+
 	// Load the block database.
 	db, err := loadBlockDB()
 	if err != nil {
@@ -127,11 +135,29 @@ func fmain(serverChan chan<- *server) error {
 		return err
 	}
 	defer func() {
-		// Ensure the database is sync'd and closed on shutdown.
+		// Ensure the database is sync'd and closed on shutdown unless
+		// it was already closed.
+		if db == nil {
+			return
+		}
 		flcdLog.Infof("Gracefully shutting down the database...")
 		db.Close()
 	}()
 
+	// Switch to the chain validated in the background when the UTXO
+	// snapshot the chain was loaded from is invalid.  The database is only
+	// replaced on success, and is not closed again when the switch failed
+	// after closing it.
+	switchedDb, err := discardInvalidSnapshot(db)
+	if err != nil {
+		if switchedDb == nil {
+			db = nil
+		}
+		flcdLog.Errorf("%v", err)
+		return err
+	}
+	db = switchedDb
+
 	// Return now if an interrupt signal was triggered.
 	if interruptRequested(interrupt) {
 		return nil
@@ -184,6 +210,14 @@ func fmain(serverChan chan<- *server) error {
 		flcdLog.Errorf("%v", err)
 		return err
 	}
+	if beenPruned && cfg.ReindexChainState {
+		err = fmt.Errorf("--reindex-chainstate cannot be used as the node "+
+			"has been previously pruned. You must delete the files in the "+
+			"datadir: \"%s\" and sync from the beginning to rebuild the "+
+			"chain state", cfg.DataDir)
+		flcdLog.Errorf("%v", err)
+		return err
+	}
 	if beenPruned && cfg.TxIndex {
 		err = fmt.Errorf("--txindex cannot be enabled as the node has been "+
 			"previously pruned. You must delete the files in the datadir: \"%s\" "+
@@ -248,6 +282,13 @@ func fmain(serverChan chan<- *server) error {
 		return err
 	}
 
+	// Reset the chain state to rebuild it when requested.
+	replay, err := resetChainState(db, interrupt)
+	if err != nil {
+		flcdLog.Errorf("%v", err)
+		return err
+	}
+
 	// The config file is already created if it did not exist and the log
 	// file has already been opened by now so we only need to allow
 	// creating rpc cert and key files if they don't exist.
@@ -260,7 +301,8 @@ func fmain(serverChan chan<- *server) error {
 
 	// Create server and start it.
 	server, err := newServer(cfg.Listeners, cfg.AgentBlacklist,
-		cfg.AgentWhitelist, db, activeNetParams.Params, interrupt)
+		cfg.AgentWhitelist, db, activeNetParams.Params, reindexPath,
+		replay, interrupt)
 	if err != nil {
 		// TODO: this logging could do with some beautifying.
 		flcdLog.Errorf("Unable to start server on %v: %v",
@@ -273,6 +315,12 @@ func fmain(serverChan chan<- *server) error {
 		server.WaitForShutdown()
 		srvrLog.Infof("Server shutdown complete")
 	}()
+
+	// Return now if an interrupt signal was triggered while reindexing.
+	if interruptRequested(interrupt) {
+		return nil
+	}
+
 	server.Start()
 	if serverChan != nil {
 		serverChan <- server
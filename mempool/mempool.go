@@ -843,6 +843,24 @@ func (mp *TxPool) FetchTransaction(txHash *chainhash.Hash) (*chainutil.Tx, error
 	return nil, fmt.Errorf("transaction is not in the pool")
 }
 
+// FetchTxDesc returns the descriptor of the requested transaction from the
+// transaction pool.  This only fetches from the main transaction pool and does
+// not include orphans.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) FetchTxDesc(txHash *chainhash.Hash) (*TxDesc, error) {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	txDesc, exists := mp.pool[*txHash]
+	mp.mtx.RUnlock()
+
+	if exists {
+		return txDesc, nil
+	}
+
+	return nil, fmt.Errorf("transaction is not in the pool")
+}
+
 // validateReplacement determines whether a transaction is deemed as a valid
 // replacement of all of its conflicts according to the RBF policy. If it is
 // valid, no error is returned. Otherwise, an error is returned indicating what
@@ -943,13 +961,13 @@ func (mp *TxPool) validateReplacement(tx *chainutil.Tx,
 //
 // This function MUST be called with the mempool lock held (for writes).
 func (mp *TxPool) maybeAcceptTransaction(tx *chainutil.Tx, isNew, rateLimit,
-	rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
+	limitFree, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
 
 	txHash := tx.Hash()
 
 	// Check for mempool acceptance.
 	r, err := mp.checkMempoolAcceptance(
-		tx, isNew, rateLimit, rejectDupOrphans,
+		tx, isNew, rateLimit, limitFree, rejectDupOrphans,
 	)
 	if err != nil {
 		return nil, nil, err
@@ -996,7 +1014,8 @@ func (mp *TxPool) maybeAcceptTransaction(tx *chainutil.Tx, isNew, rateLimit,
 func (mp *TxPool) MaybeAcceptTransaction(tx *chainutil.Tx, isNew, rateLimit bool) ([]*chainhash.Hash, *TxDesc, error) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true)
+	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit,
+		true, true)
 	mp.mtx.Unlock()
 
 	return hashes, txD, err
@@ -1039,7 +1058,7 @@ func (mp *TxPool) processOrphans(acceptedTx *chainutil.Tx) []*TxDesc {
 			// Potentially accept an orphan into the tx pool.
 			for _, tx := range orphans {
 				missing, txD, err := mp.maybeAcceptTransaction(
-					tx, true, true, false)
+					tx, true, true, true, false)
 				if err != nil {
 					// The orphan is now invalid, so there
 					// is no way any other orphans which
@@ -1115,6 +1134,24 @@ func (mp *TxPool) ProcessOrphans(acceptedTx *chainutil.Tx) []*TxDesc {
 //
 // This function is safe for concurrent access.
 func (mp *TxPool) ProcessTransaction(tx *chainutil.Tx, allowOrphan, rateLimit bool, tag Tag) ([]*TxDesc, error) {
+	return mp.processTransaction(tx, allowOrphan, rateLimit, true, tag)
+}
+
+// ProcessTransactionNoFreeLimit is the same as ProcessTransaction, except free
+// transactions are not subject to the rate limit that protects against
+// penny-flooding.  It is meant for the transactions relayed by trusted peers.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ProcessTransactionNoFreeLimit(tx *chainutil.Tx, allowOrphan, rateLimit bool, tag Tag) ([]*TxDesc, error) {
+	return mp.processTransaction(tx, allowOrphan, rateLimit, false, tag)
+}
+
+// processTransaction is the internal function which implements the public
+// ProcessTransaction and ProcessTransactionNoFreeLimit.  The limitFree flag
+// indicates whether free transactions are rate limited.
+func (mp *TxPool) processTransaction(tx *chainutil.Tx, allowOrphan, rateLimit,
+	limitFree bool, tag Tag) ([]*TxDesc, error) {
+
 	log.Tracef("Processing transaction %v", tx.Hash())
 
 	// Protect concurrent access.
@@ -1122,7 +1159,8 @@ func (mp *TxPool) ProcessTransaction(tx *chainutil.Tx, allowOrphan, rateLimit bo
 	defer mp.mtx.Unlock()
 
 	// Potentially accept the transaction to the memory pool.
-	missingParents, txD, err := mp.maybeAcceptTransaction(tx, true, rateLimit, true)
+	missingParents, txD, err := mp.maybeAcceptTransaction(tx, true,
+		rateLimit, limitFree, true)
 	if err != nil {
 		return nil, err
 	}
@@ -1331,7 +1369,7 @@ func (mp *TxPool) CheckMempoolAcceptance(tx *chainutil.Tx) (
 	// which has the effect that we always check the fee paid from this tx
 	// is greater than min relay fee. We also reject this tx if it's
 	// already an orphan.
-	result, err := mp.checkMempoolAcceptance(tx, true, true, true)
+	result, err := mp.checkMempoolAcceptance(tx, true, true, true, true)
 	if err != nil {
 		log.Errorf("CheckMempoolAcceptance: %v", err)
 		return nil, err
@@ -1347,7 +1385,7 @@ func (mp *TxPool) CheckMempoolAcceptance(tx *chainutil.Tx) (
 // transaction. It returns an error when the transaction fails to meet the
 // mempool policy, otherwise a `mempoolAcceptResult` is returned.
 func (mp *TxPool) checkMempoolAcceptance(tx *chainutil.Tx,
-	isNew, rateLimit, rejectDupOrphans bool) (*MempoolAcceptResult, error) {
+	isNew, rateLimit, limitFree, rejectDupOrphans bool) (*MempoolAcceptResult, error) {
 
 	txHash := tx.Hash()
 
@@ -1528,6 +1566,7 @@ func (mp *TxPool) checkMempoolAcceptance(tx *chainutil.Tx,
 	// block.
 	err = mp.validateRelayFeeMet(
 		tx, txFee, txSize, utxoView, nextBlockHeight, isNew, rateLimit,
+		limitFree,
 	)
 	if err != nil {
 		return nil, err
@@ -1689,7 +1728,7 @@ func (mp *TxPool) validateSigCost(tx *chainutil.Tx,
 // transaction.
 func (mp *TxPool) validateRelayFeeMet(tx *chainutil.Tx, txFee, txSize int64,
 	utxoView *blockchain.UtxoViewpoint, nextBlockHeight int32,
-	isNew, rateLimit bool) error {
+	isNew, rateLimit, limitFree bool) error {
 
 	txHash := tx.Hash()
 
@@ -1740,7 +1779,11 @@ func (mp *TxPool) validateRelayFeeMet(tx *chainutil.Tx, txFee, txSize int64,
 
 	// We can only end up here when the rateLimit is true. Free-to-relay
 	// transactions are rate limited here to prevent penny-flooding with
-	// tiny transactions as a form of attack.
+	// tiny transactions as a form of attack.  The callers can exempt the
+	// transactions of trusted sources with limitFree.
+	if !limitFree {
+		return nil
+	}
 	nowUnix := time.Now().Unix()
 
 	// Decay passed data with an exponentially decaying ~10 minute window -
@@ -1852,3 +1852,57 @@ func TestRBF(t *testing.T) {
 		}
 	}
 }
+
+// TestFreeTxRateLimit ensures free transactions are rate limited regardless of
+// the rate limiting of the low priority transactions, unless the caller
+// exempts them from the free transaction limit.
+func TestFreeTxRateLimit(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+
+	// Limit the free transactions to a few bytes so that the first one
+	// exhausts the limit.
+	harness.txPool.cfg.Policy.FreeTxRelayLimit = 0.001
+
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+
+	// The first free transaction is under the limit.
+	_, err = harness.txPool.ProcessTransaction(chainedTxns[0], false,
+		false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept tx: %v", err)
+	}
+
+	// The next one is rejected even without rate limiting, such as when
+	// it is submitted through the RPC server.
+	_, err = harness.txPool.ProcessTransaction(chainedTxns[1], false,
+		false, 0)
+	if err == nil {
+		t.Fatal("ProcessTransaction: accepted a free tx over the limit")
+	}
+	code, ok := extractRejectCode(err)
+	if !ok || code != wire.RejectInsufficientFee {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	if harness.txPool.IsTransactionInPool(chainedTxns[1].Hash()) {
+		t.Fatal("rejected tx is in the pool")
+	}
+
+	// The exempted callers bypass the limit.
+	_, err = harness.txPool.ProcessTransactionNoFreeLimit(chainedTxns[1],
+		false, true, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransactionNoFreeLimit: failed to accept tx: "+
+			"%v", err)
+	}
+	if !harness.txPool.IsTransactionInPool(chainedTxns[1].Hash()) {
+		t.Fatal("exempted tx is not in the pool")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package msgcapture implements the format of the files holding the messages
+// captured by lokid with --capturemessages, which the cmd/msgdump utility
+// decodes.
+//
+// A capture file holds the messages exchanged with a single peer.  Each
+// message is a record made of:
+//
+//	timestamp  int64 little endian unix time in microseconds
+//	direction  uint8 0 for received, 1 for sent messages
+//	command    [wire.CommandSize]byte NUL padded command
+//	length     uint32 little endian payload length
+//	payload    [length]byte raw wire payload
+package msgcapture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// RecordHeaderSize is the size of the header of each record: the unix time in
+// microseconds, the direction, the command and the payload length.
+const RecordHeaderSize = 8 + 1 + wire.CommandSize + 4
+
+// Record is a message captured from the exchanges with a peer.
+type Record struct {
+	// Time is when the message was received or sent.
+	Time time.Time
+
+	// Sent is whether the message was sent to the peer rather than
+	// received from it.
+	Sent bool
+
+	// Command is the command of the message header.
+	Command string
+
+	// Payload is the payload of the message as it was exchanged on the
+	// wire, which may be truncated or malformed for received messages.
+	Payload []byte
+}
+
+// RecordFromRaw returns the record of the passed raw wire message, header
+// included, received or sent at the passed time.  It returns false when the
+// bytes don't hold a whole message header.
+func RecordFromRaw(t time.Time, sent bool, raw []byte) (*Record, bool) {
+	if len(raw) < wire.MessageHeaderSize {
+		return nil, false
+	}
+
+	// The command follows the 4 bytes of the network magic.
+	command := raw[4 : 4+wire.CommandSize]
+	return &Record{
+		Time:    t,
+		Sent:    sent,
+		Command: string(bytes.TrimRight(command, "\x00")),
+		Payload: raw[wire.MessageHeaderSize:],
+	}, true
+}
+
+// WriteRecord writes the passed record to w.
+func WriteRecord(w io.Writer, rec *Record) error {
+	if len(rec.Command) > wire.CommandSize {
+		return fmt.Errorf("command %q is too long", rec.Command)
+	}
+
+	var hdr [RecordHeaderSize]byte
+	binary.LittleEndian.PutUint64(hdr[:8], uint64(rec.Time.UnixMicro()))
+	if rec.Sent {
+		hdr[8] = 1
+	}
+	copy(hdr[9:9+wire.CommandSize], rec.Command)
+	binary.LittleEndian.PutUint32(hdr[9+wire.CommandSize:],
+		uint32(len(rec.Payload)))
+
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(rec.Payload)
+	return err
+}
+
+// ReadRecord reads the next record from r.  It returns io.EOF when there are
+// no more records, and io.ErrUnexpectedEOF when the record is truncated.
+func ReadRecord(r io.Reader) (*Record, error) {
+	var hdr [RecordHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	micros := int64(binary.LittleEndian.Uint64(hdr[:8]))
+	command := hdr[9 : 9+wire.CommandSize]
+	length := binary.LittleEndian.Uint32(hdr[9+wire.CommandSize:])
+	if length > wire.MaxMessagePayload {
+		return nil, fmt.Errorf("payload of %d bytes exceeds the max "+
+			"message payload", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return &Record{
+		Time:    time.UnixMicro(micros),
+		Sent:    hdr[8] != 0,
+		Command: string(bytes.TrimRight(command, "\x00")),
+		Payload: payload,
+	}, nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package msgcapture
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// TestRecord ensures records are made from raw wire messages, and written and
+// read back unchanged.
+func TestRecord(t *testing.T) {
+	var raw bytes.Buffer
+	err := wire.WriteMessage(&raw, wire.NewMsgPing(1), wire.ProtocolVersion,
+		wire.MainNet)
+	if err != nil {
+		t.Fatalf("WriteMessage: unexpected err: %v", err)
+	}
+
+	// The bytes read before a failure may not hold a whole header.
+	short := raw.Bytes()[:wire.MessageHeaderSize-1]
+	if _, ok := RecordFromRaw(time.Now(), false, short); ok {
+		t.Fatal("RecordFromRaw: got a record without a whole header")
+	}
+
+	when := time.UnixMicro(time.Now().UnixMicro())
+	rec, ok := RecordFromRaw(when, true, raw.Bytes())
+	if !ok {
+		t.Fatal("RecordFromRaw: no record")
+	}
+	want := &Record{
+		Time:    when,
+		Sent:    true,
+		Command: wire.CmdPing,
+		Payload: raw.Bytes()[wire.MessageHeaderSize:],
+	}
+	if !reflect.DeepEqual(rec, want) {
+		t.Fatalf("RecordFromRaw: got %+v, want %+v", rec, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteRecord(&buf, rec); err != nil {
+		t.Fatalf("WriteRecord: unexpected err: %v", err)
+	}
+	if buf.Len() != RecordHeaderSize+len(rec.Payload) {
+		t.Fatalf("WriteRecord: wrote %d bytes, want %d", buf.Len(),
+			RecordHeaderSize+len(rec.Payload))
+	}
+	encoded := buf.Bytes()
+
+	got, err := ReadRecord(&buf)
+	if err != nil {
+		t.Fatalf("ReadRecord: unexpected err: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReadRecord: got %+v, want %+v", got, want)
+	}
+	if _, err := ReadRecord(&buf); err != io.EOF {
+		t.Fatalf("ReadRecord: got err %v at the end, want EOF", err)
+	}
+
+	// Truncated records are reported.
+	for _, n := range []int{RecordHeaderSize - 1, len(encoded) - 1} {
+		_, err := ReadRecord(bytes.NewReader(encoded[:n]))
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("ReadRecord: got err %v for %d bytes, want %v",
+				err, n, io.ErrUnexpectedEOF)
+		}
+	}
+}
@@ -48,6 +48,19 @@ type AddrManager struct {
 	lamtx          sync.Mutex
 	localAddresses map[string]*localAddress
 	version        int
+
+	// cjdnsReachable is set when addresses in fc00::/8 are reachable
+	// through CJDNS.  It is only changed before the address manager is
+	// started.
+	cjdnsReachable bool
+
+	// reachable holds the networks addresses are selected from.  It is
+	// only changed before the address manager is started.
+	reachable [numNetworks]bool
+
+	// nNewByNet and nTriedByNet break nNew and nTried down by network.
+	nNewByNet   [numNetworks]int
+	nTriedByNet [numNetworks]int
 }
 
 type serializedKnownAddress struct {
@@ -165,6 +178,9 @@ const (
 // updateAddress is a helper function to either update an address already known
 // to the address manager, or to add the address if not already known.
 func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddressV2) {
+	netAddr = a.classifyAddress(netAddr)
+	srcAddr = a.classifyAddress(srcAddr)
+
 	// Filter out non-routable addresses. Note that non-routable
 	// also includes invalid and local addresses.
 	if !IsRoutable(netAddr) {
@@ -215,6 +231,7 @@ func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddressV2) {
 		ka = &KnownAddress{na: &netAddrCopy, srcAddr: srcAddr}
 		a.addrIndex[addr] = ka
 		a.nNew++
+		a.nNewByNet[NetworkOf(netAddr)]++
 		// XXX time penalty?
 	}
 
@@ -255,6 +272,7 @@ func (a *AddrManager) expireNew(bucket int) {
 			v.refs--
 			if v.refs == 0 {
 				a.nNew--
+				a.nNewByNet[NetworkOf(v.na)]--
 				delete(a.addrIndex, k)
 			}
 			continue
@@ -274,6 +292,7 @@ func (a *AddrManager) expireNew(bucket int) {
 		oldest.refs--
 		if oldest.refs == 0 {
 			a.nNew--
+			a.nNewByNet[NetworkOf(oldest.na)]--
 			delete(a.addrIndex, key)
 		}
 	}
@@ -513,6 +532,7 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 
 			if ka.refs == 0 {
 				a.nNew++
+				a.nNewByNet[NetworkOf(ka.na)]++
 			}
 			ka.refs++
 			a.addrNew[i][val] = ka
@@ -528,6 +548,7 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 
 			ka.tried = true
 			a.nTried++
+			a.nTriedByNet[NetworkOf(ka.na)]++
 			a.addrTried[i].PushBack(ka)
 		}
 	}
@@ -667,6 +688,15 @@ func (a *AddrManager) NeedMoreAddresses() bool {
 func (a *AddrManager) AddressCache() []*wire.NetAddressV2 {
 	allAddr := a.getAddresses()
 
+	// Only share addresses in networks we are willing to connect to.
+	reachable := allAddr[:0]
+	for _, na := range allAddr {
+		if a.IsReachable(na) {
+			reachable = append(reachable, na)
+		}
+	}
+	allAddr = reachable
+
 	numAddresses := len(allAddr) * getAddrPercent / 100
 	if numAddresses > getAddrMax {
 		numAddresses = getAddrMax
@@ -708,6 +738,10 @@ func (a *AddrManager) getAddresses() []*wire.NetAddressV2 {
 func (a *AddrManager) reset() {
 
 	a.addrIndex = make(map[string]*KnownAddress)
+	a.nNew = 0
+	a.nTried = 0
+	a.nNewByNet = [numNetworks]int{}
+	a.nTriedByNet = [numNetworks]int{}
 
 	// fill key with bytes from a good random source.
 	io.ReadFull(crand.Reader, a.key[:])
@@ -719,8 +753,62 @@ func (a *AddrManager) reset() {
 	}
 }
 
+// SetCJDNSReachable sets whether IPv6 addresses in fc00::/8 are reachable
+// through CJDNS.  Such addresses are classified as CJDNS addresses, which are
+// routable, instead of private IPv6 addresses.  It must be called before the
+// address manager is started.
+func (a *AddrManager) SetCJDNSReachable(reachable bool) {
+	a.cjdnsReachable = reachable
+}
+
+// CJDNSReachable returns whether IPv6 addresses in fc00::/8 are reachable
+// through CJDNS.
+func (a *AddrManager) CJDNSReachable() bool {
+	return a.cjdnsReachable
+}
+
+// SetReachableNetworks restricts the networks addresses are selected from,
+// shared with peers and advertised as local addresses to the passed networks.
+// All networks are reachable by default.  It must be called before the address
+// manager is started.
+func (a *AddrManager) SetReachableNetworks(nets []Network) {
+	a.reachable = [numNetworks]bool{}
+	for _, n := range nets {
+		if n != NetworkUnroutable && n < numNetworks {
+			a.reachable[n] = true
+		}
+	}
+}
+
+// IsReachable returns whether the passed address is in a reachable network.
+func (a *AddrManager) IsReachable(na *wire.NetAddressV2) bool {
+	return a.reachable[NetworkOf(na)]
+}
+
+// NetworkAddressCount returns the number of addresses known in the passed
+// network.
+func (a *AddrManager) NetworkAddressCount(n Network) int {
+	if n >= numNetworks {
+		return 0
+	}
+
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+
+	return a.nNewByNet[n] + a.nTriedByNet[n]
+}
+
+// classifyAddress returns the passed address as a CJDNS address when it is in
+// the CJDNS range and CJDNS is reachable.
+func (a *AddrManager) classifyAddress(na *wire.NetAddressV2) *wire.NetAddressV2 {
+	if !a.cjdnsReachable || na == nil {
+		return na
+	}
+	return ToCJDNS(na)
+}
+
 // HostToNetAddress returns a netaddress given a host address.  If the address
-// is a Tor .onion address this will be taken care of.  Else if the host is
+// is a Tor .onion or an I2P .b32.i2p address this will be taken care of.  Else if the host is
 // not an IP address it will be resolved (via Tor if required).
 func (a *AddrManager) HostToNetAddress(host string, port uint16,
 	services wire.ServiceFlag) (*wire.NetAddressV2, error) {
@@ -759,6 +847,18 @@ func (a *AddrManager) HostToNetAddress(host string, port uint16,
 		na = wire.NetAddressV2FromBytes(
 			time.Now(), services, data[:wire.TorV3Size], port,
 		)
+	} else if len(host) == wire.I2PEncodedSize && host[wire.I2PEncodedSize-8:] == ".b32.i2p" {
+		// I2P addresses are the unpadded base32 encoding of the
+		// destination hash with the 8 byte .b32.i2p suffix.
+		data, err := base32.StdEncoding.WithPadding(base32.NoPadding).
+			DecodeString(strings.ToUpper(host[:wire.I2PEncodedSize-8]))
+		if err != nil {
+			return nil, err
+		}
+
+		var hash [wire.I2PSize]byte
+		copy(hash[:], data)
+		na = wire.NetAddressV2FromI2P(time.Now(), services, hash, port)
 	} else if ip = net.ParseIP(host); ip == nil {
 		ips, err := a.lookupFunc(host)
 		if err != nil {
@@ -776,11 +876,12 @@ func (a *AddrManager) HostToNetAddress(host string, port uint16,
 		na = wire.NetAddressV2FromBytes(time.Now(), services, ip, port)
 	}
 
-	return na, nil
+	return a.classifyAddress(na), nil
 }
 
 // NetAddressKey returns a string key in the form of ip:port for IPv4 addresses
-// or [ip]:port for IPv6 addresses. It also handles onion v2 and v3 addresses.
+// or [ip]:port for IPv6 addresses. It also handles onion v2 and v3 and i2p
+// addresses.
 func NetAddressKey(na *wire.NetAddressV2) string {
 	port := strconv.FormatUint(uint64(na.Port), 10)
 
@@ -792,16 +893,41 @@ func NetAddressKey(na *wire.NetAddressV2) string {
 // have not been used recently and should not pick 'close' addresses
 // consecutively.
 func (a *AddrManager) GetAddress() *KnownAddress {
+	return a.GetAddressFromNetworks(nil)
+}
+
+// GetAddressFromNetworks returns a single address that should be routable in
+// one of the passed networks, or in any reachable network when nets is empty.
+// Networks that are not reachable are never selected.  It returns nil when
+// no such address is known.
+func (a *AddrManager) GetAddressFromNetworks(nets []Network) *KnownAddress {
+	allowed := a.reachable
+	if len(nets) > 0 {
+		allowed = [numNetworks]bool{}
+		for _, n := range nets {
+			if n < numNetworks && a.reachable[n] {
+				allowed[n] = true
+			}
+		}
+	}
+
 	// Protect concurrent access.
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
-	if a.numAddresses() == 0 {
+	var nNew, nTried int
+	for n := Network(0); n < numNetworks; n++ {
+		if allowed[n] {
+			nNew += a.nNewByNet[n]
+			nTried += a.nTriedByNet[n]
+		}
+	}
+	if nNew+nTried == 0 {
 		return nil
 	}
 
 	// Use a 50% chance for choosing between tried and new table entries.
-	if a.nTried > 0 && (a.nNew == 0 || a.rand.Intn(2) == 0) {
+	if nTried > 0 && (nNew == 0 || a.rand.Intn(2) == 0) {
 		// Tried entry.
 		large := 1 << 30
 		factor := 1.0
@@ -819,6 +945,9 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 				e = e.Next()
 			}
 			ka := e.Value.(*KnownAddress)
+			if !allowed[NetworkOf(ka.na)] {
+				continue
+			}
 			randval := a.rand.Intn(large)
 			if float64(randval) < (factor * ka.chance() * float64(large)) {
 				log.Tracef("Selected %v from tried bucket",
@@ -847,6 +976,9 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 				}
 				nth--
 			}
+			if !allowed[NetworkOf(ka.na)] {
+				continue
+			}
 			randval := a.rand.Intn(large)
 			if float64(randval) < (factor * ka.chance() * float64(large)) {
 				log.Tracef("Selected %v from new bucket",
@@ -950,6 +1082,7 @@ func (a *AddrManager) Good(addr *wire.NetAddressV2) {
 		}
 	}
 	a.nNew--
+	a.nNewByNet[NetworkOf(ka.na)]--
 
 	if oldBucket == -1 {
 		// What? wasn't in a bucket after all.... Panic?
@@ -963,6 +1096,7 @@ func (a *AddrManager) Good(addr *wire.NetAddressV2) {
 		ka.tried = true
 		a.addrTried[bucket].PushBack(ka)
 		a.nTried++
+		a.nTriedByNet[NetworkOf(ka.na)]++
 		return
 	}
 
@@ -988,8 +1122,12 @@ func (a *AddrManager) Good(addr *wire.NetAddressV2) {
 
 	// We don't touch a.nTried here since the number of tried stays the same
 	// but we decemented new above, raise it again since we're putting
-	// something back.
+	// something back.  The counts by network do change when the two
+	// addresses are on different networks.
 	a.nNew++
+	a.nNewByNet[NetworkOf(rmka.na)]++
+	a.nTriedByNet[NetworkOf(rmka.na)]--
+	a.nTriedByNet[NetworkOf(ka.na)]++
 
 	rmkey := NetAddressKey(rmka.na)
 	log.Tracef("Replacing %s with %s in tried", rmkey, addrKey)
@@ -1022,11 +1160,16 @@ func (a *AddrManager) SetServices(addr *wire.NetAddressV2, services wire.Service
 // AddLocalAddress adds na to the list of known local addresses to advertise
 // with the given priority.
 func (a *AddrManager) AddLocalAddress(na *wire.NetAddressV2, priority AddressPriority) error {
+	na = a.classifyAddress(na)
 	if !IsRoutable(na) {
 		return fmt.Errorf(
 			"address %s is not routable", na.Addr.String(),
 		)
 	}
+	if !a.IsReachable(na) {
+		return fmt.Errorf("address %s is in unreachable network %v",
+			na.Addr.String(), NetworkOf(na))
+	}
 
 	a.lamtx.Lock()
 	defer a.lamtx.Unlock()
@@ -1063,10 +1206,28 @@ func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddressV2) int {
 		return Unreachable
 	}
 
+	// I2P and CJDNS peers can only reach addresses on the same network
+	// for certain.
+	if remoteAddr.IsI2P() {
+		if localAddr.IsI2P() {
+			return Private
+		}
+		return Default
+	}
+	if remoteAddr.IsCJDNS() {
+		if localAddr.IsCJDNS() {
+			return Private
+		}
+		return Default
+	}
+
 	if remoteAddr.IsTorV3() {
 		if localAddr.IsTorV3() {
 			return Private
 		}
+		if localAddr.IsI2P() || localAddr.IsCJDNS() {
+			return Default
+		}
 
 		lna := localAddr.ToLegacy()
 		if IsOnionCatTor(lna) {
@@ -1084,7 +1245,7 @@ func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddressV2) int {
 
 	// We can't be sure if the remote party can actually connect to this
 	// address or not.
-	if localAddr.IsTorV3() {
+	if localAddr.IsTorV3() || localAddr.IsI2P() || localAddr.IsCJDNS() {
 		return Default
 	}
 
@@ -1183,8 +1344,10 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *wire.NetAddressV2) *wire.N
 
 		// Send something unroutable if nothing suitable.
 		var ip net.IP
-		if remoteAddr.IsTorV3() {
+		if remoteAddr.IsTorV3() || remoteAddr.IsI2P() {
 			ip = net.IPv4zero
+		} else if remoteAddr.IsCJDNS() {
+			ip = net.IPv6zero
 		} else {
 			remoteLna := remoteAddr.ToLegacy()
 			if !IsIPv4(remoteLna) && !IsOnionCatTor(remoteLna) {
@@ -1213,6 +1376,9 @@ func New(dataDir string, lookupFunc func(string) ([]net.IP, error)) *AddrManager
 		localAddresses: make(map[string]*localAddress),
 		version:        serialisationVersion,
 	}
+	for n := NetworkIPv4; n < numNetworks; n++ {
+		am.reachable[n] = true
+	}
 	am.reset()
 	return &am
 }
@@ -370,6 +370,61 @@ func TestGetAddress(t *testing.T) {
 	}
 }
 
+// TestGetAddressFromNetworks ensures address selection, sharing and local
+// addresses are restricted to the reachable networks.
+func TestGetAddressFromNetworks(t *testing.T) {
+	n := netaddr.New("testgetaddressfromnetworks", lookupFunc)
+	n.SetReachableNetworks([]netaddr.Network{
+		netaddr.NetworkIPv4, netaddr.NetworkOnion,
+	})
+
+	for _, addr := range []string{someIP + ":15212", "[2001:470::1]:15212"} {
+		if err := n.AddAddressByIP(addr); err != nil {
+			t.Fatalf("Adding address failed: %v", err)
+		}
+	}
+	if got := n.NetworkAddressCount(netaddr.NetworkIPv6); got != 1 {
+		t.Fatalf("Wrong number of ipv6 addresses: got %d, want 1", got)
+	}
+
+	for i := 0; i < 20; i++ {
+		ka := n.GetAddress()
+		if ka == nil || ka.NetAddress().Addr.String() != someIP {
+			t.Fatalf("Wrong address selected: got %v, want %v", ka, someIP)
+		}
+	}
+	if ka := n.GetAddressFromNetworks([]netaddr.Network{netaddr.NetworkOnion}); ka != nil {
+		t.Fatalf("Got address %v from a network without addresses", ka)
+	}
+	if ka := n.GetAddressFromNetworks([]netaddr.Network{netaddr.NetworkIPv6}); ka != nil {
+		t.Fatalf("Got address %v from an unreachable network", ka)
+	}
+
+	// Moving the address to the tried table keeps it selectable.
+	ka := n.GetAddress()
+	n.Good(ka.NetAddress())
+	if got := n.NetworkAddressCount(netaddr.NetworkIPv4); got != 1 {
+		t.Fatalf("Wrong number of ipv4 addresses: got %d, want 1", got)
+	}
+	ka = n.GetAddressFromNetworks([]netaddr.Network{netaddr.NetworkIPv4})
+	if ka == nil || ka.NetAddress().Addr.String() != someIP {
+		t.Fatalf("Wrong address selected: got %v, want %v", ka, someIP)
+	}
+
+	for _, na := range n.AddressCache() {
+		if !n.IsReachable(na) {
+			t.Fatalf("Unreachable address %v shared", na)
+		}
+	}
+
+	local := wire.NetAddressV2FromBytes(
+		time.Now(), 0, net.ParseIP("2001:470::2"), 15212,
+	)
+	if err := n.AddLocalAddress(local, netaddr.ManualPrio); err == nil {
+		t.Fatalf("Added local address in an unreachable network")
+	}
+}
+
 func TestGetBestLocalAddress(t *testing.T) {
 	localAddrs := []wire.NetAddressV2{
 		*wire.NetAddressV2FromBytes(
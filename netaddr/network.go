@@ -85,6 +85,11 @@ var (
 	// { magic 6 bytes, 10 bytes base32 decode of key hash }
 	onionCatNet = ipNet("fd87:d87e:eb43::", 48, 128)
 
+	// cjdnsNet defines the IPv6 address block used by CJDNS (FC00::/8).
+	// It is part of the RFC4193 unique local IPv6 range, so addresses in
+	// it are only treated as CJDNS when CJDNS is reachable.
+	cjdnsNet = ipNet("FC00::", 8, 128)
+
 	// zero4Net defines the IPv4 address block for address staring with 0
 	// (0.0.0.0/8).
 	zero4Net = ipNet("0.0.0.0", 8, 32)
@@ -93,6 +98,86 @@ var (
 	heNet = ipNet("2001:470::", 32, 128)
 )
 
+// Network identifies the network an address belongs to.  It is used to restrict
+// automatic outbound connections to some networks and to spread outbound
+// connections across networks.
+type Network uint8
+
+const (
+	// NetworkUnroutable is the network of addresses that are not routable.
+	NetworkUnroutable Network = iota
+
+	// NetworkIPv4 is the IPv4 network.
+	NetworkIPv4
+
+	// NetworkIPv6 is the IPv6 network.
+	NetworkIPv6
+
+	// NetworkOnion is the Tor network.
+	NetworkOnion
+
+	// NetworkI2P is the I2P network.
+	NetworkI2P
+
+	// NetworkCJDNS is the CJDNS network.
+	NetworkCJDNS
+
+	// numNetworks is the number of networks.  It must be the last entry.
+	numNetworks
+)
+
+// networkNames maps networks to the names used to configure them.
+var networkNames = map[Network]string{
+	NetworkUnroutable: "unroutable",
+	NetworkIPv4:       "ipv4",
+	NetworkIPv6:       "ipv6",
+	NetworkOnion:      "onion",
+	NetworkI2P:        "i2p",
+	NetworkCJDNS:      "cjdns",
+}
+
+// String returns the name of the network.
+func (n Network) String() string {
+	if name, ok := networkNames[n]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown Network (%d)", uint8(n))
+}
+
+// ParseNetwork returns the network with the passed name.  The unroutable
+// network cannot be parsed.
+func ParseNetwork(name string) (Network, error) {
+	for n, networkName := range networkNames {
+		if n != NetworkUnroutable && name == networkName {
+			return n, nil
+		}
+	}
+	return NetworkUnroutable, fmt.Errorf("unknown network %q", name)
+}
+
+// NetworkOf returns the network the passed address belongs to.
+func NetworkOf(na *wire.NetAddressV2) Network {
+	switch {
+	case !IsRoutable(na):
+		return NetworkUnroutable
+	case na.IsTorV3():
+		return NetworkOnion
+	case na.IsI2P():
+		return NetworkI2P
+	case na.IsCJDNS():
+		return NetworkCJDNS
+	}
+
+	lna := na.ToLegacy()
+	switch {
+	case IsOnionCatTor(lna):
+		return NetworkOnion
+	case IsIPv4(lna):
+		return NetworkIPv4
+	}
+	return NetworkIPv6
+}
+
 // ipNet returns a net.IPNet struct given the passed IP address string, number
 // of one bits to include at the start of the mask, and the total number of bits
 // for the mask.
@@ -118,6 +203,23 @@ func IsOnionCatTor(na *wire.NetAddress) bool {
 	return onionCatNet.Contains(na.IP)
 }
 
+// IsCJDNSRange returns whether or not the passed address is part of the IPv6
+// range used by CJDNS (fc00::/8).
+func IsCJDNSRange(na *wire.NetAddress) bool {
+	return cjdnsNet.Contains(na.IP)
+}
+
+// ToCJDNS returns the passed address as a CJDNS address when it is an IPv6
+// address in the range used by CJDNS.  Other addresses are returned unchanged.
+func ToCJDNS(na *wire.NetAddressV2) *wire.NetAddressV2 {
+	lna := na.ToLegacy()
+	if lna == nil || !IsCJDNSRange(lna) || IsOnionCatTor(lna) {
+		return na
+	}
+	return wire.NetAddressV2FromCJDNS(na.Timestamp, na.Services, lna.IP,
+		na.Port)
+}
+
 // IsRFC1918 returns whether or not the passed address is part of the IPv4
 // private network address space as defined by RFC1918 (10.0.0.0/8,
 // 172.16.0.0/12, or 192.168.0.0/16).
@@ -224,13 +326,12 @@ func IsValid(na *wire.NetAddress) bool {
 // the public internet.  This is true as long as the address is valid and is not
 // in any reserved ranges.
 func IsRoutable(na *wire.NetAddressV2) bool {
-	if na.IsTorV3() {
-		// na is a torv3 address, return true.
+	if na.IsTorV3() || na.IsI2P() || na.IsCJDNS() {
+		// na is a torv3, i2p or cjdns address, return true.
 		return true
 	}
 
-	// Else na can be represented as a legacy NetAddress since i2p and
-	// cjdns are unsupported.
+	// Else na can be represented as a legacy NetAddress.
 	lna := na.ToLegacy()
 	return IsValid(lna) && !(IsRFC1918(lna) || IsRFC2544(lna) ||
 		IsRFC3927(lna) || IsRFC4862(lna) || IsRFC3849(lna) ||
@@ -242,14 +343,24 @@ func IsRoutable(na *wire.NetAddressV2) bool {
 // GroupKey returns a string representing the network group an address is part
 // of.  This is the /16 for IPv4, the /32 (/36 for he.net) for IPv6, the string
 // "local" for a local address, the string "tor:key" where key is the /4 of the
-// onion address for Tor address, and the string "unroutable" for an unroutable
-// address.
+// onion address for Tor address, the string "i2p:key" where key is the /4 of
+// the destination hash for I2P addresses, the string "cjdns:key" where key is
+// the /4 following the constant fc prefix for CJDNS addresses, and the string
+// "unroutable" for an unroutable address.
 func GroupKey(na *wire.NetAddressV2) string {
 	if na.IsTorV3() {
 		// na is a torv3 address. Use the same network group keying as
 		// for torv2.
 		return fmt.Sprintf("tor:%d", na.TorV3Key()&((1<<4)-1))
 	}
+	if na.IsI2P() {
+		return fmt.Sprintf("i2p:%d", na.I2PKey()&((1<<4)-1))
+	}
+	if na.IsCJDNS() {
+		// The first byte of a cjdns address is always 0xfc, so the
+		// group is keyed off the following 4 bits.
+		return fmt.Sprintf("cjdns:%d", na.CJDNSKey()>>4)
+	}
 
 	lna := na.ToLegacy()
 
@@ -207,3 +207,123 @@ func TestGroupKey(t *testing.T) {
 		}
 	}
 }
+
+// TestI2PAddress ensures i2p addresses are parsed, keyed and considered
+// routable.
+func TestI2PAddress(t *testing.T) {
+	const host = "aaaqeayeaudaocajbifqydiob4ibceqtcqkrmfyydenbwha5dypq.b32.i2p"
+
+	amgr := netaddr.New(t.TempDir(), nil)
+	na, err := amgr.HostToNetAddress(host, 0, wire.SFNodeNetwork)
+	if err != nil {
+		t.Fatalf("HostToNetAddress: %v", err)
+	}
+	if !na.IsI2P() {
+		t.Fatalf("%s is not an i2p address", host)
+	}
+	if key := netaddr.NetAddressKey(na); key != host+":0" {
+		t.Fatalf("unexpected address key %s", key)
+	}
+	if !netaddr.IsRoutable(na) {
+		t.Fatalf("%s is not routable", host)
+	}
+	if key := netaddr.GroupKey(na); key != "i2p:0" {
+		t.Fatalf("unexpected group key %s", key)
+	}
+}
+
+// TestCJDNSAddress ensures addresses in fc00::/8 are only classified as
+// routable CJDNS addresses when CJDNS is reachable.
+func TestCJDNSAddress(t *testing.T) {
+	const host = "fc32:17ea:e415:c3bf:9808:149d:b5a2:c9aa"
+
+	for _, reachable := range []bool{false, true} {
+		amgr := netaddr.New(t.TempDir(), nil)
+		amgr.SetCJDNSReachable(reachable)
+
+		na, err := amgr.HostToNetAddress(host, 15212, wire.SFNodeNetwork)
+		if err != nil {
+			t.Fatalf("HostToNetAddress: %v", err)
+		}
+		if na.IsCJDNS() != reachable {
+			t.Fatalf("reachable %v: got cjdns %v", reachable,
+				na.IsCJDNS())
+		}
+		if netaddr.IsRoutable(na) != reachable {
+			t.Fatalf("reachable %v: got routable %v", reachable,
+				netaddr.IsRoutable(na))
+		}
+		if key := netaddr.NetAddressKey(na); key != "["+host+"]:15212" {
+			t.Fatalf("unexpected address key %s", key)
+		}
+
+		wantGroup := "unroutable"
+		if reachable {
+			wantGroup = "cjdns:3"
+		}
+		if key := netaddr.GroupKey(na); key != wantGroup {
+			t.Fatalf("reachable %v: got group key %s, want %s",
+				reachable, key, wantGroup)
+		}
+
+		// Addresses relayed as plain IPv6 are classified when added.
+		ipv6 := wire.NetAddressV2FromBytes(time.Now(),
+			wire.SFNodeNetwork, net.ParseIP(host), 15212)
+		src := wire.NetAddressV2FromBytes(time.Now(),
+			wire.SFNodeNetwork, net.ParseIP("12.1.2.3"), 15212)
+		amgr.AddAddress(ipv6, src)
+		wantNum := 0
+		if reachable {
+			wantNum = 1
+		}
+		if amgr.NumAddresses() != wantNum {
+			t.Fatalf("reachable %v: got %d addresses, want %d",
+				reachable, amgr.NumAddresses(), wantNum)
+		}
+	}
+}
+
+// TestNetworkOf ensures addresses are assigned to the expected network and
+// network names round trip.
+func TestNetworkOf(t *testing.T) {
+	amgr := netaddr.New(t.TempDir(), nil)
+	amgr.SetCJDNSReachable(true)
+
+	tests := []struct {
+		host string
+		want netaddr.Network
+	}{
+		{"12.1.2.3", netaddr.NetworkIPv4},
+		{"2001:470::1", netaddr.NetworkIPv6},
+		{"fd87:d87e:eb43:1234::5678", netaddr.NetworkOnion},
+		{"vww6ybal4bd7szmgncyruucpgfkqahzddi37ktceo3ah7ngmcopnpyyd.onion",
+			netaddr.NetworkOnion},
+		{"aaaqeayeaudaocajbifqydiob4ibceqtcqkrmfyydenbwha5dypq.b32.i2p",
+			netaddr.NetworkI2P},
+		{"fc32:17ea:e415:c3bf:9808:149d:b5a2:c9aa", netaddr.NetworkCJDNS},
+		{"192.168.0.1", netaddr.NetworkUnroutable},
+	}
+	for _, test := range tests {
+		na, err := amgr.HostToNetAddress(test.host, 15212, wire.SFNodeNetwork)
+		if err != nil {
+			t.Fatalf("%s: HostToNetAddress: %v", test.host, err)
+		}
+		if got := netaddr.NetworkOf(na); got != test.want {
+			t.Errorf("%s: got network %v, want %v", test.host, got,
+				test.want)
+		}
+		if test.want == netaddr.NetworkUnroutable {
+			continue
+		}
+		n, err := netaddr.ParseNetwork(test.want.String())
+		if err != nil || n != test.want {
+			t.Errorf("ParseNetwork(%q): got %v, %v", test.want, n, err)
+		}
+	}
+
+	for _, name := range []string{"unroutable", "tor", ""} {
+		if _, err := netaddr.ParseNetwork(name); err == nil {
+			t.Errorf("ParseNetwork(%q): expected error", name)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/blockchain"
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	peerpkg "github.com/flokiorg/go-flokicoin/peer"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// backgroundSyncMsg is a message type to be sent across the message channel
+// for starting the sync of the background chain that validates the blocks up
+// to the base of the UTXO set snapshot the chain was loaded from.
+type backgroundSyncMsg struct {
+	chain *blockchain.BlockChain
+	done  func(error)
+}
+
+// backgroundSync holds the state of the sync of the background chain.  Its
+// blocks are downloaded alongside the blocks of the chain, from the block after
+// its tip up to the snapshot base, and are held in pendingBlocks until the
+// blocks before them are processed.
+type backgroundSync struct {
+	chain          *blockchain.BlockChain
+	done           func(error)
+	baseHeight     int32
+	nextHeight     int32
+	blocksInFlight map[chainhash.Hash]*blockInFlight
+	pendingBlocks  map[chainhash.Hash]*blockMsg
+	progressLogger *blockProgressLogger
+}
+
+// handleBackgroundSyncMsg starts the sync of the passed background chain up to
+// the base of the UTXO set snapshot the chain was loaded from.  The tip of the
+// chain moved to the snapshot base when it was loaded, so the sync of the
+// chain is started again from it.
+func (sm *SyncManager) handleBackgroundSyncMsg(msg backgroundSyncMsg) {
+	snapshot := sm.chain.SnapshotInfo()
+	if snapshot == nil {
+		log.Warnf("Not starting the background sync: the chain was " +
+			"not loaded from a UTXO snapshot")
+		return
+	}
+
+	bgBest := msg.chain.BestSnapshot()
+	sm.bgSync = &backgroundSync{
+		chain:          msg.chain,
+		done:           msg.done,
+		baseHeight:     snapshot.BaseHeight,
+		nextHeight:     bgBest.Height + 1,
+		blocksInFlight: make(map[chainhash.Hash]*blockInFlight),
+		pendingBlocks:  make(map[chainhash.Hash]*blockMsg),
+		progressLogger: newBlockProgressLogger("Validated in the "+
+			"background", log),
+	}
+	log.Infof("Validating the blocks from height %d up to the UTXO "+
+		"snapshot base at height %d in the background",
+		sm.bgSync.nextHeight, snapshot.BaseHeight)
+
+	if sm.headersFirstMode {
+		sm.resetHeaderState()
+	}
+	sm.syncPeer = nil
+	sm.startSync()
+
+	if sm.bgSync.nextHeight > sm.bgSync.baseHeight {
+		sm.finishBackgroundSync()
+		return
+	}
+	sm.fetchBackgroundBlocks()
+}
+
+// fetchBackgroundBlocks requests the blocks of the background chain in the
+// download window that are neither requested nor received yet, from the same
+// peers as the blocks of the header list.
+func (sm *SyncManager) fetchBackgroundBlocks() {
+	bg := sm.bgSync
+	if bg == nil {
+		return
+	}
+	peers := sm.blockDownloadPeers()
+	if len(peers) == 0 {
+		return
+	}
+
+	// Count the blocks in flight of each peer, since they are tracked
+	// apart from the blocks of the header list.
+	inFlight := make(map[*peerpkg.Peer]int)
+	for _, block := range bg.blocksInFlight {
+		inFlight[block.peer]++
+	}
+
+	windowEnd := bg.nextHeight + blockDownloadWindow
+	if windowEnd > bg.baseHeight+1 {
+		windowEnd = bg.baseHeight + 1
+	}
+	requests := make(map[*peerpkg.Peer]*wire.MsgGetData)
+	now := time.Now()
+	for height := bg.nextHeight; height < windowEnd; height++ {
+		hash, err := sm.chain.BlockHashByHeight(height)
+		if err != nil {
+			log.Warnf("Unable to find the block at height %d to "+
+				"validate in the background: %v", height, err)
+			return
+		}
+		if _, exists := bg.blocksInFlight[*hash]; exists {
+			continue
+		}
+		if _, exists := bg.pendingBlocks[*hash]; exists {
+			continue
+		}
+
+		var peer *peerpkg.Peer
+		for _, p := range peers {
+			if inFlight[p] >= maxBlocksInFlightPerPeer ||
+				p.LastBlock() < height {
+
+				continue
+			}
+			if peer == nil || inFlight[p] < inFlight[peer] {
+				peer = p
+			}
+		}
+		if peer == nil {
+			break
+		}
+		inFlight[peer]++
+
+		state := sm.peerStates[peer]
+		sm.requestedBlocks[*hash] = struct{}{}
+		state.requestedBlocks[*hash] = struct{}{}
+		bg.blocksInFlight[*hash] = &blockInFlight{
+			peer:      peer,
+			height:    height,
+			requested: now,
+		}
+
+		iv := wire.NewInvVect(wire.InvTypeBlock, hash)
+		if peer.IsWitnessEnabled() {
+			iv.Type = wire.InvTypeWitnessBlock
+		}
+		gdmsg, exists := requests[peer]
+		if !exists {
+			gdmsg = wire.NewMsgGetDataSizeHint(maxBlocksInFlightPerPeer)
+			requests[peer] = gdmsg
+		}
+		gdmsg.AddInvVect(iv)
+	}
+	for peer, gdmsg := range requests {
+		peer.QueueMessage(gdmsg, nil)
+	}
+}
+
+// queueBackgroundBlock holds the passed block until the blocks before it are
+// processed when it is one of the blocks of the background chain.  It returns
+// false when it is not, in which case the block is handled as usual.
+func (sm *SyncManager) queueBackgroundBlock(bmsg *blockMsg) bool {
+	bg := sm.bgSync
+	if bg == nil {
+		return false
+	}
+	blockHash := bmsg.block.Hash()
+	if _, exists := bg.pendingBlocks[*blockHash]; exists {
+		return true
+	}
+	if _, exists := bg.blocksInFlight[*blockHash]; !exists {
+		return false
+	}
+	delete(bg.blocksInFlight, *blockHash)
+	bg.pendingBlocks[*blockHash] = bmsg
+	return true
+}
+
+// processBackgroundBlocks processes the received blocks of the background
+// chain in height order until one of them is missing, and validates the UTXO
+// set snapshot once the background chain reaches its base.
+func (sm *SyncManager) processBackgroundBlocks() {
+	bg := sm.bgSync
+	var fastAddHeight int32
+	if checkpoint := bg.chain.LatestCheckpoint(); checkpoint != nil {
+		fastAddHeight = checkpoint.Height
+	}
+
+	for bg.nextHeight <= bg.baseHeight {
+		hash, err := sm.chain.BlockHashByHeight(bg.nextHeight)
+		if err != nil {
+			log.Warnf("Unable to find the block at height %d to "+
+				"validate in the background: %v", bg.nextHeight,
+				err)
+			return
+		}
+		bmsg, exists := bg.pendingBlocks[*hash]
+		if !exists {
+			return
+		}
+		delete(bg.pendingBlocks, *hash)
+
+		behaviorFlags := blockchain.BFNone
+		if bg.nextHeight <= fastAddHeight {
+			behaviorFlags = blockchain.BFFastAdd
+		}
+		_, _, err = bg.chain.ProcessBlock(bmsg.block, behaviorFlags)
+		if err != nil {
+			// The block is requested again from another peer
+			// when it was rejected, since it matches a header of
+			// the chain.
+			if _, ok := err.(blockchain.RuleError); ok {
+				log.Warnf("Block %v from %s rejected by the "+
+					"background chain -- disconnecting: %v",
+					hash, bmsg.peer, err)
+				bmsg.peer.Disconnect()
+				return
+			}
+			log.Errorf("Failed to process block %v in the "+
+				"background: %v", hash, err)
+			done := bg.done
+			sm.bgSync = nil
+			done(err)
+			return
+		}
+		bg.progressLogger.LogBlockHeight(bmsg.block, bg.chain)
+		bg.nextHeight++
+	}
+	sm.finishBackgroundSync()
+}
+
+// finishBackgroundSync validates the UTXO set snapshot against the UTXO set of
+// the background chain once it reaches the snapshot base.  The UTXO set is
+// hashed in its own goroutine, which then calls the done function of the
+// background sync.
+func (sm *SyncManager) finishBackgroundSync() {
+	bg := sm.bgSync
+	sm.bgSync = nil
+	log.Infof("Processed the blocks up to the UTXO snapshot base at "+
+		"height %d in the background -- validating the snapshot",
+		bg.baseHeight)
+
+	go func() {
+		bg.done(sm.chain.ValidateUtxoSnapshot(bg.chain))
+	}()
+}
+
+// clearBackgroundBlocks forgets about the blocks of the background chain that
+// were requested from the passed peer so they are requested from other peers.
+func (sm *SyncManager) clearBackgroundBlocks(peer *peerpkg.Peer) {
+	if sm.bgSync == nil {
+		return
+	}
+	for blockHash, block := range sm.bgSync.blocksInFlight {
+		if block.peer == peer {
+			delete(sm.bgSync.blocksInFlight, blockHash)
+		}
+	}
+}
+
+// handleBackgroundStallSample requests the blocks of the background chain from
+// other peers when the peer expected to deliver the next of them doesn't in
+// time.
+func (sm *SyncManager) handleBackgroundStallSample() {
+	bg := sm.bgSync
+	if bg == nil {
+		return
+	}
+	hash, err := sm.chain.BlockHashByHeight(bg.nextHeight)
+	if err != nil {
+		return
+	}
+	inFlight, exists := bg.blocksInFlight[*hash]
+	if !exists || time.Since(inFlight.requested) <= blockStallTimeout {
+		return
+	}
+	peers := sm.blockDownloadPeers()
+	if len(peers) == 1 && peers[0] == inFlight.peer {
+		return
+	}
+
+	log.Infof("Peer %s is stalling the background block download at "+
+		"height %d -- requesting its blocks from other peers",
+		inFlight.peer, bg.nextHeight)
+	sm.clearBackgroundBlocks(inFlight.peer)
+	if state, exists := sm.peerStates[inFlight.peer]; exists {
+		state.stalling = true
+	}
+	sm.fetchBackgroundBlocks()
+}
+
+// StartBackgroundSync starts downloading the blocks up to the base of the UTXO
+// set snapshot the chain was loaded from and processing them with the passed
+// background chain.  The snapshot is then validated against the UTXO set of
+// the background chain, and the passed function is called with the result.
+func (sm *SyncManager) StartBackgroundSync(chain *blockchain.BlockChain, done func(error)) {
+	// Ignore if we are shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+
+	sm.msgChan <- backgroundSyncMsg{chain: chain, done: done}
+}
@@ -7,8 +7,19 @@
 Package netsync implements a concurrency safe block syncing protocol. The
 SyncManager communicates with connected peers to perform an initial block
 download, keep the chain and unconfirmed transaction pool in sync, and announce
-new blocks connected to the chain. Currently the sync manager selects a single
-sync peer that it downloads all blocks from until it is up to date with the
-longest chain the sync peer is aware of.
+new blocks connected to the chain. The sync manager selects a single sync peer
+that it learns about the chain from until it is up to date with the longest
+chain the sync peer is aware of. Until the chain is current, the headers are
+downloaded from the sync peer first, up to the tip of its chain, and the blocks
+they describe are downloaded from the sync peer and the other outbound peers at
+once, within a moving window starting at the next block to process. Blocks
+received out of order are processed in height order, and the requests of a peer
+that stalls the window are reassigned to the other peers.
+
+The header chain of the sync peer is validated without being stored until it
+reaches the final checkpoint with close to the work of the best chain or more.
+It is then downloaded again, checked against the hashes of the headers kept
+during the first pass and stored in the block index, so a peer can't fill the
+block index with a low-work header chain. Peers that send one are disconnected.
 */
 package netsync
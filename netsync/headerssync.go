@@ -0,0 +1,340 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/blockchain"
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+const (
+	// headerCommitmentPeriod is the number of headers between the hashes
+	// of the header chain of the sync peer kept during the presync phase.
+	// The headers downloaded again during the redownload phase are only
+	// stored once they are proven to match up to the next of them.
+	headerCommitmentPeriod = 1000
+
+	// headerCtxWindow is the number of the latest headers kept during the
+	// presync phase to validate the next ones, which is enough for the
+	// median time and difficulty checks.
+	headerCtxWindow = 12
+
+	// minWorkBufferBlocks is the number of blocks, at the difficulty of
+	// the tip of the best chain, the cumulative work of a header chain may
+	// be below the work of the best chain and still be stored.
+	minWorkBufferBlocks = 144
+
+	// maxHeadersPerSecond is the maximum number of headers per second of
+	// elapsed time a valid header chain can have, since the timestamp of
+	// each header must be after the median time of the previous 11.
+	maxHeadersPerSecond = 6
+)
+
+// headerSyncPhase is the phase of the header sync with the sync peer.
+type headerSyncPhase uint8
+
+const (
+	// headerPresync is the phase in which the header chain of the sync
+	// peer is validated and its cumulative work computed without storing
+	// it, keeping only the hash of a header every headerCommitmentPeriod.
+	headerPresync headerSyncPhase = iota
+
+	// headerRedownload is the phase in which the header chain is
+	// downloaded again, checked against the hashes kept during the
+	// presync phase and stored in the block index.
+	headerRedownload
+)
+
+// headerCtx is a header validated during the presync phase.  It implements
+// the blockchain.HeaderCtx interface so the next headers can be validated
+// against it without being in the block index.
+type headerCtx struct {
+	height    int32
+	bits      uint32
+	timestamp int64
+	parent    blockchain.HeaderCtx
+}
+
+// Height returns the height of the header.
+func (h *headerCtx) Height() int32 {
+	return h.height
+}
+
+// Bits returns the difficulty bits of the header.
+func (h *headerCtx) Bits() uint32 {
+	return h.bits
+}
+
+// Timestamp returns the timestamp of the header.
+func (h *headerCtx) Timestamp() int64 {
+	return h.timestamp
+}
+
+// Parent returns the previous header, or nil when it's no longer kept.
+func (h *headerCtx) Parent() blockchain.HeaderCtx {
+	return h.parent
+}
+
+// RelativeAncestorCtx returns the header distance headers before this one, or
+// nil when it's no longer kept.
+func (h *headerCtx) RelativeAncestorCtx(distance int32) blockchain.HeaderCtx {
+	var ancestor blockchain.HeaderCtx = h
+	for ; ancestor != nil && distance > 0; distance-- {
+		ancestor = ancestor.Parent()
+	}
+	return ancestor
+}
+
+// headerSync downloads the header chain of the sync peer in two phases so a
+// peer can't fill the block index with a header chain that doesn't have
+// enough cumulative work to ever become the best chain.  The chain is first
+// validated without being stored until its cumulative work is sufficient, and
+// is then downloaded again and stored once it's proven to be the same chain.
+// The presync phase is skipped when the chain forks from a block that already
+// has sufficient work.
+type headerSync struct {
+	chain *blockchain.BlockChain
+	phase headerSyncPhase
+
+	// forkHeight is the height of the block in the block index the header
+	// chain of the peer starts from.  The header chain must reach
+	// minHeight with at least minWork of cumulative work, and can't be
+	// longer than maxHeight.
+	forkHeight int32
+	minWork    *big.Int
+	minHeight  int32
+	maxHeight  int32
+
+	// These fields are used in the presync phase.  The last headers of
+	// the chain are kept to validate the next ones.
+	lastHash    chainhash.Hash
+	last        blockchain.HeaderCtx
+	work        *big.Int
+	commitments []chainhash.Hash
+
+	// These fields are used in the redownload phase.  The headers are
+	// held in pending until they are proven to match the chain of the
+	// presync phase, which ends at presyncHeight.
+	presyncHeight  int32
+	redownloadHash chainhash.Hash
+	redownloadNext int32
+	pending        []*wire.BlockHeader
+
+	// done is set once the peer sent its whole header chain.
+	done bool
+}
+
+// newHeaderSync returns the state to sync the header chain of a peer that
+// starts after the passed block, which must be in the block index.  The chain
+// must reach the final checkpoint, if any, and have close to the work of the
+// best chain or more.
+func newHeaderSync(chain *blockchain.BlockChain, forkHash *chainhash.Hash) (*headerSync, error) {
+	fork := chain.HeaderCtxByHash(forkHash)
+	if fork == nil {
+		return nil, fmt.Errorf("header chain does not connect to "+
+			"a known block, it starts after %v", forkHash)
+	}
+	forkWork, err := chain.ChainWork(forkHash)
+	if err != nil {
+		return nil, err
+	}
+
+	best := chain.BestSnapshot()
+	bestWork, err := chain.ChainWork(&best.Hash)
+	if err != nil {
+		return nil, err
+	}
+	buffer := new(big.Int).Mul(blockchain.CalcWork(best.Bits),
+		big.NewInt(minWorkBufferBlocks))
+	minWork := new(big.Int).Sub(bestWork, buffer)
+	if minWork.Sign() < 0 {
+		minWork.SetInt64(0)
+	}
+	var minHeight int32
+	if checkpoint := chain.LatestCheckpoint(); checkpoint != nil {
+		minHeight = checkpoint.Height
+	}
+
+	// The header chain can't have more headers than allowed by the median
+	// time rule between the fork and the latest timestamp accepted.
+	maxTime := time.Now().Unix() + blockchain.MaxTimeOffsetSeconds
+	maxHeaders := (maxTime - fork.Timestamp()) * maxHeadersPerSecond
+	if maxHeaders > int64(math.MaxInt32-fork.Height()) {
+		maxHeaders = int64(math.MaxInt32 - fork.Height())
+	}
+
+	hs := &headerSync{
+		chain:          chain,
+		forkHeight:     fork.Height(),
+		minWork:        minWork,
+		minHeight:      minHeight,
+		maxHeight:      fork.Height() + int32(maxHeaders),
+		lastHash:       *forkHash,
+		last:           fork,
+		work:           new(big.Int).Set(forkWork),
+		presyncHeight:  fork.Height(),
+		redownloadHash: *forkHash,
+		redownloadNext: fork.Height() + 1,
+	}
+	if hs.sufficientWork(fork.Height(), forkWork) {
+		hs.phase = headerRedownload
+	}
+	return hs, nil
+}
+
+// sufficientWork returns whether a header chain up to the passed height with
+// the passed cumulative work can be stored.
+func (hs *headerSync) sufficientWork(height int32, work *big.Int) bool {
+	return height >= hs.minHeight && work.Cmp(hs.minWork) >= 0
+}
+
+// nextRequest returns the getheaders message requesting the next headers from
+// the peer, up to the end of its chain (zero hash).
+func (hs *headerSync) nextRequest() *wire.MsgGetHeaders {
+	hash := hs.redownloadHash
+	if hs.phase == headerPresync {
+		hash = hs.lastHash
+	}
+	msg := wire.NewMsgGetHeaders()
+	msg.BlockLocatorHashes = []*chainhash.Hash{&hash}
+	return msg
+}
+
+// processHeaders processes a headers message received from the peer and
+// returns the headers that can be stored in the block index, in order.  The
+// full flag indicates the message holds the max number of headers, so the
+// peer has more of them.  An error is returned when the peer must be
+// disconnected because its header chain is invalid or doesn't have enough
+// work.
+func (hs *headerSync) processHeaders(headers []*wire.BlockHeader, full bool) ([]*wire.BlockHeader, error) {
+	if hs.phase == headerPresync {
+		return nil, hs.presync(headers, full)
+	}
+	return hs.redownload(headers, full)
+}
+
+// presync validates the passed headers and adds their work to the cumulative
+// work of the header chain.  It switches to the redownload phase once the
+// work is sufficient.
+func (hs *headerSync) presync(headers []*wire.BlockHeader, full bool) error {
+	for _, header := range headers {
+		if header.PrevBlock != hs.lastHash {
+			return fmt.Errorf("header %v does not connect to the "+
+				"previous header %v", header.BlockHash(),
+				hs.lastHash)
+		}
+		height := hs.last.Height() + 1
+		if height > hs.maxHeight {
+			return fmt.Errorf("header chain is longer than the "+
+				"max of %d headers allowed since the fork at "+
+				"height %d", hs.maxHeight-hs.forkHeight,
+				hs.forkHeight)
+		}
+		err := hs.chain.CheckBlockHeader(header, hs.last,
+			blockchain.BFNone)
+		if err != nil {
+			return fmt.Errorf("header %v at height %d is invalid: "+
+				"%v", header.BlockHash(), height, err)
+		}
+
+		// Keep the hash of the header at each commitment period, and
+		// only the latest headers.
+		hs.lastHash = header.BlockHash()
+		hs.last = &headerCtx{
+			height:    height,
+			bits:      header.Bits,
+			timestamp: header.Timestamp.Unix(),
+			parent:    hs.last,
+		}
+		if ctx, ok := hs.last.RelativeAncestorCtx(headerCtxWindow - 1).(*headerCtx); ok {
+			ctx.parent = nil
+		}
+		hs.work.Add(hs.work, blockchain.CalcWork(header.Bits))
+		if (height-hs.forkHeight)%headerCommitmentPeriod == 0 {
+			hs.commitments = append(hs.commitments, hs.lastHash)
+		}
+
+		// Download the chain again to store it once its work is
+		// sufficient.  The commitment for the last header of the
+		// chain is kept as well.
+		if hs.sufficientWork(height, hs.work) {
+			if (height-hs.forkHeight)%headerCommitmentPeriod != 0 {
+				hs.commitments = append(hs.commitments,
+					hs.lastHash)
+			}
+			hs.phase = headerRedownload
+			hs.presyncHeight = height
+			hs.last = nil
+			return nil
+		}
+	}
+
+	if !full {
+		return fmt.Errorf("header chain ending at height %d does not "+
+			"have enough work", hs.last.Height())
+	}
+	return nil
+}
+
+// commitment returns the hash kept during the presync phase for the passed
+// height, if any.
+func (hs *headerSync) commitment(height int32) (chainhash.Hash, bool) {
+	if height > hs.presyncHeight {
+		return chainhash.Hash{}, false
+	}
+	if height == hs.presyncHeight {
+		return hs.commitments[len(hs.commitments)-1], true
+	}
+	offset := height - hs.forkHeight
+	if offset%headerCommitmentPeriod != 0 {
+		return chainhash.Hash{}, false
+	}
+	return hs.commitments[offset/headerCommitmentPeriod-1], true
+}
+
+// redownload checks the passed headers match the chain of the presync phase
+// and returns those proven to match.  The headers past the end of the presync
+// phase extend a chain with sufficient work and are returned right away.
+func (hs *headerSync) redownload(headers []*wire.BlockHeader, full bool) ([]*wire.BlockHeader, error) {
+	var matched []*wire.BlockHeader
+	for _, header := range headers {
+		if header.PrevBlock != hs.redownloadHash {
+			return nil, fmt.Errorf("header %v does not connect to "+
+				"the previous header %v", header.BlockHash(),
+				hs.redownloadHash)
+		}
+		height := hs.redownloadNext
+		hs.redownloadHash = header.BlockHash()
+		hs.redownloadNext++
+		hs.pending = append(hs.pending, header)
+
+		commitment, ok := hs.commitment(height)
+		if ok && commitment != hs.redownloadHash {
+			return nil, fmt.Errorf("header %v at height %d does "+
+				"not match the header chain sent before",
+				hs.redownloadHash, height)
+		}
+		if ok || height > hs.presyncHeight {
+			matched = append(matched, hs.pending...)
+			hs.pending = hs.pending[:0]
+		}
+	}
+
+	if !full {
+		if hs.redownloadNext <= hs.presyncHeight {
+			return nil, fmt.Errorf("header chain ends at height %d "+
+				"before the height %d it reached before",
+				hs.redownloadNext-1, hs.presyncHeight)
+		}
+		hs.done = true
+	}
+	return matched, nil
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/blockchain"
+	"github.com/flokiorg/go-flokicoin/chaincfg"
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/database"
+	_ "github.com/flokiorg/go-flokicoin/database/ffldb"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// newTestChain returns a chain on the regression test network with only its
+// genesis block.
+func newTestChain(t *testing.T) *blockchain.BlockChain {
+	t.Helper()
+
+	params := chaincfg.RegressionNetParams
+	dbPath := filepath.Join(t.TempDir(), "ffldb")
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	return chain
+}
+
+// testHeaders returns a chain of n valid headers extending the genesis block
+// of the regression test network.  The seed makes distinct chains.
+func testHeaders(t *testing.T, n int, seed uint32) []*wire.BlockHeader {
+	t.Helper()
+
+	genesis := &chaincfg.RegressionNetParams.GenesisBlock.Header
+	prevHash := genesis.BlockHash()
+	timestamp := genesis.Timestamp
+	target := blockchain.CompactToBig(genesis.Bits)
+	headers := make([]*wire.BlockHeader, n)
+	for i := range headers {
+		timestamp = timestamp.Add(time.Minute)
+		header := &wire.BlockHeader{
+			Version:    4,
+			PrevBlock:  prevHash,
+			MerkleRoot: chainhash.Hash{byte(seed), byte(seed >> 8)},
+			Timestamp:  timestamp,
+			Bits:       genesis.Bits,
+		}
+		for {
+			hash := header.BlockPoWHash()
+			if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+				break
+			}
+			header.Nonce++
+		}
+		headers[i] = header
+		prevHash = header.BlockHash()
+	}
+	return headers
+}
+
+// headersWork returns the cumulative work of the passed number of headers at
+// the difficulty of the regression test network.
+func headersWork(n int) *big.Int {
+	work := blockchain.CalcWork(chaincfg.RegressionNetParams.PowLimitBits)
+	return work.Mul(work, big.NewInt(int64(n)))
+}
+
+// headerSyncMsg is a headers message sent by the peer during a header sync test.
+type headerSyncMsg struct {
+	headers []*wire.BlockHeader
+	full    bool
+
+	// wantStored is the number of headers to store, and wantErr is a
+	// substring of the expected error, if any.
+	wantStored int
+	wantErr    string
+}
+
+// TestHeaderSync ensures the header chain of a peer is only stored once it's
+// proven to have enough work, and that invalid header chains are rejected.
+func TestHeaderSync(t *testing.T) {
+	chainA := testHeaders(t, 15, 1)
+	chainB := testHeaders(t, 15, 2)
+
+	// A chain matching chain A up to a header before its end, diverging
+	// at the last header of the presync phase.
+	mismatched := append(append([]*wire.BlockHeader{}, chainA[:9]...),
+		testHeaders(t, 1, 3)...)
+	mismatched[9].PrevBlock = chainA[8].BlockHash()
+
+	tests := []struct {
+		name string
+
+		// minWork is the work, in headers after the fork, required to
+		// store the chain, and maxHeaders is the max length of the chain, or 0
+		// for the default.
+		minWork    int
+		maxHeaders int32
+
+		msgs     []headerSyncMsg
+		wantDone bool
+	}{{
+		name:    "enough work",
+		minWork: 10,
+		msgs: []headerSyncMsg{
+			// The work becomes sufficient at the 10th header, the
+			// chain is then downloaded again to be stored.  The
+			// headers are held until the 10th one matches.
+			{headers: chainA[:6], full: true},
+			{headers: chainA[6:12], full: true},
+			{headers: chainA[:8], full: true},
+			{headers: chainA[8:], wantStored: 15},
+		},
+		wantDone: true,
+	}, {
+		name:    "no presync with enough work at the fork",
+		minWork: 0,
+		msgs: []headerSyncMsg{
+			{headers: chainB[:5], full: true, wantStored: 5},
+			{headers: chainB[5:], wantStored: 10},
+		},
+		wantDone: true,
+	}, {
+		name:    "low-work chain",
+		minWork: 20,
+		msgs: []headerSyncMsg{
+			{headers: chainA[:10], full: true},
+			{headers: chainA[10:], wantErr: "does not have " +
+				"enough work"},
+		},
+	}, {
+		name:    "mismatched redownload",
+		minWork: 10,
+		msgs: []headerSyncMsg{
+			{headers: chainA[:10], full: true},
+			{headers: mismatched, wantErr: "does not match the " +
+				"header chain sent before"},
+		},
+	}, {
+		name:    "redownload shorter than the presync chain",
+		minWork: 10,
+		msgs: []headerSyncMsg{
+			{headers: chainA[:10], full: true},
+			{headers: chainA[:9], wantErr: "before the height 10 " +
+				"it reached before"},
+		},
+	}, {
+		name:       "too-long chain",
+		minWork:    20,
+		maxHeaders: 12,
+		msgs: []headerSyncMsg{
+			{headers: chainA, full: true, wantErr: "longer than " +
+				"the max of 12 headers"},
+		},
+	}, {
+		name:    "unconnected headers",
+		minWork: 10,
+		msgs: []headerSyncMsg{
+			{headers: chainA[:5], full: true},
+			{headers: chainB[5:], full: true, wantErr: "does not " +
+				"connect to the previous header"},
+		},
+	}}
+
+	chain := newTestChain(t)
+	genesisHash := chaincfg.RegressionNetParams.GenesisHash
+	for _, test := range tests {
+		hs, err := newHeaderSync(chain, genesisHash)
+		if err != nil {
+			t.Fatalf("%s: newHeaderSync: %v", test.name, err)
+		}
+
+		// The chain only has its genesis block, so the work required
+		// is set for the test, on top of the work of the genesis block.
+		hs.minWork = headersWork(test.minWork + 1)
+		hs.phase = headerRedownload
+		if !hs.sufficientWork(hs.forkHeight, hs.work) {
+			hs.phase = headerPresync
+		}
+		if test.maxHeaders != 0 {
+			hs.maxHeight = hs.forkHeight + test.maxHeaders
+		}
+
+		var stored []*wire.BlockHeader
+		for i, msg := range test.msgs {
+			// Each request continues after the last header
+			// received in the current phase.
+			req := hs.nextRequest()
+			if msg.wantErr == "" &&
+				*req.BlockLocatorHashes[0] != msg.headers[0].PrevBlock {
+
+				t.Fatalf("%s: msg %d: request starts after %v, "+
+					"want %v", test.name, i,
+					req.BlockLocatorHashes[0],
+					msg.headers[0].PrevBlock)
+			}
+
+			headers, err := hs.processHeaders(msg.headers, msg.full)
+			if msg.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(),
+					msg.wantErr) {
+
+					t.Fatalf("%s: msg %d: got err %v, want %q",
+						test.name, i, err, msg.wantErr)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: msg %d: processHeaders: %v",
+					test.name, i, err)
+			}
+			if len(headers) != msg.wantStored {
+				t.Fatalf("%s: msg %d: got %d headers to store, "+
+					"want %d", test.name, i, len(headers),
+					msg.wantStored)
+			}
+			stored = append(stored, headers...)
+		}
+		if hs.done != test.wantDone {
+			t.Fatalf("%s: got done %v, want %v", test.name, hs.done,
+				test.wantDone)
+		}
+
+		// The headers stored are the whole chain, in order, from the
+		// fork.
+		prevHash := *genesisHash
+		for i, header := range stored {
+			if header.PrevBlock != prevHash {
+				t.Fatalf("%s: header %d to store does not "+
+					"connect to the previous one", test.name, i)
+			}
+			prevHash = header.BlockHash()
+		}
+	}
+}
@@ -24,10 +24,25 @@ import (
 )
 
 const (
-	// minInFlightBlocks is the minimum number of blocks that should be
-	// in the request queue for headers-first mode before requesting
-	// more.
-	minInFlightBlocks = 10
+	// blockDownloadWindow is the maximum number of blocks past the next
+	// block to process that are requested in headers-first mode.  Blocks
+	// received out of order are held until the blocks before them are
+	// processed, so it also bounds the number of blocks held in memory.
+	blockDownloadWindow = 1024
+
+	// maxBlocksInFlightPerPeer is the maximum number of blocks requested
+	// from a single peer at a time in headers-first mode.
+	maxBlocksInFlightPerPeer = 16
+
+	// blockStallTimeout is the time after which a peer that hasn't
+	// delivered the next block to process in headers-first mode is
+	// considered to stall the download.  Its requests are then reassigned
+	// to other peers and it's disconnected.
+	blockStallTimeout = 10 * time.Second
+
+	// blockStallSampleInterval is the interval at which the download of
+	// the next block to process is checked for stalls.
+	blockStallSampleInterval = time.Second
 
 	// maxRejectedTxns is the maximum number of rejected transactions
 	// hashes to store in memory.
@@ -48,6 +63,10 @@ const (
 	// stallSampleInterval the interval at which we will check to see if our
 	// sync has stalled.
 	stallSampleInterval = 30 * time.Second
+
+	// utxoFlushSampleInterval is the interval at which the dirty entries
+	// of the UTXO cache are checked for a periodic flush.
+	utxoFlushSampleInterval = time.Minute
 )
 
 // zeroHash is the zero value hash (all zeros).  It is defined as a convenience.
@@ -95,9 +114,10 @@ type donePeerMsg struct {
 // txMsg packages a flokicoin tx message and the peer it came from together
 // so the block handler has access to that information.
 type txMsg struct {
-	tx    *chainutil.Tx
-	peer  *peerpkg.Peer
-	reply chan struct{}
+	tx        *chainutil.Tx
+	peer      *peerpkg.Peer
+	limitFree bool
+	reply     chan struct{}
 }
 
 // getSyncPeerMsg is a message type to be sent across the message channel for
@@ -139,13 +159,21 @@ type pauseMsg struct {
 	unpause <-chan struct{}
 }
 
-// headerNode is used as a node in a list of headers that are linked together
-// between checkpoints.
+// headerNode is used as a node in the list of the headers stored in the block
+// index whose blocks are downloaded in headers-first mode.
 type headerNode struct {
 	height int32
 	hash   *chainhash.Hash
 }
 
+// blockInFlight describes a block of the header list requested from a peer in
+// headers-first mode.
+type blockInFlight struct {
+	peer      *peerpkg.Peer
+	height    int32
+	requested time.Time
+}
+
 // peerSyncState stores additional information that the SyncManager tracks
 // about a peer.
 type peerSyncState struct {
@@ -153,6 +181,13 @@ type peerSyncState struct {
 	requestQueue    []*wire.InvVect
 	requestedTxns   map[chainhash.Hash]struct{}
 	requestedBlocks map[chainhash.Hash]struct{}
+
+	// blocksInFlight holds the blocks of the header list the peer is
+	// currently expected to deliver in headers-first mode, and stalling
+	// is set when its requests were reassigned because it didn't deliver
+	// them in time.
+	blocksInFlight map[chainhash.Hash]struct{}
+	stalling       bool
 }
 
 // limitAdd is a helper function for maps that require a maximum limit by
@@ -183,6 +218,7 @@ type SyncManager struct {
 	peerNotifier   PeerNotifier
 	started        int32
 	shutdown       int32
+	reindexing     int32
 	chain          *blockchain.BlockChain
 	txMemPool      *mempool.TxPool
 	chainParams    *chaincfg.Params
@@ -199,11 +235,26 @@ type SyncManager struct {
 	peerStates       map[*peerpkg.Peer]*peerSyncState
 	lastProgressTime time.Time
 
-	// The following fields are used for headers-first mode.
+	// The following fields are used for headers-first mode.  The header
+	// chain of the sync peer is synced with headerSync, and the headers
+	// stored in the block index are added to headerList.  Once there are
+	// some, fetchingBlocks is set and their blocks are downloaded from
+	// several peers at once.  The blocks received ahead of the next block
+	// to process are held in pendingBlocks until it is received.
+	// headersSynced is set once the sync peer sent its whole header chain.
 	headersFirstMode bool
+	headerSync       *headerSync
+	headersSynced    bool
 	headerList       *list.List
-	startHeader      *list.Element
-	nextCheckpoint   *chaincfg.Checkpoint
+	fetchingBlocks   bool
+	blocksInFlight   map[chainhash.Hash]*blockInFlight
+	pendingBlocks    map[chainhash.Hash]*blockMsg
+	windowStartTime  time.Time
+
+	// bgSync holds the state of the sync of the background chain that
+	// validates the blocks up to the base of the UTXO set snapshot the
+	// chain was loaded from, if any.
+	bgSync *backgroundSync
 
 	// An optional fee estimator.
 	feeEstimator *mempool.FeeEstimator
@@ -211,46 +262,13 @@ type SyncManager struct {
 
 // resetHeaderState sets the headers-first mode state to values appropriate for
 // syncing from a new peer.
-func (sm *SyncManager) resetHeaderState(newestHash *chainhash.Hash, newestHeight int32) {
+func (sm *SyncManager) resetHeaderState() {
 	sm.headersFirstMode = false
+	sm.headerSync = nil
+	sm.headersSynced = false
 	sm.headerList.Init()
-	sm.startHeader = nil
-
-	// When there is a next checkpoint, add an entry for the latest known
-	// block into the header pool.  This allows the next downloaded header
-	// to prove it links to the chain properly.
-	if sm.nextCheckpoint != nil {
-		node := headerNode{height: newestHeight, hash: newestHash}
-		sm.headerList.PushBack(&node)
-	}
-}
-
-// findNextHeaderCheckpoint returns the next checkpoint after the passed height.
-// It returns nil when there is not one either because the height is already
-// later than the final checkpoint or some other reason such as disabled
-// checkpoints.
-func (sm *SyncManager) findNextHeaderCheckpoint(height int32) *chaincfg.Checkpoint {
-	checkpoints := sm.chain.Checkpoints()
-	if len(checkpoints) == 0 {
-		return nil
-	}
-
-	// There is no next checkpoint if the height is already after the final
-	// checkpoint.
-	finalCheckpoint := &checkpoints[len(checkpoints)-1]
-	if height >= finalCheckpoint.Height {
-		return nil
-	}
-
-	// Find the next checkpoint.
-	nextCheckpoint := finalCheckpoint
-	for i := len(checkpoints) - 2; i >= 0; i-- {
-		if height >= checkpoints[i].Height {
-			break
-		}
-		nextCheckpoint = &checkpoints[i]
-	}
-	return nextCheckpoint
+	sm.fetchingBlocks = false
+	sm.clearBlocksInFlight()
 }
 
 // startSync will choose the best peer among the available candidate peers to
@@ -346,32 +364,32 @@ func (sm *SyncManager) startSync() {
 		log.Infof("Syncing to block height %d from peer %v",
 			bestPeer.LastBlock(), bestPeer.Addr())
 
-		// When the current height is less than a known checkpoint we
-		// can use block headers to learn about which blocks comprise
-		// the chain up to the checkpoint and perform less validation
-		// for them.  This is possible since each header contains the
-		// hash of the previous header and a merkle root.  Therefore if
-		// we validate all of the received headers link together
-		// properly and the checkpoint hashes match, we can be sure the
-		// hashes for the blocks in between are accurate.  Further, once
-		// the full blocks are downloaded, the merkle root is computed
-		// and compared against the value in the header which proves the
+		// When the chain is not current, use block headers to learn
+		// about which blocks comprise the chain up to the tip of the
+		// sync peer and download them from several peers at once.  The
+		// header chain is only stored once it's known to have enough
+		// work, so a peer can't fill the block index with headers that
+		// will never be part of the best chain.  The blocks up to the
+		// final checkpoint perform less validation since each header
+		// contains the hash of the previous header and a merkle root.
+		// Therefore if the received headers link together properly and
+		// the checkpoint hashes match, we can be sure the hashes for
+		// the blocks in between are accurate.  Further, once the full
+		// blocks are downloaded, the merkle root is computed and
+		// compared against the value in the header which proves the
 		// full block hasn't been tampered with.
 		//
-		// Once we have passed the final checkpoint, or checkpoints are
-		// disabled, use standard inv messages learn about the blocks
-		// and fully validate them.  Finally, regression test mode does
-		// not support the headers-first approach so do normal block
+		// Once the chain is current, use standard inv messages learn
+		// about the blocks.  Finally, regression test mode does not
+		// support the headers-first approach so do normal block
 		// downloads when in regression test mode.
-		if sm.nextCheckpoint != nil &&
-			best.Height < sm.nextCheckpoint.Height &&
+		if !sm.chain.IsCurrent() &&
 			sm.chainParams != &chaincfg.RegressionNetParams {
 
-			bestPeer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
+			bestPeer.PushGetHeadersMsg(locator, &zeroHash)
 			sm.headersFirstMode = true
-			log.Infof("Downloading headers for blocks %d to "+
-				"%d from peer %s", best.Height+1,
-				sm.nextCheckpoint.Height, bestPeer.Addr())
+			log.Infof("Downloading headers for blocks after %d from "+
+				"peer %s", best.Height, bestPeer.Addr())
 		} else if !sm.current() {
 			bestPeer.PushGetBlocksMsg(locator, &zeroHash)
 		}
@@ -475,12 +493,22 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 		syncCandidate:   isSyncCandidate,
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
+		blocksInFlight:  make(map[chainhash.Hash]struct{}),
 	}
 
 	// Start syncing by choosing the best candidate if needed.
 	if isSyncCandidate && sm.syncPeer == nil {
 		sm.startSync()
 	}
+
+	// Download blocks from the new peer as well when they are being
+	// fetched from the header list.
+	if isSyncCandidate && sm.fetchingBlocks {
+		sm.fetchHeaderBlocks()
+	}
+	if isSyncCandidate {
+		sm.fetchBackgroundBlocks()
+	}
 }
 
 // handleStallSample will switch to a new sync peer if the current one has
@@ -553,12 +581,19 @@ func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
 	log.Infof("Lost peer %s", peer)
 
 	sm.clearRequestedState(state)
+	sm.clearBackgroundBlocks(peer)
+	sm.fetchBackgroundBlocks()
 
 	if peer == sm.syncPeer {
 		// Update the sync peer. The server has already disconnected the
 		// peer before signaling to the sync manager.
 		sm.updateSyncPeer(false)
+		return
 	}
+
+	// Request the blocks the peer was expected to deliver from the other
+	// peers.
+	sm.fetchHeaderBlocks()
 }
 
 // clearRequestedState wipes all expected transactions and blocks from the sync
@@ -578,6 +613,24 @@ func (sm *SyncManager) clearRequestedState(state *peerSyncState) {
 	for blockHash := range state.requestedBlocks {
 		delete(sm.requestedBlocks, blockHash)
 	}
+
+	// Remove the blocks of the header list the peer was expected to
+	// deliver so they are requested from other peers.
+	for blockHash := range state.blocksInFlight {
+		delete(sm.blocksInFlight, blockHash)
+	}
+	state.blocksInFlight = make(map[chainhash.Hash]struct{})
+}
+
+// clearBlocksInFlight forgets about all the blocks of the header list that are
+// requested or held until the blocks before them are processed.
+func (sm *SyncManager) clearBlocksInFlight() {
+	sm.blocksInFlight = make(map[chainhash.Hash]*blockInFlight)
+	sm.pendingBlocks = make(map[chainhash.Hash]*blockMsg)
+	for _, state := range sm.peerStates {
+		state.blocksInFlight = make(map[chainhash.Hash]struct{})
+		state.stalling = false
+	}
 }
 
 // updateSyncPeer choose a new sync peer to replace the current one. If
@@ -595,8 +648,7 @@ func (sm *SyncManager) updateSyncPeer(dcSyncPeer bool) {
 
 	// Reset any header state before we choose our next active sync peer.
 	if sm.headersFirstMode {
-		best := sm.chain.BestSnapshot()
-		sm.resetHeaderState(&best.Hash, best.Height)
+		sm.resetHeaderState()
 	}
 
 	sm.syncPeer = nil
@@ -632,9 +684,14 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	}
 
 	// Process the transaction to include validation, insertion in the
-	// memory pool, orphan handling, etc.
-	acceptedTxs, err := sm.txMemPool.ProcessTransaction(tmsg.tx,
-		true, true, mempool.Tag(peer.ID()))
+	// memory pool, orphan handling, etc.  Free transactions are only rate
+	// limited when requested.
+	process := sm.txMemPool.ProcessTransaction
+	if !tmsg.limitFree {
+		process = sm.txMemPool.ProcessTransactionNoFreeLimit
+	}
+	acceptedTxs, err := process(tmsg.tx, true, true,
+		mempool.Tag(peer.ID()))
 
 	// Remove transaction from request maps. Either the mempool/chain
 	// already knows about it and as such we shouldn't have any more
@@ -673,6 +730,12 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 // current returns true if we believe we are synced with our peers, false if we
 // still have blocks to check
 func (sm *SyncManager) current() bool {
+	// The blocks processed while reindexing are neither relayed nor used
+	// to update the mempool.
+	if atomic.LoadInt32(&sm.reindexing) != 0 {
+		return false
+	}
+
 	if !sm.chain.IsCurrent() {
 		return false
 	}
@@ -716,39 +779,45 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
-	// When in headers-first mode, if the block matches the hash of the
-	// first header in the list of headers that are being fetched, it's
-	// eligible for less validation since the headers have already been
-	// verified to link together and are valid up to the next checkpoint.
-	// Also, remove the list entry for all blocks except the checkpoint
-	// since it is needed to verify the next round of headers links
-	// properly.
-	isCheckpointBlock := false
-	behaviorFlags := blockchain.BFNone
-	if sm.headersFirstMode {
-		firstNodeEl := sm.headerList.Front()
-		if firstNodeEl != nil {
-			firstNode := firstNodeEl.Value.(*headerNode)
-			if blockHash.IsEqual(firstNode.hash) {
-				behaviorFlags |= blockchain.BFFastAdd
-				if firstNode.hash.IsEqual(sm.nextCheckpoint.Hash) {
-					isCheckpointBlock = true
-				} else {
-					sm.headerList.Remove(firstNodeEl)
-				}
-			}
-		}
-	}
-
 	// Remove block from request maps. Either chain will know about it and
 	// so we shouldn't have any more instances of trying to fetch it, or we
 	// will fail the insert and thus we'll retry next time we get an inv.
 	delete(state.requestedBlocks, *blockHash)
 	delete(sm.requestedBlocks, *blockHash)
 
+	// The blocks of the background chain are processed in height order
+	// as well, by the background chain.
+	if sm.queueBackgroundBlock(bmsg) {
+		sm.processBackgroundBlocks()
+		sm.fetchBackgroundBlocks()
+		return
+	}
+
+	// When the blocks of the header list are being fetched, they are
+	// downloaded from several peers at once and processed in height order,
+	// so the block is held until the blocks before it are received.
+	if sm.fetchingBlocks && sm.queueHeaderBlock(bmsg, state) {
+		sm.processHeaderBlocks()
+		sm.fetchHeaderBlocks()
+		return
+	}
+
+	if err := sm.processBlock(bmsg.block, peer, blockchain.BFNone); err != nil {
+		return
+	}
+}
+
+// processBlock processes the passed block received from the passed peer, which
+// includes validation, best chain selection and orphan handling, and updates
+// the peer heights accordingly.  It returns the error returned by the chain
+// when the block was rejected, after notifying the peer.
+func (sm *SyncManager) processBlock(block *chainutil.Block, peer *peerpkg.Peer,
+	behaviorFlags blockchain.BehaviorFlags) error {
+
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
-	_, isOrphan, err := sm.chain.ProcessBlock(bmsg.block, behaviorFlags)
+	blockHash := block.Hash()
+	_, isOrphan, err := sm.chain.ProcessBlock(block, behaviorFlags)
 	if err != nil {
 		// When the error is a rule error, it means the block was simply
 		// rejected as opposed to something actually going wrong, so log
@@ -768,7 +837,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		// send it.
 		code, reason := mempool.ErrToRejectErr(err)
 		peer.PushRejectMsg(wire.CmdBlock, code, reason, blockHash, false)
-		return
+		return err
 	}
 
 	// Meta-data about the new block this peer is reporting. We use this
@@ -790,9 +859,9 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		// block height from the scriptSig of the coinbase transaction.
 		// Extraction is only attempted if the block's version is
 		// high enough (ver 2+).
-		header := &bmsg.block.MsgBlock().Header
+		header := &block.MsgBlock().Header
 		if blockchain.ShouldHaveSerializedBlockHeight(header) {
-			coinbaseTx := bmsg.block.Transactions()[0]
+			coinbaseTx := block.Transactions()[0]
 			cbHeight, err := blockchain.ExtractCoinbaseHeight(coinbaseTx)
 			if err != nil {
 				log.Warnf("Unable to extract height from "+
@@ -820,7 +889,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 
 		// When the block is not an orphan, log information about it and
 		// update the chain state.
-		sm.progressLogger.LogBlockHeight(bmsg.block, sm.chain)
+		sm.progressLogger.LogBlockHeight(block, sm.chain)
 
 		// Update this peer's latest block height, for future
 		// potential sync node candidacy.
@@ -844,83 +913,234 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
-	// If we are not in headers first mode, it's a good time to periodically
-	// flush the blockchain cache because we don't expect new blocks immediately.
-	// After that, there is nothing more to do.
-	if !sm.headersFirstMode {
-		if err := sm.chain.FlushUtxoCache(blockchain.FlushPeriodic); err != nil {
-			log.Errorf("Error while flushing the blockchain cache: %v", err)
+	return nil
+}
+
+// inDownloadWindow returns whether the block with the passed hash is one of the
+// blocks of the header list in the download window.
+func (sm *SyncManager) inDownloadWindow(hash *chainhash.Hash) bool {
+	firstNodeEl := sm.headerList.Front()
+	if firstNodeEl == nil {
+		return false
+	}
+	windowEnd := firstNodeEl.Value.(*headerNode).height + blockDownloadWindow
+	for e := firstNodeEl; e != nil; e = e.Next() {
+		node := e.Value.(*headerNode)
+		if node.height >= windowEnd {
+			break
+		}
+		if node.hash.IsEqual(hash) {
+			return true
 		}
-		return
 	}
+	return false
+}
 
-	// This is headers-first mode, so if the block is not a checkpoint
-	// request more blocks using the header list when the request queue is
-	// getting short.
-	if !isCheckpointBlock {
-		if sm.startHeader != nil &&
-			len(state.requestedBlocks) < minInFlightBlocks {
-			sm.fetchHeaderBlocks()
+// queueHeaderBlock holds the passed block until the blocks before it are
+// processed when it is one of the blocks of the header list being fetched.  It
+// returns false when it is not, in which case the block must be processed
+// right away.
+func (sm *SyncManager) queueHeaderBlock(bmsg *blockMsg, state *peerSyncState) bool {
+	blockHash := bmsg.block.Hash()
+	inFlight, exists := sm.blocksInFlight[*blockHash]
+	if !exists {
+		// The block may be received twice when it was requested again
+		// from another peer after this one stalled.  Drop the copy.
+		if _, exists := sm.pendingBlocks[*blockHash]; exists ||
+			sm.chain.MainChainHasBlock(blockHash) {
+
+			log.Debugf("Ignoring block %v from %s received twice",
+				blockHash, bmsg.peer)
+			return true
 		}
-		return
+
+		// The block may also be received late from a peer that
+		// stalled, before it's requested again from another peer.
+		// It's held like the other blocks of the window since
+		// processing it out of order would make it an orphan.
+		if !sm.inDownloadWindow(blockHash) {
+			return false
+		}
+		log.Debugf("Received block %v late from %s", blockHash,
+			bmsg.peer)
+		state.stalling = false
+		sm.pendingBlocks[*blockHash] = bmsg
+		return true
+	}
+
+	// The block may be received from the peer it was requested from
+	// before its requests were reassigned.
+	if inFlightState, exists := sm.peerStates[inFlight.peer]; exists {
+		delete(inFlightState.blocksInFlight, *blockHash)
+	}
+	delete(sm.blocksInFlight, *blockHash)
+	state.stalling = false
+
+	sm.pendingBlocks[*blockHash] = bmsg
+	return true
+}
+
+// processHeaderBlocks processes the received blocks of the header list in
+// height order, starting with the next block to process, until one of them is
+// missing.  The blocks up to the final checkpoint are eligible for less
+// validation since their headers have already been verified to link together
+// and to match the checkpoints.  Headers-first mode ends once the whole header
+// chain of the sync peer is known and the blocks are processed.
+func (sm *SyncManager) processHeaderBlocks() {
+	var fastAddHeight int32
+	if checkpoint := sm.chain.LatestCheckpoint(); checkpoint != nil {
+		fastAddHeight = checkpoint.Height
 	}
 
-	// This is headers-first mode and the block is a checkpoint.  When
-	// there is a next checkpoint, get the next round of headers by asking
-	// for headers starting from the block after this one up to the next
-	// checkpoint.
-	prevHeight := sm.nextCheckpoint.Height
-	prevHash := sm.nextCheckpoint.Hash
-	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(prevHeight)
-	if sm.nextCheckpoint != nil {
-		locator := blockchain.BlockLocator([]*chainhash.Hash{prevHash})
-		err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
+	for sm.fetchingBlocks {
+		firstNodeEl := sm.headerList.Front()
+		if firstNodeEl == nil {
+			if sm.headersSynced {
+				sm.finishHeadersFirst()
+			}
+			return
+		}
+		firstNode := firstNodeEl.Value.(*headerNode)
+
+		bmsg, exists := sm.pendingBlocks[*firstNode.hash]
+		if !exists {
+			// Skip the blocks that were received some other way
+			// since they are never requested.
+			have, err := sm.chain.HaveBlock(firstNode.hash)
+			if err != nil {
+				log.Warnf("Unexpected failure when checking for "+
+					"existing block %v: %v", firstNode.hash, err)
+				return
+			}
+			if have {
+				sm.headerList.Remove(firstNodeEl)
+				continue
+			}
+			return
+		}
+		delete(sm.pendingBlocks, *firstNode.hash)
+		sm.windowStartTime = time.Now()
+
+		behaviorFlags := blockchain.BFNone
+		if firstNode.height <= fastAddHeight {
+			behaviorFlags = blockchain.BFFastAdd
+		}
+		err := sm.processBlock(bmsg.block, bmsg.peer, behaviorFlags)
 		if err != nil {
-			log.Warnf("Failed to send getheaders message to "+
-				"peer %s: %v", peer.Addr(), err)
+			ruleErr, ok := err.(blockchain.RuleError)
+			if !ok {
+				return
+			}
+
+			// A block whose ancestor is invalid is not at fault,
+			// the header chain of the sync peer is, so the sync
+			// peer is replaced.
+			if ruleErr.ErrorCode == blockchain.ErrInvalidAncestorBlock {
+				if sm.syncPeer != nil {
+					log.Warnf("Header chain of %s has an "+
+						"invalid block before %v -- "+
+						"disconnecting", sm.syncPeer,
+						firstNode.hash)
+					sm.syncPeer.Disconnect()
+				}
+				return
+			}
+
+			// The block matches a header that was already
+			// validated, so a rejected block was altered by the
+			// peer that sent it.  The block is requested again
+			// from another peer.
+			log.Warnf("Block %v from %s does not match its "+
+				"header -- disconnecting", firstNode.hash,
+				bmsg.peer)
+			bmsg.peer.Disconnect()
 			return
 		}
-		log.Infof("Downloading headers for blocks %d to %d from "+
-			"peer %s", prevHeight+1, sm.nextCheckpoint.Height,
-			sm.syncPeer.Addr())
+		sm.lastProgressTime = time.Now()
+		sm.headerList.Remove(firstNodeEl)
+	}
+}
+
+// finishHeadersFirst switches to normal mode once the whole header chain of the
+// sync peer is known and the blocks are processed.  The blocks announced in
+// the meantime are requested from the block after the tip up to the end of
+// the chain (zero hash).
+func (sm *SyncManager) finishHeadersFirst() {
+	sm.resetHeaderState()
+	peer := sm.syncPeer
+	if peer == nil {
 		return
 	}
 
-	// This is headers-first mode, the block is a checkpoint, and there are
-	// no more checkpoints, so switch to normal mode by requesting blocks
-	// from the block after this one up to the end of the chain (zero hash).
-	sm.headersFirstMode = false
-	sm.headerList.Init()
-	log.Infof("Reached the final checkpoint -- switching to normal mode")
-	locator := blockchain.BlockLocator([]*chainhash.Hash{blockHash})
-	err = peer.PushGetBlocksMsg(locator, &zeroHash)
+	best := sm.chain.BestSnapshot()
+	log.Infof("Processed the blocks of the header chain up to height %d "+
+		"-- switching to normal mode", best.Height)
+	locator := blockchain.BlockLocator([]*chainhash.Hash{&best.Hash})
+	err := peer.PushGetBlocksMsg(locator, &zeroHash)
 	if err != nil {
 		log.Warnf("Failed to send getblocks message to peer %s: %v",
 			peer.Addr(), err)
-		return
 	}
 }
 
-// fetchHeaderBlocks creates and sends a request to the syncPeer for the next
-// list of blocks to be downloaded based on the current list of headers.
+// blockDownloadPeers returns the peers the blocks of the header list are
+// downloaded from, which are the sync peer and the outbound sync candidates.
+// Peers stalling the download are only returned when there are no others.
+func (sm *SyncManager) blockDownloadPeers() []*peerpkg.Peer {
+	var peers, stalling []*peerpkg.Peer
+	for peer, state := range sm.peerStates {
+		if peer != sm.syncPeer && (!state.syncCandidate || peer.Inbound()) {
+			continue
+		}
+		if state.stalling {
+			stalling = append(stalling, peer)
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	if len(peers) == 0 {
+		return stalling
+	}
+	return peers
+}
+
+// fetchHeaderBlocks requests the blocks of the header list in the download
+// window that are neither requested nor received yet, spreading them across
+// the peers that have them with the fewest blocks in flight.
 func (sm *SyncManager) fetchHeaderBlocks() {
-	// Nothing to do if there is no start header.
-	if sm.startHeader == nil {
-		log.Warnf("fetchHeaderBlocks called with no start header")
+	// Nothing to do until the headers up to the next checkpoint are known.
+	if !sm.fetchingBlocks {
+		return
+	}
+	firstNodeEl := sm.headerList.Front()
+	if firstNodeEl == nil {
+		return
+	}
+	peers := sm.blockDownloadPeers()
+	if len(peers) == 0 {
 		return
 	}
 
-	// Build up a getdata request for the list of blocks the headers
-	// describe.  The size hint will be limited to wire.MaxInvPerMsg by
-	// the function, so no need to double check it here.
-	gdmsg := wire.NewMsgGetDataSizeHint(uint(sm.headerList.Len()))
-	numRequested := 0
-	for e := sm.startHeader; e != nil; e = e.Next() {
+	// Build up a getdata request for each peer with the blocks assigned
+	// to it.  The window starts at the next block to process.
+	windowEnd := firstNodeEl.Value.(*headerNode).height + blockDownloadWindow
+	requests := make(map[*peerpkg.Peer]*wire.MsgGetData)
+	now := time.Now()
+	for e := firstNodeEl; e != nil; e = e.Next() {
 		node, ok := e.Value.(*headerNode)
 		if !ok {
 			log.Warn("Header list node type is not a headerNode")
 			continue
 		}
+		if node.height >= windowEnd {
+			break
+		}
+		if _, exists := sm.blocksInFlight[*node.hash]; exists {
+			continue
+		}
+		if _, exists := sm.pendingBlocks[*node.hash]; exists {
+			continue
+		}
 
 		iv := wire.NewInvVect(wire.InvTypeBlock, node.hash)
 		haveInv, err := sm.haveInventory(iv)
@@ -929,34 +1149,126 @@ func (sm *SyncManager) fetchHeaderBlocks() {
 				"existing inventory during header block "+
 				"fetch: %v", err)
 		}
-		if !haveInv {
-			syncPeerState := sm.peerStates[sm.syncPeer]
+		if haveInv {
+			continue
+		}
 
-			sm.requestedBlocks[*node.hash] = struct{}{}
-			syncPeerState.requestedBlocks[*node.hash] = struct{}{}
+		// Assign the block to the peer with the fewest blocks in
+		// flight that has it.  When there is none, either all the
+		// peers are busy or none has the block, and so the following
+		// ones.
+		var peer *peerpkg.Peer
+		var state *peerSyncState
+		for _, p := range peers {
+			pState := sm.peerStates[p]
+			if len(pState.blocksInFlight) >= maxBlocksInFlightPerPeer ||
+				p.LastBlock() < node.height {
 
-			// If we're fetching from a witness enabled peer
-			// post-fork, then ensure that we receive all the
-			// witness data in the blocks.
-			if sm.syncPeer.IsWitnessEnabled() {
-				iv.Type = wire.InvTypeWitnessBlock
+				continue
 			}
+			if state == nil ||
+				len(pState.blocksInFlight) < len(state.blocksInFlight) {
 
-			gdmsg.AddInvVect(iv)
-			numRequested++
+				peer, state = p, pState
+			}
 		}
-		sm.startHeader = e.Next()
-		if numRequested >= wire.MaxInvPerMsg {
+		if peer == nil {
 			break
 		}
+
+		sm.requestedBlocks[*node.hash] = struct{}{}
+		state.requestedBlocks[*node.hash] = struct{}{}
+		state.blocksInFlight[*node.hash] = struct{}{}
+		sm.blocksInFlight[*node.hash] = &blockInFlight{
+			peer:      peer,
+			height:    node.height,
+			requested: now,
+		}
+
+		// If we're fetching from a witness enabled peer
+		// post-fork, then ensure that we receive all the
+		// witness data in the blocks.
+		if peer.IsWitnessEnabled() {
+			iv.Type = wire.InvTypeWitnessBlock
+		}
+
+		gdmsg, exists := requests[peer]
+		if !exists {
+			gdmsg = wire.NewMsgGetDataSizeHint(maxBlocksInFlightPerPeer)
+			requests[peer] = gdmsg
+		}
+		gdmsg.AddInvVect(iv)
 	}
-	if len(gdmsg.InvList) > 0 {
-		sm.syncPeer.QueueMessage(gdmsg, nil)
+	for peer, gdmsg := range requests {
+		peer.QueueMessage(gdmsg, nil)
+	}
+}
+
+// handleBlockStallSample reassigns the blocks requested from a peer that
+// stalls the download of the header list by not delivering the next block to
+// process in time, so the download window can move on, and disconnects the
+// peer.  The sync peer is kept since it also serves the header chain, and is
+// replaced by handleStallSample when the sync makes no progress.
+func (sm *SyncManager) handleBlockStallSample() {
+	if atomic.LoadInt32(&sm.shutdown) != 0 || !sm.fetchingBlocks {
+		return
+	}
+
+	firstNodeEl := sm.headerList.Front()
+	if firstNodeEl == nil {
+		return
+	}
+	firstNode := firstNodeEl.Value.(*headerNode)
+	inFlight, exists := sm.blocksInFlight[*firstNode.hash]
+	if !exists {
+		return
+	}
+
+	// The peer is given the stall timeout from the time the block became
+	// the next one to process, since it may have been requested well
+	// before.
+	since := inFlight.requested
+	if sm.windowStartTime.After(since) {
+		since = sm.windowStartTime
+	}
+	if time.Since(since) <= blockStallTimeout {
+		return
+	}
+
+	// Keep waiting when there is no other peer to download from.
+	peers := sm.blockDownloadPeers()
+	if len(peers) == 1 && peers[0] == inFlight.peer {
+		return
+	}
+
+	state, exists := sm.peerStates[inFlight.peer]
+	if !exists {
+		return
+	}
+	log.Infof("Peer %s is stalling the block download at height %d -- "+
+		"requesting its %d blocks from other peers", inFlight.peer,
+		firstNode.height, len(state.blocksInFlight))
+
+	// The blocks stay in the requested blocks of the peer so they are
+	// still accepted if it delivers them later on.
+	for blockHash := range state.blocksInFlight {
+		delete(sm.blocksInFlight, blockHash)
+	}
+	state.blocksInFlight = make(map[chainhash.Hash]struct{})
+	state.stalling = true
+	sm.fetchHeaderBlocks()
+
+	if inFlight.peer != sm.syncPeer {
+		log.Infof("Disconnecting stalling peer %s", inFlight.peer)
+		inFlight.peer.Disconnect()
 	}
 }
 
 // handleHeadersMsg handles block header messages from all peers.  Headers are
-// requested when performing a headers-first sync.
+// requested from the sync peer when performing a headers-first sync.  The
+// header chain of the sync peer is only stored in the block index once it's
+// known to have enough work, and the sync peer is disconnected when it
+// doesn't.
 func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	peer := hmsg.peer
 	_, exists := sm.peerStates[peer]
@@ -975,92 +1287,106 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		return
 	}
 
-	// Nothing to do for an empty headers message.
-	if numHeaders == 0 {
+	// Headers are only requested from the sync peer, so the headers
+	// announced by other peers are ignored.
+	if peer != sm.syncPeer || sm.headersSynced {
+		log.Debugf("Ignoring %d headers from %s", numHeaders, peer)
 		return
 	}
 
-	// Process all of the received headers ensuring each one connects to the
-	// previous and that checkpoints match.
-	receivedCheckpoint := false
-	var finalHash *chainhash.Hash
-	for _, blockHeader := range msg.Headers {
-		blockHash := blockHeader.BlockHash()
-		finalHash = &blockHash
-
-		// Ensure there is a previous header to compare against.
-		prevNodeEl := sm.headerList.Back()
-		if prevNodeEl == nil {
-			log.Warnf("Header list does not contain a previous" +
-				"element as expected -- disconnecting peer")
-			peer.Disconnect()
+	// The header chain of the peer starts after the block of the previous
+	// header of the first one, which must be known.  An empty message
+	// means the peer has no blocks after the tip.
+	if sm.headerSync == nil {
+		if numHeaders == 0 {
+			sm.handleHeadersSynced()
 			return
 		}
-
-		// Ensure the header properly connects to the previous one and
-		// add it to the list of headers.
-		node := headerNode{hash: &blockHash}
-		prevNode := prevNodeEl.Value.(*headerNode)
-		if prevNode.hash.IsEqual(&blockHeader.PrevBlock) {
-			node.height = prevNode.height + 1
-			e := sm.headerList.PushBack(&node)
-			if sm.startHeader == nil {
-				sm.startHeader = e
-			}
-		} else {
-			log.Warnf("Received block header that does not "+
-				"properly connect to the chain from peer %s "+
-				"-- disconnecting", peer.Addr())
+		hs, err := newHeaderSync(sm.chain, &msg.Headers[0].PrevBlock)
+		if err != nil {
+			log.Warnf("Received headers from peer %s that can't "+
+				"be synced: %v -- disconnecting", peer.Addr(), err)
 			peer.Disconnect()
 			return
 		}
+		sm.headerSync = hs
+	}
 
-		// Verify the header at the next checkpoint height matches.
-		if node.height == sm.nextCheckpoint.Height {
-			if node.hash.IsEqual(sm.nextCheckpoint.Hash) {
-				receivedCheckpoint = true
-				log.Infof("Verified downloaded block "+
-					"header against checkpoint at height "+
-					"%d/hash %s", node.height, node.hash)
-			} else {
-				log.Warnf("Block header at height %d/hash "+
-					"%s from peer %s does NOT match "+
-					"expected checkpoint hash of %s -- "+
-					"disconnecting", node.height,
-					node.hash, peer.Addr(),
-					sm.nextCheckpoint.Hash)
-				peer.Disconnect()
-				return
+	hs := sm.headerSync
+	wasPresync := hs.phase == headerPresync
+	full := numHeaders == wire.MaxBlockHeadersPerMsg
+	headers, err := hs.processHeaders(msg.Headers, full)
+	if err != nil {
+		log.Warnf("Rejected the header chain of peer %s: %v -- "+
+			"disconnecting", peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+	sm.lastProgressTime = time.Now()
+	if wasPresync && hs.phase == headerRedownload {
+		log.Infof("Header chain of peer %s has enough work at height "+
+			"%d -- downloading the headers again to store them",
+			peer.Addr(), hs.presyncHeight)
+	}
+
+	// Store the headers proven to be part of a chain with enough work and
+	// fetch their blocks.
+	err = sm.chain.ProcessBlockHeaders(headers, blockchain.BFNone)
+	if err != nil {
+		log.Warnf("Rejected block headers from peer %s: %v -- "+
+			"disconnecting", peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+	if len(headers) > 0 {
+		lastHeight := hs.redownloadNext - 1
+		firstHeight := lastHeight - int32(len(headers)) + 1
+		for i, header := range headers {
+			blockHash := header.BlockHash()
+			node := headerNode{
+				height: firstHeight + int32(i),
+				hash:   &blockHash,
 			}
-			break
+			sm.headerList.PushBack(&node)
 		}
-	}
+		if peer.LastBlock() < lastHeight {
+			peer.UpdateLastBlockHeight(lastHeight)
+		}
+		log.Debugf("Stored %d block headers up to height %d from "+
+			"peer %s", len(headers), lastHeight, peer.Addr())
 
-	// When this header is a checkpoint, switch to fetching the blocks for
-	// all of the headers since the last checkpoint.
-	if receivedCheckpoint {
-		// Since the first entry of the list is always the final block
-		// that is already in the database and is only used to ensure
-		// the next header links properly, it must be removed before
-		// fetching the blocks.
-		sm.headerList.Remove(sm.headerList.Front())
-		log.Infof("Received %v block headers: Fetching blocks",
-			sm.headerList.Len())
-		sm.progressLogger.SetLastLogTime(time.Now())
+		if !sm.fetchingBlocks {
+			sm.progressLogger.SetLastLogTime(time.Now())
+			sm.fetchingBlocks = true
+			sm.windowStartTime = time.Now()
+		}
 		sm.fetchHeaderBlocks()
-		return
 	}
 
-	// This header is not a checkpoint, so request the next batch of
-	// headers starting from the latest known header and ending with the
-	// next checkpoint.
-	locator := blockchain.BlockLocator([]*chainhash.Hash{finalHash})
-	err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-	if err != nil {
-		log.Warnf("Failed to send getheaders message to "+
-			"peer %s: %v", peer.Addr(), err)
+	if hs.done {
+		sm.handleHeadersSynced()
 		return
 	}
+
+	// Request the next batch of headers.  The message is queued directly
+	// since the request restarting the download from the fork for the
+	// redownload phase may be the same as the first one, which the peer
+	// would filter as a duplicate.
+	peer.QueueMessage(hs.nextRequest(), nil)
+}
+
+// handleHeadersSynced is invoked once the sync peer sent its whole header
+// chain.  Headers-first mode ends right away when there are no blocks left to
+// download.
+func (sm *SyncManager) handleHeadersSynced() {
+	bestHash, bestHeight := sm.chain.BestHeader()
+	log.Infof("Synced the headers up to block %v (height %d) from peer %s",
+		bestHash, bestHeight, sm.syncPeer.Addr())
+	sm.headerSync = nil
+	sm.headersSynced = true
+	if sm.headerList.Len() == 0 {
+		sm.finishHeadersFirst()
+	}
 }
 
 // handleNotFoundMsg handles notfound messages from all peers.
@@ -1071,6 +1397,7 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 		log.Warnf("Received notfound message from unknown peer %s", peer)
 		return
 	}
+	fetchHeaderBlocks := false
 	for _, inv := range nfmsg.notFound.InvList {
 		// verify the hash was actually announced by the peer
 		// before deleting from the global requested maps.
@@ -1083,6 +1410,14 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 				delete(sm.requestedBlocks, inv.Hash)
 			}
 
+			// Request the blocks of the header list from another
+			// peer.
+			if _, exists := state.blocksInFlight[inv.Hash]; exists {
+				delete(state.blocksInFlight, inv.Hash)
+				delete(sm.blocksInFlight, inv.Hash)
+				fetchHeaderBlocks = true
+			}
+
 		case wire.InvTypeWitnessTx:
 			fallthrough
 		case wire.InvTypeTx:
@@ -1092,6 +1427,9 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 			}
 		}
 	}
+	if fetchHeaderBlocks {
+		sm.fetchHeaderBlocks()
+	}
 }
 
 // haveInventory returns whether or not the inventory represented by the passed
@@ -1352,6 +1690,8 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 func (sm *SyncManager) blockHandler() {
 	stallTicker := time.NewTicker(stallSampleInterval)
 	defer stallTicker.Stop()
+	blockStallTicker := time.NewTicker(blockStallSampleInterval)
+	defer blockStallTicker.Stop()
 
 out:
 	for {
@@ -1410,6 +1750,9 @@ out:
 				// Wait until the sender unpauses the manager.
 				<-msg.unpause
 
+			case backgroundSyncMsg:
+				sm.handleBackgroundSyncMsg(msg)
+
 			default:
 				log.Warnf("Invalid message type in block "+
 					"handler: %T", msg)
@@ -1418,6 +1761,10 @@ out:
 		case <-stallTicker.C:
 			sm.handleStallSample()
 
+		case <-blockStallTicker.C:
+			sm.handleBlockStallSample()
+			sm.handleBackgroundStallSample()
+
 		case <-sm.quit:
 			break out
 		}
@@ -1432,6 +1779,33 @@ out:
 	log.Trace("Block handler done")
 }
 
+// utxoFlushHandler writes the dirty entries of the UTXO cache to the database
+// in the background, when the chain signals there are enough of them and
+// periodically, so blocks are not connected while a large cache is flushed.  It
+// must be run as a goroutine.
+func (sm *SyncManager) utxoFlushHandler() {
+	ticker := time.NewTicker(utxoFlushSampleInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-sm.chain.UtxoFlushSignal():
+		case <-ticker.C:
+		case <-sm.quit:
+			break out
+		}
+
+		if err := sm.chain.FlushDirtyUtxos(sm.quit); err != nil {
+			log.Errorf("Error while flushing the blockchain cache: %v",
+				err)
+		}
+	}
+
+	sm.wg.Done()
+	log.Trace("UTXO flush handler done")
+}
+
 // handleBlockchainNotification handles notifications from blockchain.  It does
 // things such as request orphan block parents and relay accepted blocks to
 // connected peers.
@@ -1539,16 +1913,20 @@ func (sm *SyncManager) NewPeer(peer *peerpkg.Peer) {
 }
 
 // QueueTx adds the passed transaction message and peer to the block handling
-// queue. Responds to the done channel argument after the tx message is
-// processed.
-func (sm *SyncManager) QueueTx(tx *chainutil.Tx, peer *peerpkg.Peer, done chan struct{}) {
+// queue. The limitFree flag indicates whether free transactions from the peer
+// are rate limited. Responds to the done channel argument after the tx message
+// is processed.
+func (sm *SyncManager) QueueTx(tx *chainutil.Tx, peer *peerpkg.Peer,
+	limitFree bool, done chan struct{}) {
+
 	// Don't accept more transactions if we're shutting down.
 	if atomic.LoadInt32(&sm.shutdown) != 0 {
 		done <- struct{}{}
 		return
 	}
 
-	sm.msgChan <- &txMsg{tx: tx, peer: peer, reply: done}
+	sm.msgChan <- &txMsg{tx: tx, peer: peer, limitFree: limitFree,
+		reply: done}
 }
 
 // QueueBlock adds the passed block message and peer to the block handling
@@ -1617,8 +1995,9 @@ func (sm *SyncManager) Start() {
 	}
 
 	log.Trace("Starting sync manager")
-	sm.wg.Add(1)
+	sm.wg.Add(2)
 	go sm.blockHandler()
+	go sm.utxoFlushHandler()
 }
 
 // Stop gracefully shuts down the sync manager by stopping all asynchronous
@@ -1685,18 +2064,13 @@ func New(config *Config) (*SyncManager, error) {
 		progressLogger:  newBlockProgressLogger("Processed", log),
 		msgChan:         make(chan interface{}, config.MaxPeers*3),
 		headerList:      list.New(),
+		blocksInFlight:  make(map[chainhash.Hash]*blockInFlight),
+		pendingBlocks:   make(map[chainhash.Hash]*blockMsg),
 		quit:            make(chan struct{}),
 		feeEstimator:    config.FeeEstimator,
 	}
 
-	best := sm.chain.BestSnapshot()
-	if !config.DisableCheckpoints {
-		// Initialize the next checkpoint based on the current height.
-		sm.nextCheckpoint = sm.findNextHeaderCheckpoint(best.Height)
-		if sm.nextCheckpoint != nil {
-			sm.resetHeaderState(&best.Hash, best.Height)
-		}
-	} else {
+	if config.DisableCheckpoints {
 		log.Info("Checkpoints are disabled")
 	}
 
@@ -0,0 +1,276 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"container/list"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg"
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+	peerpkg "github.com/flokiorg/go-flokicoin/peer"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// blockDownloadTest holds a sync manager fetching the blocks of a header list
+// from several peers.
+type blockDownloadTest struct {
+	sm      *SyncManager
+	headers []*wire.BlockHeader
+	peers   []*peerpkg.Peer
+}
+
+// newBlockDownloadTest returns a sync manager fetching the blocks of a header
+// list of the passed number of headers from the passed number of outbound
+// peers having them all.  The first peer is the sync peer.
+func newBlockDownloadTest(t *testing.T, numHeaders, numPeers int) *blockDownloadTest {
+	t.Helper()
+
+	DisableLog()
+	sm := &SyncManager{
+		chain:           newTestChain(t),
+		chainParams:     &chaincfg.RegressionNetParams,
+		requestedBlocks: make(map[chainhash.Hash]struct{}),
+		peerStates:      make(map[*peerpkg.Peer]*peerSyncState),
+		headerList:      list.New(),
+		fetchingBlocks:  true,
+		blocksInFlight:  make(map[chainhash.Hash]*blockInFlight),
+		pendingBlocks:   make(map[chainhash.Hash]*blockMsg),
+		windowStartTime: time.Now(),
+	}
+
+	headers := testHeaders(t, numHeaders, 1)
+	for i, header := range headers {
+		hash := header.BlockHash()
+		sm.headerList.PushBack(&headerNode{
+			height: int32(i + 1),
+			hash:   &hash,
+		})
+	}
+
+	peers := make([]*peerpkg.Peer, numPeers)
+	for i := range peers {
+		peer, err := peerpkg.NewOutboundPeer(&peerpkg.Config{
+			ChainParams: &chaincfg.RegressionNetParams,
+		}, fmt.Sprintf("10.0.0.%d:15212", i+1))
+		if err != nil {
+			t.Fatalf("unable to create peer: %v", err)
+		}
+		peer.UpdateLastBlockHeight(int32(numHeaders))
+		sm.peerStates[peer] = &peerSyncState{
+			syncCandidate:   true,
+			requestedTxns:   make(map[chainhash.Hash]struct{}),
+			requestedBlocks: make(map[chainhash.Hash]struct{}),
+			blocksInFlight:  make(map[chainhash.Hash]struct{}),
+		}
+		peers[i] = peer
+	}
+	sm.syncPeer = peers[0]
+
+	return &blockDownloadTest{sm: sm, headers: headers, peers: peers}
+}
+
+// hash returns the hash of the block at the passed height.
+func (bt *blockDownloadTest) hash(height int) chainhash.Hash {
+	return bt.headers[height-1].BlockHash()
+}
+
+// deliver delivers the block at the passed height from the passed peer and
+// returns whether it was held until the blocks before it are processed.
+func (bt *blockDownloadTest) deliver(height int, peer *peerpkg.Peer) bool {
+	block := chainutil.NewBlock(&wire.MsgBlock{
+		Header: *bt.headers[height-1],
+	})
+	state := bt.sm.peerStates[peer]
+	delete(state.requestedBlocks, *block.Hash())
+	delete(bt.sm.requestedBlocks, *block.Hash())
+	return bt.sm.queueHeaderBlock(&blockMsg{block: block, peer: peer}, state)
+}
+
+// inFlightPeer returns the peer the block at the passed height is requested
+// from, or nil when it is not in flight.
+func (bt *blockDownloadTest) inFlightPeer(height int) *peerpkg.Peer {
+	inFlight, ok := bt.sm.blocksInFlight[bt.hash(height)]
+	if !ok {
+		return nil
+	}
+	return inFlight.peer
+}
+
+// disconnected returns whether the passed peer was disconnected.
+func disconnected(peer *peerpkg.Peer) bool {
+	done := make(chan struct{})
+	go func() {
+		peer.WaitForDisconnect()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(50 * time.Millisecond):
+		return false
+	}
+}
+
+// TestFetchHeaderBlocks ensures the blocks of the header list are spread
+// across the peers, up to the max number of blocks in flight per peer and
+// within the download window.
+func TestFetchHeaderBlocks(t *testing.T) {
+	bt := newBlockDownloadTest(t, 40, 2)
+	sm := bt.sm
+	sm.fetchHeaderBlocks()
+
+	// Both peers are given as many blocks as they can take, which leaves
+	// the last blocks unrequested.
+	for _, peer := range bt.peers {
+		if n := len(sm.peerStates[peer].blocksInFlight); n != maxBlocksInFlightPerPeer {
+			t.Fatalf("%s has %d blocks in flight, want %d", peer, n,
+				maxBlocksInFlightPerPeer)
+		}
+	}
+	for height := 1; height <= 40; height++ {
+		requested := bt.inFlightPeer(height) != nil
+		if want := height <= 2*maxBlocksInFlightPerPeer; requested != want {
+			t.Fatalf("block %d requested: %v, want %v", height,
+				requested, want)
+		}
+	}
+
+	// A delivered block frees a slot for the next block, which goes to
+	// the peer with the fewest blocks in flight.
+	peer := bt.inFlightPeer(1)
+	if !bt.deliver(1, peer) {
+		t.Fatal("block 1 not held")
+	}
+	sm.fetchHeaderBlocks()
+	next := 2*maxBlocksInFlightPerPeer + 1
+	if got := bt.inFlightPeer(next); got != peer {
+		t.Fatalf("block %d requested from %v, want %v", next, got, peer)
+	}
+
+	// The blocks past the download window are not requested.
+	bt = newBlockDownloadTest(t, 3, 1)
+	bt.sm.headerList.Back().Value.(*headerNode).height = blockDownloadWindow + 1
+	bt.sm.fetchHeaderBlocks()
+	if bt.inFlightPeer(2) == nil || bt.inFlightPeer(3) != nil {
+		t.Fatal("unexpected blocks requested around the window end")
+	}
+}
+
+// TestQueueHeaderBlock ensures the blocks of the header list are held until
+// the blocks before them are processed whatever the order they are delivered
+// in, including when they are delivered late by a peer that stalled, and that
+// the blocks delivered twice are dropped.
+func TestQueueHeaderBlock(t *testing.T) {
+	bt := newBlockDownloadTest(t, 10, 2)
+	sm := bt.sm
+	sm.fetchHeaderBlocks()
+
+	// The blocks delivered out of order are all held.
+	for _, height := range []int{3, 1, 2} {
+		peer := bt.inFlightPeer(height)
+		if !bt.deliver(height, peer) {
+			t.Fatalf("block %d not held", height)
+		}
+		if bt.inFlightPeer(height) != nil {
+			t.Fatalf("block %d still in flight", height)
+		}
+		if _, ok := sm.pendingBlocks[bt.hash(height)]; !ok {
+			t.Fatalf("block %d not pending", height)
+		}
+	}
+
+	// A copy of a block that is already held is dropped.
+	pending := sm.pendingBlocks[bt.hash(1)]
+	if !bt.deliver(1, bt.peers[1]) || sm.pendingBlocks[bt.hash(1)] != pending {
+		t.Fatal("copy of block 1 not dropped")
+	}
+
+	// A block delivered late by a stalling peer, before it's requested
+	// again, is held as well instead of being processed out of order.
+	peer := bt.inFlightPeer(4)
+	state := sm.peerStates[peer]
+	for hash := range state.blocksInFlight {
+		delete(sm.blocksInFlight, hash)
+	}
+	state.blocksInFlight = make(map[chainhash.Hash]struct{})
+	state.stalling = true
+	if !bt.deliver(4, peer) {
+		t.Fatal("late block 4 not held")
+	}
+	if _, ok := sm.pendingBlocks[bt.hash(4)]; !ok || state.stalling {
+		t.Fatal("late block 4 not pending")
+	}
+
+	// The blocks that are not part of the header list are processed
+	// right away.
+	other := chainutil.NewBlock(&wire.MsgBlock{
+		Header: *testHeaders(t, 1, 2)[0],
+	})
+	if sm.queueHeaderBlock(&blockMsg{block: other, peer: peer}, state) {
+		t.Fatal("block outside of the header list held")
+	}
+}
+
+// TestHandleBlockStallSample ensures the blocks requested from a peer that
+// doesn't deliver the next block to process in time are reassigned to other
+// peers and that the peer is disconnected, unless it is the sync peer.
+func TestHandleBlockStallSample(t *testing.T) {
+	bt := newBlockDownloadTest(t, 10, 3)
+	sm := bt.sm
+	sm.fetchHeaderBlocks()
+
+	// The next block to process is requested from a peer other than the
+	// sync peer.
+	stalling := bt.inFlightPeer(1)
+	if stalling == sm.syncPeer {
+		sm.syncPeer = bt.inFlightPeer(2)
+	}
+	var stallingBlocks []chainhash.Hash
+	for hash := range sm.peerStates[stalling].blocksInFlight {
+		stallingBlocks = append(stallingBlocks, hash)
+	}
+
+	// Nothing happens before the stall timeout.
+	sm.handleBlockStallSample()
+	if bt.inFlightPeer(1) != stalling {
+		t.Fatal("block 1 reassigned before the stall timeout")
+	}
+
+	// The blocks of the peer are reassigned once it expired.
+	sm.blocksInFlight[bt.hash(1)].requested = time.Now().Add(
+		-2 * blockStallTimeout)
+	sm.windowStartTime = time.Now().Add(-2 * blockStallTimeout)
+	sm.handleBlockStallSample()
+	state := sm.peerStates[stalling]
+	if !state.stalling || len(state.blocksInFlight) != 0 {
+		t.Fatal("stalling peer not marked as such")
+	}
+	for _, hash := range stallingBlocks {
+		inFlight, ok := sm.blocksInFlight[hash]
+		if !ok || inFlight.peer == stalling {
+			t.Fatalf("block %v not reassigned", hash)
+		}
+	}
+	if !disconnected(stalling) {
+		t.Fatal("stalling peer not disconnected")
+	}
+
+	// The sync peer is not disconnected when it stalls.
+	syncPeer := bt.inFlightPeer(1)
+	sm.syncPeer = syncPeer
+	sm.blocksInFlight[bt.hash(1)].requested = time.Now().Add(
+		-2 * blockStallTimeout)
+	sm.handleBlockStallSample()
+	if !sm.peerStates[syncPeer].stalling {
+		t.Fatal("stalling sync peer not marked as such")
+	}
+	if disconnected(syncPeer) {
+		t.Fatal("stalling sync peer disconnected")
+	}
+}
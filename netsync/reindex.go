@@ -0,0 +1,116 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/flokiorg/go-flokicoin/blockchain"
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+)
+
+// maxPendingImportBlocks is the max number of blocks held while importing
+// blocks until their parent is imported.  Blocks are stored slightly out of
+// order when they are downloaded from several peers, within the block download
+// window.
+const maxPendingImportBlocks = 4 * blockDownloadWindow
+
+// ImportBlocks processes the blocks the passed scan function gives to the
+// function it's called with, such as the blocks read from the block files of a
+// database being reindexed.  The blocks are fully validated and the blocks
+// received before their parent are held until their parent is processed.  An
+// error is returned when some blocks could not be processed because their
+// parent is missing.
+//
+// It must be called before the sync manager is started.
+func (sm *SyncManager) ImportBlocks(scan func(importBlock func(*chainutil.Block) error) error) error {
+	atomic.StoreInt32(&sm.reindexing, 1)
+	defer atomic.StoreInt32(&sm.reindexing, 0)
+
+	progressLogger := newBlockProgressLogger("Reindexed", log)
+	pendingBlocks := make(map[chainhash.Hash][]*chainutil.Block)
+	var numPending, numDropped int
+
+	processBlock := func(block *chainutil.Block) error {
+		_, _, err := sm.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			// The blocks already in the chain are skipped, which
+			// is the case of the blocks imported before an
+			// interrupted import is resumed.
+			ruleErr, ok := err.(blockchain.RuleError)
+			if !ok {
+				return err
+			}
+			if ruleErr.ErrorCode != blockchain.ErrDuplicateBlock {
+				log.Warnf("Rejected block %v: %v", block.Hash(),
+					err)
+			}
+			return nil
+		}
+		progressLogger.LogBlockHeight(block, sm.chain)
+		return nil
+	}
+
+	importBlock := func(block *chainutil.Block) error {
+		prevHash := &block.MsgBlock().Header.PrevBlock
+		haveParent, err := sm.chain.HaveBlock(prevHash)
+		if err != nil {
+			return err
+		}
+		if !haveParent && !block.Hash().IsEqual(sm.chainParams.GenesisHash) {
+			if numPending >= maxPendingImportBlocks {
+				numDropped++
+				return nil
+			}
+			pendingBlocks[*prevHash] = append(pendingBlocks[*prevHash],
+				block)
+			numPending++
+			return nil
+		}
+
+		// Process the block and then the blocks that were waiting for
+		// it, recursively.
+		queue := []*chainutil.Block{block}
+		for len(queue) > 0 {
+			block := queue[0]
+			queue = queue[1:]
+			if err := processBlock(block); err != nil {
+				return err
+			}
+
+			children := pendingBlocks[*block.Hash()]
+			delete(pendingBlocks, *block.Hash())
+			numPending -= len(children)
+			queue = append(queue, children...)
+		}
+		return nil
+	}
+
+	if err := scan(importBlock); err != nil {
+		return err
+	}
+	if numPending+numDropped > 0 {
+		return fmt.Errorf("unable to reindex %d blocks whose parent is "+
+			"missing", numPending+numDropped)
+	}
+	return nil
+}
+
+// ReplayBlocks connects the blocks stored in the database that have more work
+// than the tip of the chain, after its chain state was reset, with their
+// progress logged like the blocks received from peers.
+//
+// It must be called before the sync manager is started.
+func (sm *SyncManager) ReplayBlocks(interrupt <-chan struct{}) error {
+	atomic.StoreInt32(&sm.reindexing, 1)
+	defer atomic.StoreInt32(&sm.reindexing, 0)
+
+	progressLogger := newBlockProgressLogger("Replayed", log)
+	return sm.chain.ReplayBlocks(interrupt, func(block *chainutil.Block) {
+		progressLogger.LogBlockHeight(block, sm.chain)
+	})
+}
@@ -6,6 +6,9 @@
 package main
 
 import (
+	"math"
+	"strconv"
+
 	"github.com/flokiorg/go-flokicoin/chaincfg"
 	"github.com/flokiorg/go-flokicoin/wire"
 )
@@ -77,6 +80,22 @@ var sigNetParams = params{
 	rpcPort: "55213",
 }
 
+// newCustomNetParams returns the parameters for a network loaded from a chain
+// parameters file.  The RPC port is the port following the network's default
+// peer port, which matches the convention used by the standard networks.
+func newCustomNetParams(chainParams *chaincfg.Params) *params {
+	rpcPort := chainParams.DefaultPort
+	if port, err := strconv.ParseUint(rpcPort, 10, 16); err == nil &&
+		port < math.MaxUint16 {
+
+		rpcPort = strconv.FormatUint(port+1, 10)
+	}
+	return &params{
+		Params:  chainParams,
+		rpcPort: rpcPort,
+	}
+}
+
 // netName returns the name used when referring to a flokicoin network.  At the
 // time of writing, lokid currently places blocks for testnet version 3 in the
 // data and log directory "testnet", which does not match the Name field of the
@@ -40,6 +40,10 @@ const (
 	// connected peer may support.
 	MinAcceptableProtocolVersion = wire.MultipleAddressVersion
 
+	// TxReconciliationVersion is the version of the transaction
+	// reconciliation protocol (BIP330) the peer supports.
+	TxReconciliationVersion = 1
+
 	// outputBufferSize is the number of elements the output channels use.
 	outputBufferSize = 50
 
@@ -204,6 +208,18 @@ type MessageListeners struct {
 	// OnSendAddrV2 is invoked when a peer receives a sendaddrv2 message.
 	OnSendAddrV2 func(p *Peer, msg *wire.MsgSendAddrV2)
 
+	// OnReqRecon is invoked when a peer that negotiated transaction
+	// reconciliation receives a reqrecon flokicoin message.
+	OnReqRecon func(p *Peer, msg *wire.MsgReqRecon)
+
+	// OnSketch is invoked when a peer that negotiated transaction
+	// reconciliation receives a sketch flokicoin message.
+	OnSketch func(p *Peer, msg *wire.MsgSketch)
+
+	// OnReconcilDiff is invoked when a peer that negotiated transaction
+	// reconciliation receives a reconcildiff flokicoin message.
+	OnReconcilDiff func(p *Peer, msg *wire.MsgReconcilDiff)
+
 	// OnRead is invoked when a peer receives a flokicoin message.  It
 	// consists of the number of bytes read, the message, and whether or not
 	// an error in the read occurred.  Typically, callers will opt to use
@@ -218,6 +234,17 @@ type MessageListeners struct {
 	// not an error in the write occurred.  This can be useful for
 	// circumstances such as keeping track of server-wide byte counts.
 	OnWrite func(p *Peer, bytesWritten int, msg wire.Message, err error)
+
+	// OnReadRaw is invoked with the raw bytes of each flokicoin message
+	// read from a peer, header included, as they were received.  It is
+	// also invoked for the messages that failed to be read or decoded,
+	// with the bytes read up to the failure.  This can be useful for
+	// circumstances such as capturing the traffic of peers.
+	OnReadRaw func(p *Peer, raw []byte)
+
+	// OnWriteRaw is invoked with the raw bytes of each flokicoin message
+	// written to a peer, header included, as they were sent.
+	OnWriteRaw func(p *Peer, raw []byte)
 }
 
 // Config is the struct to hold configuration options useful to Peer.
@@ -271,6 +298,19 @@ type Config struct {
 	// not send inv messages for transactions.
 	DisableRelayTx bool
 
+	// BlockRelayOnly specifies the connection is only used to relay
+	// blocks.  Transactions are neither requested from the remote peer,
+	// as with DisableRelayTx, nor relayed to it, and addresses are neither
+	// sent to nor accepted from it.  This makes the connection harder to
+	// discover through the transactions and addresses it relays.
+	BlockRelayOnly bool
+
+	// TxReconciliation specifies whether transaction relay through set
+	// reconciliation (BIP330) is offered to the remote peer during the
+	// handshake.  It is only offered when transactions are relayed in both
+	// directions.
+	TxReconciliation bool
+
 	// Listeners houses callback functions to be invoked on receiving peer
 	// messages.
 	Listeners MessageListeners
@@ -463,6 +503,11 @@ type Peer struct {
 	verAckReceived       bool
 	witnessEnabled       bool
 	sendAddrV2           bool
+	remoteRelayTx        bool   // peer asked for transaction relay
+	txReconLocalSalt     uint64 // salt sent in our sendtxrcncl
+	txReconRemoteSalt    uint64 // salt received in their sendtxrcncl
+	txReconRecvd         bool   // peer sent a sendtxrcncl message
+	txReconciliation     bool   // transaction reconciliation negotiated
 
 	wireEncoding wire.MessageEncoding
 
@@ -485,6 +530,7 @@ type Peer struct {
 	lastPingNonce      uint64    // Set to nonce if we have a pending ping.
 	lastPingTime       time.Time // Time we sent last ping.
 	lastPingMicros     int64     // Time for last ping to return.
+	minPingMicros      int64     // Lowest time for a ping to return.
 
 	stallControl  chan stallControlMsg
 	outputQueue   chan outMsg
@@ -540,6 +586,14 @@ func (p *Peer) AddKnownInventory(invVect *wire.InvVect) {
 	p.knownInventory.Add(invVect)
 }
 
+// IsKnownInventory returns whether the passed inventory is in the cache of
+// known inventory for the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) IsKnownInventory(invVect *wire.InvVect) bool {
+	return p.knownInventory.Contains(invVect)
+}
+
 // StatsSnapshot returns a snapshot of the current peer flags and statistics.
 //
 // This function is safe for concurrent access.
@@ -683,6 +737,18 @@ func (p *Peer) LastPingMicros() int64 {
 	return lastPingMicros
 }
 
+// MinPingMicros returns the lowest ping micros of the remote peer, or 0 when
+// no ping has returned yet.
+//
+// This function is safe for concurrent access.
+func (p *Peer) MinPingMicros() int64 {
+	p.statsMtx.RLock()
+	minPingMicros := p.minPingMicros
+	p.statsMtx.RUnlock()
+
+	return minPingMicros
+}
+
 // VersionKnown returns the whether or not the version of a peer is known
 // locally.
 //
@@ -838,6 +904,25 @@ func (p *Peer) WantsAddrV2() bool {
 	return wantsAddrV2
 }
 
+// BlockRelayOnly returns whether the connection is only used to relay blocks.
+//
+// This function is safe for concurrent access.
+func (p *Peer) BlockRelayOnly() bool {
+	return p.cfg.BlockRelayOnly
+}
+
+// TxReconciliation returns the local and remote salts of the short transaction
+// ids used for transaction reconciliation (BIP330) with the peer, and whether
+// it was negotiated during the handshake.
+//
+// This function is safe for concurrent access.
+func (p *Peer) TxReconciliation() (uint64, uint64, bool) {
+	p.flagsMtx.Lock()
+	defer p.flagsMtx.Unlock()
+
+	return p.txReconLocalSalt, p.txReconRemoteSalt, p.txReconciliation
+}
+
 // PushAddrMsg sends an addr message to the connected peer using the provided
 // addresses.  This function is useful over manually sending the message via
 // QueueMessage since it automatically limits the addresses to the maximum
@@ -849,8 +934,9 @@ func (p *Peer) WantsAddrV2() bool {
 func (p *Peer) PushAddrMsg(addresses []*wire.NetAddress) ([]*wire.NetAddress, error) {
 	addressCount := len(addresses)
 
-	// Nothing to send.
-	if addressCount == 0 {
+	// Nothing to send.  Addresses are never sent over block-relay-only
+	// connections.
+	if addressCount == 0 || p.cfg.BlockRelayOnly {
 		return nil, nil
 	}
 
@@ -882,8 +968,9 @@ func (p *Peer) PushAddrV2Msg(addrs []*wire.NetAddressV2) (
 
 	count := len(addrs)
 
-	// Nothing to send.
-	if count == 0 {
+	// Nothing to send.  Addresses are never sent over block-relay-only
+	// connections.
+	if count == 0 || p.cfg.BlockRelayOnly {
 		return nil, nil
 	}
 
@@ -1061,6 +1148,9 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 			p.lastPingMicros = time.Since(p.lastPingTime).Nanoseconds()
 			p.lastPingMicros /= 1000 // convert to usec.
 			p.lastPingNonce = 0
+			if p.minPingMicros == 0 || p.lastPingMicros < p.minPingMicros {
+				p.minPingMicros = p.lastPingMicros
+			}
 		}
 		p.statsMtx.Unlock()
 	}
@@ -1068,9 +1158,20 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 
 // readMessage reads the next flokicoin message from the peer with logging.
 func (p *Peer) readMessage(encoding wire.MessageEncoding) (wire.Message, []byte, error) {
-	n, msg, buf, err := wire.ReadMessageWithEncodingN(p.conn,
+	// Keep a copy of the bytes read when they are requested.
+	var r io.Reader = p.conn
+	var raw *bytes.Buffer
+	if p.cfg.Listeners.OnReadRaw != nil {
+		raw = new(bytes.Buffer)
+		r = io.TeeReader(p.conn, raw)
+	}
+
+	n, msg, buf, err := wire.ReadMessageWithEncodingN(r,
 		p.ProtocolVersion(), p.cfg.ChainParams.Net, encoding)
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
+	if raw != nil && raw.Len() > 0 {
+		p.cfg.Listeners.OnReadRaw(p, raw.Bytes())
+	}
 	if p.cfg.Listeners.OnRead != nil {
 		p.cfg.Listeners.OnRead(p, n, msg, err)
 	}
@@ -1130,10 +1231,22 @@ func (p *Peer) writeMessage(msg wire.Message, enc wire.MessageEncoding) error {
 		return spew.Sdump(buf.Bytes())
 	}))
 
+	// Keep a copy of the bytes written when they are requested.  The
+	// copy only receives the bytes the connection accepted.
+	var w io.Writer = p.conn
+	var raw *bytes.Buffer
+	if p.cfg.Listeners.OnWriteRaw != nil {
+		raw = new(bytes.Buffer)
+		w = io.MultiWriter(p.conn, raw)
+	}
+
 	// Write the message to the peer.
-	n, err := wire.WriteMessageWithEncodingN(p.conn, msg,
+	n, err := wire.WriteMessageWithEncodingN(w, msg,
 		p.ProtocolVersion(), p.cfg.ChainParams.Net, enc)
 	atomic.AddUint64(&p.bytesSent, uint64(n))
+	if raw != nil && raw.Len() > 0 {
+		p.cfg.Listeners.OnWriteRaw(p, raw.Bytes())
+	}
 	if p.cfg.Listeners.OnWrite != nil {
 		p.cfg.Listeners.OnWrite(p, n, msg, err)
 	}
@@ -1467,25 +1580,60 @@ out:
 			)
 			break out
 
-		case *wire.MsgSendAddrV2:
+		case *wire.MsgSendAddrV2, *wire.MsgSendTxRcncl:
 			// Disconnect if peer sends this after the handshake is
 			// completed.
 			break out
 
-		case *wire.MsgGetAddr:
-			if p.cfg.Listeners.OnGetAddr != nil {
-				p.cfg.Listeners.OnGetAddr(p, msg)
+		case *wire.MsgReqRecon, *wire.MsgSketch, *wire.MsgReconcilDiff:
+			// Reconciliation messages are only expected from peers
+			// that negotiated it.
+			if _, _, ok := p.TxReconciliation(); !ok {
+				log.Debugf("Ignoring %s message from peer %v "+
+					"without transaction reconciliation",
+					msg.Command(), p)
+				break
 			}
 
-		case *wire.MsgAddr:
-			if p.cfg.Listeners.OnAddr != nil {
-				p.cfg.Listeners.OnAddr(p, msg)
+			switch msg := msg.(type) {
+			case *wire.MsgReqRecon:
+				if p.cfg.Listeners.OnReqRecon != nil {
+					p.cfg.Listeners.OnReqRecon(p, msg)
+				}
+			case *wire.MsgSketch:
+				if p.cfg.Listeners.OnSketch != nil {
+					p.cfg.Listeners.OnSketch(p, msg)
+				}
+			case *wire.MsgReconcilDiff:
+				if p.cfg.Listeners.OnReconcilDiff != nil {
+					p.cfg.Listeners.OnReconcilDiff(p, msg)
+				}
 			}
 
-		case *wire.MsgAddrV2:
+		case *wire.MsgGetAddr, *wire.MsgAddr, *wire.MsgAddrV2:
+			// Addresses are not exchanged over block-relay-only
+			// connections.
+			if p.cfg.BlockRelayOnly {
+				log.Debugf("Ignoring %s message from "+
+					"block-relay-only peer %v", msg.Command(), p)
+				break
+			}
+
+			switch msg := msg.(type) {
+			case *wire.MsgGetAddr:
+				if p.cfg.Listeners.OnGetAddr != nil {
+					p.cfg.Listeners.OnGetAddr(p, msg)
+				}
+
+			case *wire.MsgAddr:
+				if p.cfg.Listeners.OnAddr != nil {
+					p.cfg.Listeners.OnAddr(p, msg)
+				}
 
-			if p.cfg.Listeners.OnAddrV2 != nil {
-				p.cfg.Listeners.OnAddrV2(p, msg)
+			case *wire.MsgAddrV2:
+				if p.cfg.Listeners.OnAddrV2 != nil {
+					p.cfg.Listeners.OnAddrV2(p, msg)
+				}
 			}
 
 		case *wire.MsgPing:
@@ -2013,6 +2161,7 @@ func (p *Peer) readRemoteVersionMsg() error {
 	p.flagsMtx.Lock()
 	p.id = atomic.AddInt32(&nodeCount, 1)
 	p.userAgent = msg.UserAgent
+	p.remoteRelayTx = !msg.DisableRelayTx
 
 	// Determine if the peer would like to receive witness data with
 	// transactions, or not.
@@ -2085,9 +2234,9 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 
 	theirNA := p.na.ToLegacy()
 
-	// If p.na is a torv3 hidden service address, we'll need to send over
-	// an empty NetAddress for their address.
-	if p.na.IsTorV3() {
+	// If p.na is a torv3 hidden service, an i2p or a cjdns address, we'll
+	// need to send over an empty NetAddress for their address.
+	if p.na.ToLegacy() == nil {
 		theirNA = wire.NewNetAddressIPPort(
 			net.IP([]byte{0, 0, 0, 0}), p.na.Port, p.na.Services,
 		)
@@ -2136,7 +2285,7 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 	msg.ProtocolVersion = int32(p.cfg.ProtocolVersion)
 
 	// Advertise if inv messages for transactions are desired.
-	msg.DisableRelayTx = p.cfg.DisableRelayTx
+	msg.DisableRelayTx = p.cfg.DisableRelayTx || p.cfg.BlockRelayOnly
 
 	return msg, nil
 }
@@ -2163,6 +2312,36 @@ func (p *Peer) writeSendAddrV2Msg(pver uint32) error {
 	return p.writeMessage(sendAddrMsg, wire.LatestEncoding)
 }
 
+// writeSendTxRcnclMsg writes our sendtxrcncl message to the remote peer to
+// offer transaction reconciliation (BIP330) when it is enabled, the peer
+// supports protocol version 70016 and above, and transactions are relayed in
+// both directions.
+func (p *Peer) writeSendTxRcnclMsg(pver uint32) error {
+	if !p.cfg.TxReconciliation || pver < wire.AddrV2Version ||
+		p.cfg.DisableRelayTx || p.cfg.BlockRelayOnly {
+
+		return nil
+	}
+
+	p.flagsMtx.Lock()
+	remoteRelayTx := p.remoteRelayTx
+	p.flagsMtx.Unlock()
+	if !remoteRelayTx {
+		return nil
+	}
+
+	salt, err := wire.RandomUint64()
+	if err != nil {
+		return err
+	}
+	p.flagsMtx.Lock()
+	p.txReconLocalSalt = salt
+	p.flagsMtx.Unlock()
+
+	msg := wire.NewMsgSendTxRcncl(TxReconciliationVersion, salt)
+	return p.writeMessage(msg, wire.LatestEncoding)
+}
+
 // waitToFinishNegotiation waits until desired negotiation messages are
 // received, recording the remote peer's preference for sendaddrv2 as an
 // example. The list of negotiated features can be expanded in the future. If a
@@ -2192,6 +2371,24 @@ func (p *Peer) waitToFinishNegotiation(pver uint32) error {
 					p.cfg.Listeners.OnSendAddrV2(p, m)
 				}
 			}
+		case *wire.MsgSendTxRcncl:
+			p.flagsMtx.Lock()
+			if p.txReconRecvd {
+				p.flagsMtx.Unlock()
+				return wire.ErrInvalidHandshake
+			}
+			p.txReconRecvd = true
+
+			// Reconciliation is only used when both peers offered
+			// it.  Peers must support our version, which is the
+			// first one.
+			if p.txReconLocalSalt != 0 &&
+				m.Version >= TxReconciliationVersion {
+
+				p.txReconRemoteSalt = m.Salt
+				p.txReconciliation = true
+			}
+			p.flagsMtx.Unlock()
 		case *wire.MsgVerAck:
 			// Receiving a verack means we are done with the
 			// handshake.
@@ -2211,11 +2408,13 @@ func (p *Peer) waitToFinishNegotiation(pver uint32) error {
 //
 //  1. Remote peer sends their version.
 //  2. We send our version.
-//  3. We send sendaddrv2 if their version is >= 70016.
+//  3. We send sendaddrv2 if their version is >= 70016, along with
+//     sendtxrcncl when transaction reconciliation is offered.
 //  4. We send our verack.
-//  5. Wait until sendaddrv2 or verack is received. Unknown messages are
-//     skipped.
-//  6. If remote peer sent sendaddrv2 above, wait until receipt of verack.
+//  5. Wait until sendaddrv2, sendtxrcncl or verack is received. Unknown
+//     messages are skipped.
+//  6. If remote peer sent sendaddrv2 or sendtxrcncl above, wait until
+//     receipt of verack.
 func (p *Peer) negotiateInboundProtocol() error {
 	if err := p.readRemoteVersionMsg(); err != nil {
 		return err
@@ -2234,6 +2433,10 @@ func (p *Peer) negotiateInboundProtocol() error {
 		return err
 	}
 
+	if err := p.writeSendTxRcnclMsg(protoVersion); err != nil {
+		return err
+	}
+
 	err := p.writeMessage(wire.NewMsgVerAck(), wire.LatestEncoding)
 	if err != nil {
 		return err
@@ -2249,11 +2452,12 @@ func (p *Peer) negotiateInboundProtocol() error {
 //
 //  1. We send our version.
 //  2. Remote peer sends their version.
-//  3. We send sendaddrv2 if their version is >= 70016.
+//  3. We send sendaddrv2 if their version is >= 70016, along with
+//     sendtxrcncl when transaction reconciliation is offered.
 //  4. We send our verack.
-//  5. We wait to receive sendaddrv2 or verack, skipping unknown messages as
-//     in the inbound case.
-//  6. If sendaddrv2 was received, wait for receipt of verack.
+//  5. We wait to receive sendaddrv2, sendtxrcncl or verack, skipping unknown
+//     messages as in the inbound case.
+//  6. If sendaddrv2 or sendtxrcncl was received, wait for receipt of verack.
 func (p *Peer) negotiateOutboundProtocol() error {
 	if err := p.writeLocalVersionMsg(); err != nil {
 		return err
@@ -2272,6 +2476,10 @@ func (p *Peer) negotiateOutboundProtocol() error {
 		return err
 	}
 
+	if err := p.writeSendTxRcnclMsg(protoVersion); err != nil {
+		return err
+	}
+
 	err := p.writeMessage(wire.NewMsgVerAck(), wire.LatestEncoding)
 	if err != nil {
 		return err
@@ -2335,18 +2543,13 @@ func (p *Peer) AssociateConnection(conn net.Conn) {
 		// Set up a NetAddress for the peer to be used with AddrManager.  We
 		// only do this inbound because outbound set this up at connection time
 		// and no point recomputing.
-		na, err := newNetAddress(p.conn.RemoteAddr(), p.services)
+		na, err := p.inboundNetAddress()
 		if err != nil {
 			log.Errorf("Cannot create remote net address: %v", err)
 			p.Disconnect()
 			return
 		}
-
-		// Convert the NetAddress created above into NetAddressV2.
-		currentNa := wire.NetAddressV2FromBytes(
-			na.Timestamp, na.Services, na.IP, na.Port,
-		)
-		p.na = currentNa
+		p.na = na
 	}
 
 	go func() {
@@ -2357,6 +2560,36 @@ func (p *Peer) AssociateConnection(conn net.Conn) {
 	}()
 }
 
+// inboundNetAddress returns the address of the remote end of an inbound
+// connection.  Connections accepted over overlay networks such as I2P carry a
+// host name rather than an IP address, which is converted with the configured
+// HostToNetAddress function.
+func (p *Peer) inboundNetAddress() (*wire.NetAddressV2, error) {
+	remoteAddr := p.conn.RemoteAddr()
+	_, isTCP := remoteAddr.(*net.TCPAddr)
+	if !isTCP && p.cfg.HostToNetAddress != nil {
+		host, portStr, err := net.SplitHostPort(remoteAddr.String())
+		if err == nil && net.ParseIP(host) == nil {
+			port, err := strconv.ParseUint(portStr, 10, 16)
+			if err != nil {
+				return nil, err
+			}
+			return p.cfg.HostToNetAddress(host, uint16(port),
+				p.services)
+		}
+	}
+
+	na, err := newNetAddress(remoteAddr, p.services)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert the NetAddress created above into NetAddressV2.
+	return wire.NetAddressV2FromBytes(
+		na.Timestamp, na.Services, na.IP, na.Port,
+	), nil
+}
+
 // WaitForDisconnect waits until the peer has completely disconnected and all
 // resources are cleaned up.  This will happen if either the local or remote
 // side has been disconnected or the peer is forcibly disconnected via
@@ -7,10 +7,12 @@
 package peer_test
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"net"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -1210,3 +1212,280 @@ func TestSendAddrV2Handshake(t *testing.T) {
 		outPeer.WaitForDisconnect()
 	}
 }
+
+// TestBlockRelayOnlyPeer ensures block-relay-only peers ask the remote peer not
+// to relay transactions and neither send nor accept addresses.
+func TestBlockRelayOnlyPeer(t *testing.T) {
+	verack := make(chan struct{}, 2)
+	relayTx := make(chan bool, 1)
+	inCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVersion: func(p *peer.Peer, msg *wire.MsgVersion) *wire.MsgReject {
+				relayTx <- !msg.DisableRelayTx
+				return nil
+			},
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+		},
+		AllowSelfConns: true,
+		ChainParams:    &chaincfg.MainNetParams,
+	}
+
+	addrs := make(chan struct{}, 1)
+	pings := make(chan struct{}, 1)
+	outCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+			OnAddr: func(p *peer.Peer, msg *wire.MsgAddr) {
+				addrs <- struct{}{}
+			},
+			OnPing: func(p *peer.Peer, msg *wire.MsgPing) {
+				pings <- struct{}{}
+			},
+		},
+		AllowSelfConns: true,
+		ChainParams:    &chaincfg.MainNetParams,
+		BlockRelayOnly: true,
+	}
+
+	inPeer := peer.NewInboundPeer(inCfg)
+	outPeer, err := peer.NewOutboundPeer(outCfg, "10.0.0.2:15212")
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err: %v", err)
+	}
+	if err := setupPeerConnection(inPeer, outPeer); err != nil {
+		t.Fatalf("setupPeerConnection: %v", err)
+	}
+	defer inPeer.Disconnect()
+	defer outPeer.Disconnect()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-time.After(time.Second * 2):
+			t.Fatal("verack timeout")
+		}
+	}
+	if <-relayTx {
+		t.Fatal("block-relay-only peer requested transaction relay")
+	}
+	if !outPeer.BlockRelayOnly() || inPeer.BlockRelayOnly() {
+		t.Fatal("unexpected block-relay-only state")
+	}
+
+	na := wire.NewNetAddressIPPort(net.ParseIP("12.1.2.3"), 15212, 0)
+	sent, err := outPeer.PushAddrMsg([]*wire.NetAddress{na})
+	if err != nil || sent != nil {
+		t.Fatalf("PushAddrMsg: got %v, %v, want no addresses sent",
+			sent, err)
+	}
+
+	// Messages are handled in order, so the addr message has been dropped
+	// once the ping is seen.
+	addrMsg := wire.NewMsgAddr()
+	addrMsg.AddAddress(na)
+	inPeer.QueueMessage(addrMsg, nil)
+	inPeer.QueueMessage(wire.NewMsgPing(1), nil)
+	select {
+	case <-pings:
+	case <-time.After(time.Second * 2):
+		t.Fatal("ping timeout")
+	}
+	select {
+	case <-addrs:
+		t.Fatal("addr message accepted from block-relay-only peer")
+	default:
+	}
+}
+
+// TestTxReconciliationNegotiation tests that transaction reconciliation is
+// only negotiated when both peers offer it and that reconciliation messages
+// are only handled once it is.
+func TestTxReconciliationNegotiation(t *testing.T) {
+	tests := []struct {
+		name    string
+		inRecon bool
+		want    bool
+	}{
+		{name: "both peers", inRecon: true, want: true},
+		{name: "outbound peer only", inRecon: false, want: false},
+	}
+
+	for _, test := range tests {
+		verack := make(chan struct{}, 2)
+		reqRecons := make(chan *wire.MsgReqRecon, 1)
+		pings := make(chan struct{}, 1)
+		inCfg := &peer.Config{
+			Listeners: peer.MessageListeners{
+				OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+					verack <- struct{}{}
+				},
+			},
+			AllowSelfConns:   true,
+			ChainParams:      &chaincfg.MainNetParams,
+			TxReconciliation: test.inRecon,
+		}
+		outCfg := &peer.Config{
+			Listeners: peer.MessageListeners{
+				OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+					verack <- struct{}{}
+				},
+				OnReqRecon: func(p *peer.Peer, msg *wire.MsgReqRecon) {
+					reqRecons <- msg
+				},
+				OnPing: func(p *peer.Peer, msg *wire.MsgPing) {
+					pings <- struct{}{}
+				},
+			},
+			AllowSelfConns:   true,
+			ChainParams:      &chaincfg.MainNetParams,
+			TxReconciliation: true,
+		}
+
+		inPeer := peer.NewInboundPeer(inCfg)
+		outPeer, err := peer.NewOutboundPeer(outCfg, "10.0.0.2:15212")
+		if err != nil {
+			t.Fatalf("NewOutboundPeer: unexpected err: %v", err)
+		}
+		if err := setupPeerConnection(inPeer, outPeer); err != nil {
+			t.Fatalf("setupPeerConnection: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-verack:
+			case <-time.After(time.Second * 2):
+				t.Fatalf("%s: verack timeout", test.name)
+			}
+		}
+
+		inLocal, inRemote, inOK := inPeer.TxReconciliation()
+		outLocal, outRemote, outOK := outPeer.TxReconciliation()
+		if inOK != test.want || outOK != test.want {
+			t.Fatalf("%s: got negotiated %v/%v, want %v", test.name,
+				inOK, outOK, test.want)
+		}
+		if test.want && (inLocal != outRemote || inRemote != outLocal) {
+			t.Fatalf("%s: salts don't match", test.name)
+		}
+
+		// Messages are handled in order, so the reqrecon message has
+		// been handled or dropped once the ping is seen.
+		inPeer.QueueMessage(wire.NewMsgReqRecon(1, 8191), nil)
+		inPeer.QueueMessage(wire.NewMsgPing(1), nil)
+		select {
+		case <-pings:
+		case <-time.After(time.Second * 2):
+			t.Fatalf("%s: ping timeout", test.name)
+		}
+		select {
+		case <-reqRecons:
+			if !test.want {
+				t.Fatalf("%s: reqrecon handled without "+
+					"negotiation", test.name)
+			}
+		default:
+			if test.want {
+				t.Fatalf("%s: reqrecon not handled", test.name)
+			}
+		}
+
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+	}
+}
+
+// TestRawMessageListeners ensures the raw message listeners are invoked with
+// the exact bytes of the messages exchanged on the wire.
+func TestRawMessageListeners(t *testing.T) {
+	verack := make(chan struct{}, 2)
+	pings := make(chan struct{}, 1)
+	var mtx sync.Mutex
+	var sent, recv [][]byte
+	inCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+			OnPing: func(p *peer.Peer, msg *wire.MsgPing) {
+				pings <- struct{}{}
+			},
+			OnReadRaw: func(p *peer.Peer, raw []byte) {
+				mtx.Lock()
+				recv = append(recv, bytes.Clone(raw))
+				mtx.Unlock()
+			},
+		},
+		AllowSelfConns: true,
+		ChainParams:    &chaincfg.MainNetParams,
+	}
+	outCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+			OnWriteRaw: func(p *peer.Peer, raw []byte) {
+				mtx.Lock()
+				sent = append(sent, bytes.Clone(raw))
+				mtx.Unlock()
+			},
+		},
+		AllowSelfConns: true,
+		ChainParams:    &chaincfg.MainNetParams,
+	}
+
+	inPeer := peer.NewInboundPeer(inCfg)
+	outPeer, err := peer.NewOutboundPeer(outCfg, "10.0.0.2:15212")
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err: %v", err)
+	}
+	if err := setupPeerConnection(inPeer, outPeer); err != nil {
+		t.Fatalf("setupPeerConnection: %v", err)
+	}
+	defer inPeer.Disconnect()
+	defer outPeer.Disconnect()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-time.After(time.Second * 2):
+			t.Fatal("verack timeout")
+		}
+	}
+
+	ping := wire.NewMsgPing(1)
+	outPeer.QueueMessage(ping, nil)
+	select {
+	case <-pings:
+	case <-time.After(time.Second * 2):
+		t.Fatal("ping timeout")
+	}
+
+	var want bytes.Buffer
+	err = wire.WriteMessage(&want, ping, outPeer.ProtocolVersion(),
+		wire.MainNet)
+	if err != nil {
+		t.Fatalf("WriteMessage: unexpected err: %v", err)
+	}
+
+	// The messages read by the inbound peer up to the ping are the ones
+	// written by the outbound peer.
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(recv) == 0 || len(recv) > len(sent) {
+		t.Fatalf("got %d messages read for %d written", len(recv),
+			len(sent))
+	}
+	for i := range recv {
+		if !bytes.Equal(recv[i], sent[i]) {
+			t.Fatalf("message %d: read %x, written %x", i, recv[i],
+				sent[i])
+		}
+	}
+	if last := recv[len(recv)-1]; !bytes.Equal(last, want.Bytes()) {
+		t.Fatalf("got ping %x, want %x", last, want.Bytes())
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/flokiorg/go-flokicoin/connmgr"
+)
+
+// peerPermissions is a set of privileges granted to the peers matched by
+// --whitelist or connected through a --whitebind listener.
+type peerPermissions uint32
+
+const (
+	// permNoBan exempts the peer from banning and eviction.  It implies
+	// permDownload.
+	permNoBan peerPermissions = 1 << iota
+
+	// permRelay accepts transactions from the peer even with --blocksonly
+	// and exempts them from the free transaction rate limiting.
+	permRelay
+
+	// permForceRelay relays transactions from the peer even when they are
+	// already in the mempool.  It implies permRelay.
+	permForceRelay
+
+	// permDownload exempts the peer from the upload target.
+	permDownload
+
+	// permMempool allows the peer to request the mempool even when bloom
+	// filtering is disabled and without increasing its ban score.
+	permMempool
+)
+
+// defaultWhitelistPermissions are the permissions granted by whitelist and
+// whitebind entries that don't list any.
+const defaultWhitelistPermissions = permNoBan | permRelay | permDownload |
+	permMempool
+
+// peerPermissionNames maps each permission to the name used to configure it.
+var peerPermissionNames = []struct {
+	perm peerPermissions
+	name string
+}{
+	{permNoBan, "noban"},
+	{permRelay, "relay"},
+	{permForceRelay, "forcerelay"},
+	{permDownload, "download"},
+	{permMempool, "mempool"},
+}
+
+// has returns whether all the passed permissions are granted.
+func (p peerPermissions) has(perm peerPermissions) bool {
+	return p&perm == perm
+}
+
+// names returns the names of the granted permissions.
+func (p peerPermissions) names() []string {
+	names := make([]string, 0, len(peerPermissionNames))
+	for _, entry := range peerPermissionNames {
+		if p.has(entry.perm) {
+			names = append(names, entry.name)
+		}
+	}
+	return names
+}
+
+// parsePermissions parses a comma-separated list of permission names.  The
+// name "all" grants every permission.
+func parsePermissions(s string) (peerPermissions, error) {
+	var perms peerPermissions
+	if s == "" {
+		return perms, nil
+	}
+
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "all" {
+			for _, entry := range peerPermissionNames {
+				perms |= entry.perm
+			}
+			continue
+		}
+
+		var found bool
+		for _, entry := range peerPermissionNames {
+			if entry.name == name {
+				perms |= entry.perm
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown permission '%s'", name)
+		}
+	}
+
+	if perms.has(permNoBan) {
+		perms |= permDownload
+	}
+	if perms.has(permForceRelay) {
+		perms |= permRelay
+	}
+	return perms, nil
+}
+
+// splitPermissions splits a whitelist or whitebind value of the form
+// [perm1,perm2@]value into its permissions and value.  Values without
+// permissions are granted the default whitelist permissions.
+func splitPermissions(s string) (peerPermissions, string, error) {
+	permStr, value, ok := strings.Cut(s, "@")
+	if !ok {
+		return defaultWhitelistPermissions, s, nil
+	}
+	perms, err := parsePermissions(permStr)
+	if err != nil {
+		return 0, "", err
+	}
+	return perms, value, nil
+}
+
+// whitelistNet is an IP network whose peers are granted permissions.
+type whitelistNet struct {
+	ipnet *net.IPNet
+	perms peerPermissions
+}
+
+// whiteBind is a listen address whose inbound peers are granted permissions.
+type whiteBind struct {
+	addr  string
+	perms peerPermissions
+}
+
+// addrIP returns the IP of the passed peer address, or nil when it is not an
+// IP address.
+func addrIP(addr net.Addr) net.IP {
+	// Only IP addresses can be matched.
+	if _, ok := addr.(*connmgr.I2PAddr); ok {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		srvrLog.Warnf("Unable to SplitHostPort on '%s': %v", addr, err)
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		srvrLog.Warnf("Unable to parse IP '%s'", addr)
+	}
+	return ip
+}
+
+// whitelistPermissions returns the permissions granted to a peer with the
+// passed remote address by the whitelisted networks and IPs.
+func whitelistPermissions(addr net.Addr) peerPermissions {
+	if len(cfg.whitelists) == 0 {
+		return 0
+	}
+	ip := addrIP(addr)
+	if ip == nil {
+		return 0
+	}
+
+	var perms peerPermissions
+	for _, wl := range cfg.whitelists {
+		if wl.ipnet.Contains(ip) {
+			perms |= wl.perms
+		}
+	}
+	return perms
+}
+
+// whiteBindPermissions returns the permissions granted to an inbound peer that
+// connected to the passed local address by the whitebind listeners.
+func whiteBindPermissions(addr net.Addr) peerPermissions {
+	if len(cfg.whiteBinds) == 0 {
+		return 0
+	}
+	ip := addrIP(addr)
+	if ip == nil {
+		return 0
+	}
+	_, port, _ := net.SplitHostPort(addr.String())
+
+	var perms peerPermissions
+	for _, wb := range cfg.whiteBinds {
+		host, bindPort, err := net.SplitHostPort(wb.addr)
+		if err != nil || bindPort != port {
+			continue
+		}
+
+		// Listeners on all interfaces match any local address.
+		bindIP := net.ParseIP(host)
+		if host == "" || (bindIP != nil && bindIP.IsUnspecified()) ||
+			ip.Equal(bindIP) {
+
+			perms |= wb.perms
+		}
+	}
+	return perms
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+// TestSplitPermissions ensures whitelist and whitebind values are split into
+// their permissions and value, with implied permissions added.
+func TestSplitPermissions(t *testing.T) {
+	tests := []struct {
+		in        string
+		wantPerms peerPermissions
+		wantValue string
+		wantNames []string
+		wantErr   bool
+	}{{
+		in:        "192.168.1.0/24",
+		wantPerms: defaultWhitelistPermissions,
+		wantValue: "192.168.1.0/24",
+		wantNames: []string{"noban", "relay", "download", "mempool"},
+	}, {
+		in:        "mempool@::1",
+		wantPerms: permMempool,
+		wantValue: "::1",
+		wantNames: []string{"mempool"},
+	}, {
+		in:        "noban, ForceRelay@127.0.0.1:15300",
+		wantPerms: permNoBan | permDownload | permRelay | permForceRelay,
+		wantValue: "127.0.0.1:15300",
+		wantNames: []string{"noban", "relay", "forcerelay", "download"},
+	}, {
+		in:        "all@10.0.0.1",
+		wantPerms: permNoBan | permRelay | permForceRelay | permDownload | permMempool,
+		wantValue: "10.0.0.1",
+		wantNames: []string{"noban", "relay", "forcerelay", "download", "mempool"},
+	}, {
+		in:        "@10.0.0.1",
+		wantValue: "10.0.0.1",
+		wantNames: []string{},
+	}, {
+		in:      "bloom@10.0.0.1",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		perms, value, err := splitPermissions(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.in, err)
+			continue
+		}
+		if perms != test.wantPerms || value != test.wantValue {
+			t.Errorf("%q: got %b %q, want %b %q", test.in, perms,
+				value, test.wantPerms, test.wantValue)
+		}
+		if names := perms.names(); !reflect.DeepEqual(names, test.wantNames) {
+			t.Errorf("%q: got names %v, want %v", test.in, names,
+				test.wantNames)
+		}
+	}
+}
+
+// TestPeerAddrPermissions ensures peers are granted the permissions of the
+// whitelists matching their remote address and of the whitebind matching the
+// local address they connected to.
+func TestPeerAddrPermissions(t *testing.T) {
+	origCfg := cfg
+	defer func() { cfg = origCfg }()
+
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/8")
+	cfg = &config{
+		whitelists: []whitelistNet{
+			{ipnet: ipnet, perms: permNoBan},
+			{ipnet: &net.IPNet{
+				IP:   net.ParseIP("10.1.2.3"),
+				Mask: net.CIDRMask(32, 32),
+			}, perms: permMempool},
+		},
+		whiteBinds: []whiteBind{
+			{addr: "127.0.0.1:15300", perms: permRelay},
+			{addr: ":15301", perms: permDownload},
+		},
+	}
+
+	tcpAddr := func(s string) net.Addr {
+		addr, err := net.ResolveTCPAddr("tcp", s)
+		if err != nil {
+			t.Fatalf("ResolveTCPAddr %s: %v", s, err)
+		}
+		return addr
+	}
+
+	whitelistTests := []struct {
+		addr string
+		want peerPermissions
+	}{
+		{"10.1.2.3:15212", permNoBan | permMempool},
+		{"10.9.9.9:15212", permNoBan},
+		{"192.168.1.1:15212", 0},
+	}
+	for _, test := range whitelistTests {
+		got := whitelistPermissions(tcpAddr(test.addr))
+		if got != test.want {
+			t.Errorf("whitelist %s: got %b, want %b", test.addr, got,
+				test.want)
+		}
+	}
+
+	whiteBindTests := []struct {
+		addr string
+		want peerPermissions
+	}{
+		{"127.0.0.1:15300", permRelay},
+		{"192.168.1.1:15300", 0},
+		{"192.168.1.1:15301", permDownload},
+		{"[::1]:15301", permDownload},
+		{"127.0.0.1:15212", 0},
+	}
+	for _, test := range whiteBindTests {
+		got := whiteBindPermissions(tcpAddr(test.addr))
+		if got != test.want {
+			t.Errorf("whitebind %s: got %b, want %b", test.addr, got,
+				test.want)
+		}
+	}
+}
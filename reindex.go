@@ -0,0 +1,157 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/flokiorg/go-flokicoin/blockchain"
+	"github.com/flokiorg/go-flokicoin/blockchain/indexers"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/database"
+	"github.com/flokiorg/go-flokicoin/database/ffldb"
+)
+
+// errReindexInterrupted indicates the reindex was interrupted by a shutdown
+// request.
+var errReindexInterrupted = errors.New("reindex interrupted")
+
+// reindexDbPath returns the path the block database is moved to while the
+// block database is rebuilt from its block files.
+func reindexDbPath() string {
+	return blockDbPath(cfg.DbType) + "_reindex"
+}
+
+// prepareReindex moves the block database aside so it's rebuilt from its
+// block files when requested, and returns the path of the database the blocks
+// are read from.  The path is empty when the block database is not being
+// rebuilt.  A reindex that was interrupted is resumed, keeping the blocks that
+// were already imported.  The block database of a chain that was pruned or
+// loaded from a UTXO snapshot is not rebuilt since its blocks are incomplete.
+func prepareReindex() (string, error) {
+	if cfg.DbType == "memdb" {
+		return "", nil
+	}
+
+	dbPath := blockDbPath(cfg.DbType)
+	reindexPath := reindexDbPath()
+	if fileExists(reindexPath) {
+		flcdLog.Infof("Resuming the rebuild of the block database from "+
+			"'%s'", reindexPath)
+		return reindexPath, nil
+	}
+	if !cfg.Reindex {
+		return "", nil
+	}
+	if !fileExists(dbPath) {
+		flcdLog.Warnf("Not rebuilding the block database since '%s' "+
+			"does not exist", dbPath)
+		return "", nil
+	}
+
+	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net)
+	if err != nil {
+		return "", err
+	}
+	err = blockchain.CheckAllBlocksStored(db)
+	db.Close()
+	if err != nil {
+		return "", fmt.Errorf("--reindex cannot be used since %v. You "+
+			"must delete the files in the datadir: \"%s\" and sync "+
+			"from the beginning to rebuild the block database", err,
+			cfg.DataDir)
+	}
+
+	flcdLog.Infof("Moving the block database to '%s' to rebuild it from "+
+		"its block files", reindexPath)
+	if err := os.Rename(dbPath, reindexPath); err != nil {
+		return "", err
+	}
+	return reindexPath, nil
+}
+
+// resetChainState resets the chain state to the genesis block when requested,
+// or when its reset was interrupted, after dropping the optional indexes which
+// are rebuilt as the blocks are connected again.  It returns whether the
+// blocks stored in the database must be replayed.
+func resetChainState(db database.DB, interrupt <-chan struct{}) (bool, error) {
+	status, err := blockchain.FetchReindexStatus(db)
+	if err != nil {
+		return false, err
+	}
+	if !cfg.ReindexChainState && status != blockchain.ReindexResetting {
+		return status == blockchain.ReindexReplaying, nil
+	}
+
+	// NOTE: Dropping the tx index also drops the address index since it
+	// relies on it.
+	if indexers.TxIndexInitialized(db) {
+		if err := indexers.DropTxIndex(db, interrupt); err != nil {
+			return false, err
+		}
+	}
+	if indexers.CfIndexInitialized(db) {
+		if err := indexers.DropCfIndex(db, interrupt); err != nil {
+			return false, err
+		}
+	}
+	err = blockchain.ResetChainState(db, activeNetParams.Params, interrupt)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// reindex rebuilds the block database from the block files of the database at
+// the passed path, when it's not empty, and then removes that database unless
+// some of its blocks could not be imported, in which case it's kept.  It
+// then replays the blocks stored in the block database when requested, after
+// its chain state was reset.  It returns early without error when a shutdown
+// is requested, in which case the reindex is resumed on the next start.
+//
+// It must be called before the sync manager is started and the RPC server is
+// created.
+func (s *server) reindex(reindexPath string, replay bool, interrupt <-chan struct{}) error {
+	if reindexPath != "" {
+		err := s.syncManager.ImportBlocks(func(importBlock func(*chainutil.Block) error) error {
+			return ffldb.ScanBlockFiles(reindexPath, activeNetParams.Net,
+				func(rawBlock []byte) error {
+					if interruptRequested(interrupt) {
+						return errReindexInterrupted
+					}
+					block, err := chainutil.NewBlockFromBytes(rawBlock)
+					if err != nil {
+						flcdLog.Warnf("Skipping a block that "+
+							"can't be decoded: %v", err)
+						return nil
+					}
+					return importBlock(block)
+				})
+		})
+		if err == errReindexInterrupted {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%v -- keeping '%s' which holds the "+
+				"blocks that were not reindexed", err, reindexPath)
+		}
+
+		flcdLog.Infof("Rebuilt the block database -- removing '%s'",
+			reindexPath)
+		if err := os.RemoveAll(reindexPath); err != nil {
+			return err
+		}
+	}
+
+	if replay {
+		err := s.syncManager.ReplayBlocks(interrupt)
+		if err != nil && !interruptRequested(interrupt) {
+			return err
+		}
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ package main
 
 import (
 	"sync/atomic"
+	"time"
 
 	"github.com/flokiorg/go-flokicoin/blockchain"
 	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
@@ -62,6 +63,15 @@ func (p *rpcPeer) FeeFilter() int64 {
 	return atomic.LoadInt64(&(*serverPeer)(p).feeFilter)
 }
 
+// Permissions returns the names of the permissions granted to the peer by
+// --whitelist and --whitebind.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) Permissions() []string {
+	return (*serverPeer)(p).permissions.names()
+}
+
 // rpcConnManager provides a connection manager for use with the RPC server and
 // implements the rpcserverConnManager interface.
 type rpcConnManager struct {
@@ -148,6 +158,23 @@ func (cm *rpcConnManager) DisconnectByAddr(addr string) error {
 	return <-replyChan
 }
 
+// FetchBlock requests the passed block from the connected peer associated with
+// the provided id, which stores the block without processing it once it's
+// received.  Attempting to request a block from a peer that does not exist or
+// does not serve all blocks will return an error.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) FetchBlock(id int32, hash *chainhash.Hash) error {
+	replyChan := make(chan error)
+	cm.server.query <- fetchBlockMsg{
+		id:    id,
+		hash:  hash,
+		reply: replyChan,
+	}
+	return <-replyChan
+}
+
 // ConnectedCount returns the number of currently connected peers.
 //
 // This function is safe for concurrent access and is part of the
@@ -165,6 +192,15 @@ func (cm *rpcConnManager) NetTotals() (uint64, uint64) {
 	return cm.server.NetTotals()
 }
 
+// UploadTarget returns the state of the upload target limiting the bytes sent
+// to peers per day.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) UploadTarget() uploadTargetStatus {
+	return cm.server.uploadTarget.status(time.Now())
+}
+
 // ConnectedPeers returns an array consisting of all connected peers.
 //
 // This function is safe for concurrent access and is part of the
@@ -287,3 +323,12 @@ func (b *rpcSyncMgr) SyncPeerID() int32 {
 func (b *rpcSyncMgr) LocateHeaders(locators []*chainhash.Hash, hashStop *chainhash.Hash) []wire.BlockHeader {
 	return b.server.chain.LocateHeaders(locators, hashStop)
 }
+
+// LoadUtxoSnapshot loads the UTXO set snapshot at the provided path into the
+// chain and starts validating the blocks up to its base in the background.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) LoadUtxoSnapshot(path string) (*blockchain.UtxoSnapshot, error) {
+	return b.server.loadUtxoSnapshot(path)
+}
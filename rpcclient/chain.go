@@ -940,13 +940,20 @@ func (r FutureVerifyChainResult) Receive() (bool, error) {
 		return false, err
 	}
 
-	// Unmarshal the result as a boolean.
+	// Unmarshal the result as a boolean, as returned by the servers
+	// that don't report the details of the verification.
 	var verified bool
-	err = json.Unmarshal(res, &verified)
+	if err := json.Unmarshal(res, &verified); err == nil {
+		return verified, nil
+	}
+
+	// Unmarshal the result as a verifychain result object otherwise.
+	var verifyResult chainjson.VerifyChainResult
+	err = json.Unmarshal(res, &verifyResult)
 	if err != nil {
 		return false, err
 	}
-	return verified, nil
+	return verifyResult.Verified, nil
 }
 
 // VerifyChainAsync returns an instance of a type that can be used to get the
@@ -1015,6 +1022,86 @@ func (c *Client) VerifyChainBlocks(checkLevel, numBlocks int32) (bool, error) {
 	return c.VerifyChainBlocksAsync(checkLevel, numBlocks).Receive()
 }
 
+// FutureVerifyChainReportResult is a future promise to deliver the result of a
+// VerifyChainReportAsync, VerifyChainReportLevelAsync, or
+// VerifyChainReportBlocksAsync invocation (or an applicable error).
+type FutureVerifyChainReportResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the report
+// of the verification of the chain: whether or not it verified, the number of
+// blocks checked and the first block that failed the checks when it did not.
+func (r FutureVerifyChainReportResult) Receive() (*chainjson.VerifyChainResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a verifychain result object.
+	var verifyResult chainjson.VerifyChainResult
+	err = json.Unmarshal(res, &verifyResult)
+	if err != nil {
+		return nil, err
+	}
+	return &verifyResult, nil
+}
+
+// VerifyChainReportAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See VerifyChainReport for the blocking version and more details.
+func (c *Client) VerifyChainReportAsync() FutureVerifyChainReportResult {
+	cmd := chainjson.NewVerifyChainCmd(nil, nil)
+	return c.SendCmd(cmd)
+}
+
+// VerifyChainReport requests the server to verify the block chain database
+// using the default check level and number of blocks to verify, and returns
+// the report of the verification.
+//
+// See VerifyChain to only get whether or not the chain verified.
+func (c *Client) VerifyChainReport() (*chainjson.VerifyChainResult, error) {
+	return c.VerifyChainReportAsync().Receive()
+}
+
+// VerifyChainReportLevelAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See VerifyChainReportLevel for the blocking version and more details.
+func (c *Client) VerifyChainReportLevelAsync(checkLevel int32) FutureVerifyChainReportResult {
+	cmd := chainjson.NewVerifyChainCmd(&checkLevel, nil)
+	return c.SendCmd(cmd)
+}
+
+// VerifyChainReportLevel requests the server to verify the block chain
+// database using the passed check level and default number of blocks to
+// verify, and returns the report of the verification.
+//
+// See VerifyChainLevel to only get whether or not the chain verified.
+func (c *Client) VerifyChainReportLevel(checkLevel int32) (*chainjson.VerifyChainResult, error) {
+	return c.VerifyChainReportLevelAsync(checkLevel).Receive()
+}
+
+// VerifyChainReportBlocksAsync returns an instance of a type that can be used
+// to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See VerifyChainReportBlocks for the blocking version and more details.
+func (c *Client) VerifyChainReportBlocksAsync(checkLevel, numBlocks int32) FutureVerifyChainReportResult {
+	cmd := chainjson.NewVerifyChainCmd(&checkLevel, &numBlocks)
+	return c.SendCmd(cmd)
+}
+
+// VerifyChainReportBlocks requests the server to verify the block chain
+// database using the passed check level and number of blocks to verify, and
+// returns the report of the verification.
+//
+// See VerifyChainBlocks to only get whether or not the chain verified.
+func (c *Client) VerifyChainReportBlocks(checkLevel, numBlocks int32) (*chainjson.VerifyChainResult, error) {
+	return c.VerifyChainReportBlocksAsync(checkLevel, numBlocks).Receive()
+}
+
 // FutureGetTxOutResult is a future promise to deliver the result of a
 // GetTxOutAsync RPC invocation (or an applicable error).
 type FutureGetTxOutResult chan *Response
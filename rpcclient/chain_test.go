@@ -139,6 +139,47 @@ func TestFutureGetBlockCountResultReceiveMarshalsResponseCorrectly(t *testing.T)
 	}
 }
 
+// TestFutureVerifyChainResultReceive ensures whether the chain verified is
+// returned both from the servers reporting the details of the verification and
+// from the ones only returning a boolean, and that the report is returned as is.
+func TestFutureVerifyChainResultReceive(t *testing.T) {
+	tests := []struct {
+		name   string
+		result string
+		want   bool
+	}{
+		{name: "boolean", result: `true`, want: true},
+		{name: "report", result: `{"verified":false,"checklevel":3,` +
+			`"blockschecked":6,"failure":{"hash":"00","height":5,` +
+			`"reason":"bad"}}`, want: false},
+	}
+
+	for _, test := range tests {
+		responseChan := FutureVerifyChainResult(make(chan *Response, 1))
+		responseChan <- &Response{result: []byte(test.result)}
+		verified, err := responseChan.Receive()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if verified != test.want {
+			t.Fatalf("%s: got verified %v, want %v", test.name,
+				verified, test.want)
+		}
+	}
+
+	reportChan := FutureVerifyChainReportResult(make(chan *Response, 1))
+	reportChan <- &Response{result: []byte(tests[1].result)}
+	report, err := reportChan.Receive()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Verified || report.BlocksChecked != 6 ||
+		report.Failure == nil || report.Failure.Height != 5 {
+
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
 func TestClientConnectedToWSServerRunner(t *testing.T) {
 	type TestTableItem struct {
 		Name     string
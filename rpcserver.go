@@ -21,6 +21,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -142,10 +143,12 @@ type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{},
 var rpcHandlers map[string]commandHandler
 var rpcHandlersBeforeInit = map[string]commandHandler{
 	"addnode":              handleAddNode,
+	"approvereorg":         handleApproveReorg,
 	"createrawtransaction": handleCreateRawTransaction,
 	"debuglevel":           handleDebugLevel,
 	"decoderawtransaction": handleDecodeRawTransaction,
 	"decodescript":         handleDecodeScript,
+	"dumptxoutset":         handleDumpTxOutSet,
 
 	"estimatefee":      handleEstimateFee,
 	"estimatesmartfee": handleEstimateSmartFee,
@@ -157,14 +160,17 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getblock":          handleGetBlock,
 	"getblockchaininfo": handleGetBlockChainInfo,
 	"getblockcount":     handleGetBlockCount,
+	"getblockfrompeer":  handleGetBlockFromPeer,
 	"getblockhash":      handleGetBlockHash,
 	"getblockheader":    handleGetBlockHeader,
 
 	"getblocktemplate": handleGetBlockTemplate,
 	"createauxblock":   handleCreateAuxBlock,
 	"submitauxblock":   handleSubmitAuxBlock,
+	"getauxpowinfo":    handleGetAuxPowInfo,
 
 	"getchaintips":       handleGetChainTips,
+	"getchaintxstats":    handleGetChainTxStats,
 	"getcfilter":         handleGetCFilter,
 	"getcfilterheader":   handleGetCFilterHeader,
 	"getconnectioncount": handleGetConnectionCount,
@@ -191,6 +197,7 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"gettxout":               handleGetTxOut,
 	"help":                   handleHelp,
 	"invalidateblock":        handleInvalidateBlock,
+	"loadtxoutset":           handleLoadTxOutSet,
 	"node":                   handleNode,
 	"ping":                   handlePing,
 	"reconsiderblock":        handleReconsiderBlock,
@@ -293,7 +300,9 @@ var rpcLimited = map[string]struct{}{
 	"getblockcount":         {},
 	"getblockhash":          {},
 	"getblockheader":        {},
+	"getauxpowinfo":         {},
 	"getchaintips":          {},
+	"getchaintxstats":       {},
 	"getcfilter":            {},
 	"getcfilterheader":      {},
 	"getcurrentnet":         {},
@@ -543,6 +552,19 @@ func messageToHex(msg wire.Message) (string, error) {
 	return hex.EncodeToString(buf.Bytes()), nil
 }
 
+// handleApproveReorg implements the approvereorg command.
+func handleApproveReorg(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*chainjson.ApproveReorgCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+
+	err = s.cfg.Chain.ApproveReorg(hash)
+	return nil, err
+}
+
 // handleCreateRawTransaction handles createrawtransaction commands.
 func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*chainjson.CreateRawTransactionCmd)
@@ -1141,6 +1163,78 @@ func getDifficultyRatio(bits uint32, params *chaincfg.Params) float64 {
 	return diff
 }
 
+// createAuxPowResult converts the passed AuxPoW payload into its JSON-RPC
+// representation.  When decoded is set, the parent block header is also
+// returned as a parsed object alongside its serialized form.
+func createAuxPowResult(aph *wire.AuxPowHeader, decoded bool) *chainjson.AuxPowResult {
+	var txBuf bytes.Buffer
+	_ = aph.CoinbaseTx.Serialize(&txBuf)
+	txHex := hex.EncodeToString(txBuf.Bytes())
+	txid := aph.CoinbaseTx.TxHash().String()
+
+	var vin []chainjson.AuxPowVin
+	if len(aph.CoinbaseTx.TxIn) > 0 {
+		vin = []chainjson.AuxPowVin{{Coinbase: hex.EncodeToString(aph.CoinbaseTx.TxIn[0].SignatureScript)}}
+	}
+
+	vout := make([]chainjson.AuxPowVout, len(aph.CoinbaseTx.TxOut))
+	for i, o := range aph.CoinbaseTx.TxOut {
+		vout[i] = chainjson.AuxPowVout{
+			Value:        o.Value,
+			ScriptPubKey: hex.EncodeToString(o.PkScript),
+		}
+	}
+
+	merkleBranch := make([]string, len(aph.CoinbaseBranch.Hashes))
+	for i := range aph.CoinbaseBranch.Hashes {
+		merkleBranch[i] = aph.CoinbaseBranch.Hashes[i].String()
+	}
+
+	chainMerkleBranch := make([]string, len(aph.BlockChainBranch.Hashes))
+	for i := range aph.BlockChainBranch.Hashes {
+		chainMerkleBranch[i] = aph.BlockChainBranch.Hashes[i].String()
+	}
+
+	var ph bytes.Buffer
+	_ = aph.ParentBlockHeader.Serialize(&ph)
+	parentHex := hex.EncodeToString(ph.Bytes())
+
+	result := &chainjson.AuxPowResult{
+		Tx: chainjson.AuxPowTxResult{
+			Hex:      txHex,
+			Txid:     txid,
+			Version:  aph.CoinbaseTx.Version,
+			Vin:      vin,
+			Vout:     vout,
+			LockTime: aph.CoinbaseTx.LockTime,
+		},
+		Index:             aph.CoinbaseBranch.SideMask,
+		ChainIndex:        aph.BlockChainBranch.SideMask,
+		MerkleBranch:      merkleBranch,
+		ChainMerkleBranch: chainMerkleBranch,
+		ParentBlock:       parentHex,
+	}
+
+	if decoded {
+		parent := &aph.ParentBlockHeader
+		powHash := parent.BlockPoWHash()
+		result.ParentHeader = &chainjson.AuxPowParentHeaderResult{
+			Hash:         parent.BlockHash().String(),
+			PoWHash:      powHash.String(),
+			ChainID:      parent.GetChainID(),
+			Version:      parent.Version,
+			VersionHex:   fmt.Sprintf("%08x", parent.Version),
+			PreviousHash: parent.PrevBlock.String(),
+			MerkleRoot:   parent.MerkleRoot.String(),
+			Time:         parent.Timestamp.Unix(),
+			Bits:         strconv.FormatInt(int64(parent.Bits), 16),
+			Nonce:        parent.Nonce,
+		}
+	}
+
+	return result
+}
+
 // handleGetBlock implements the getblock command.
 func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*chainjson.GetBlockCmd)
@@ -1171,10 +1265,10 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	if verbosity == 0 {
 		return hex.EncodeToString(blkBytes), nil
 	}
-	if verbosity < 0 || verbosity > 2 {
+	if verbosity < 0 || verbosity > 3 {
 		return nil, &chainjson.RPCError{
 			Code:    chainjson.ErrRPCInvalidParameter,
-			Message: "Verbosity must be 0, 1 or 2",
+			Message: "Verbosity must be 0, 1, 2 or 3",
 		}
 	}
 
@@ -1230,52 +1324,7 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 
 	var auxPow *chainjson.AuxPowResult
 	if blockHeader.AuxPowHeader != nil {
-		aph := blockHeader.AuxPowHeader
-
-		var txBuf bytes.Buffer
-		_ = aph.CoinbaseTx.Serialize(&txBuf)
-		txHex := hex.EncodeToString(txBuf.Bytes())
-		txid := aph.CoinbaseTx.TxHash().String()
-
-		vin := []chainjson.AuxPowVin{{Coinbase: hex.EncodeToString(aph.CoinbaseTx.TxIn[0].SignatureScript)}}
-
-		vout := make([]chainjson.AuxPowVout, len(aph.CoinbaseTx.TxOut))
-		for i, o := range aph.CoinbaseTx.TxOut {
-			vout[i] = chainjson.AuxPowVout{
-				Value:        o.Value,
-				ScriptPubKey: hex.EncodeToString(o.PkScript),
-			}
-		}
-
-		merkleBranch := make([]string, len(aph.CoinbaseBranch.Hashes))
-		for i := range aph.CoinbaseBranch.Hashes {
-			merkleBranch[i] = aph.CoinbaseBranch.Hashes[i].String()
-		}
-
-		chainMerkleBranch := make([]string, len(aph.BlockChainBranch.Hashes))
-		for i := range aph.BlockChainBranch.Hashes {
-			chainMerkleBranch[i] = aph.BlockChainBranch.Hashes[i].String()
-		}
-
-		var ph bytes.Buffer
-		_ = aph.ParentBlockHeader.Serialize(&ph)
-		parentHex := hex.EncodeToString(ph.Bytes())
-
-		auxPow = &chainjson.AuxPowResult{
-			Tx: chainjson.AuxPowTxResult{
-				Hex:      txHex,
-				Txid:     txid,
-				Version:  aph.CoinbaseTx.Version,
-				Vin:      vin,
-				Vout:     vout,
-				LockTime: aph.CoinbaseTx.LockTime,
-			},
-			Index:             aph.CoinbaseBranch.SideMask,
-			ChainIndex:        aph.BlockChainBranch.SideMask,
-			MerkleBranch:      merkleBranch,
-			ChainMerkleBranch: chainMerkleBranch,
-			ParentBlock:       parentHex,
-		}
+		auxPow = createAuxPowResult(blockHeader.AuxPowHeader, verbosity > 2)
 	}
 
 	txns := blk.Transactions()
@@ -1395,9 +1444,11 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 		return nil, internalRPCError(err.Error(), "Could not fetch chain work")
 	}
 
-	// Estimate the verification progress of the node.
-	var verifyProgress float64
-	if bestHeaderHeight > 0 {
+	// Estimate the verification progress of the node from the rate of the
+	// transactions of the chain, or from the best known header height when
+	// the rate is not known.
+	verifyProgress, ok := chain.VerificationProgress()
+	if !ok && bestHeaderHeight > 0 {
 		verifyProgress = float64(chainSnapshot.Height) / float64(bestHeaderHeight)
 		if verifyProgress > 1 {
 			verifyProgress = 1
@@ -1517,11 +1568,17 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 
 		// Finally, populate the soft-fork description with all the
 		// information gathered above.
+		// A zero start or end time means the deployment is always
+		// started or never expires, which is reported as 0.
 		var startTime, endTime int64
-		if starter, ok := deploymentDetails.DeploymentStarter.(*chaincfg.MedianTimeDeploymentStarter); ok {
+		if starter, ok := deploymentDetails.DeploymentStarter.(*chaincfg.MedianTimeDeploymentStarter); ok &&
+			!starter.StartTime().IsZero() {
+
 			startTime = starter.StartTime().Unix()
 		}
-		if ender, ok := deploymentDetails.DeploymentEnder.(*chaincfg.MedianTimeDeploymentEnder); ok {
+		if ender, ok := deploymentDetails.DeploymentEnder.(*chaincfg.MedianTimeDeploymentEnder); ok &&
+			!ender.EndTime().IsZero() {
+
 			endTime = ender.EndTime().Unix()
 		}
 		chainInfo.SoftForks.Bip9SoftForks[forkName] = &chainjson.Bip9SoftForkDescription{
@@ -1542,6 +1599,53 @@ func handleGetBlockCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	return int64(best.Height), nil
 }
 
+// handleGetBlockFromPeer implements the getblockfrompeer command.
+func handleGetBlockFromPeer(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*chainjson.GetBlockFromPeerCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+
+	// The block is checked against its header once it's received, so
+	// the header must be known.
+	if _, err := s.cfg.Chain.HeaderByHash(hash); err != nil {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCBlockNotFound,
+			Message: "Block header missing",
+		}
+	}
+
+	var stored bool
+	err = s.cfg.DB.View(func(dbTx database.Tx) error {
+		var err error
+		stored, err = dbTx.HasBlock(hash)
+		return err
+	})
+	if err != nil {
+		context := "Failed to look up the block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if stored {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCMisc,
+			Message: "Block already downloaded",
+		}
+	}
+
+	if err := s.cfg.ConnMgr.FetchBlock(c.PeerID, hash); err != nil {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+
+	// No data is returned since the block is stored once the peer sends
+	// it.
+	return nil, nil
+}
+
 // handleGetBlockHash implements the getblockhash command.
 func handleGetBlockHash(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*chainjson.GetBlockHashCmd)
@@ -1621,6 +1725,11 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 		Bits:          strconv.FormatInt(int64(blockHeader.Bits), 16),
 		Difficulty:    getDifficultyRatio(blockHeader.Bits, params),
 	}
+	if c.AuxPow != nil && *c.AuxPow && blockHeader.AuxPowHeader != nil {
+		blockHeaderReply.AuxPow = createAuxPowResult(
+			blockHeader.AuxPowHeader, true,
+		)
+	}
 	return blockHeaderReply, nil
 }
 
@@ -2438,6 +2547,73 @@ func handleGetChainTips(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	return ret, nil
 }
 
+// handleGetChainTxStats implements the getchaintxstats command.
+func handleGetChainTxStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*chainjson.GetChainTxStatsCmd)
+	chain := s.cfg.Chain
+
+	// The statistics are computed up to the tip of the main chain unless a
+	// block is given.
+	hash := chain.BestSnapshot().Hash
+	if c.BlockHash != nil {
+		blockHash, err := chainhash.NewHashFromStr(*c.BlockHash)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.BlockHash)
+		}
+		hash = *blockHash
+	}
+	height, err := chain.BlockHeightByHash(&hash)
+	if err != nil {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCBlockNotFound,
+			Message: "Block is not in the main chain",
+		}
+	}
+
+	// The window defaults to the blocks of about a month, limited to the
+	// blocks after the genesis block.
+	var windowBlocks int32
+	if c.NBlocks != nil {
+		windowBlocks = *c.NBlocks
+		if windowBlocks < 0 || (windowBlocks > 0 && windowBlocks >= height) {
+			return nil, &chainjson.RPCError{
+				Code: chainjson.ErrRPCInvalidParameter,
+				Message: "Invalid block count: should be between " +
+					"0 and the block's height - 1",
+			}
+		}
+	} else {
+		targetTimePerBlock := s.cfg.ChainParams.TargetTimePerBlock
+		windowBlocks = int32(30 * 24 * time.Hour / targetTimePerBlock)
+		windowBlocks = min(windowBlocks, max(height-1, 0))
+	}
+
+	stats, err := chain.ChainTxStats(&hash, windowBlocks)
+	if err != nil {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+
+	result := &chainjson.GetChainTxStatsResult{
+		Time:                   stats.Time,
+		TxCount:                int64(stats.TxCount),
+		WindowFinalBlockHash:   stats.Hash.String(),
+		WindowFinalBlockHeight: stats.Height,
+		WindowBlockCount:       stats.WindowBlockCount,
+	}
+	if stats.WindowBlockCount > 0 {
+		result.WindowTxCount = int32(stats.WindowTxCount)
+		result.WindowInterval = int32(stats.WindowInterval)
+		if stats.WindowInterval > 0 {
+			result.TxRate = float64(stats.WindowTxCount) /
+				float64(stats.WindowInterval)
+		}
+	}
+	return result, nil
+}
+
 // handleGetCFilter implements the getcfilter command.
 func handleGetCFilter(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	if s.cfg.CfIndex == nil {
@@ -3005,10 +3181,19 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 // handleGetNetTotals implements the getnettotals command.
 func handleGetNetTotals(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	totalBytesRecv, totalBytesSent := s.cfg.ConnMgr.NetTotals()
+	target := s.cfg.ConnMgr.UploadTarget()
 	reply := &chainjson.GetNetTotalsResult{
 		TotalBytesRecv: totalBytesRecv,
 		TotalBytesSent: totalBytesSent,
 		TimeMillis:     time.Now().UTC().UnixNano() / int64(time.Millisecond),
+		UploadTarget: chainjson.GetNetTotalsUploadTargetResult{
+			Timeframe:             int64(target.Timeframe / time.Second),
+			Target:                target.Target,
+			TargetReached:         target.TargetReached,
+			ServeHistoricalBlocks: target.ServeHistoricalBlocks,
+			BytesLeftInCycle:      target.BytesLeft,
+			TimeLeftInCycle:       int64(target.TimeLeft / time.Second),
+		},
 	}
 	return reply, nil
 }
@@ -3169,6 +3354,7 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 			BanScore:       int32(p.BanScore()),
 			FeeFilter:      p.FeeFilter(),
 			SyncNode:       statsSnap.ID == syncPeerID,
+			Permissions:    p.Permissions(),
 		}
 		if p.ToPeer().LastPingNonce() != 0 {
 			wait := float64(time.Since(statsSnap.LastPingTime).Nanoseconds())
@@ -3452,6 +3638,84 @@ func handleInvalidateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struc
 	return nil, err
 }
 
+// utxoSnapshotPath returns the path of a UTXO set snapshot passed to the
+// dumptxoutset and loadtxoutset commands.  Relative paths are relative to the
+// data directory.
+func utxoSnapshotPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(cfg.DataDir, path)
+}
+
+// handleDumpTxOutSet implements the dumptxoutset command.
+func handleDumpTxOutSet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*chainjson.DumpTxOutSetCmd)
+
+	path := utxoSnapshotPath(c.Path)
+	if fileExists(path) {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("%s already exists", path),
+		}
+	}
+
+	// Write the snapshot to a temporary file first so an incomplete
+	// snapshot is never left at the requested path.
+	tmpPath := path + ".incomplete"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		context := "Failed to create the UTXO snapshot file"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	snapshot, err := s.cfg.Chain.DumpUtxoSnapshot(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		context := "Failed to write the UTXO snapshot"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	return &chainjson.DumpTxOutSetResult{
+		CoinsWritten: snapshot.CoinsCount,
+		BaseHash:     snapshot.BaseHash.String(),
+		BaseHeight:   snapshot.BaseHeight,
+		Path:         path,
+		TxOutSetHash: snapshot.TxOutSetHash.String(),
+		ChainTxCount: snapshot.ChainTxCount,
+	}, nil
+}
+
+// handleLoadTxOutSet implements the loadtxoutset command.
+func handleLoadTxOutSet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*chainjson.LoadTxOutSetCmd)
+
+	path := utxoSnapshotPath(c.Path)
+	snapshot, err := s.cfg.SyncMgr.LoadUtxoSnapshot(path)
+	if err != nil {
+		return nil, &chainjson.RPCError{
+			Code: chainjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Unable to load UTXO snapshot %s: %v",
+				path, err),
+		}
+	}
+
+	return &chainjson.LoadTxOutSetResult{
+		CoinsLoaded: snapshot.CoinsCount,
+		TipHash:     snapshot.BaseHash.String(),
+		BaseHeight:  snapshot.BaseHeight,
+		Path:        path,
+	}, nil
+}
+
 // handleHelp implements the help command.
 func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*chainjson.HelpCmd)
@@ -4284,41 +4548,6 @@ func handleValidateAddress(s *rpcServer, cmd interface{}, closeChan <-chan struc
 	return result, nil
 }
 
-func verifyChain(s *rpcServer, level, depth int32) error {
-	best := s.cfg.Chain.BestSnapshot()
-	finishHeight := best.Height - depth
-	if finishHeight < 0 {
-		finishHeight = 0
-	}
-	rpcsLog.Infof("Verifying chain for %d blocks at level %d",
-		best.Height-finishHeight, level)
-
-	for height := best.Height; height > finishHeight; height-- {
-		// Level 0 just looks up the block.
-		block, err := s.cfg.Chain.BlockByHeight(height)
-		if err != nil {
-			rpcsLog.Errorf("Verify is unable to fetch block at "+
-				"height %d: %v", height, err)
-			return err
-		}
-
-		// Level 1 does basic chain sanity checks.
-		if level > 0 {
-			err := blockchain.CheckBlockSanity(block,
-				s.cfg.ChainParams.PowLimit, s.cfg.TimeSource)
-			if err != nil {
-				rpcsLog.Errorf("Verify is unable to validate "+
-					"block at hash %v height %d: %v",
-					block.Hash(), height, err)
-				return err
-			}
-		}
-	}
-	rpcsLog.Infof("Chain verify completed successfully")
-
-	return nil
-}
-
 // handleVerifyChain implements the verifychain command.
 func handleVerifyChain(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*chainjson.VerifyChainCmd)
@@ -4331,8 +4560,38 @@ func handleVerifyChain(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		checkDepth = *c.CheckDepth
 	}
 
-	err := verifyChain(s, checkLevel, checkDepth)
-	return err == nil, nil
+	// Higher levels are clamped to the highest supported level.
+	level := blockchain.VerifyLevel(checkLevel)
+	if level < blockchain.VerifyLevelRead {
+		level = blockchain.VerifyLevelRead
+	}
+	if level > blockchain.MaxVerifyLevel {
+		level = blockchain.MaxVerifyLevel
+	}
+
+	numChecked, err := s.cfg.Chain.VerifyChain(level, checkDepth, closeChan)
+	result := &chainjson.VerifyChainResult{
+		Verified:      err == nil,
+		CheckLevel:    int32(level),
+		BlocksChecked: numChecked,
+	}
+	if verifyErr, ok := err.(*blockchain.VerifyError); ok {
+		rpcsLog.Errorf("Chain verification failed: %v", verifyErr)
+		result.Failure = &chainjson.VerifyChainFailure{
+			Hash:       verifyErr.Hash.String(),
+			Height:     verifyErr.Height,
+			CheckLevel: int32(verifyErr.Level),
+			Check:      verifyErr.Level.String(),
+			Reason:     verifyErr.Err.Error(),
+		}
+		return result, nil
+	}
+	if err != nil {
+		context := "Failed to verify the chain"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	return result, nil
 }
 
 // handleVerifyMessage implements the verifymessage command.
@@ -5231,6 +5490,10 @@ type rpcserverPeer interface {
 	// FeeFilter returns the requested current minimum fee rate for which
 	// transactions should be announced.
 	FeeFilter() int64
+
+	// Permissions returns the names of the permissions granted to the
+	// peer by --whitelist and --whitebind.
+	Permissions() []string
 }
 
 // rpcserverConnManager represents a connection manager for use with the RPC
@@ -5266,6 +5529,13 @@ type rpcserverConnManager interface {
 	// error.
 	DisconnectByAddr(addr string) error
 
+	// FetchBlock requests the passed block from the connected peer
+	// associated with the provided id, which stores the block without
+	// processing it once it's received.  Attempting to request a block
+	// from a peer that does not exist or does not serve all blocks will
+	// return an error.
+	FetchBlock(id int32, hash *chainhash.Hash) error
+
 	// ConnectedCount returns the number of currently connected peers.
 	ConnectedCount() int32
 
@@ -5273,6 +5543,10 @@ type rpcserverConnManager interface {
 	// network for all peers.
 	NetTotals() (uint64, uint64)
 
+	// UploadTarget returns the state of the upload target limiting the
+	// bytes sent to peers per day.
+	UploadTarget() uploadTargetStatus
+
 	// ConnectedPeers returns an array consisting of all connected peers.
 	ConnectedPeers() []rpcserverPeer
 
@@ -5323,6 +5597,11 @@ type rpcserverSyncManager interface {
 	// current tip is reached, up to a max of wire.MaxBlockHeadersPerMsg
 	// hashes.
 	LocateHeaders(locators []*chainhash.Hash, hashStop *chainhash.Hash) []wire.BlockHeader
+
+	// LoadUtxoSnapshot loads the UTXO set snapshot at the provided path
+	// into the chain and starts validating the blocks up to its base in
+	// the background.
+	LoadUtxoSnapshot(path string) (*blockchain.UtxoSnapshot, error)
 }
 
 // rpcserverConfig is a descriptor containing the RPC server configuration.
@@ -5463,6 +5742,18 @@ func (s *rpcServer) handleBlockchainNotification(notification *blockchain.Notifi
 		if s.cfg.AuxCache != nil {
 			s.cfg.AuxCache.clear()
 		}
+
+	case blockchain.NTChainReorgBlocked:
+		blocked, ok := notification.Data.(*blockchain.ReorgBlocked)
+		if !ok {
+			rpcsLog.Warnf("Chain reorg blocked notification is not a " +
+				"blocked reorg.")
+			break
+		}
+
+		// Notify registered websocket clients so they can alert the
+		// operator.
+		s.ntfnMgr.NotifyChainReorgBlocked(blocked)
 	}
 }
 
@@ -5717,6 +6008,106 @@ func handleSubmitAuxBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct
 	return chainjson.SubmitAuxBlockResult(true), nil
 }
 
+// handleGetAuxPowInfo implements the getauxpowinfo command.  It summarises
+// how many blocks within a window of the main chain were merged mined and
+// breaks them down by the chain ID of their parent chain.
+func handleGetAuxPowInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*chainjson.GetAuxPowInfoCmd)
+	chain := s.cfg.Chain
+	params := s.cfg.ChainParams
+
+	// Determine the block which ends the window, defaulting to the tip of
+	// the main chain.
+	best := chain.BestSnapshot()
+	endHash := best.Hash
+	endHeight := best.Height
+	if c.BlockHash != nil {
+		hash, err := chainhash.NewHashFromStr(*c.BlockHash)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.BlockHash)
+		}
+		if !chain.MainChainHasBlock(hash) {
+			return nil, &chainjson.RPCError{
+				Code:    chainjson.ErrRPCBlockNotFound,
+				Message: "Block is not in the main chain",
+			}
+		}
+		endHeight, err = chain.BlockHeightByHash(hash)
+		if err != nil {
+			context := "Failed to obtain block height"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		endHash = *hash
+	}
+
+	nBlocks := int32(1440)
+	if c.NBlocks != nil {
+		nBlocks = *c.NBlocks
+	}
+	if nBlocks < 1 {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCInvalidParameter,
+			Message: "Invalid block count: should be greater than 0",
+		}
+	}
+	if nBlocks > endHeight+1 {
+		nBlocks = endHeight + 1
+	}
+	startHeight := endHeight - nBlocks + 1
+
+	var auxPowBlocks int32
+	parentCounts := make(map[int32]int32)
+	for height := startHeight; height <= endHeight; height++ {
+		select {
+		case <-closeChan:
+			return nil, ErrClientQuit
+		default:
+		}
+
+		hash, err := chain.BlockHashByHeight(height)
+		if err != nil {
+			context := "Failed to fetch block hash"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		header, err := chain.HeaderByHash(hash)
+		if err != nil {
+			context := "Failed to fetch block header"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if !header.AuxPow() || header.AuxPowHeader == nil {
+			continue
+		}
+
+		auxPowBlocks++
+		parentCounts[header.AuxPowHeader.ParentBlockHeader.GetChainID()]++
+	}
+
+	parentChains := make([]chainjson.AuxPowParentChainResult, 0, len(parentCounts))
+	for chainID, count := range parentCounts {
+		parentChains = append(parentChains, chainjson.AuxPowParentChainResult{
+			ChainID: chainID,
+			Blocks:  count,
+			Share:   float64(count) / float64(nBlocks),
+		})
+	}
+	sort.Slice(parentChains, func(i, j int) bool {
+		return parentChains[i].ChainID < parentChains[j].ChainID
+	})
+
+	return &chainjson.GetAuxPowInfoResult{
+		ChainID:           params.AuxpowChainId,
+		ActivationHeight:  params.AuxpowHeightEffective,
+		WindowStartHeight: startHeight,
+		WindowEndHeight:   endHeight,
+		WindowEndHash:     endHash.String(),
+		WindowBlocks:      nBlocks,
+		AuxPowBlocks:      auxPowBlocks,
+		NativeBlocks:      nBlocks - auxPowBlocks,
+		AuxPowShare:       float64(auxPowBlocks) / float64(nBlocks),
+		ParentChains:      parentChains,
+	}, nil
+}
+
 func init() {
 	rpcHandlers = rpcHandlersBeforeInit
 	rand.Seed(time.Now().UnixNano())
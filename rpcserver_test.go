@@ -856,3 +856,42 @@ func TestGetTxSpendingPrevOut(t *testing.T) {
 	require.NoError(err)
 	require.Equal(expectedResults, results)
 }
+
+// TestGetAuxPowInfo checks the window bounds and parameter validation of the
+// getauxpowinfo handler on a chain containing only the genesis block.
+func TestGetAuxPowInfo(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	chain, teardown := mkChain(t, &params)
+	defer teardown()
+
+	s := &rpcServer{cfg: rpcserverConfig{Chain: chain, ChainParams: &params}}
+
+	res, err := handleGetAuxPowInfo(s, &chainjson.GetAuxPowInfoCmd{
+		NBlocks: chainjson.Int32(10),
+	}, nil)
+	require.NoError(t, err)
+
+	info := res.(*chainjson.GetAuxPowInfoResult)
+	require.Equal(t, int32(0), info.WindowStartHeight)
+	require.Equal(t, int32(0), info.WindowEndHeight)
+	require.Equal(t, params.GenesisHash.String(), info.WindowEndHash)
+	require.Equal(t, int32(1), info.WindowBlocks)
+	require.Equal(t, int32(0), info.AuxPowBlocks)
+	require.Equal(t, int32(1), info.NativeBlocks)
+	require.Empty(t, info.ParentChains)
+
+	_, err = handleGetAuxPowInfo(s, &chainjson.GetAuxPowInfoCmd{
+		NBlocks: chainjson.Int32(0),
+	}, nil)
+	var rpcErr *chainjson.RPCError
+	require.ErrorAs(t, err, &rpcErr)
+	require.Equal(t, chainjson.ErrRPCInvalidParameter, rpcErr.Code)
+
+	unknown := chainhash.Hash{0x01}.String()
+	_, err = handleGetAuxPowInfo(s, &chainjson.GetAuxPowInfoCmd{
+		NBlocks:   chainjson.Int32(10),
+		BlockHash: &unknown,
+	}, nil)
+	require.ErrorAs(t, err, &rpcErr)
+	require.Equal(t, chainjson.ErrRPCBlockNotFound, rpcErr.Code)
+}
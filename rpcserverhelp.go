@@ -35,6 +35,10 @@ var helpDescsEnUS = map[string]string{
 	"addnode-addr":      "IP address and port of the peer to operate on",
 	"addnode-subcmd":    "'add' to add a persistent peer, 'remove' to remove a persistent peer, or 'onetry' to try a single connection to a peer",
 
+	// ApproveReorgCmd help.
+	"approvereorg--synopsis": "Approves the reorganization of the main chain to the branch of the given block, which is no longer limited by the maximum reorganization depth set with --maxreorgdepth. The main chain is reorganized right away when the branch has more work.",
+	"approvereorg-blockhash": "The hash of a block of the branch to approve",
+
 	// NodeCmd help.
 	"node--synopsis":     "Attempts to add or remove a peer.",
 	"node-subcmd":        "'disconnect' to remove all matching non-persistent peers, 'remove' to remove a persistent peer, or 'connect' to connect to a peer",
@@ -118,6 +122,18 @@ var helpDescsEnUS = map[string]string{
 	"decodescript--synopsis": "Returns a JSON object with information about the provided hex-encoded script.",
 	"decodescript-hexscript": "Hex-encoded script",
 
+	// DumpTxOutSetCmd help.
+	"dumptxoutset--synopsis": "Writes a snapshot of the UTXO set at the tip of the best chain to a file, which can be loaded with loadtxoutset when its hash is committed in the chain parameters.",
+	"dumptxoutset-path":      "Path of the snapshot file, relative to the data directory unless absolute; it must not exist",
+
+	// DumpTxOutSetResult help.
+	"dumptxoutsetresult-coins_written": "Number of unspent outputs written",
+	"dumptxoutsetresult-base_hash":     "Hash of the block the snapshot is taken at",
+	"dumptxoutsetresult-base_height":   "Height of the block the snapshot is taken at",
+	"dumptxoutsetresult-path":          "Absolute path of the snapshot file",
+	"dumptxoutsetresult-txoutset_hash": "Hash of the serialized UTXO set, as committed in the chain parameters",
+	"dumptxoutsetresult-nchaintx":      "Number of transactions in the chain up to and including the base block",
+
 	// EstimateFeeCmd help.
 	"estimatefee--synopsis": "Estimate the fee per kilobyte in lokis " +
 		"required for a transaction to be mined before a certain number of " +
@@ -165,7 +181,7 @@ var helpDescsEnUS = map[string]string{
 	// GetBlockCmd help.
 	"getblock--synopsis":   "Returns information about a block given its hash.",
 	"getblock-hash":        "The hash of the block",
-	"getblock-verbosity":   "Specifies whether the block data should be returned as a hex-encoded string (0), as parsed data with a slice of TXIDs (1), or as parsed data with parsed transaction data (2) ",
+	"getblock-verbosity":   "Specifies whether the block data should be returned as a hex-encoded string (0), as parsed data with a slice of TXIDs (1), as parsed data with parsed transaction data (2), or as parsed transaction data with a decoded AuxPoW parent header (3)",
 	"getblock--condition0": "verbosity=0",
 	"getblock--condition1": "verbosity=1",
 	"getblock--result0":    "Hex-encoded bytes of the serialized block",
@@ -267,6 +283,19 @@ var helpDescsEnUS = map[string]string{
 	"auxpowresult-merklebranch":      "Merkle branch from coinbase tx to parent merkle root (hex hashes).",
 	"auxpowresult-chainmerklebranch": "Merkle branch from child hash to aux chain root (hex hashes).",
 	"auxpowresult-parentblock":       "Parent block header as hex.",
+	"auxpowresult-parentheader":      "Decoded parent block header (only when the decoded AuxPoW form is requested).",
+
+	// AuxPowParentHeaderResult help.
+	"auxpowparentheaderresult-hash":              "Hash of the parent block.",
+	"auxpowparentheaderresult-powhash":           "Scrypt proof-of-work hash of the parent block.",
+	"auxpowparentheaderresult-chainid":           "Chain ID encoded in the parent block version.",
+	"auxpowparentheaderresult-version":           "Parent block version.",
+	"auxpowparentheaderresult-versionHex":        "Parent block version in hexadecimal.",
+	"auxpowparentheaderresult-previousblockhash": "Hash of the block preceding the parent block on the parent chain.",
+	"auxpowparentheaderresult-merkleroot":        "Merkle root of the parent block.",
+	"auxpowparentheaderresult-time":              "Parent block time in seconds since 1 Jan 1970 GMT.",
+	"auxpowparentheaderresult-bits":              "Parent block difficulty bits.",
+	"auxpowparentheaderresult-nonce":             "Parent block nonce.",
 
 	// AuxPowTxResult help.
 	"auxpowtxresult-hex":      "Hex-encoded parent coinbase transaction.",
@@ -287,6 +316,13 @@ var helpDescsEnUS = map[string]string{
 	"getblockcount--synopsis": "Returns the number of blocks in the longest block chain.",
 	"getblockcount--result0":  "The current block count",
 
+	// GetBlockFromPeerCmd help.
+	"getblockfrompeer--synopsis": "Requests a block whose header is known, such as a pruned block, from the given peer.\n" +
+		"The block is stored once the peer sends it and it matches its header, without being processed, so getblock can return it until it's pruned again.\n" +
+		"The peer must serve all blocks.",
+	"getblockfrompeer-blockhash": "The hash of the block to request",
+	"getblockfrompeer-peerid":    "The id of the peer to request the block from, as returned by getpeerinfo",
+
 	// GetBlockHashCmd help.
 	"getblockhash--synopsis": "Returns hash of the block in best block chain at the given height.",
 	"getblockhash-index":     "The block height",
@@ -296,6 +332,7 @@ var helpDescsEnUS = map[string]string{
 	"getblockheader--synopsis":   "Returns information about a block header given its hash.",
 	"getblockheader-hash":        "The hash of the block",
 	"getblockheader-verbose":     "Specifies the block header is returned as a JSON object instead of hex-encoded string",
+	"getblockheader-auxpow":      "Include the decoded AuxPoW payload in the JSON object for merged-mined blocks",
 	"getblockheader--condition0": "verbose=false",
 	"getblockheader--condition1": "verbose=true",
 	"getblockheader--result0":    "The block header hash",
@@ -313,6 +350,7 @@ var helpDescsEnUS = map[string]string{
 	"getblockheaderverboseresult-difficulty":        "The proof-of-work difficulty as a multiple of the minimum difficulty",
 	"getblockheaderverboseresult-previousblockhash": "The hash of the previous block",
 	"getblockheaderverboseresult-nextblockhash":     "The hash of the next block (only if there is one)",
+	"getblockheaderverboseresult-auxpow":            "Decoded AuxPoW data (only when auxpow=true and the block is merged mined)",
 
 	// TemplateRequest help.
 	"templaterequest-mode":         "This is 'template', 'proposal', or omitted",
@@ -366,6 +404,28 @@ var helpDescsEnUS = map[string]string{
 	"createauxblockresult-height":            "Height of the candidate block.",
 	"createauxblockresult-target":            "Full 256-bit big-endian target threshold as hex.",
 
+	// GetAuxPowInfoCmd help.
+	"getauxpowinfo--synopsis": "Returns the share of merged-mined blocks within a window of the main chain.",
+	"getauxpowinfo-nblocks":   "Size of the window in number of blocks",
+	"getauxpowinfo-blockhash": "The hash of the block which ends the window (default: best block)",
+
+	// GetAuxPowInfoResult help.
+	"getauxpowinforesult-chainid":           "AuxPoW chain ID for this network",
+	"getauxpowinforesult-activationheight":  "Height from which AuxPoW blocks are accepted",
+	"getauxpowinforesult-windowstartheight": "Height of the first block in the window",
+	"getauxpowinforesult-windowendheight":   "Height of the last block in the window",
+	"getauxpowinforesult-windowendhash":     "Hash of the last block in the window",
+	"getauxpowinforesult-windowblocks":      "Number of blocks in the window",
+	"getauxpowinforesult-auxpowblocks":      "Number of merged-mined blocks in the window",
+	"getauxpowinforesult-nativeblocks":      "Number of natively mined blocks in the window",
+	"getauxpowinforesult-auxpowshare":       "Fraction of the window that was merged mined",
+	"getauxpowinforesult-parentchains":      "Merged-mined blocks broken down by parent chain ID",
+
+	// AuxPowParentChainResult help.
+	"auxpowparentchainresult-chainid": "Chain ID of the parent chain",
+	"auxpowparentchainresult-blocks":  "Number of blocks in the window mined on this parent chain",
+	"auxpowparentchainresult-share":   "Fraction of the window mined on this parent chain",
+
 	// GetBlockTemplateResult help.
 	"getblocktemplateresult-bits":                       "Hex-encoded compressed difficulty",
 	"getblocktemplateresult-curtime":                    "Current time as seen by the server (recommended for block time); must fall within mintime/maxtime rules",
@@ -407,10 +467,25 @@ var helpDescsEnUS = map[string]string{
 	"getchaintipsresult-height":    "The height of the chain tip",
 	"getchaintipsresult-hash":      "The block hash of the chain tip",
 	"getchaintipsresult-branchlen": "Returns zero for main chain. Otherwise is the length of branch connecting the tip to the main chain",
-	"getchaintipsresult-status":    "Status of the chain. Returns \"active\" for the main chain",
+	"getchaintipsresult-status":    "Status of the chain. Returns \"active\" for the main chain, \"valid-fork\" for a side branch whose blocks are stored, \"headers-only\" for a branch whose headers are known ahead of its blocks and \"invalid\" for a branch with an invalid block",
 	// GetChainTipsCmd help.
 	"getchaintips--synopsis": "Returns information about all known tips in the block tree, including the main chain as well as orphaned branches.",
 
+	// GetChainTxStatsCmd help.
+	"getchaintxstats--synopsis": "Returns statistics about the total number and rate of transactions in the main chain.",
+	"getchaintxstats-nblocks":   "The number of blocks in the window, which defaults to the blocks of about a month",
+	"getchaintxstats-blockhash": "The hash of the block that ends the window, which defaults to the best block",
+
+	// GetChainTxStatsResult help.
+	"getchaintxstatsresult-time":                      "The timestamp of the final block of the window in seconds since 1 Jan 1970 GMT",
+	"getchaintxstatsresult-txcount":                   "The total number of transactions in the chain up to the final block of the window",
+	"getchaintxstatsresult-window_final_block_hash":   "The hash of the final block of the window",
+	"getchaintxstatsresult-window_final_block_height": "The height of the final block of the window",
+	"getchaintxstatsresult-window_block_count":        "The number of blocks in the window",
+	"getchaintxstatsresult-window_tx_count":           "The number of transactions in the window, only returned when the window has blocks",
+	"getchaintxstatsresult-window_interval":           "The elapsed time in the window in seconds, only returned when the window has blocks",
+	"getchaintxstatsresult-txrate":                    "The average rate of transactions per second in the window, only returned when the window interval is positive",
+
 	// GetCFilterCmd help.
 	"getcfilter--synopsis":  "Returns a block's committed filter given its hash.",
 	"getcfilter-filtertype": "The type of filter to return (0=regular)",
@@ -520,6 +595,15 @@ var helpDescsEnUS = map[string]string{
 	"getnettotalsresult-totalbytesrecv": "Total bytes received",
 	"getnettotalsresult-totalbytessent": "Total bytes sent",
 	"getnettotalsresult-timemillis":     "Number of milliseconds since 1 Jan 1970 GMT",
+	"getnettotalsresult-uploadtarget":   "The upload target set with --maxuploadtarget",
+
+	// GetNetTotalsUploadTargetResult help.
+	"getnettotalsuploadtargetresult-timeframe":               "Length of an upload target cycle in seconds",
+	"getnettotalsuploadtargetresult-target":                  "Bytes that may be sent per cycle, 0 when there is no target",
+	"getnettotalsuploadtargetresult-target_reached":          "Whether the target is reached for the current cycle",
+	"getnettotalsuploadtargetresult-serve_historical_blocks": "Whether blocks older than a week are served to non-whitelisted peers",
+	"getnettotalsuploadtargetresult-bytes_left_in_cycle":     "Bytes left to send in the current cycle",
+	"getnettotalsuploadtargetresult-time_left_in_cycle":      "Seconds left in the current cycle",
 
 	// GetNodeAddressesResult help.
 	"getnodeaddressesresult-time":     "Timestamp in seconds since epoch (Jan 1 1970 GMT) keeping track of when the node was last seen",
@@ -554,6 +638,7 @@ var helpDescsEnUS = map[string]string{
 	"getpeerinforesult-banscore":       "The ban score",
 	"getpeerinforesult-feefilter":      "The requested minimum fee a transaction must have to be announced to the peer",
 	"getpeerinforesult-syncnode":       "Whether or not the peer is the sync peer",
+	"getpeerinforesult-permissions":    "The permissions granted to the peer by --whitelist and --whitebind (noban, relay, forcerelay, download, mempool)",
 
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
@@ -602,6 +687,16 @@ var helpDescsEnUS = map[string]string{
 	"invalidateblock--synopsis": "Invalidates the block of the given block hash. To re-validate the invalidated block, use the reconsiderblock rpc",
 	"invalidateblock-blockhash": "The block hash of the block to invalidate",
 
+	// LoadTxOutSetCmd help.
+	"loadtxoutset--synopsis": "Loads a UTXO set snapshot committed in the chain parameters and moves the chain tip to its base block. The blocks up to the base are then validated in the background, but they are never stored in the block database so the node stops advertising that it serves all blocks.",
+	"loadtxoutset-path":      "Path of the snapshot file, relative to the data directory unless absolute",
+
+	// LoadTxOutSetResult help.
+	"loadtxoutsetresult-coins_loaded": "Number of unspent outputs loaded",
+	"loadtxoutsetresult-tip_hash":     "Hash of the new chain tip, the base block of the snapshot",
+	"loadtxoutsetresult-base_height":  "Height of the base block of the snapshot",
+	"loadtxoutsetresult-path":         "Absolute path of the snapshot file",
+
 	// HelpCmd help.
 	"help--synopsis":   "Returns a list of all commands or help for a specified command.",
 	"help-command":     "The command to retrieve help for",
@@ -681,10 +776,26 @@ var helpDescsEnUS = map[string]string{
 		"The actual checks performed by the checklevel parameter are implementation specific.\n" +
 		"For lokid this is:\n" +
 		"checklevel=0 - Look up each block and ensure it can be loaded from the database.\n" +
-		"checklevel=1 - Perform basic context-free sanity checks on each block.",
-	"verifychain-checklevel": "How thorough the block verification is",
-	"verifychain-checkdepth": "The number of blocks to check",
-	"verifychain--result0":   "Whether or not the chain verified",
+		"checklevel=1 - Perform basic context-free sanity checks on each block.\n" +
+		"checklevel=2 - Ensure the spend journal entry of each block can be loaded and matches its inputs.\n" +
+		"checklevel=3 - Disconnect the blocks from a view of the UTXO set in memory.\n" +
+		"checklevel=4 - Reconnect the blocks with full validation and ensure the view matches the UTXO set.\n" +
+		"Each level also performs the checks of the lower levels.",
+	"verifychain-checklevel": "How thorough the block verification is, clamped to the highest supported level",
+	"verifychain-checkdepth": "The number of blocks to check from the tip of the best chain (0 = all)",
+
+	// VerifyChainResult help.
+	"verifychainresult-verified":      "Whether or not the chain verified",
+	"verifychainresult-checklevel":    "The check level that was used",
+	"verifychainresult-blockschecked": "The number of blocks that passed the checks",
+	"verifychainresult-failure":       "The first block that failed the checks, only present when the chain did not verify",
+
+	// VerifyChainFailure help.
+	"verifychainfailure-hash":       "The hash of the block that failed the checks",
+	"verifychainfailure-height":     "The height of the block that failed the checks",
+	"verifychainfailure-checklevel": "The check level of the failed check",
+	"verifychainfailure-check":      "The name of the failed check (read, sanity, undo, disconnect or reconnect)",
+	"verifychainfailure-reason":     "Why the block failed the check",
 
 	// VerifyMessageCmd help.
 	"verifymessage--synopsis": "Verify a signed message.",
@@ -700,7 +811,7 @@ var helpDescsEnUS = map[string]string{
 	"sessionresult-sessionid": "The unique session ID for a client's websocket connection.",
 
 	// NotifyBlocksCmd help.
-	"notifyblocks--synopsis": "Request notifications for whenever a block is connected or disconnected from the main (best) chain.",
+	"notifyblocks--synopsis": "Request notifications for whenever a block is connected or disconnected from the main (best) chain, or a reorganization of the main chain is refused for being too deep.",
 
 	// StopNotifyBlocksCmd help.
 	"stopnotifyblocks--synopsis": "Cancel registered notifications for whenever a block is connected or disconnected from the main (best) chain.",
@@ -1008,10 +1119,12 @@ var helpDescsEnUS = map[string]string{
 // pointer to the type (or nil to indicate no return value).
 var rpcResultTypes = map[string][]interface{}{
 	"addnode":              nil,
+	"approvereorg":         nil,
 	"createrawtransaction": {(*string)(nil)},
 	"debuglevel":           {(*string)(nil), (*string)(nil)},
 	"decoderawtransaction": {(*chainjson.TxRawDecodeResult)(nil)},
 	"decodescript":         {(*chainjson.DecodeScriptResult)(nil)},
+	"dumptxoutset":         {(*chainjson.DumpTxOutSetResult)(nil)},
 
 	"estimatefee":      {(*float64)(nil)},
 	"estimatesmartfee": {(*float64)(nil)},
@@ -1022,15 +1135,18 @@ var rpcResultTypes = map[string][]interface{}{
 	"getbestblockhash": {(*string)(nil)},
 	"getblock":         {(*string)(nil), (*chainjson.GetBlockVerboseResult)(nil)},
 	"getblockcount":    {(*int64)(nil)},
+	"getblockfrompeer": nil,
 	"getblockhash":     {(*string)(nil)},
 	"getblockheader":   {(*string)(nil), (*chainjson.GetBlockHeaderVerboseResult)(nil)},
 
 	"getblocktemplate": {(*chainjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
 	"createauxblock":   {(*chainjson.CreateAuxBlockResult)(nil), nil, nil},
 	"submitauxblock":   {(*chainjson.SubmitAuxBlockResult)(nil), nil, nil},
+	"getauxpowinfo":    {(*chainjson.GetAuxPowInfoResult)(nil)},
 
 	"getblockchaininfo":  {(*chainjson.GetBlockChainInfoResult)(nil)},
 	"getchaintips":       {(*[]chainjson.GetChainTipsResult)(nil)},
+	"getchaintxstats":    {(*chainjson.GetChainTxStatsResult)(nil)},
 	"getcfilter":         {(*string)(nil)},
 	"getcfilterheader":   {(*string)(nil)},
 	"getconnectioncount": {(*int32)(nil)},
@@ -1058,6 +1174,7 @@ var rpcResultTypes = map[string][]interface{}{
 	"node":                   nil,
 	"help":                   {(*string)(nil), (*string)(nil)},
 	"invalidateblock":        nil,
+	"loadtxoutset":           {(*chainjson.LoadTxOutSetResult)(nil)},
 	"ping":                   nil,
 	"reconsiderblock":        nil,
 	"searchrawtransactions":  {(*string)(nil), (*[]chainjson.SearchRawTransactionsResult)(nil)},
@@ -1068,7 +1185,7 @@ var rpcResultTypes = map[string][]interface{}{
 	"submitblock":            {nil, (*string)(nil)},
 	"uptime":                 {(*int64)(nil)},
 	"validateaddress":        {(*chainjson.ValidateAddressChainResult)(nil)},
-	"verifychain":            {(*bool)(nil)},
+	"verifychain":            {(*chainjson.VerifyChainResult)(nil)},
 	"verifymessage":          {(*bool)(nil)},
 	"version":                {(*map[string]chainjson.VersionResult)(nil)},
 	"testmempoolaccept":      {(*[]chainjson.TestMempoolAcceptResult)(nil)},
@@ -227,6 +227,20 @@ func (m *wsNotificationManager) NotifyBlockDisconnected(block *chainutil.Block)
 	}
 }
 
+// NotifyChainReorgBlocked passes a reorganization of the best chain refused for
+// being too deep to the notification manager for block notification
+// processing.
+func (m *wsNotificationManager) NotifyChainReorgBlocked(blocked *blockchain.ReorgBlocked) {
+	// As NotifyChainReorgBlocked will be called by the block manager
+	// and the RPC server may no longer be running, use a select
+	// statement to unblock enqueuing the notification once the RPC
+	// server has begun shutting down.
+	select {
+	case m.queueNotification <- (*notificationChainReorgBlocked)(blocked):
+	case <-m.quit:
+	}
+}
+
 // NotifyMempoolTx passes a transaction accepted by mempool to the
 // notification manager for transaction notification processing.  If
 // isNew is true, the tx is a new transaction, rather than one
@@ -448,6 +462,7 @@ func (f *wsClientFilter) removeUnspentOutPoint(op *wire.OutPoint) {
 // Notification types
 type notificationBlockConnected chainutil.Block
 type notificationBlockDisconnected chainutil.Block
+type notificationChainReorgBlocked blockchain.ReorgBlocked
 type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *chainutil.Tx
@@ -533,6 +548,12 @@ out:
 						block)
 				}
 
+			case *notificationChainReorgBlocked:
+				if len(blockNotifications) != 0 {
+					m.notifyChainReorgBlocked(blockNotifications,
+						(*blockchain.ReorgBlocked)(n))
+				}
+
 			case *notificationTxAcceptedByMempool:
 				if n.isNew && len(txNotifications) != 0 {
 					m.notifyForNewTx(txNotifications, n.tx)
@@ -731,6 +752,26 @@ func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]
 	}
 }
 
+// notifyChainReorgBlocked notifies websocket clients that have registered for
+// block updates when a reorganization of the main chain is refused for being
+// deeper than the configured maximum.
+func (*wsNotificationManager) notifyChainReorgBlocked(clients map[chan struct{}]*wsClient,
+	blocked *blockchain.ReorgBlocked) {
+
+	ntfn := chainjson.NewChainReorgBlockedNtfn(blocked.Hash.String(),
+		blocked.Height, blocked.ForkHash.String(), blocked.ForkHeight,
+		blocked.TipHash.String(), blocked.TipHeight, blocked.Depth)
+	marshalledJSON, err := chainjson.MarshalCmd(chainjson.RpcVersion1, nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal chain reorg blocked "+
+			"notification: %v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // notifyFilteredBlockConnected notifies websocket clients that have registered for
 // block updates when a block is connected to the main chain.
 func (m *wsNotificationManager) notifyFilteredBlockConnected(clients map[chan struct{}]*wsClient,
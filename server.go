@@ -202,6 +202,7 @@ type server struct {
 	// Putting the uint64s first makes them 64-bit aligned for 32-bit systems.
 	bytesReceived uint64 // Total bytes received from all peers since start.
 	bytesSent     uint64 // Total bytes sent by all peers since start.
+	services      uint64 // Services advertised to peers.
 	started       int32
 	shutdown      int32
 	shutdownSched int32
@@ -228,9 +229,10 @@ type server struct {
 	wg                   sync.WaitGroup
 	quit                 chan struct{}
 	nat                  NAT
+	onionTarget          string
+	i2pSession           *connmgr.I2PSession
 	db                   database.DB
 	timeSource           blockchain.MedianTimeSource
-	services             wire.ServiceFlag
 
 	// The following fields are used for optional indexes.  They will be nil
 	// if the associated index is not enabled.  These fields are set during
@@ -256,6 +258,28 @@ type server struct {
 	// agentWhitelist is a list of whitelisted user agent substrings, no
 	// whitelisting will be applied if the list is empty or nil.
 	agentWhitelist []string
+
+	// blockRelayConnManager maintains the block-relay-only outbound
+	// connections.  It is nil when no such connections are made.  The
+	// anchors are the block-relay-only peers of the previous run, which
+	// are connected to before any other address.
+	blockRelayConnManager *connmgr.ConnManager
+	anchorsMtx            sync.Mutex
+	anchors               []net.Addr
+
+	// evictionKey is a random secret used to key the network groups of
+	// inbound peers when choosing one to evict.
+	evictionKey uint64
+
+	// uploadTarget limits the bytes sent to peers per day.
+	uploadTarget *uploadTarget
+
+	// bgChain validates the blocks up to the base of the UTXO set snapshot
+	// the chain was loaded from until the snapshot is validated.  It's
+	// stored in bgDB.
+	bgMtx   sync.Mutex
+	bgChain *blockchain.BlockChain
+	bgDB    database.DB
 }
 
 // serverPeer extends the peer to maintain state shared by the server and
@@ -264,16 +288,25 @@ type serverPeer struct {
 	// The following variables must only be used atomically
 	feeFilter int64
 
+	// lastTxTime and lastBlockTime are the unix times in nanoseconds the
+	// peer last relayed a new transaction and block.  They protect useful
+	// inbound peers from eviction.
+	lastTxTime    int64
+	lastBlockTime int64
+
 	*peer.Peer
 
 	connReq        *connmgr.ConnReq
 	server         *server
 	persistent     bool
+	blockRelayOnly bool
 	continueHash   *chainhash.Hash
 	relayMtx       sync.Mutex
 	disableRelayTx bool
 	sentAddrs      bool
-	isWhitelisted  bool
+	permissions    peerPermissions
+	txRecon        *txReconState
+	capture        *messageCapture
 	filter         *bloom.Filter
 	addressesMtx   sync.RWMutex
 	knownAddresses lru.Cache
@@ -288,6 +321,11 @@ type serverPeer struct {
 	// connection drops before the peer finishes negotiation.
 	groupKey     string
 	groupCounted bool
+
+	// fetchedBlocks holds the blocks requested from the peer on demand,
+	// which are stored without being processed when they are received.
+	fetchedBlocksMtx sync.Mutex
+	fetchedBlocks    map[chainhash.Hash]struct{}
 }
 
 // newServerPeer returns a new serverPeer instance. The peer needs to be set by
@@ -304,6 +342,30 @@ func newServerPeer(s *server, isPersistent bool) *serverPeer {
 	}
 }
 
+// addFetchedBlock records the passed block was requested from the peer on
+// demand.
+func (sp *serverPeer) addFetchedBlock(hash *chainhash.Hash) {
+	sp.fetchedBlocksMtx.Lock()
+	if sp.fetchedBlocks == nil {
+		sp.fetchedBlocks = make(map[chainhash.Hash]struct{})
+	}
+	sp.fetchedBlocks[*hash] = struct{}{}
+	sp.fetchedBlocksMtx.Unlock()
+}
+
+// takeFetchedBlock returns whether the passed block was requested from the peer
+// on demand, and forgets the request.
+func (sp *serverPeer) takeFetchedBlock(hash *chainhash.Hash) bool {
+	sp.fetchedBlocksMtx.Lock()
+	defer sp.fetchedBlocksMtx.Unlock()
+
+	if _, ok := sp.fetchedBlocks[*hash]; !ok {
+		return false
+	}
+	delete(sp.fetchedBlocks, *hash)
+	return true
+}
+
 // newestBlock returns the current best block hash and height using the format
 // required by the configuration for the peer package.
 func (sp *serverPeer) newestBlock() (*chainhash.Hash, int32, error) {
@@ -386,13 +448,15 @@ func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddressV2) {
 			continue
 		}
 
-		// Must skip the V3 addresses for legacy ADDR messages.
-		if addr.IsTorV3() {
+		// Must skip addresses without a legacy encoding, such as
+		// torv3, i2p and cjdns addresses, for legacy ADDR messages.
+		legacyAddr := addr.ToLegacy()
+		if legacyAddr == nil {
 			continue
 		}
 
-		// Convert the NetAddressV2 to a legacy address.
-		addrs = append(addrs, addr.ToLegacy())
+		// Add the legacy address.
+		addrs = append(addrs, legacyAddr)
 	}
 
 	known, err := sp.PushAddrMsg(addrs)
@@ -427,8 +491,8 @@ func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) b
 	if cfg.DisableBanning {
 		return false
 	}
-	if sp.isWhitelisted {
-		peerLog.Debugf("Misbehaving whitelisted peer %s: %s", sp, reason)
+	if sp.permissions.has(permNoBan) {
+		peerLog.Debugf("Misbehaving noban peer %s: %s", sp, reason)
 		return false
 	}
 
@@ -537,6 +601,12 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 // OnVerAck is invoked when a peer receives a verack flokicoin message and is used
 // to kick start communication with them.
 func (sp *serverPeer) OnVerAck(_ *peer.Peer, _ *wire.MsgVerAck) {
+	// Set up transaction reconciliation when it was negotiated during the
+	// handshake.  The side that made the connection requests the rounds.
+	if localSalt, remoteSalt, ok := sp.TxReconciliation(); ok {
+		sp.txRecon = newTxReconState(!sp.Inbound(), localSalt,
+			remoteSalt)
+	}
 	sp.server.AddPeer(sp)
 }
 
@@ -545,9 +615,20 @@ func (sp *serverPeer) OnVerAck(_ *peer.Peer, _ *wire.MsgVerAck) {
 // pool up to the maximum inventory allowed per message.  When the peer has a
 // bloom filter loaded, the contents are filtered accordingly.
 func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
+	// Transactions are never relayed over block-relay-only connections.
+	if sp.BlockRelayOnly() {
+		peerLog.Debugf("peer %v sent mempool request over a "+
+			"block-relay-only connection -- disconnecting", sp)
+		sp.Disconnect()
+		return
+	}
+
 	// Only allow mempool requests if the server has bloom filtering
-	// enabled.
-	if sp.server.services&wire.SFNodeBloom != wire.SFNodeBloom {
+	// enabled or the peer has the mempool permission.
+	mempoolPerm := sp.permissions.has(permMempool)
+	if !mempoolPerm &&
+		sp.server.Services()&wire.SFNodeBloom != wire.SFNodeBloom {
+
 		peerLog.Debugf("peer %v sent mempool request with bloom "+
 			"filtering disabled -- disconnecting", sp)
 		sp.Disconnect()
@@ -558,7 +639,7 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 	// The ban score accumulates and passes the ban threshold if a burst of
 	// mempool messages comes from a peer. The score decays each minute to
 	// half of its value.
-	if sp.addBanScore(0, 33, "mempool") {
+	if !mempoolPerm && sp.addBanScore(0, 33, "mempool") {
 		return
 	}
 
@@ -595,11 +676,20 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 // handler this does not serialize all transactions through a single thread
 // transactions don't rely on the previous one in a linear fashion like blocks.
 func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
-	if cfg.BlocksOnly {
+	// Peers with the relay permission may still relay transactions in
+	// blocksonly mode.
+	relayPerm := sp.permissions.has(permRelay)
+	if cfg.BlocksOnly && !relayPerm {
 		peerLog.Tracef("Ignoring tx %v from %v - blocksonly enabled",
 			msg.TxHash(), sp)
 		return
 	}
+	if sp.BlockRelayOnly() {
+		peerLog.Debugf("Peer %v sent tx %v over a block-relay-only "+
+			"connection -- disconnecting", sp, msg.TxHash())
+		sp.Disconnect()
+		return
+	}
 
 	// Add the transaction to the known inventory for the peer.
 	// Convert the raw MsgTx to a chainutil.Tx which provides some convenience
@@ -608,13 +698,32 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
 	iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
 	sp.AddKnownInventory(iv)
 
+	// Transactions from peers with the forcerelay permission are relayed
+	// again even when they are already in the mempool.
+	if sp.permissions.has(permForceRelay) {
+		txD, err := sp.server.txMemPool.FetchTxDesc(tx.Hash())
+		if err == nil {
+			sp.server.relayTransactions([]*mempool.TxDesc{txD})
+			return
+		}
+	}
+
 	// Queue the transaction up to be handled by the sync manager and
 	// intentionally block further receives until the transaction is fully
 	// processed and known good or bad.  This helps prevent a malicious peer
 	// from queuing up a bunch of bad transactions before disconnecting (or
-	// being disconnected) and wasting memory.
-	sp.server.syncManager.QueueTx(tx, sp.Peer, sp.txProcessed)
+	// being disconnected) and wasting memory.  Transactions from peers
+	// with the relay permission are not rate limited.
+	wasInPool := sp.server.txMemPool.IsTransactionInPool(tx.Hash())
+	sp.server.syncManager.QueueTx(tx, sp.Peer, !relayPerm, sp.txProcessed)
 	<-sp.txProcessed
+
+	// Remember when the peer last relayed a transaction that was newly
+	// accepted to the main pool.  Transactions that were already known
+	// and orphans don't count, since any peer can send them for free.
+	if !wasInPool && sp.server.txMemPool.IsTransactionInPool(tx.Hash()) {
+		atomic.StoreInt64(&sp.lastTxTime, time.Now().UnixNano())
+	}
 }
 
 // OnBlock is invoked when a peer receives a block flokicoin message.  It
@@ -628,6 +737,21 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 	iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
 	sp.AddKnownInventory(iv)
 
+	// The blocks requested on demand, such as pruned blocks, are only
+	// stored so they can be served again, without being processed.
+	if sp.takeFetchedBlock(block.Hash()) {
+		if err := sp.server.chain.StoreFetchedBlock(block); err != nil {
+			peerLog.Warnf("Unable to store block %v fetched from "+
+				"%v: %v", block.Hash(), sp, err)
+			return
+		}
+		peerLog.Infof("Stored block %v fetched from %v", block.Hash(),
+			sp)
+		return
+	}
+
+	isNew := !sp.server.chain.MainChainHasBlock(block.Hash())
+
 	// Queue the block up to be handled by the block
 	// manager and intentionally block further receives
 	// until the flokicoin block is fully processed and known
@@ -641,6 +765,12 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 	// the flokicoin block has been fully processed.
 	sp.server.syncManager.QueueBlock(block, sp.Peer, sp.blockProcessed)
 	<-sp.blockProcessed
+
+	// Remember when the peer last relayed a block that extended the main
+	// chain.
+	if isNew && sp.server.chain.MainChainHasBlock(block.Hash()) {
+		atomic.StoreInt64(&sp.lastBlockTime, time.Now().UnixNano())
+	}
 }
 
 // OnInv is invoked when a peer receives an inv flokicoin message and is
@@ -648,7 +778,7 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 // accordingly.  We pass the message down to blockmanager which will call
 // QueueMessage with any appropriate responses.
 func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
-	if !cfg.BlocksOnly {
+	if !cfg.BlocksOnly && !sp.BlockRelayOnly() {
 		if len(msg.InvList) > 0 {
 			sp.server.syncManager.QueueInv(msg, sp.Peer)
 		}
@@ -659,7 +789,7 @@ func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
 	for _, invVect := range msg.InvList {
 		if invVect.Type == wire.InvTypeTx {
 			peerLog.Tracef("Ignoring tx %v in inv from %v -- "+
-				"blocksonly enabled", invVect.Hash, sp)
+				"transaction relay disabled", invVect.Hash, sp)
 			if sp.ProtocolVersion() >= wire.BIP0037Version {
 				peerLog.Infof("Peer %v is announcing "+
 					"transactions -- disconnecting", sp)
@@ -722,6 +852,22 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 		}
 		var err error
 		switch iv.Type {
+		case wire.InvTypeWitnessBlock, wire.InvTypeBlock,
+			wire.InvTypeFilteredWitnessBlock, wire.InvTypeFilteredBlock:
+
+			// Disconnect peers requesting historical blocks once
+			// the upload target no longer allows serving them.
+			filtered := iv.Type == wire.InvTypeFilteredWitnessBlock ||
+				iv.Type == wire.InvTypeFilteredBlock
+			if sp.server.refuseHistoricalBlock(sp, &iv.Hash, filtered) {
+				peerLog.Infof("Upload target reached -- "+
+					"disconnecting peer %v requesting historical "+
+					"block %v", sp, iv.Hash)
+				sp.Disconnect()
+				return
+			}
+		}
+		switch iv.Type {
 		case wire.InvTypeWitnessTx:
 			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
 		case wire.InvTypeTx:
@@ -1163,7 +1309,7 @@ func (sp *serverPeer) OnGetCFCheckpt(_ *peer.Peer, msg *wire.MsgGetCFCheckpt) {
 // version  that is high enough to observe the bloom filter service support bit,
 // it will be banned since it is intentionally violating the protocol.
 func (sp *serverPeer) enforceNodeBloomFlag(cmd string) bool {
-	if sp.server.services&wire.SFNodeBloom != wire.SFNodeBloom {
+	if sp.server.Services()&wire.SFNodeBloom != wire.SFNodeBloom {
 		// Ban the peer if the protocol version is high enough that the
 		// peer is knowingly violating the protocol and banning is
 		// enabled.
@@ -1412,6 +1558,18 @@ func (sp *serverPeer) OnWrite(_ *peer.Peer, bytesWritten int, msg wire.Message,
 	sp.server.AddBytesSent(uint64(bytesWritten))
 }
 
+// OnReadRaw is invoked with the raw bytes of the messages a peer receives
+// when --capturemessages is enabled, and it is used to capture them.
+func (sp *serverPeer) OnReadRaw(p *peer.Peer, raw []byte) {
+	sp.capture.write(p, false, raw)
+}
+
+// OnWriteRaw is invoked with the raw bytes of the messages a peer sends when
+// --capturemessages is enabled, and it is used to capture them.
+func (sp *serverPeer) OnWriteRaw(p *peer.Peer, raw []byte) {
+	sp.capture.write(p, true, raw)
+}
+
 // OnNotFound is invoked when a peer sends a notfound message.
 func (sp *serverPeer) OnNotFound(p *peer.Peer, msg *wire.MsgNotFound) {
 	if !sp.Connected() {
@@ -1742,7 +1900,7 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		sp.Disconnect()
 		return false
 	}
-	if banEnd, ok := state.banned[host]; ok {
+	if banEnd, ok := state.banned[host]; ok && !sp.permissions.has(permNoBan) {
 		if time.Now().Before(banEnd) {
 			srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
 				host, time.Until(banEnd))
@@ -1756,8 +1914,11 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 
 	// TODO: Check for max peers from a single IP.
 
-	// Limit max number of total peers.
-	if state.Count() >= cfg.MaxPeers {
+	// Limit max number of total peers.  New inbound peers may take the
+	// place of an evicted inbound peer.
+	if state.Count() >= cfg.MaxPeers &&
+		(!sp.Inbound() || !s.evictInboundPeer(state)) {
+
 		srvrLog.Infof("Max peers reached [%d] - disconnecting peer %s",
 			cfg.MaxPeers, sp)
 		sp.Disconnect()
@@ -1803,8 +1964,10 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 	if !cfg.SimNet && !sp.Inbound() {
 		// Advertise the local address when the server accepts incoming
 		// connections and it believes itself to be close to the best
-		// known tip.
-		if !cfg.DisableListen && s.syncManager.IsCurrent() {
+		// known tip.  Addresses are not exchanged over
+		// block-relay-only connections.
+		blockRelayOnly := sp.BlockRelayOnly()
+		if !cfg.DisableListen && !blockRelayOnly && s.syncManager.IsCurrent() {
 			// Get address that best matches.
 			lna := s.addrManager.GetBestLocalAddress(sp.NA())
 			if netaddr.IsRoutable(lna) {
@@ -1818,7 +1981,9 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		// more and the peer has a protocol version new enough to
 		// include a timestamp with addresses.
 		hasTimestamp := sp.ProtocolVersion() >= wire.NetAddressTimeVersion
-		if s.addrManager.NeedMoreAddresses() && hasTimestamp {
+		if s.addrManager.NeedMoreAddresses() && hasTimestamp &&
+			!blockRelayOnly {
+
 			sp.QueueMessage(wire.NewMsgGetAddr(), nil)
 		}
 
@@ -1845,11 +2010,12 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 	// our connection manager about the disconnection. This can happen if we
 	// process a peer's `done` message before its `add`.
 	if !sp.Inbound() {
+		cm := s.outboundConnManager(sp.blockRelayOnly)
 		if sp.persistent {
-			s.connManager.Disconnect(sp.connReq.ID())
+			cm.Disconnect(sp.connReq.ID())
 		} else {
-			s.connManager.Remove(sp.connReq.ID())
-			go s.connManager.NewConnReq()
+			cm.Remove(sp.connReq.ID())
+			go cm.NewConnReq()
 		}
 	}
 
@@ -1888,6 +2054,13 @@ func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
 // known to have it.  It is invoked from the peerHandler goroutine.
 func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
+	// Transactions are only flooded to a few of the outbound peers
+	// reconciling transactions.
+	var fanout map[int32]struct{}
+	if msg.invVect.Type == wire.InvTypeTx && cfg.TxReconciliation {
+		fanout = txReconFanout(state, &msg.invVect.Hash)
+	}
+
 	state.forAllPeers(func(sp *serverPeer) {
 		if !sp.Connected() {
 			return
@@ -1915,8 +2088,9 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 
 		if msg.invVect.Type == wire.InvTypeTx {
 			// Don't relay the transaction to the peer when it has
-			// transaction relaying disabled.
-			if sp.relayTxDisabled() {
+			// transaction relaying disabled or the connection is
+			// block-relay-only.
+			if sp.relayTxDisabled() || sp.BlockRelayOnly() {
 				return
 			}
 
@@ -1942,6 +2116,17 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 					return
 				}
 			}
+
+			// Peers reconciling transactions learn about the
+			// transaction in the next reconciliation round unless
+			// it is flooded to them or their set is full.
+			_, flood := fanout[sp.ID()]
+			if sp.txRecon != nil && !flood &&
+				!sp.IsKnownInventory(msg.invVect) &&
+				sp.txRecon.add(txD.Tx) {
+
+				return
+			}
 		}
 
 		// Queue the inventory to be relayed with the next batch.
@@ -1982,6 +2167,10 @@ type getOutboundGroup struct {
 	reply chan int
 }
 
+type getOutboundNetworksMsg struct {
+	reply chan map[netaddr.Network]int
+}
+
 type getAddedNodesMsg struct {
 	reply chan []*serverPeer
 }
@@ -2002,6 +2191,12 @@ type removeNodeMsg struct {
 	reply chan error
 }
 
+type fetchBlockMsg struct {
+	id    int32
+	hash  *chainhash.Hash
+	reply chan error
+}
+
 // handleQuery is the central handler for all queries and commands from other
 // goroutines related to peer state.
 func (s *server) handleQuery(state *peerState, querymsg interface{}) {
@@ -2074,6 +2269,17 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		} else {
 			msg.reply <- 0
 		}
+	case getOutboundNetworksMsg:
+		// Persistent peers are not counted since they are not
+		// chosen from the address manager, nor are block-relay-only
+		// peers which have their own connection slots.
+		counts := make(map[netaddr.Network]int)
+		for _, sp := range state.outboundPeers {
+			if !sp.blockRelayOnly {
+				counts[netaddr.NetworkOf(sp.NA())]++
+			}
+		}
+		msg.reply <- counts
 	// Request a list of the persistent (added) peers.
 	case getAddedNodesMsg:
 		// Respond with a slice of the relevant peers.
@@ -2082,6 +2288,34 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 			peers = append(peers, sp)
 		}
 		msg.reply <- peers
+	case fetchBlockMsg:
+		var target *serverPeer
+		state.forAllPeers(func(sp *serverPeer) {
+			if sp.ID() == msg.id && sp.Connected() {
+				target = sp
+			}
+		})
+		if target == nil {
+			msg.reply <- errors.New("peer not found")
+			return
+		}
+
+		// Only full nodes serve the blocks below the last ones.
+		if !hasServices(target.Services(), wire.SFNodeNetwork) {
+			msg.reply <- errors.New("peer does not serve all blocks")
+			return
+		}
+
+		invType := wire.InvTypeBlock
+		if hasServices(target.Services(), wire.SFNodeWitness) {
+			invType = wire.InvTypeWitnessBlock
+		}
+		target.addFetchedBlock(msg.hash)
+		gdmsg := wire.NewMsgGetData()
+		gdmsg.AddInvVect(wire.NewInvVect(invType, msg.hash))
+		target.QueueMessage(gdmsg, nil)
+		msg.reply <- nil
+
 	case disconnectNodeMsg:
 		// Check inbound peers. We pass a nil callback since we don't
 		// require any additional actions on disconnect for inbound peers.
@@ -2140,7 +2374,7 @@ func disconnectPeer(peerList map[int32]*serverPeer, compareFunc func(*serverPeer
 
 // newPeerConfig returns the configuration for the given serverPeer.
 func newPeerConfig(sp *serverPeer) *peer.Config {
-	return &peer.Config{
+	config := &peer.Config{
 		Listeners: peer.MessageListeners{
 			OnVersion:      sp.OnVersion,
 			OnVerAck:       sp.OnVerAck,
@@ -2165,6 +2399,9 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnRead:         sp.OnRead,
 			OnWrite:        sp.OnWrite,
 			OnNotFound:     sp.OnNotFound,
+			OnReqRecon:     sp.OnReqRecon,
+			OnSketch:       sp.OnSketch,
+			OnReconcilDiff: sp.OnReconcilDiff,
 
 			// Note: The reference client currently bans peers that send alerts
 			// not signed with its key.  We could verify against their key, but
@@ -2179,12 +2416,22 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 		UserAgentVersion:    userAgentVersion,
 		UserAgentComments:   cfg.UserAgentComments,
 		ChainParams:         sp.server.chainParams,
-		Services:            sp.server.services,
+		Services:            sp.server.Services(),
 		DisableRelayTx:      cfg.BlocksOnly,
+		BlockRelayOnly:      sp.blockRelayOnly,
+		TxReconciliation:    cfg.TxReconciliation,
 		ProtocolVersion:     peer.MaxProtocolVersion,
 		TrickleInterval:     cfg.TrickleInterval,
 		DisableStallHandler: cfg.DisableStallHandler,
 	}
+
+	// Capture the raw messages exchanged with the peer when enabled.
+	if sp.capture != nil {
+		config.Listeners.OnReadRaw = sp.OnReadRaw
+		config.Listeners.OnWriteRaw = sp.OnWriteRaw
+	}
+
+	return config
 }
 
 // inboundPeerConnected is invoked by the connection manager when a new inbound
@@ -2193,7 +2440,11 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 // for disconnection.
 func (s *server) inboundPeerConnected(conn net.Conn) {
 	sp := newServerPeer(s, false)
-	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
+	sp.permissions = whitelistPermissions(conn.RemoteAddr()) |
+		whiteBindPermissions(conn.LocalAddr())
+	if cfg.CaptureMessages {
+		sp.capture = &messageCapture{}
+	}
 	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp))
 	sp.AssociateConnection(conn)
 	go s.peerDoneHandler(sp)
@@ -2205,21 +2456,42 @@ func (s *server) inboundPeerConnected(conn net.Conn) {
 // request instance and the connection itself, and finally notifies the address
 // manager of the attempt.
 func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
+	s.newOutboundPeer(c, conn, false)
+}
+
+// blockRelayPeerConnected is invoked by the block-relay-only connection
+// manager when a new outbound connection is established.  It initializes a
+// new outbound server peer which only relays blocks.
+func (s *server) blockRelayPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
+	s.newOutboundPeer(c, conn, true)
+}
+
+// newOutboundPeer initializes a new outbound server peer for the passed
+// connection request and connection and starts a goroutine to wait for
+// disconnection.
+func (s *server) newOutboundPeer(c *connmgr.ConnReq, conn net.Conn,
+	blockRelayOnly bool) {
+
 	sp := newServerPeer(s, c.Permanent)
+	sp.blockRelayOnly = blockRelayOnly
+	if cfg.CaptureMessages {
+		sp.capture = &messageCapture{}
+	}
 	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String())
 	if err != nil {
 		srvrLog.Debugf("Cannot create outbound peer %s: %v", c.Addr, err)
+		cm := s.outboundConnManager(blockRelayOnly)
 		if c.Permanent {
-			s.connManager.Disconnect(c.ID())
+			cm.Disconnect(c.ID())
 		} else {
-			s.connManager.Remove(c.ID())
-			go s.connManager.NewConnReq()
+			cm.Remove(c.ID())
+			go cm.NewConnReq()
 		}
 		return
 	}
 	sp.Peer = p
 	sp.connReq = c
-	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
+	sp.permissions = whitelistPermissions(conn.RemoteAddr())
 	sp.AssociateConnection(conn)
 	go s.peerDoneHandler(sp)
 }
@@ -2229,6 +2501,9 @@ func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 func (s *server) peerDoneHandler(sp *serverPeer) {
 	sp.WaitForDisconnect()
 	s.donePeers <- sp
+	if sp.capture != nil {
+		sp.capture.close()
+	}
 
 	// Only tell sync manager we are gone if we ever told it we existed.
 	if sp.VerAckReceived() {
@@ -2267,19 +2542,40 @@ func (s *server) peerHandler() {
 		outboundGroups:  make(map[string]int),
 	}
 
-	if !cfg.DisableDNSSeed {
+	// DNS seeds only return IP addresses, so there is no point in
+	// querying them when neither IPv4 nor IPv6 is reachable.
+	seedable := false
+	for _, n := range reachableNetworks() {
+		if n == netaddr.NetworkIPv4 || n == netaddr.NetworkIPv6 {
+			seedable = true
+		}
+	}
+	if !cfg.DisableDNSSeed && seedable {
 		// Add peers discovered through DNS to the address manager.
 		connmgr.SeedFromDNS(activeNetParams.Params, defaultRequiredServices,
 			lookup, func(addrs []*wire.NetAddressV2) {
+				reachable := addrs[:0]
+				for _, addr := range addrs {
+					if s.addrManager.IsReachable(addr) {
+						reachable = append(reachable, addr)
+					}
+				}
+				if len(reachable) == 0 {
+					return
+				}
+
 				// Lokid uses a lookup of the dns seeder here. This
 				// is rather strange since the values looked up by the
 				// DNS seed lookups will vary quite a lot.
 				// to replicate this behaviour we put all addresses as
 				// having come from the first one.
-				s.addrManager.AddAddresses(addrs, addrs[0])
+				s.addrManager.AddAddresses(reachable, reachable[0])
 			})
 	}
 	go s.connManager.Start()
+	if s.blockRelayConnManager != nil {
+		go s.blockRelayConnManager.Start()
+	}
 
 out:
 	for {
@@ -2313,6 +2609,10 @@ out:
 			s.handleQuery(state, qmsg)
 
 		case <-s.quit:
+			// Remember the block-relay-only peers to reconnect to
+			// them first on the next start.
+			s.saveAnchors(state)
+
 			// Disconnect all peers on server shutdown.
 			state.forAllPeers(func(sp *serverPeer) {
 				srvrLog.Tracef("Shutdown peer %s", sp)
@@ -2323,7 +2623,14 @@ out:
 	}
 
 	s.connManager.Stop()
+	if s.blockRelayConnManager != nil {
+		s.blockRelayConnManager.Stop()
+	}
+	if s.i2pSession != nil {
+		s.i2pSession.Close()
+	}
 	s.syncManager.Stop()
+	s.closeBackgroundChain()
 	s.addrManager.Stop()
 
 	// Drain channels before exiting so nothing is left waiting around
@@ -2387,10 +2694,19 @@ func (s *server) OutboundGroupCount(key string) int {
 	return <-replyChan
 }
 
+// OutboundNetworkCounts returns the number of automatic outbound peers
+// connected in each network.
+func (s *server) OutboundNetworkCounts() map[netaddr.Network]int {
+	replyChan := make(chan map[netaddr.Network]int)
+	s.query <- getOutboundNetworksMsg{reply: replyChan}
+	return <-replyChan
+}
+
 // AddBytesSent adds the passed number of bytes to the total bytes sent counter
 // for the server.  It is safe for concurrent access.
 func (s *server) AddBytesSent(bytesSent uint64) {
 	atomic.AddUint64(&s.bytesSent, bytesSent)
+	s.uploadTarget.addBytes(bytesSent, time.Now())
 }
 
 // AddBytesReceived adds the passed number of bytes to the total bytes received
@@ -2406,6 +2722,18 @@ func (s *server) NetTotals() (uint64, uint64) {
 		atomic.LoadUint64(&s.bytesSent)
 }
 
+// Services returns the services the server advertises to peers.  It is safe
+// for concurrent access.
+func (s *server) Services() wire.ServiceFlag {
+	return wire.ServiceFlag(atomic.LoadUint64(&s.services))
+}
+
+// clearServices stops advertising the passed services to the peers that
+// connect from now on.  It is safe for concurrent access.
+func (s *server) clearServices(services wire.ServiceFlag) {
+	atomic.AndUint64(&s.services, ^uint64(services))
+}
+
 // UpdatePeerHeights updates the heights of all peers who have have announced
 // the latest connected main chain block, or a recognized orphan. These height
 // updates allow us to dynamically refresh peer heights, ensuring sync peer
@@ -2491,11 +2819,27 @@ func (s *server) Start() {
 	s.wg.Add(1)
 	go s.peerHandler()
 
+	// Resume validating the UTXO snapshot the chain was loaded from.
+	if err := s.startBackgroundChain(); err != nil {
+		srvrLog.Errorf("Unable to start validating the UTXO snapshot "+
+			"in the background: %v", err)
+	}
+
 	if s.nat != nil {
 		s.wg.Add(1)
 		go s.upnpUpdateThread()
 	}
 
+	if cfg.TorControl != "" && s.onionTarget != "" {
+		s.wg.Add(1)
+		go s.torControlHandler()
+	}
+
+	if cfg.TxReconciliation {
+		s.wg.Add(1)
+		go s.txReconHandler()
+	}
+
 	if !cfg.DisableRPC {
 		s.wg.Add(1)
 
@@ -2660,7 +3004,7 @@ out:
 					srvrLog.Warnf("UPnP can't get external address: %v", err)
 					continue out
 				}
-				na := wire.NetAddressV2FromBytes(time.Now(), s.services,
+				na := wire.NetAddressV2FromBytes(time.Now(), s.Services(),
 					externalip, uint16(listenPort))
 				err = s.addrManager.AddLocalAddress(na, netaddr.UpnpPrio)
 				if err != nil {
@@ -2737,10 +3081,12 @@ func setupRPCListeners() ([]net.Listener, error) {
 
 // newServer returns a new lokid server configured to listen on addr for the
 // flokicoin network type specified by chainParams.  Use start to begin accepting
-// connections from peers.
+// connections from peers.  The block database is rebuilt from the block files
+// of the database at reindexPath when it's not empty, and the stored blocks are
+// replayed when replayBlocks is set, before the server is returned.
 func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
-	db database.DB, chainParams *chaincfg.Params,
-	interrupt <-chan struct{}) (*server, error) {
+	db database.DB, chainParams *chaincfg.Params, reindexPath string,
+	replayBlocks bool, interrupt <-chan struct{}) (*server, error) {
 
 	services := defaultServices
 	if cfg.NoPeerBloomFilters {
@@ -2753,7 +3099,18 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		services &^= wire.SFNodeNetwork
 	}
 
+	// The blocks before the base of a UTXO set snapshot are not stored.
+	_, snapshotLoaded, err := blockchain.FetchSnapshotStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	if snapshotLoaded {
+		services &^= wire.SFNodeNetwork
+	}
+
 	amgr := netaddr.New(cfg.DataDir, lookup)
+	amgr.SetCJDNSReachable(cfg.CJDNSReachable)
+	amgr.SetReachableNetworks(reachableNetworks())
 
 	var listeners []net.Listener
 	var nat NAT
@@ -2768,6 +3125,16 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		}
 	}
 
+	// The I2P session is a listener for incoming I2P streams in addition
+	// to dialing I2P peers.
+	i2pSession, err := newI2PSession(amgr, services)
+	if err != nil {
+		return nil, err
+	}
+	if i2pSession != nil && !cfg.DisableListen {
+		listeners = append(listeners, i2pSession)
+	}
+
 	if len(agentBlacklist) > 0 {
 		srvrLog.Infof("User-agent blacklist %s", agentBlacklist)
 	}
@@ -2788,14 +3155,22 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		modifyRebroadcastInv: make(chan interface{}),
 		peerHeightsUpdate:    make(chan updatePeerHeightsMsg),
 		nat:                  nat,
+		onionTarget:          onionServiceTarget(listeners),
+		i2pSession:           i2pSession,
 		db:                   db,
 		timeSource:           blockchain.NewMedianTime(),
-		services:             services,
+		services:             uint64(services),
 		sigCache:             txscript.NewSigCache(cfg.SigCacheMaxSize),
 		hashCache:            txscript.NewHashCache(cfg.SigCacheMaxSize),
 		cfCheckptCaches:      make(map[wire.FilterType][]cfHeaderKV),
 		agentBlacklist:       agentBlacklist,
 		agentWhitelist:       agentWhitelist,
+		uploadTarget: newUploadTarget(cfg.MaxUploadTarget*1024*1024,
+			chainParams.TargetTimePerBlock),
+	}
+	err = binary.Read(rand.Reader, binary.LittleEndian, &s.evictionKey)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create the transaction and address indexes if needed.
@@ -2842,24 +3217,37 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		checkpoints = mergeCheckpoints(s.chainParams.Checkpoints, cfg.addCheckpoints)
 	}
 
+	// Log the assumed valid block.
+	if cfg.assumeValid != nil {
+		flcdLog.Infof("Assuming valid scripts for block %v and its "+
+			"ancestors", cfg.assumeValid)
+	}
+
 	// Log that the node is pruned.
 	if cfg.Prune != 0 {
 		flcdLog.Infof("Prune set to %d MiB", cfg.Prune)
 	}
 
+	// Log that the automatic reorganizations are limited.
+	if cfg.MaxReorgDepth != 0 {
+		flcdLog.Infof("Max automatic reorganization depth set to %d "+
+			"blocks", cfg.MaxReorgDepth)
+	}
+
 	// Create a new block chain instance with the appropriate configuration.
-	var err error
 	s.chain, err = blockchain.New(&blockchain.Config{
 		DB:               s.db,
 		Interrupt:        interrupt,
 		ChainParams:      s.chainParams,
 		Checkpoints:      checkpoints,
+		AssumeValid:      cfg.assumeValid,
 		TimeSource:       s.timeSource,
 		SigCache:         s.sigCache,
 		IndexManager:     indexManager,
 		HashCache:        s.hashCache,
 		Prune:            cfg.Prune * 1024 * 1024,
 		UtxoCacheMaxSize: uint64(cfg.UtxoCacheMaxSizeMiB) * 1024 * 1024,
+		MaxReorgDepth:    cfg.MaxReorgDepth,
 	})
 	if err != nil {
 		return nil, err
@@ -2913,6 +3301,13 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		return nil, err
 	}
 
+	// Rebuild the block database or the chain state before the RPC server
+	// subscribes to the notifications of the chain, since it's only
+	// started with the server.
+	if err := s.reindex(reindexPath, replayBlocks, interrupt); err != nil {
+		return nil, err
+	}
+
 	// Create the mining policy and block template generator based on the
 	// configuration options.
 	//
@@ -2938,6 +3333,11 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		IsCurrent:              s.syncManager.IsCurrent,
 	})
 
+	targetOutbound := defaultTargetOutbound
+	if cfg.MaxPeers < targetOutbound {
+		targetOutbound = cfg.MaxPeers
+	}
+
 	// Only setup a function to return new addresses to connect to when
 	// not running in connect-only mode.  The simulation network is always
 	// in connect-only mode since it is only intended to connect to
@@ -2947,8 +3347,18 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	var newAddressFunc func() (net.Addr, error)
 	if !cfg.SimNet && len(cfg.ConnectPeers) == 0 {
 		newAddressFunc = func() (net.Addr, error) {
+			// Prefer networks that are below their share of the
+			// outbound slots so a single network can't take all
+			// of them.
+			underTarget := s.underTargetNetworks(targetOutbound)
 			for tries := 0; tries < 100; tries++ {
-				addr := s.addrManager.GetAddress()
+				var addr *netaddr.KnownAddress
+				if len(underTarget) > 0 && tries < 50 {
+					addr = s.addrManager.GetAddressFromNetworks(underTarget)
+				}
+				if addr == nil {
+					addr = s.addrManager.GetAddress()
+				}
 				if addr == nil {
 					break
 				}
@@ -2964,6 +3374,12 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 					continue
 				}
 
+				// The address manager only returns addresses in
+				// reachable networks, which excludes I2P without a
+				// SAM bridge and CJDNS when the node is not part of
+				// the CJDNS network.
+				isI2P := addr.NetAddress().IsI2P()
+
 				// only allow recent nodes (10mins) after we failed 30
 				// times
 				if tries < 30 && time.Since(addr.LastAttempt()) < 10*time.Minute {
@@ -2971,8 +3387,10 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 				}
 
 				// allow nondefault ports after 50 failed tries.
-				if tries < 50 && fmt.Sprintf("%d", addr.NetAddress().Port) !=
-					activeNetParams.DefaultPort {
+				// I2P addresses have no ports.
+				if tries < 50 && !isI2P &&
+					fmt.Sprintf("%d", addr.NetAddress().Port) !=
+						activeNetParams.DefaultPort {
 					continue
 				}
 
@@ -2988,16 +3406,12 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	}
 
 	// Create a connection manager.
-	targetOutbound := defaultTargetOutbound
-	if cfg.MaxPeers < targetOutbound {
-		targetOutbound = cfg.MaxPeers
-	}
 	cmgr, err := connmgr.New(&connmgr.Config{
 		Listeners:      listeners,
 		OnAccept:       s.inboundPeerConnected,
 		RetryDuration:  connectionRetryInterval,
 		TargetOutbound: uint32(targetOutbound),
-		Dial:           dial,
+		Dial:           s.dialPeer,
 		OnConnection:   s.outboundPeerConnected,
 		GetNewAddress:  newAddressFunc,
 	})
@@ -3006,6 +3420,34 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	}
 	s.connManager = cmgr
 
+	// Maintain block-relay-only connections, which make it harder to
+	// partition the node, when peers are discovered automatically and
+	// there are slots left for them.  The anchors of the previous run are
+	// connected to first.
+	blockRelayOutbound := defaultBlockRelayOutbound
+	if cfg.MaxPeers-targetOutbound < blockRelayOutbound {
+		blockRelayOutbound = cfg.MaxPeers - targetOutbound
+	}
+	if newAddressFunc != nil && blockRelayOutbound > 0 {
+		s.anchors = readAnchors(anchorsPath(), s.addrManager)
+		brcmgr, err := connmgr.New(&connmgr.Config{
+			RetryDuration:  connectionRetryInterval,
+			TargetOutbound: uint32(blockRelayOutbound),
+			Dial:           s.dialPeer,
+			OnConnection:   s.blockRelayPeerConnected,
+			GetNewAddress: func() (net.Addr, error) {
+				if addr := s.popAnchor(); addr != nil {
+					return addr, nil
+				}
+				return newAddressFunc()
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.blockRelayConnManager = brcmgr
+	}
+
 	// Start up persistent peers.
 	permanentPeers := cfg.ConnectPeers
 	if len(permanentPeers) == 0 {
@@ -3143,6 +3585,53 @@ func initListeners(amgr *netaddr.AddrManager, listenAddrs []string, services wir
 	return listeners, nat, nil
 }
 
+// reachableNetworks returns the networks automatic outbound connections are
+// made to.  These are the networks passed with --onlynet or, when there are
+// none, every network the configuration allows connecting to.
+func reachableNetworks() []netaddr.Network {
+	if len(cfg.onlyNets) > 0 {
+		return cfg.onlyNets
+	}
+
+	// Onion addresses can only be reached through a proxy.
+	nets := []netaddr.Network{netaddr.NetworkIPv4, netaddr.NetworkIPv6}
+	if !cfg.NoOnion && (cfg.OnionProxy != "" || cfg.Proxy != "") {
+		nets = append(nets, netaddr.NetworkOnion)
+	}
+	if cfg.I2PSAM != "" {
+		nets = append(nets, netaddr.NetworkI2P)
+	}
+	if cfg.CJDNSReachable {
+		nets = append(nets, netaddr.NetworkCJDNS)
+	}
+	return nets
+}
+
+// underTargetNetworks returns the reachable networks with known addresses that
+// have fewer automatic outbound peers than their share of the target outbound
+// connections.  The share is split evenly between those networks.
+func (s *server) underTargetNetworks(targetOutbound int) []netaddr.Network {
+	var available []netaddr.Network
+	for _, n := range reachableNetworks() {
+		if s.addrManager.NetworkAddressCount(n) > 0 {
+			available = append(available, n)
+		}
+	}
+	if len(available) < 2 {
+		return nil
+	}
+
+	limit := (targetOutbound + len(available) - 1) / len(available)
+	counts := s.OutboundNetworkCounts()
+	var under []netaddr.Network
+	for _, n := range available {
+		if counts[n] < limit {
+			under = append(under, n)
+		}
+	}
+	return under
+}
+
 // addrStringToNetAddr takes an address in the form of 'host:port' and returns
 // a net.Addr which maps to the original address with any host names resolved
 // to IP addresses.  It also handles tor addresses properly by returning a
@@ -3176,6 +3665,15 @@ func addrStringToNetAddr(addr string) (net.Addr, error) {
 		return &onionAddr{addr: addr}, nil
 	}
 
+	// I2P addresses are dialed through the SAM bridge.
+	if strings.HasSuffix(host, connmgr.I2PAddrSuffix) {
+		if cfg.I2PSAM == "" {
+			return nil, errI2PDisabled
+		}
+
+		return &connmgr.I2PAddr{Host: host}, nil
+	}
+
 	// Attempt to look up an IP address associated with the parsed host.
 	ips, err := lookup(host)
 	if err != nil {
@@ -3261,32 +3759,6 @@ func dynamicTickDuration(remaining time.Duration) time.Duration {
 	return time.Hour
 }
 
-// isWhitelisted returns whether the IP address is included in the whitelisted
-// networks and IPs.
-func isWhitelisted(addr net.Addr) bool {
-	if len(cfg.whitelists) == 0 {
-		return false
-	}
-
-	host, _, err := net.SplitHostPort(addr.String())
-	if err != nil {
-		srvrLog.Warnf("Unable to SplitHostPort on '%s': %v", addr, err)
-		return false
-	}
-	ip := net.ParseIP(host)
-	if ip == nil {
-		srvrLog.Warnf("Unable to parse IP '%s'", addr)
-		return false
-	}
-
-	for _, ipnet := range cfg.whitelists {
-		if ipnet.Contains(ip) {
-			return true
-		}
-	}
-	return false
-}
-
 // checkpointSorter implements sort.Interface to allow a slice of checkpoints to
 // be sorted.
 type checkpointSorter []chaincfg.Checkpoint
@@ -0,0 +1,256 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/flokiorg/go-flokicoin/blockchain"
+	"github.com/flokiorg/go-flokicoin/chaincfg"
+	"github.com/flokiorg/go-flokicoin/database"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// backgroundDbPath returns the path to the database of the background chain
+// that validates the blocks up to the base of the UTXO set snapshot the chain
+// was loaded from.
+func backgroundDbPath() string {
+	return blockDbPath(cfg.DbType) + "_background"
+}
+
+// loadBackgroundDB loads (or creates when needed) the database of the
+// background chain.
+func loadBackgroundDB() (database.DB, error) {
+	if cfg.DbType == "memdb" {
+		return database.Create(cfg.DbType)
+	}
+
+	dbPath := backgroundDbPath()
+	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net)
+	if err != nil {
+		if dbErr, ok := err.(database.Error); !ok || dbErr.ErrorCode !=
+			database.ErrDbDoesNotExist {
+
+			return nil, err
+		}
+		db, err = database.Create(cfg.DbType, dbPath, activeNetParams.Net)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// discardInvalidSnapshot replaces the block database of a chain loaded from a
+// UTXO set snapshot found to be invalid with the database of the background
+// chain, which validated all the blocks up to the snapshot base.  The database
+// of the invalid chain is moved aside rather than removed.  On failure, the
+// returned database is the passed one while it's still open, and nil once it
+// was closed.
+func discardInvalidSnapshot(db database.DB) (database.DB, error) {
+	if cfg.DbType == "memdb" {
+		return db, nil
+	}
+	status, loaded, err := blockchain.FetchSnapshotStatus(db)
+	if err != nil {
+		return db, err
+	}
+	if !loaded || status != blockchain.SnapshotInvalid {
+		return db, nil
+	}
+
+	dbPath := blockDbPath(cfg.DbType)
+	bgPath := backgroundDbPath()
+	invalidPath := dbPath + "_invalid"
+	if !fileExists(bgPath) {
+		return db, fmt.Errorf("the chain was loaded from an invalid "+
+			"UTXO snapshot and the background chain database '%s' "+
+			"is missing", bgPath)
+	}
+	if fileExists(invalidPath) {
+		return db, fmt.Errorf("the chain was loaded from an invalid "+
+			"UTXO snapshot and '%s' already exists -- remove it to "+
+			"switch to the background chain", invalidPath)
+	}
+
+	flcdLog.Warnf("The chain was loaded from an invalid UTXO snapshot -- "+
+		"moving its database to '%s' and switching to the background "+
+		"chain", invalidPath)
+	if err := db.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(dbPath, invalidPath); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(bgPath, dbPath); err != nil {
+		return nil, err
+	}
+	return database.Open(cfg.DbType, dbPath, activeNetParams.Net)
+}
+
+// loadUtxoSnapshot loads the UTXO set snapshot at the passed path into the
+// chain and starts validating the blocks up to its base in the background.
+func (s *server) loadUtxoSnapshot(path string) (*blockchain.UtxoSnapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	snapshot, err := s.chain.LoadUtxoSnapshot(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// The blocks before the snapshot base are not stored, nor fetched
+	// later on, so the node no longer serves all blocks.
+	s.clearServices(wire.SFNodeNetwork)
+
+	if err := s.startBackgroundChain(); err != nil {
+		srvrLog.Errorf("Unable to start validating the UTXO snapshot "+
+			"in the background: %v", err)
+	}
+	return snapshot, nil
+}
+
+// startBackgroundChain creates the background chain that validates the blocks
+// up to the base of the UTXO set snapshot the chain was loaded from, when it
+// isn't validated yet, and starts syncing it.  It's given the headers of the
+// chain up to the snapshot base first so the assumed valid block applies.
+func (s *server) startBackgroundChain() error {
+	snapshot := s.chain.SnapshotInfo()
+	if snapshot == nil {
+		return nil
+	}
+	switch snapshot.Status {
+	case blockchain.SnapshotValidated:
+		// Remove the background chain database left behind when the
+		// node stopped right after validating the snapshot.
+		if cfg.DbType != "memdb" && fileExists(backgroundDbPath()) {
+			return os.RemoveAll(backgroundDbPath())
+		}
+		return nil
+
+	case blockchain.SnapshotInvalid:
+		return nil
+	}
+
+	db, err := loadBackgroundDB()
+	if err != nil {
+		return err
+	}
+	var checkpoints []chaincfg.Checkpoint
+	if !cfg.DisableCheckpoints {
+		checkpoints = mergeCheckpoints(s.chainParams.Checkpoints, cfg.addCheckpoints)
+	}
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:               db,
+		Interrupt:        s.quit,
+		ChainParams:      s.chainParams,
+		Checkpoints:      checkpoints,
+		AssumeValid:      cfg.assumeValid,
+		TimeSource:       s.timeSource,
+		SigCache:         s.sigCache,
+		HashCache:        s.hashCache,
+		UtxoCacheMaxSize: uint64(cfg.UtxoCacheMaxSizeMiB) * 1024 * 1024,
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	_, bestHeaderHeight := chain.BestHeader()
+	for height := bestHeaderHeight + 1; height <= snapshot.BaseHeight; height++ {
+		hash, err := s.chain.BlockHashByHeight(height)
+		if err != nil {
+			db.Close()
+			return err
+		}
+		header, err := s.chain.HeaderByHash(hash)
+		if err != nil {
+			db.Close()
+			return err
+		}
+		err = chain.ProcessBlockHeader(&header, blockchain.BFNone)
+		if err != nil {
+			db.Close()
+			return err
+		}
+	}
+
+	s.bgMtx.Lock()
+	s.bgChain = chain
+	s.bgDB = db
+	s.bgMtx.Unlock()
+
+	s.syncManager.StartBackgroundSync(chain, s.backgroundChainDone)
+	return nil
+}
+
+// backgroundChainDone is called once the background chain validated the UTXO
+// set snapshot or failed to.  The background chain is discarded once the
+// snapshot is validated.  When it's invalid, the node is shut down so it
+// switches to the background chain on the next start.
+func (s *server) backgroundChainDone(err error) {
+	snapshot := s.chain.SnapshotInfo()
+	switch {
+	case snapshot != nil && snapshot.Status == blockchain.SnapshotInvalid:
+		srvrLog.Criticalf("The UTXO snapshot the chain was loaded from "+
+			"is invalid: %v -- shutting down to switch to the chain "+
+			"validated in the background", err)
+		s.closeBackgroundChain()
+		shutdownRequestChannel <- struct{}{}
+		return
+
+	case err != nil:
+		srvrLog.Errorf("Unable to validate the UTXO snapshot in the "+
+			"background: %v", err)
+		return
+	}
+
+	s.bgMtx.Lock()
+	db := s.bgDB
+	s.bgChain = nil
+	s.bgDB = nil
+	s.bgMtx.Unlock()
+	if db == nil {
+		return
+	}
+	if err := db.Close(); err != nil {
+		srvrLog.Warnf("Unable to close the background chain database: %v",
+			err)
+		return
+	}
+	if cfg.DbType == "memdb" {
+		return
+	}
+	if err := os.RemoveAll(backgroundDbPath()); err != nil {
+		srvrLog.Warnf("Unable to remove the background chain database: %v",
+			err)
+	}
+}
+
+// closeBackgroundChain flushes the background chain, if any, and closes its
+// database.
+func (s *server) closeBackgroundChain() {
+	s.bgMtx.Lock()
+	defer s.bgMtx.Unlock()
+
+	if s.bgChain == nil {
+		return
+	}
+	err := s.bgChain.FlushUtxoCache(blockchain.FlushRequired)
+	if err != nil {
+		srvrLog.Errorf("Error while flushing the background chain "+
+			"cache: %v", err)
+	}
+	if err := s.bgDB.Close(); err != nil {
+		srvrLog.Errorf("Unable to close the background chain database: %v",
+			err)
+	}
+	s.bgChain = nil
+	s.bgDB = nil
+}
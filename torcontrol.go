@@ -0,0 +1,163 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/connmgr"
+	"github.com/flokiorg/go-flokicoin/netaddr"
+)
+
+const (
+	// onionKeyFilename is the name of the file in the data directory that
+	// holds the private key of the onion service published through the
+	// Tor control port.  Reusing the key keeps the onion address stable
+	// across restarts.
+	onionKeyFilename = "onion_v3_private_key"
+
+	// torControlRetryInterval is the time to wait before reconnecting to
+	// the Tor control port after a failure or a lost connection.
+	torControlRetryInterval = time.Minute
+)
+
+// onionServiceTarget returns the local address the onion service forwards
+// incoming connections to.  It is the first listener, with unspecified
+// addresses replaced by the loopback address.  An empty string is returned
+// when there are no listeners.
+func onionServiceTarget(listeners []net.Listener) string {
+	if len(listeners) == 0 {
+		return ""
+	}
+
+	addr, ok := listeners[0].Addr().(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	ip := addr.IP
+	if ip.IsUnspecified() {
+		if ip.To4() != nil {
+			ip = net.IPv4(127, 0, 0, 1)
+		} else {
+			ip = net.IPv6loopback
+		}
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(addr.Port))
+}
+
+// readOnionKey returns the onion service private key stored in the data
+// directory, or an empty string when there is none.
+func readOnionKey(path string) (string, error) {
+	key, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(key)), nil
+}
+
+// publishOnionService authenticates with the Tor control port and publishes
+// an onion service forwarding the default peer port of the active network to
+// the local listener.  The onion address is added to the local addresses of
+// the address manager so it is advertised to peers.
+func (s *server) publishOnionService(ctrl *connmgr.TorController) error {
+	if err := ctrl.Connect(); err != nil {
+		return err
+	}
+
+	keyFile := filepath.Join(cfg.DataDir, onionKeyFilename)
+	key, err := readOnionKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	port, err := strconv.ParseUint(activeNetParams.DefaultPort, 10, 16)
+	if err != nil {
+		return err
+	}
+	service, err := ctrl.AddOnion(key, uint16(port), s.onionTarget)
+	if err != nil {
+		return err
+	}
+
+	// Persist a newly generated key so the same address is reused.
+	if key == "" && service.PrivateKey != "" {
+		err := os.WriteFile(keyFile, []byte(service.PrivateKey+"\n"), 0600)
+		if err != nil {
+			srvrLog.Warnf("Unable to save onion service key to %s: %v",
+				keyFile, err)
+		}
+	}
+
+	na, err := s.addrManager.HostToNetAddress(service.Address(),
+		uint16(port), s.Services())
+	if err != nil {
+		return err
+	}
+	if err := s.addrManager.AddLocalAddress(na, netaddr.ManualPrio); err != nil {
+		return err
+	}
+
+	srvrLog.Infof("Onion service published at %s",
+		netaddr.NetAddressKey(na))
+	return nil
+}
+
+// torControlHandler publishes an onion service through the Tor control port
+// and keeps the control connection open for as long as the server runs since
+// Tor removes the service once the connection is closed.  Lost connections are
+// retried periodically.
+//
+// It must be run as a goroutine.
+func (s *server) torControlHandler() {
+	defer s.wg.Done()
+
+out:
+	for {
+		ctrl := connmgr.NewTorController(cfg.TorControl, cfg.TorPassword)
+		if err := s.publishOnionService(ctrl); err != nil {
+			srvrLog.Warnf("Unable to publish onion service via Tor "+
+				"control port %s: %v", cfg.TorControl, err)
+			ctrl.Close()
+		} else {
+			// Close the control connection on shutdown to unblock
+			// the wait below.
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-s.quit:
+					ctrl.Close()
+				case <-done:
+				}
+			}()
+
+			err := ctrl.Wait()
+			close(done)
+			select {
+			case <-s.quit:
+				break out
+			default:
+			}
+			srvrLog.Warnf("Lost connection to Tor control port %s: %v",
+				cfg.TorControl, err)
+			ctrl.Close()
+		}
+
+		select {
+		case <-time.After(torControlRetryInterval):
+		case <-s.quit:
+			break out
+		}
+	}
+
+	srvrLog.Tracef("Tor control handler done")
+}
@@ -0,0 +1,448 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aead/siphash"
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/chainutil/minisketch"
+	"github.com/flokiorg/go-flokicoin/peer"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+const (
+	// txReconSaltTag is the tag of the hash combining the salts of both
+	// peers into the key of their short transaction ids.
+	txReconSaltTag = "Tx Relay Salting"
+
+	// txReconRequestInterval is the minimum time between two
+	// reconciliation rounds requested from the same peer.
+	txReconRequestInterval = 8 * time.Second
+
+	// txReconRequestTimeout is the duration after which a peer that has
+	// not answered a reconciliation request is assumed to never answer
+	// it.  The pending transactions are flooded to it instead.
+	txReconRequestTimeout = time.Minute
+
+	// txReconMaxSetSize is the maximum number of transactions waiting to
+	// be reconciled with a peer.  Further transactions are flooded to it.
+	txReconMaxSetSize = 3000
+
+	// txReconQPrecision is the scale of the q coefficient in reqrecon
+	// messages.
+	txReconQPrecision = 1<<15 - 1
+
+	// txReconQ is the coefficient used to estimate the size of the set
+	// difference from the size of the smaller set, 0.25 scaled by
+	// txReconQPrecision.
+	txReconQ = txReconQPrecision / 4
+
+	// txReconFanoutOutbound is the number of outbound peers reconciling
+	// transactions that each transaction is still flooded to, so it keeps
+	// propagating quickly through the network.
+	txReconFanoutOutbound = 2
+)
+
+// errUnexpectedReconMsg signifies that a reconciliation message was received
+// out of turn.
+var errUnexpectedReconMsg = errors.New("unexpected reconciliation message")
+
+// txReconState holds the state of transaction reconciliation (BIP330) with a
+// peer.  The side that made the connection initiates the reconciliation rounds
+// by sending reqrecon, the other side replies with the sketch of its set, and
+// the initiator concludes the round with reconcildiff once it has decoded the
+// difference between both sets.
+type txReconState struct {
+	// initiator is whether we request the reconciliation rounds.
+	initiator bool
+
+	// key is the key of the short transaction ids derived from the salts
+	// of both peers.
+	key [16]byte
+
+	mtx sync.Mutex
+
+	// set holds the transactions to announce to the peer in the next
+	// reconciliation round, keyed by short id.
+	set map[uint32]chainhash.Hash
+
+	// snapshot holds the set sent in our last sketch until the initiator
+	// concludes the round.  It is only used by the responder.
+	snapshot map[uint32]chainhash.Hash
+
+	// requested is whether a round was requested and its sketch is
+	// awaited, lastRequest is when, and requestSize is the size of our set
+	// sent in the request.  They are only used by the initiator.
+	requested   bool
+	lastRequest time.Time
+	requestSize int
+}
+
+// newTxReconState returns the reconciliation state with a peer given the salts
+// exchanged in the sendtxrcncl messages.
+func newTxReconState(initiator bool, localSalt, remoteSalt uint64) *txReconState {
+	// The salts are combined in ascending order so both peers derive the
+	// same key.
+	if localSalt > remoteSalt {
+		localSalt, remoteSalt = remoteSalt, localSalt
+	}
+	var salt1, salt2 [8]byte
+	binary.LittleEndian.PutUint64(salt1[:], localSalt)
+	binary.LittleEndian.PutUint64(salt2[:], remoteSalt)
+	h := chainhash.TaggedHash([]byte(txReconSaltTag), salt1[:], salt2[:])
+
+	r := &txReconState{
+		initiator:   initiator,
+		set:         make(map[uint32]chainhash.Hash),
+		lastRequest: time.Now(),
+	}
+	copy(r.key[:], h[:16])
+	return r
+}
+
+// shortID returns the short id of the passed transaction, which is derived
+// from its witness hash.
+func (r *txReconState) shortID(tx *chainutil.Tx) uint32 {
+	return shortIDFromHash(siphash.Sum64(tx.WitnessHash()[:], &r.key))
+}
+
+// shortIDFromHash returns the short id of the passed SipHash of a witness
+// hash.  BIP330 maps the hashes to 1 + (hash mod 0xffffffff), so short ids are
+// never 0, which minisketch can't hold.
+func shortIDFromHash(h uint64) uint32 {
+	return 1 + uint32(h%0xffffffff)
+}
+
+// add adds the passed transaction to the set to reconcile.  It returns false
+// when the set is full, in which case the transaction must be flooded.
+//
+// This function is safe for concurrent access.
+func (r *txReconState) add(tx *chainutil.Tx) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if len(r.set) >= txReconMaxSetSize {
+		return false
+	}
+	r.set[r.shortID(tx)] = *tx.Hash()
+	return true
+}
+
+// takeAll returns the transactions of the passed set.
+func takeAll(set map[uint32]chainhash.Hash) []chainhash.Hash {
+	hashes := make([]chainhash.Hash, 0, len(set))
+	for _, hash := range set {
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// nextRequest returns the reqrecon message to send to start a new round, or
+// nil when it is not time to.  When the peer has not answered the last request
+// in time, the transactions of the set are returned to be flooded instead.
+//
+// This function is safe for concurrent access.
+func (r *txReconState) nextRequest(now time.Time) (*wire.MsgReqRecon, []chainhash.Hash) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.requested {
+		if now.Sub(r.lastRequest) < txReconRequestTimeout {
+			return nil, nil
+		}
+		r.requested = false
+		r.lastRequest = now
+		flood := takeAll(r.set)
+		r.set = make(map[uint32]chainhash.Hash)
+		return nil, flood
+	}
+	if now.Sub(r.lastRequest) < txReconRequestInterval {
+		return nil, nil
+	}
+
+	r.requested = true
+	r.lastRequest = now
+	r.requestSize = len(r.set)
+	return wire.NewMsgReqRecon(uint16(r.requestSize), txReconQ), nil
+}
+
+// sketchCapacity returns the capacity of the sketch needed to decode the
+// expected difference between sets of the passed sizes.
+func sketchCapacity(localSize, remoteSize int, q uint16) int {
+	diff, minSize := localSize-remoteSize, remoteSize
+	if diff < 0 {
+		diff, minSize = -diff, localSize
+	}
+	capacity := diff + int(q)*minSize/txReconQPrecision + 1
+	if capacity > wire.MaxSketchCapacity {
+		capacity = wire.MaxSketchCapacity
+	}
+	return capacity
+}
+
+// respond returns the sketch message answering the passed reconciliation
+// request and keeps the sketched set until the round is concluded.  When the
+// previous round was never concluded, the initiator gave up on it, so the
+// transactions of its sketched set are returned to be flooded instead.
+//
+// This function is safe for concurrent access.
+func (r *txReconState) respond(msg *wire.MsgReqRecon) (*wire.MsgSketch, []chainhash.Hash, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.initiator {
+		return nil, nil, errUnexpectedReconMsg
+	}
+	var flood []chainhash.Hash
+	if r.snapshot != nil {
+		flood = takeAll(r.snapshot)
+		r.snapshot = nil
+	}
+
+	// An empty sketch lets the initiator announce its whole set when
+	// both sets are empty.
+	var capacity int
+	if len(r.set) > 0 || msg.SetSize > 0 {
+		capacity = sketchCapacity(len(r.set), int(msg.SetSize), msg.Q)
+	}
+	sketch := minisketch.New(capacity)
+	for id := range r.set {
+		sketch.Add(id)
+	}
+
+	r.snapshot = r.set
+	r.set = make(map[uint32]chainhash.Hash)
+	return wire.NewMsgSketch(sketch.Serialize()), flood, nil
+}
+
+// reconcile decodes the difference between the set sketched in the passed
+// message and our set.  It returns the reconcildiff message concluding the
+// round along with the transactions to announce to the peer.  When the
+// difference can't be decoded, the round fails and our whole set is announced.
+// A sketch arriving after the request timed out fails the round without
+// announcing anything since our set was already flooded.
+//
+// This function is safe for concurrent access.
+func (r *txReconState) reconcile(msg *wire.MsgSketch) (*wire.MsgReconcilDiff, []chainhash.Hash, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if !r.initiator {
+		return nil, nil, errUnexpectedReconMsg
+	}
+	if !r.requested {
+		// Failing the round lets the peer flood its sketched set and
+		// answer our next request.
+		return wire.NewMsgReconcilDiff(false, nil), nil, nil
+	}
+	remote, err := minisketch.Deserialize(msg.SketchData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Decoding takes time quadratic in the capacity, so the sketch can't
+	// be larger than the one the peer computes for our request with a
+	// full set.
+	maxCapacity := sketchCapacity(txReconMaxSetSize, r.requestSize, txReconQ)
+	if remote.Capacity() > maxCapacity {
+		return nil, nil, fmt.Errorf("sketch capacity of %d exceeds the "+
+			"max capacity of %d for the request", remote.Capacity(),
+			maxCapacity)
+	}
+	r.requested = false
+	set := r.set
+	r.set = make(map[uint32]chainhash.Hash)
+
+	var diff []uint32
+	if remote.Capacity() > 0 {
+		local := minisketch.New(remote.Capacity())
+		for id := range set {
+			local.Add(id)
+		}
+		local.Merge(remote)
+		diff, err = local.Decode()
+	}
+	if remote.Capacity() == 0 || err != nil {
+		return wire.NewMsgReconcilDiff(false, nil), takeAll(set), nil
+	}
+
+	// The differences in our set are missing from the peer's set, and
+	// the others are missing from ours.
+	var announce []chainhash.Hash
+	var ask []uint32
+	for _, id := range diff {
+		if hash, ok := set[id]; ok {
+			announce = append(announce, hash)
+		} else {
+			ask = append(ask, id)
+		}
+	}
+	return wire.NewMsgReconcilDiff(true, ask), announce, nil
+}
+
+// finish concludes the round with the passed reconcildiff message and returns
+// the transactions to announce to the peer: the ones it asked for on success
+// or the whole sketched set on failure.
+//
+// This function is safe for concurrent access.
+func (r *txReconState) finish(msg *wire.MsgReconcilDiff) ([]chainhash.Hash, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.initiator || r.snapshot == nil {
+		return nil, errUnexpectedReconMsg
+	}
+	snapshot := r.snapshot
+	r.snapshot = nil
+
+	if !msg.Success {
+		return takeAll(snapshot), nil
+	}
+	announce := make([]chainhash.Hash, 0, len(msg.AskShortIDs))
+	for _, id := range msg.AskShortIDs {
+		if hash, ok := snapshot[id]; ok {
+			announce = append(announce, hash)
+		}
+	}
+	return announce, nil
+}
+
+// announceTxs queues the inventory of the passed transactions for the peer.
+func (sp *serverPeer) announceTxs(hashes []chainhash.Hash) {
+	for i := range hashes {
+		sp.QueueInventory(wire.NewInvVect(wire.InvTypeTx, &hashes[i]))
+	}
+}
+
+// OnReqRecon is invoked when a peer receives a reqrecon flokicoin message.
+// It replies with the sketch of the transactions to announce to the peer.
+func (sp *serverPeer) OnReqRecon(_ *peer.Peer, msg *wire.MsgReqRecon) {
+	if sp.txRecon == nil {
+		return
+	}
+	sketch, flood, err := sp.txRecon.respond(msg)
+	if err != nil {
+		peerLog.Debugf("Ignoring reqrecon from %v: %v", sp, err)
+		return
+	}
+	if len(flood) > 0 {
+		peerLog.Debugf("Previous reconciliation round with %v was not "+
+			"concluded -- announcing %d transactions", sp, len(flood))
+		sp.announceTxs(flood)
+	}
+	sp.QueueMessage(sketch, nil)
+}
+
+// OnSketch is invoked when a peer receives a sketch flokicoin message.  It
+// concludes the reconciliation round and announces the transactions the peer
+// is missing.
+func (sp *serverPeer) OnSketch(_ *peer.Peer, msg *wire.MsgSketch) {
+	if sp.txRecon == nil {
+		return
+	}
+	diff, announce, err := sp.txRecon.reconcile(msg)
+	if err == errUnexpectedReconMsg {
+		peerLog.Debugf("Ignoring sketch from %v: %v", sp, err)
+		return
+	}
+	if err != nil {
+		peerLog.Debugf("Invalid sketch from %v: %v -- disconnecting",
+			sp, err)
+		sp.Disconnect()
+		return
+	}
+
+	if !diff.Success {
+		peerLog.Debugf("Reconciliation with %v failed -- announcing %d "+
+			"transactions", sp, len(announce))
+	}
+	sp.announceTxs(announce)
+	sp.QueueMessage(diff, nil)
+}
+
+// OnReconcilDiff is invoked when a peer receives a reconcildiff flokicoin
+// message.  It announces the transactions the peer asked for.
+func (sp *serverPeer) OnReconcilDiff(_ *peer.Peer, msg *wire.MsgReconcilDiff) {
+	if sp.txRecon == nil {
+		return
+	}
+	announce, err := sp.txRecon.finish(msg)
+	if err != nil {
+		peerLog.Debugf("Ignoring reconcildiff from %v: %v", sp, err)
+		return
+	}
+	sp.announceTxs(announce)
+}
+
+// txReconFanout returns the ids of the outbound peers reconciling transactions
+// that the transaction with the passed hash is still flooded to.  The peers are
+// picked from the transaction hash so they differ between transactions.  It is
+// invoked from the peerHandler goroutine.
+func txReconFanout(state *peerState, hash *chainhash.Hash) map[int32]struct{} {
+	var ids []int32
+	state.forAllOutboundPeers(func(sp *serverPeer) {
+		if sp.txRecon != nil && sp.Connected() {
+			ids = append(ids, sp.ID())
+		}
+	})
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	fanout := make(map[int32]struct{}, txReconFanoutOutbound)
+	start := binary.LittleEndian.Uint64(hash[:8])
+	for i := 0; i < len(ids) && i < txReconFanoutOutbound; i++ {
+		fanout[ids[(start+uint64(i))%uint64(len(ids))]] = struct{}{}
+	}
+	return fanout
+}
+
+// txReconHandler periodically requests reconciliation rounds from the outbound
+// peers reconciling transactions.  It must be run as a goroutine.
+func (s *server) txReconHandler() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			replyChan := make(chan []*serverPeer)
+			select {
+			case s.query <- getPeersMsg{reply: replyChan}:
+			case <-s.quit:
+				break out
+			}
+
+			now := time.Now()
+			for _, sp := range <-replyChan {
+				if sp.txRecon == nil || !sp.txRecon.initiator {
+					continue
+				}
+				msg, flood := sp.txRecon.nextRequest(now)
+				if msg != nil {
+					sp.QueueMessage(msg, nil)
+				}
+				if len(flood) > 0 {
+					peerLog.Debugf("Reconciliation request to "+
+						"%v timed out -- announcing %d "+
+						"transactions", sp, len(flood))
+					sp.announceTxs(flood)
+				}
+			}
+
+		case <-s.quit:
+			break out
+		}
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+	"github.com/flokiorg/go-flokicoin/chainutil"
+	"github.com/flokiorg/go-flokicoin/chainutil/minisketch"
+	"github.com/flokiorg/go-flokicoin/wire"
+)
+
+// testReconTxs returns n distinct transactions starting at the passed lock
+// time.
+func testReconTxs(start, n int) []*chainutil.Tx {
+	txs := make([]*chainutil.Tx, n)
+	for i := range txs {
+		msgTx := wire.NewMsgTx(1)
+		msgTx.LockTime = uint32(start + i)
+		txs[i] = chainutil.NewTx(msgTx)
+	}
+	return txs
+}
+
+// sortedHashes returns the sorted hashes of the passed transactions.
+func sortedHashes(txs []*chainutil.Tx) []chainhash.Hash {
+	hashes := make([]chainhash.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = *tx.Hash()
+	}
+	sortHashes(hashes)
+	return hashes
+}
+
+// sortHashes sorts the passed hashes.
+func sortHashes(hashes []chainhash.Hash) {
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i].String() < hashes[j].String()
+	})
+}
+
+// TestShortIDFromHash ensures the short ids are mapped from the hashes as
+// specified by BIP330 and are never 0.
+func TestShortIDFromHash(t *testing.T) {
+	tests := []struct {
+		hash uint64
+		want uint32
+	}{
+		{0, 1},
+		{1, 2},
+		{0xfffffffe, 0xffffffff},
+		{0xffffffff, 1},
+		{0x1ffffffff, 2},
+		{0xffffffffffffffff, 1},
+	}
+	for _, test := range tests {
+		if got := shortIDFromHash(test.hash); got != test.want {
+			t.Errorf("shortIDFromHash(%#x): got %#x, want %#x",
+				test.hash, got, test.want)
+		}
+	}
+}
+
+// TestSketchCapacity ensures the sketch capacity covers the difference in set
+// sizes plus the expected difference between the common part.
+func TestSketchCapacity(t *testing.T) {
+	tests := []struct {
+		local, remote int
+		q             uint16
+		want          int
+	}{
+		{0, 0, txReconQ, 1},
+		{10, 0, txReconQ, 11},
+		{0, 10, txReconQ, 11},
+		{100, 100, txReconQ, 25},
+		{100, 40, 0, 61},
+		{20000, 0, txReconQ, wire.MaxSketchCapacity},
+	}
+	for _, test := range tests {
+		got := sketchCapacity(test.local, test.remote, test.q)
+		if got != test.want {
+			t.Errorf("sketchCapacity(%d, %d, %d): got %d, want %d",
+				test.local, test.remote, test.q, got, test.want)
+		}
+	}
+}
+
+// TestTxReconciliationRound ensures a reconciliation round announces to each
+// peer the transactions it is missing, or the whole sets when the difference
+// can't be decoded.
+func TestTxReconciliationRound(t *testing.T) {
+	tests := []struct {
+		name        string
+		common      int
+		onlyInit    int
+		onlyResp    int
+		wantSuccess bool
+	}{
+		{name: "empty sets", wantSuccess: false},
+		{name: "identical sets", common: 20, wantSuccess: true},
+		{name: "small difference", common: 50, onlyInit: 3, onlyResp: 4,
+			wantSuccess: true},
+		{name: "responder only", onlyResp: 5, wantSuccess: true},
+		{name: "difference over capacity", common: 20, onlyInit: 30,
+			onlyResp: 30, wantSuccess: false},
+	}
+
+	for _, test := range tests {
+		initiator := newTxReconState(true, 1234, 5678)
+		responder := newTxReconState(false, 5678, 1234)
+		if initiator.key != responder.key {
+			t.Fatalf("%s: peers derived different keys", test.name)
+		}
+
+		common := testReconTxs(0, test.common)
+		onlyInit := testReconTxs(1000, test.onlyInit)
+		onlyResp := testReconTxs(2000, test.onlyResp)
+		for _, tx := range append(append([]*chainutil.Tx{}, common...), onlyInit...) {
+			initiator.add(tx)
+		}
+		for _, tx := range append(append([]*chainutil.Tx{}, common...), onlyResp...) {
+			responder.add(tx)
+		}
+
+		// No round is requested before the interval elapsed.
+		now := time.Now()
+		if req, _ := initiator.nextRequest(now); req != nil {
+			t.Fatalf("%s: round requested too early", test.name)
+		}
+		req, _ := initiator.nextRequest(now.Add(txReconRequestInterval))
+		if req == nil {
+			t.Fatalf("%s: no round requested", test.name)
+		}
+
+		sketch, flood, err := responder.respond(req)
+		if err != nil {
+			t.Fatalf("%s: respond: %v", test.name, err)
+		}
+		if len(flood) != 0 {
+			t.Fatalf("%s: responder flooded %d transactions",
+				test.name, len(flood))
+		}
+
+		diff, initAnnounce, err := initiator.reconcile(sketch)
+		if err != nil {
+			t.Fatalf("%s: reconcile: %v", test.name, err)
+		}
+		if diff.Success != test.wantSuccess {
+			t.Fatalf("%s: got success %v, want %v", test.name,
+				diff.Success, test.wantSuccess)
+		}
+		respAnnounce, err := responder.finish(diff)
+		if err != nil {
+			t.Fatalf("%s: finish: %v", test.name, err)
+		}
+
+		// On success only the missing transactions are announced,
+		// otherwise the whole sets are.
+		wantInit, wantResp := onlyInit, onlyResp
+		if !test.wantSuccess {
+			wantInit = append(append([]*chainutil.Tx{}, common...), onlyInit...)
+			wantResp = append(append([]*chainutil.Tx{}, common...), onlyResp...)
+		}
+		sortHashes(initAnnounce)
+		sortHashes(respAnnounce)
+		if got, want := initAnnounce, sortedHashes(wantInit); len(got) != len(want) ||
+			(len(got) > 0 && got[0] != want[0]) {
+
+			t.Errorf("%s: initiator announced %d transactions, want %d",
+				test.name, len(got), len(want))
+		}
+		if got, want := respAnnounce, sortedHashes(wantResp); len(got) != len(want) ||
+			(len(got) > 0 && got[0] != want[0]) {
+
+			t.Errorf("%s: responder announced %d transactions, want %d",
+				test.name, len(got), len(want))
+		}
+
+		// Both sets are emptied by the round.
+		if len(initiator.set) != 0 || len(responder.set) != 0 ||
+			responder.snapshot != nil {
+
+			t.Errorf("%s: sets not emptied", test.name)
+		}
+	}
+}
+
+// TestTxReconciliationSketchTooLarge ensures the sketches larger than the
+// capacity the peer can compute for our request are rejected.
+func TestTxReconciliationSketchTooLarge(t *testing.T) {
+	for _, size := range []int{0, 10} {
+		initiator := newTxReconState(true, 1234, 5678)
+		for _, tx := range testReconTxs(0, size) {
+			initiator.add(tx)
+		}
+		now := time.Now().Add(txReconRequestInterval)
+		if req, _ := initiator.nextRequest(now); req == nil {
+			t.Fatalf("set of %d: no round requested", size)
+		}
+
+		maxCapacity := sketchCapacity(txReconMaxSetSize, size, txReconQ)
+		sketch := minisketch.New(maxCapacity + 1)
+		msg := wire.NewMsgSketch(sketch.Serialize())
+		if _, _, err := initiator.reconcile(msg); err == nil ||
+			err == errUnexpectedReconMsg {
+
+			t.Fatalf("set of %d: sketch of capacity %d accepted: %v",
+				size, maxCapacity+1, err)
+		}
+
+		// A sketch of the max capacity is still accepted.
+		sketch = minisketch.New(maxCapacity)
+		msg = wire.NewMsgSketch(sketch.Serialize())
+		if _, _, err := initiator.reconcile(msg); err != nil {
+			t.Fatalf("set of %d: reconcile: %v", size, err)
+		}
+	}
+}
+
+// TestTxReconciliationTimeout ensures the set is flooded when a peer doesn't
+// answer a reconciliation request.
+func TestTxReconciliationTimeout(t *testing.T) {
+	r := newTxReconState(true, 1, 2)
+	for _, tx := range testReconTxs(0, 3) {
+		r.add(tx)
+	}
+
+	now := time.Now().Add(txReconRequestInterval)
+	if req, _ := r.nextRequest(now); req == nil || req.SetSize != 3 {
+		t.Fatalf("unexpected request %v", req)
+	}
+	if req, flood := r.nextRequest(now.Add(time.Second)); req != nil || flood != nil {
+		t.Fatal("new request while awaiting a sketch")
+	}
+	_, flood := r.nextRequest(now.Add(txReconRequestTimeout))
+	if len(flood) != 3 {
+		t.Fatalf("got %d flooded transactions, want 3", len(flood))
+	}
+
+	// A late sketch fails the round without announcing anything.
+	diff, announce, err := r.reconcile(wire.NewMsgSketch(nil))
+	if err != nil {
+		t.Fatalf("reconcile late sketch: %v", err)
+	}
+	if diff.Success || len(announce) != 0 {
+		t.Fatalf("late sketch: got success %v and %d announced "+
+			"transactions", diff.Success, len(announce))
+	}
+}
+
+// TestTxReconciliationNewRoundAfterTimeout ensures a new round can be
+// reconciled after the initiator gave up on a request, whether the sketch
+// answering it arrives late or never.
+func TestTxReconciliationNewRoundAfterTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		lateSketch bool
+	}{
+		{name: "late sketch", lateSketch: true},
+		{name: "lost sketch", lateSketch: false},
+	}
+
+	for _, test := range tests {
+		initiator := newTxReconState(true, 1234, 5678)
+		responder := newTxReconState(false, 5678, 1234)
+		for _, tx := range testReconTxs(0, 5) {
+			responder.add(tx)
+		}
+
+		// The request times out on the initiator before the sketch
+		// answering it arrives.
+		now := time.Now().Add(txReconRequestInterval)
+		req, _ := initiator.nextRequest(now)
+		if req == nil {
+			t.Fatalf("%s: no round requested", test.name)
+		}
+		sketch, _, err := responder.respond(req)
+		if err != nil {
+			t.Fatalf("%s: respond: %v", test.name, err)
+		}
+		now = now.Add(txReconRequestTimeout)
+		initiator.nextRequest(now)
+
+		var flooded int
+		if test.lateSketch {
+			diff, _, err := initiator.reconcile(sketch)
+			if err != nil {
+				t.Fatalf("%s: reconcile: %v", test.name, err)
+			}
+			announce, err := responder.finish(diff)
+			if err != nil {
+				t.Fatalf("%s: finish: %v", test.name, err)
+			}
+			flooded = len(announce)
+		}
+
+		// The responder answers the next request and floods the set of
+		// the round that was never concluded.
+		for _, tx := range testReconTxs(100, 2) {
+			responder.add(tx)
+		}
+		req, _ = initiator.nextRequest(now.Add(txReconRequestInterval))
+		if req == nil {
+			t.Fatalf("%s: no new round requested", test.name)
+		}
+		sketch, flood, err := responder.respond(req)
+		if err != nil {
+			t.Fatalf("%s: respond to new round: %v", test.name, err)
+		}
+		if flooded += len(flood); flooded != 5 {
+			t.Fatalf("%s: responder flooded %d transactions, want 5",
+				test.name, flooded)
+		}
+
+		diff, _, err := initiator.reconcile(sketch)
+		if err != nil {
+			t.Fatalf("%s: reconcile new round: %v", test.name, err)
+		}
+		if !diff.Success {
+			t.Fatalf("%s: new round failed", test.name)
+		}
+		announce, err := responder.finish(diff)
+		if err != nil {
+			t.Fatalf("%s: finish new round: %v", test.name, err)
+		}
+		if len(announce) != 2 {
+			t.Fatalf("%s: responder announced %d transactions, "+
+				"want 2", test.name, len(announce))
+		}
+	}
+}
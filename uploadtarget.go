@@ -0,0 +1,169 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/blockchain"
+	"github.com/flokiorg/go-flokicoin/chaincfg/chainhash"
+)
+
+const (
+	// uploadTargetTimeframe is the duration of a cycle of the upload
+	// target.
+	uploadTargetTimeframe = 24 * time.Hour
+
+	// historicalBlockAge is the age after which a block is considered
+	// historical and is no longer served once the upload target is
+	// reached.
+	historicalBlockAge = 7 * 24 * time.Hour
+
+	// uploadTargetBlockSize is the size of the new blocks the reserve of
+	// the upload target is kept for.  The blocks of the chain are rarely
+	// larger than the maximum size of a block without its witness data,
+	// while reserving the maximum payload of a block for each of them
+	// would exceed most targets with short block intervals.
+	uploadTargetBlockSize = blockchain.MaxBlockBaseSize
+)
+
+// uploadTargetReserve returns the part of the upload target kept to relay the
+// new blocks expected during the passed time left in the cycle.
+func uploadTargetReserve(timeLeft, blockInterval time.Duration) uint64 {
+	if blockInterval <= 0 {
+		return 0
+	}
+	return uint64(timeLeft/blockInterval) * uploadTargetBlockSize
+}
+
+// minUploadTarget returns the smallest upload target in MiB that still serves
+// historical blocks at the start of a cycle with the passed block interval.
+func minUploadTarget(blockInterval time.Duration) uint64 {
+	return uploadTargetReserve(uploadTargetTimeframe, blockInterval)>>20 + 1
+}
+
+// uploadTarget tracks the bytes sent to peers during the current cycle of the
+// upload target set with --maxuploadtarget.
+type uploadTarget struct {
+	// target is the number of bytes that may be sent per cycle.  Zero
+	// means there is no target.
+	target uint64
+
+	// blockInterval is the expected time between blocks.  It is used to
+	// keep enough of the target to relay the new blocks of the rest of
+	// the cycle.
+	blockInterval time.Duration
+
+	mtx        sync.Mutex
+	cycleStart time.Time
+	cycleBytes uint64
+}
+
+// uploadTargetStatus is a snapshot of the state of the upload target.
+type uploadTargetStatus struct {
+	Target                uint64
+	Timeframe             time.Duration
+	TargetReached         bool
+	ServeHistoricalBlocks bool
+	BytesLeft             uint64
+	TimeLeft              time.Duration
+}
+
+// newUploadTarget returns an upload target allowing the passed number of
+// bytes per cycle.
+func newUploadTarget(target uint64, blockInterval time.Duration) *uploadTarget {
+	return &uploadTarget{
+		target:        target,
+		blockInterval: blockInterval,
+		cycleStart:    time.Now(),
+	}
+}
+
+// rollCycle starts a new cycle when the current one is over.  It must be called
+// with the mutex held.
+func (u *uploadTarget) rollCycle(now time.Time) {
+	if now.Sub(u.cycleStart) >= uploadTargetTimeframe {
+		u.cycleStart = now
+		u.cycleBytes = 0
+	}
+}
+
+// addBytes records bytes sent to a peer.
+//
+// This function is safe for concurrent access.
+func (u *uploadTarget) addBytes(n uint64, now time.Time) {
+	if u.target == 0 {
+		return
+	}
+
+	u.mtx.Lock()
+	u.rollCycle(now)
+	u.cycleBytes += n
+	u.mtx.Unlock()
+}
+
+// status returns the state of the upload target at the passed time.
+//
+// This function is safe for concurrent access.
+func (u *uploadTarget) status(now time.Time) uploadTargetStatus {
+	status := uploadTargetStatus{
+		Target:                u.target,
+		Timeframe:             uploadTargetTimeframe,
+		ServeHistoricalBlocks: true,
+	}
+	if u.target == 0 {
+		return status
+	}
+
+	u.mtx.Lock()
+	u.rollCycle(now)
+	sent := u.cycleBytes
+	status.TimeLeft = u.cycleStart.Add(uploadTargetTimeframe).Sub(now)
+	u.mtx.Unlock()
+
+	if sent < u.target {
+		status.BytesLeft = u.target - sent
+	}
+	status.TargetReached = status.BytesLeft == 0
+
+	// Historical blocks are no longer served once what is left of the
+	// target is only enough to relay the new blocks expected during the
+	// rest of the cycle.
+	reserve := uploadTargetReserve(status.TimeLeft, u.blockInterval)
+	status.ServeHistoricalBlocks = status.BytesLeft > reserve
+	return status
+}
+
+// isHistoricalBlock returns whether the block with the passed hash is more than
+// a week older than the best block.
+func (s *server) isHistoricalBlock(hash *chainhash.Hash) bool {
+	header, err := s.chain.HeaderByHash(hash)
+	if err != nil {
+		return false
+	}
+	best, err := s.chain.HeaderByHash(&s.chain.BestSnapshot().Hash)
+	if err != nil {
+		return false
+	}
+	return best.Timestamp.Sub(header.Timestamp) > historicalBlockAge
+}
+
+// refuseHistoricalBlock returns whether a request for the block with the passed
+// hash must be refused because the upload target does not allow serving
+// historical blocks anymore.  Peers with the download permission are exempt
+// from the target.  Filtered blocks are always considered historical since they
+// are only requested by light clients.
+func (s *server) refuseHistoricalBlock(sp *serverPeer, hash *chainhash.Hash,
+	filtered bool) bool {
+
+	if sp.permissions.has(permDownload) {
+		return false
+	}
+	if s.uploadTarget.status(time.Now()).ServeHistoricalBlocks {
+		return false
+	}
+	return filtered || s.isHistoricalBlock(hash)
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flokiorg/go-flokicoin/chaincfg"
+)
+
+// TestUploadTarget ensures the upload target tracks the bytes sent per cycle,
+// stops serving historical blocks when only the reserve for new blocks is left
+// and starts a new cycle once the timeframe is over.
+func TestUploadTarget(t *testing.T) {
+	const blockSize = uploadTargetBlockSize
+
+	// No target never limits anything.
+	u := newUploadTarget(0, time.Hour)
+	u.addBytes(100*blockSize, time.Now())
+	status := u.status(time.Now())
+	if status.TargetReached || !status.ServeHistoricalBlocks {
+		t.Fatalf("unexpected status without target: %+v", status)
+	}
+
+	start := time.Unix(1700000000, 0)
+	u = newUploadTarget(30*blockSize, time.Hour)
+	u.cycleStart = start
+
+	tests := []struct {
+		name          string
+		elapsed       time.Duration
+		sent          uint64
+		wantLeft      uint64
+		wantTimeLeft  time.Duration
+		wantReached   bool
+		wantServeHist bool
+	}{{
+		name:          "cycle start",
+		wantLeft:      30 * blockSize,
+		wantTimeLeft:  24 * time.Hour,
+		wantServeHist: true,
+	}, {
+		name:         "reserve for new blocks reached",
+		sent:         7 * blockSize,
+		wantLeft:     23 * blockSize,
+		wantTimeLeft: 24 * time.Hour,
+	}, {
+		name:          "reserve shrinks with the cycle",
+		elapsed:       12 * time.Hour,
+		wantLeft:      23 * blockSize,
+		wantTimeLeft:  12 * time.Hour,
+		wantServeHist: true,
+	}, {
+		name:         "target reached",
+		elapsed:      12 * time.Hour,
+		sent:         30 * blockSize,
+		wantTimeLeft: 12 * time.Hour,
+		wantReached:  true,
+	}, {
+		name:          "new cycle",
+		elapsed:       24 * time.Hour,
+		wantLeft:      30 * blockSize,
+		wantTimeLeft:  24 * time.Hour,
+		wantServeHist: true,
+	}}
+
+	for _, test := range tests {
+		now := start.Add(test.elapsed)
+		u.addBytes(test.sent, now)
+		status := u.status(now)
+		if status.BytesLeft != test.wantLeft ||
+			status.TimeLeft != test.wantTimeLeft ||
+			status.TargetReached != test.wantReached ||
+			status.ServeHistoricalBlocks != test.wantServeHist {
+
+			t.Errorf("%s: unexpected status %+v", test.name, status)
+		}
+	}
+}
+
+// TestUploadTargetMainNet ensures the reserve for new blocks leaves room to
+// serve historical blocks with the block interval of the main network.
+func TestUploadTargetMainNet(t *testing.T) {
+	blockInterval := chaincfg.MainNetParams.TargetTimePerBlock
+	start := time.Unix(1700000000, 0)
+
+	// The smallest target allowed still serves historical blocks at the
+	// start of a cycle, but not a smaller one.
+	minTarget := minUploadTarget(blockInterval)
+	u := newUploadTarget(minTarget<<20, blockInterval)
+	u.cycleStart = start
+	if !u.status(start).ServeHistoricalBlocks {
+		t.Fatalf("the minimum target of %d MiB doesn't serve historical "+
+			"blocks at the start of a cycle", minTarget)
+	}
+	u = newUploadTarget((minTarget-1)<<20, blockInterval)
+	u.cycleStart = start
+	if u.status(start).ServeHistoricalBlocks {
+		t.Fatalf("a target below the minimum of %d MiB serves "+
+			"historical blocks", minTarget)
+	}
+
+	u = newUploadTarget(5000<<20, blockInterval)
+	u.cycleStart = start
+	tests := []struct {
+		name          string
+		elapsed       time.Duration
+		sent          uint64
+		wantServeHist bool
+	}{{
+		name:          "cycle start",
+		wantServeHist: true,
+	}, {
+		name:          "historical blocks served",
+		elapsed:       time.Hour,
+		sent:          3000 << 20,
+		wantServeHist: true,
+	}, {
+		name:    "reserve for new blocks reached",
+		elapsed: time.Hour,
+		sent:    1000 << 20,
+	}, {
+		name:          "reserve shrinks with the cycle",
+		elapsed:       20 * time.Hour,
+		wantServeHist: true,
+	}}
+	for _, test := range tests {
+		now := start.Add(test.elapsed)
+		u.addBytes(test.sent, now)
+		status := u.status(now)
+		if status.ServeHistoricalBlocks != test.wantServeHist {
+			t.Errorf("%s: unexpected status %+v", test.name, status)
+		}
+	}
+}
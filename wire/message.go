@@ -61,6 +61,10 @@ const (
 	CmdCFCheckpt    = "cfcheckpt"
 	CmdSendAddrV2   = "sendaddrv2"
 	CmdWTxIdRelay   = "wtxidrelay"
+	CmdSendTxRcncl  = "sendtxrcncl"
+	CmdReqRecon     = "reqrecon"
+	CmdSketch       = "sketch"
+	CmdReconcilDiff = "reconcildiff"
 )
 
 // MessageEncoding represents the wire message encoding format to be used.
@@ -197,6 +201,18 @@ func makeEmptyMessage(command string) (Message, error) {
 	case CmdCFCheckpt:
 		msg = &MsgCFCheckpt{}
 
+	case CmdSendTxRcncl:
+		msg = &MsgSendTxRcncl{}
+
+	case CmdReqRecon:
+		msg = &MsgReqRecon{}
+
+	case CmdSketch:
+		msg = &MsgSketch{}
+
+	case CmdReconcilDiff:
+		msg = &MsgReconcilDiff{}
+
 	default:
 		return nil, ErrUnknownMessage
 	}
@@ -77,6 +77,10 @@ func TestMessage(t *testing.T) {
 		[]byte("payload"))
 	msgCFHeaders := NewMsgCFHeaders()
 	msgCFCheckpt := NewMsgCFCheckpt(GCSFilterRegular, &chainhash.Hash{}, 0)
+	msgSendTxRcncl := NewMsgSendTxRcncl(1, 123123)
+	msgReqRecon := NewMsgReqRecon(10, 8191)
+	msgSketch := NewMsgSketch([]byte{0x01, 0x02, 0x03, 0x04})
+	msgReconcilDiff := NewMsgReconcilDiff(true, []uint32{1, 2})
 
 	tests := []struct {
 		in     Message      // Value to encode
@@ -112,6 +116,10 @@ func TestMessage(t *testing.T) {
 		{msgCFilter, msgCFilter, pver, MainNet, 65},
 		{msgCFHeaders, msgCFHeaders, pver, MainNet, 90},
 		{msgCFCheckpt, msgCFCheckpt, pver, MainNet, 58},
+		{msgSendTxRcncl, msgSendTxRcncl, pver, MainNet, 36},
+		{msgReqRecon, msgReqRecon, pver, MainNet, 28},
+		{msgSketch, msgSketch, pver, MainNet, 29},
+		{msgReconcilDiff, msgReconcilDiff, pver, MainNet, 34},
 	}
 
 	t.Logf("Running %d tests", len(tests))
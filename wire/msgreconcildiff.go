@@ -0,0 +1,110 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// MsgReconcilDiff defines a flokicoin reconcildiff message which is used to
+// conclude a transaction reconciliation round (BIP330).  On success, it lists
+// the short ids of the transactions of the responder the requester is missing.
+// On failure, both peers announce their whole reconciliation set.  It
+// implements the Message interface.
+//
+// This message was not added until protocol versions starting with
+// AddrV2Version.
+type MsgReconcilDiff struct {
+	Success     bool
+	AskShortIDs []uint32
+}
+
+// FlcDecode decodes r using the flokicoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgReconcilDiff) FlcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < AddrV2Version {
+		str := fmt.Sprintf("reconcildiff message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgReconcilDiff.FlcDecode", str)
+	}
+
+	if err := readElement(r, &msg.Success); err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Limit to the maximum number of differences a sketch can decode.
+	if count > MaxSketchCapacity {
+		str := fmt.Sprintf("too many short ids for message "+
+			"[count %v, max %v]", count, MaxSketchCapacity)
+		return messageError("MsgReconcilDiff.FlcDecode", str)
+	}
+
+	msg.AskShortIDs = make([]uint32, count)
+	for i := range msg.AskShortIDs {
+		if err := readElement(r, &msg.AskShortIDs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FlcEncode encodes the receiver to w using the flokicoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgReconcilDiff) FlcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < AddrV2Version {
+		str := fmt.Sprintf("reconcildiff message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgReconcilDiff.FlcEncode", str)
+	}
+
+	count := len(msg.AskShortIDs)
+	if count > MaxSketchCapacity {
+		str := fmt.Sprintf("too many short ids for message "+
+			"[count %v, max %v]", count, MaxSketchCapacity)
+		return messageError("MsgReconcilDiff.FlcEncode", str)
+	}
+
+	if err := writeElement(w, msg.Success); err != nil {
+		return err
+	}
+	if err := WriteVarInt(w, pver, uint64(count)); err != nil {
+		return err
+	}
+	for _, id := range msg.AskShortIDs {
+		if err := writeElement(w, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgReconcilDiff) Command() string {
+	return CmdReconcilDiff
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgReconcilDiff) MaxPayloadLength(pver uint32) uint32 {
+	// Success flag 1 byte + num short ids (varInt) + short ids 4 bytes
+	// each.
+	return 1 + MaxVarIntPayload + MaxSketchCapacity*4
+}
+
+// NewMsgReconcilDiff returns a new flokicoin reconcildiff message that
+// conforms to the Message interface.  See MsgReconcilDiff for details.
+func NewMsgReconcilDiff(success bool, askShortIDs []uint32) *MsgReconcilDiff {
+	return &MsgReconcilDiff{
+		Success:     success,
+		AskShortIDs: askShortIDs,
+	}
+}
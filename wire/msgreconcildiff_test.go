@@ -0,0 +1,76 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestReconcilDiffWire tests the MsgReconcilDiff wire encode and decode along
+// with its command, maximum payload and short id limit.
+func TestReconcilDiffWire(t *testing.T) {
+	msg := NewMsgReconcilDiff(true, []uint32{1, 0x01020304})
+	if cmd := msg.Command(); cmd != "reconcildiff" {
+		t.Errorf("wrong command - got %v want reconcildiff", cmd)
+	}
+	wantPayload := uint32(1 + MaxVarIntPayload + MaxSketchCapacity*4)
+	if maxPayload := msg.MaxPayloadLength(ProtocolVersion); maxPayload != wantPayload {
+		t.Errorf("wrong max payload length - got %v, want %v",
+			maxPayload, wantPayload)
+	}
+
+	encoded := []byte{
+		0x01,                   // Success
+		0x02,                   // Varint for number of short ids
+		0x01, 0x00, 0x00, 0x00, // First short id
+		0x04, 0x03, 0x02, 0x01, // Second short id
+	}
+	var buf bytes.Buffer
+	if err := msg.FlcEncode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("FlcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), encoded) {
+		t.Fatalf("FlcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(encoded))
+	}
+
+	var readMsg MsgReconcilDiff
+	err := readMsg.FlcDecode(bytes.NewReader(encoded), ProtocolVersion,
+		BaseEncoding)
+	if err != nil {
+		t.Fatalf("FlcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("FlcDecode\n got: %s want: %s", spew.Sdump(readMsg),
+			spew.Sdump(msg))
+	}
+
+	// More short ids than a sketch can decode are rejected.
+	big := NewMsgReconcilDiff(true, make([]uint32, MaxSketchCapacity+1))
+	buf.Reset()
+	if err := big.FlcEncode(&buf, ProtocolVersion, BaseEncoding); err == nil {
+		t.Error("encode succeeded with too many short ids")
+	}
+	tooMany := []byte{0x01, 0xfd, 0x01, 0x20} // Success, 8193 short ids
+	err = readMsg.FlcDecode(bytes.NewReader(tooMany), ProtocolVersion,
+		BaseEncoding)
+	if err == nil {
+		t.Error("decode succeeded with too many short ids")
+	}
+
+	// The message did not exist before AddrV2Version.
+	oldPver := AddrV2Version - 1
+	if err := msg.FlcEncode(&buf, oldPver, BaseEncoding); err == nil {
+		t.Error("encode succeeded for old protocol version")
+	}
+	err = readMsg.FlcDecode(bytes.NewReader(encoded), oldPver, BaseEncoding)
+	if err == nil {
+		t.Error("decode succeeded for old protocol version")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// MsgReqRecon defines a flokicoin reqrecon message which is used to request
+// a transaction reconciliation round (BIP330) from a peer, which replies with
+// a sketch message.  It implements the Message interface.
+//
+// This message was not added until protocol versions starting with
+// AddrV2Version.
+type MsgReqRecon struct {
+	// SetSize is the size of the requester's reconciliation set.
+	SetSize uint16
+
+	// Q is the coefficient used to estimate the set difference, scaled
+	// by 2^15 - 1.
+	Q uint16
+}
+
+// FlcDecode decodes r using the flokicoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgReqRecon) FlcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < AddrV2Version {
+		str := fmt.Sprintf("reqrecon message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgReqRecon.FlcDecode", str)
+	}
+
+	var err error
+	msg.SetSize, err = binarySerializer.Uint16(r, littleEndian)
+	if err != nil {
+		return err
+	}
+	msg.Q, err = binarySerializer.Uint16(r, littleEndian)
+	return err
+}
+
+// FlcEncode encodes the receiver to w using the flokicoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgReqRecon) FlcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < AddrV2Version {
+		str := fmt.Sprintf("reqrecon message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgReqRecon.FlcEncode", str)
+	}
+
+	err := binarySerializer.PutUint16(w, littleEndian, msg.SetSize)
+	if err != nil {
+		return err
+	}
+	return binarySerializer.PutUint16(w, littleEndian, msg.Q)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgReqRecon) Command() string {
+	return CmdReqRecon
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgReqRecon) MaxPayloadLength(pver uint32) uint32 {
+	// Set size 2 bytes + q 2 bytes.
+	return 4
+}
+
+// NewMsgReqRecon returns a new flokicoin reqrecon message that conforms to the
+// Message interface.  See MsgReqRecon for details.
+func NewMsgReqRecon(setSize, q uint16) *MsgReqRecon {
+	return &MsgReqRecon{
+		SetSize: setSize,
+		Q:       q,
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestReqReconWire tests the MsgReqRecon wire encode and decode along with its
+// command and maximum payload.
+func TestReqReconWire(t *testing.T) {
+	msg := NewMsgReqRecon(300, 8191)
+	if cmd := msg.Command(); cmd != "reqrecon" {
+		t.Errorf("wrong command - got %v want reqrecon", cmd)
+	}
+	if maxPayload := msg.MaxPayloadLength(ProtocolVersion); maxPayload != 4 {
+		t.Errorf("wrong max payload length - got %v, want 4", maxPayload)
+	}
+
+	encoded := []byte{
+		0x2c, 0x01, // Set size
+		0xff, 0x1f, // Q
+	}
+	var buf bytes.Buffer
+	if err := msg.FlcEncode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("FlcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), encoded) {
+		t.Fatalf("FlcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(encoded))
+	}
+
+	var readMsg MsgReqRecon
+	err := readMsg.FlcDecode(bytes.NewReader(encoded), ProtocolVersion,
+		BaseEncoding)
+	if err != nil {
+		t.Fatalf("FlcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("FlcDecode\n got: %s want: %s", spew.Sdump(readMsg),
+			spew.Sdump(msg))
+	}
+
+	// Truncated messages must fail to decode.
+	err = readMsg.FlcDecode(bytes.NewReader(encoded[:3]), ProtocolVersion,
+		BaseEncoding)
+	if err == nil {
+		t.Error("decode succeeded for truncated message")
+	}
+
+	// The message did not exist before AddrV2Version.
+	oldPver := AddrV2Version - 1
+	if err := msg.FlcEncode(&buf, oldPver, BaseEncoding); err == nil {
+		t.Error("encode succeeded for old protocol version")
+	}
+	err = readMsg.FlcDecode(bytes.NewReader(encoded), oldPver, BaseEncoding)
+	if err == nil {
+		t.Error("decode succeeded for old protocol version")
+	}
+}
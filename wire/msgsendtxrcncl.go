@@ -0,0 +1,71 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// MsgSendTxRcncl defines a flokicoin sendtxrcncl message which is used for a
+// peer to signal support for transaction relay through set reconciliation
+// (BIP330) during the handshake.  It implements the Message interface.
+//
+// This message was not added until protocol versions starting with
+// AddrV2Version.
+type MsgSendTxRcncl struct {
+	// Version is the highest reconciliation protocol version supported.
+	Version uint32
+
+	// Salt is the peer's contribution to the salt of the short
+	// transaction ids used in reconciliation.
+	Salt uint64
+}
+
+// FlcDecode decodes r using the flokicoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSendTxRcncl) FlcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < AddrV2Version {
+		str := fmt.Sprintf("sendtxrcncl message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendTxRcncl.FlcDecode", str)
+	}
+
+	return readElements(r, &msg.Version, &msg.Salt)
+}
+
+// FlcEncode encodes the receiver to w using the flokicoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSendTxRcncl) FlcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < AddrV2Version {
+		str := fmt.Sprintf("sendtxrcncl message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendTxRcncl.FlcEncode", str)
+	}
+
+	return writeElements(w, msg.Version, msg.Salt)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSendTxRcncl) Command() string {
+	return CmdSendTxRcncl
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSendTxRcncl) MaxPayloadLength(pver uint32) uint32 {
+	// Version 4 bytes + salt 8 bytes.
+	return 12
+}
+
+// NewMsgSendTxRcncl returns a new flokicoin sendtxrcncl message that conforms
+// to the Message interface.  See MsgSendTxRcncl for details.
+func NewMsgSendTxRcncl(version uint32, salt uint64) *MsgSendTxRcncl {
+	return &MsgSendTxRcncl{
+		Version: version,
+		Salt:    salt,
+	}
+}
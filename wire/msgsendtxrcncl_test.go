@@ -0,0 +1,59 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestSendTxRcnclWire tests the MsgSendTxRcncl wire encode and decode along
+// with its command and maximum payload.
+func TestSendTxRcnclWire(t *testing.T) {
+	msg := NewMsgSendTxRcncl(1, 0x0102030405060708)
+	if cmd := msg.Command(); cmd != "sendtxrcncl" {
+		t.Errorf("wrong command - got %v want sendtxrcncl", cmd)
+	}
+	if maxPayload := msg.MaxPayloadLength(ProtocolVersion); maxPayload != 12 {
+		t.Errorf("wrong max payload length - got %v, want 12", maxPayload)
+	}
+
+	encoded := []byte{
+		0x01, 0x00, 0x00, 0x00, // Version
+		0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, // Salt
+	}
+	var buf bytes.Buffer
+	if err := msg.FlcEncode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("FlcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), encoded) {
+		t.Fatalf("FlcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(encoded))
+	}
+
+	var readMsg MsgSendTxRcncl
+	err := readMsg.FlcDecode(bytes.NewReader(encoded), ProtocolVersion,
+		BaseEncoding)
+	if err != nil {
+		t.Fatalf("FlcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("FlcDecode\n got: %s want: %s", spew.Sdump(readMsg),
+			spew.Sdump(msg))
+	}
+
+	// The message did not exist before AddrV2Version.
+	oldPver := AddrV2Version - 1
+	if err := msg.FlcEncode(&buf, oldPver, BaseEncoding); err == nil {
+		t.Error("encode succeeded for old protocol version")
+	}
+	err = readMsg.FlcDecode(bytes.NewReader(encoded), oldPver, BaseEncoding)
+	if err == nil {
+		t.Error("decode succeeded for old protocol version")
+	}
+}
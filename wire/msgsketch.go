@@ -0,0 +1,84 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// MaxSketchCapacity is the maximum capacity of a sketch in a sketch message,
+// which is the maximum number of differences a reconciliation round can find.
+const MaxSketchCapacity = 2 << 12
+
+// SketchElementSize is the size of each element of a serialized sketch.
+const SketchElementSize = 4
+
+// MsgSketch defines a flokicoin sketch message which is used to reply to a
+// reqrecon message with the sketch of the short transaction ids of the
+// responder's reconciliation set (BIP330).  It implements the Message
+// interface.
+//
+// This message was not added until protocol versions starting with
+// AddrV2Version.
+type MsgSketch struct {
+	SketchData []byte
+}
+
+// FlcDecode decodes r using the flokicoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSketch) FlcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < AddrV2Version {
+		str := fmt.Sprintf("sketch message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSketch.FlcDecode", str)
+	}
+
+	var err error
+	msg.SketchData, err = ReadVarBytes(r, pver,
+		MaxSketchCapacity*SketchElementSize, "sketch data")
+	return err
+}
+
+// FlcEncode encodes the receiver to w using the flokicoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSketch) FlcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < AddrV2Version {
+		str := fmt.Sprintf("sketch message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSketch.FlcEncode", str)
+	}
+
+	size := len(msg.SketchData)
+	if size > MaxSketchCapacity*SketchElementSize {
+		str := fmt.Sprintf("sketch data size too large for message "+
+			"[size %v, max %v]", size,
+			MaxSketchCapacity*SketchElementSize)
+		return messageError("MsgSketch.FlcEncode", str)
+	}
+
+	return WriteVarBytes(w, pver, msg.SketchData)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSketch) Command() string {
+	return CmdSketch
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSketch) MaxPayloadLength(pver uint32) uint32 {
+	maxSize := uint32(MaxSketchCapacity * SketchElementSize)
+	return uint32(VarIntSerializeSize(uint64(maxSize))) + maxSize
+}
+
+// NewMsgSketch returns a new flokicoin sketch message that conforms to the
+// Message interface.  See MsgSketch for details.
+func NewMsgSketch(sketchData []byte) *MsgSketch {
+	return &MsgSketch{
+		SketchData: sketchData,
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2024 The Flokicoin developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestSketchWire tests the MsgSketch wire encode and decode along with its
+// command, maximum payload and size limit.
+func TestSketchWire(t *testing.T) {
+	msg := NewMsgSketch([]byte{0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00})
+	if cmd := msg.Command(); cmd != "sketch" {
+		t.Errorf("wrong command - got %v want sketch", cmd)
+	}
+	wantPayload := uint32(3 + MaxSketchCapacity*SketchElementSize)
+	if maxPayload := msg.MaxPayloadLength(ProtocolVersion); maxPayload != wantPayload {
+		t.Errorf("wrong max payload length - got %v, want %v",
+			maxPayload, wantPayload)
+	}
+
+	encoded := []byte{
+		0x08,                   // Varint for sketch data size
+		0x01, 0x00, 0x00, 0x00, // First syndrome
+		0x02, 0x00, 0x00, 0x00, // Second syndrome
+	}
+	var buf bytes.Buffer
+	if err := msg.FlcEncode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("FlcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), encoded) {
+		t.Fatalf("FlcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(encoded))
+	}
+
+	var readMsg MsgSketch
+	err := readMsg.FlcDecode(bytes.NewReader(encoded), ProtocolVersion,
+		BaseEncoding)
+	if err != nil {
+		t.Fatalf("FlcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("FlcDecode\n got: %s want: %s", spew.Sdump(readMsg),
+			spew.Sdump(msg))
+	}
+
+	// Sketches over the maximum capacity are rejected.
+	big := NewMsgSketch(make([]byte, (MaxSketchCapacity+1)*SketchElementSize))
+	buf.Reset()
+	if err := big.FlcEncode(&buf, ProtocolVersion, BaseEncoding); err == nil {
+		t.Error("encode succeeded for oversized sketch")
+	}
+	buf.Reset()
+	WriteVarBytes(&buf, ProtocolVersion, big.SketchData)
+	err = readMsg.FlcDecode(&buf, ProtocolVersion, BaseEncoding)
+	if err == nil {
+		t.Error("decode succeeded for oversized sketch")
+	}
+
+	// The message did not exist before AddrV2Version.
+	oldPver := AddrV2Version - 1
+	if err := msg.FlcEncode(&buf, oldPver, BaseEncoding); err == nil {
+		t.Error("encode succeeded for old protocol version")
+	}
+	err = readMsg.FlcDecode(bytes.NewReader(encoded), oldPver, BaseEncoding)
+	if err == nil {
+		t.Error("decode succeeded for old protocol version")
+	}
+}
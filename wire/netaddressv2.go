@@ -24,14 +24,14 @@ var (
 	// maximum size for an unknown networkID.
 	ErrInvalidAddressSize = fmt.Errorf("invalid address size")
 
-	// ErrSkippedNetworkID is returned when the cjdns, i2p, or unknown
-	// networks are encountered during decoding. lokid does not support i2p
-	// or cjdns addresses. In the case of an unknown networkID, this is so
-	// that a future BIP reserving a new networkID does not cause older
-	// addrv2-supporting lokid software to disconnect upon receiving the new
-	// addresses. This error can also be returned when an OnionCat-encoded
-	// torv2 address is received with the ipv6 networkID. This error
-	// signals to the caller to continue reading.
+	// ErrSkippedNetworkID is returned when an unknown network is
+	// encountered during decoding. This is so that a future BIP reserving
+	// a new networkID does not cause older addrv2-supporting lokid
+	// software to disconnect upon receiving the new addresses. This error
+	// can also be returned when an OnionCat-encoded torv2 address is
+	// received with the ipv6 networkID, or when a cjdns address outside
+	// of fc00::/8 is received. This error signals to the caller to
+	// continue reading.
 	ErrSkippedNetworkID = fmt.Errorf("skipped networkID")
 )
 
@@ -72,7 +72,7 @@ func isOnionCatTor(ip net.IP) bool {
 // NetAddressV2 defines information about a peer on the network including the
 // last time it was seen, the services it supports, its address, and port. This
 // struct is used in the addrv2 message (MsgAddrV2) and can contain larger
-// addresses, like Tor. Additionally, it can contain any NetAddress address.
+// addresses, like Tor, I2P and CJDNS. Additionally, it can contain any NetAddress address.
 type NetAddressV2 struct {
 	// Last time the address was seen. This is, unfortunately, encoded as a
 	// uint32 on the wire and therefore is limited to 2106. This field is
@@ -107,8 +107,8 @@ func (na *NetAddressV2) AddService(service ServiceFlag) {
 
 // ToLegacy attempts to convert a NetAddressV2 to a legacy NetAddress. This
 // only works for ipv4, ipv6, or torv2 addresses as they can be encoded with
-// the OnionCat encoding. If this method is called on a torv3 address, nil will
-// be returned.
+// the OnionCat encoding. If this method is called on a torv3, i2p or cjdns
+// address, nil will be returned.
 func (na *NetAddressV2) ToLegacy() *NetAddress {
 	legacyNa := &NetAddress{
 		Timestamp: na.Timestamp,
@@ -123,7 +123,7 @@ func (na *NetAddressV2) ToLegacy() *NetAddress {
 		legacyNa.IP = a.addr[:]
 	case *torv2Addr:
 		legacyNa.IP = a.onionCatEncoding()
-	case *torv3Addr:
+	case *torv3Addr, *i2pAddr, *cjdnsAddr:
 		return nil
 	}
 
@@ -149,6 +149,75 @@ func (na *NetAddressV2) TorV3Key() byte {
 	return addr.addr[0]
 }
 
+// IsI2P returns a bool that signals to the caller whether or not this is an
+// i2p address.
+func (na *NetAddressV2) IsI2P() bool {
+	_, ok := na.Addr.(*i2pAddr)
+	return ok
+}
+
+// I2PKey returns the first byte of the i2p destination hash. This is used in
+// the addrmgr to calculate a key from a network group.
+func (na *NetAddressV2) I2PKey() byte {
+	// This should never be called on a non-i2p address.
+	addr, ok := na.Addr.(*i2pAddr)
+	if !ok {
+		panic("unexpected I2PKey call on non-i2p address")
+	}
+
+	return addr.addr[0]
+}
+
+// IsCJDNS returns a bool that signals to the caller whether or not this is a
+// cjdns address.
+func (na *NetAddressV2) IsCJDNS() bool {
+	_, ok := na.Addr.(*cjdnsAddr)
+	return ok
+}
+
+// CJDNSKey returns the second byte of the cjdns address. The first byte is
+// always 0xfc, so this is the first byte derived from the public key of the
+// node. This is used in the addrmgr to calculate a key from a network group.
+func (na *NetAddressV2) CJDNSKey() byte {
+	// This should never be called on a non-cjdns address.
+	addr, ok := na.Addr.(*cjdnsAddr)
+	if !ok {
+		panic("unexpected CJDNSKey call on non-cjdns address")
+	}
+
+	return addr.addr[1]
+}
+
+// NetAddressV2FromCJDNS creates a NetAddressV2 for the passed cjdns address.
+// CJDNS addresses are IPv6 addresses in fc00::/8, so they cannot be told apart
+// from regular IPv6 addresses by NetAddressV2FromBytes.
+func NetAddressV2FromCJDNS(timestamp time.Time, services ServiceFlag,
+	ip net.IP, port uint16) *NetAddressV2 {
+
+	addr := &cjdnsAddr{netID: cjdns}
+	copy(addr.addr[:], ip.To16())
+	return &NetAddressV2{
+		Timestamp: timestamp,
+		Services:  services,
+		Addr:      addr,
+		Port:      port,
+	}
+}
+
+// NetAddressV2FromI2P creates a NetAddressV2 for the i2p destination with the
+// passed SHA256 hash.  I2P destinations have the same size as torv3 public
+// keys, so they cannot be told apart by NetAddressV2FromBytes.
+func NetAddressV2FromI2P(timestamp time.Time, services ServiceFlag,
+	hash [I2PSize]byte, port uint16) *NetAddressV2 {
+
+	return &NetAddressV2{
+		Timestamp: timestamp,
+		Services:  services,
+		Addr:      &i2pAddr{addr: hash, netID: i2p},
+		Port:      port,
+	}
+}
+
 // NetAddressV2FromBytes creates a NetAddressV2 from a byte slice. It will
 // also handle a torv2 address using the OnionCat encoding.
 func NetAddressV2FromBytes(timestamp time.Time, services ServiceFlag,
@@ -223,6 +292,12 @@ func writeNetAddressV2(w io.Writer, pver uint32, na *NetAddressV2) error {
 	case *torv3Addr:
 		netID = a.netID
 		address = a.addr[:]
+	case *i2pAddr:
+		netID = a.netID
+		address = a.addr[:]
+	case *cjdnsAddr:
+		netID = a.netID
+		address = a.addr[:]
 	default:
 		// This should not occur.
 		return fmt.Errorf("unexpected address type")
@@ -291,10 +366,7 @@ func readNetAddressV2(r io.Reader, pver uint32, na *NetAddressV2) error {
 		return ErrSkippedNetworkID
 	}
 
-	// If the netID is an i2p or cjdns address, we'll advance the reader
-	// and return a special error to signal to the caller to not use the
-	// passed NetAddressV2 struct. Otherwise, we'll just read the address
-	// and port without returning an error.
+	// Read the address and port of the known network.
 	switch networkID(netID) {
 	case ipv4:
 		addr := &ipv4Addr{}
@@ -375,7 +447,7 @@ func readNetAddressV2(r io.Reader, pver uint32, na *NetAddressV2) error {
 	case i2p:
 		addr := &i2pAddr{}
 		addr.netID = i2p
-		if decodedSize != uint64(i2pSize) {
+		if decodedSize != uint64(I2PSize) {
 			return ErrInvalidAddressSize
 		}
 
@@ -388,7 +460,7 @@ func readNetAddressV2(r io.Reader, pver uint32, na *NetAddressV2) error {
 			return err
 		}
 
-		return ErrSkippedNetworkID
+		na.Addr = addr
 	case cjdns:
 		addr := &cjdnsAddr{}
 		addr.netID = cjdns
@@ -405,14 +477,19 @@ func readNetAddressV2(r io.Reader, pver uint32, na *NetAddressV2) error {
 			return err
 		}
 
-		return ErrSkippedNetworkID
+		na.Addr = addr
+
+		// BIP-155 says cjdns addresses are in fc00::/8, so the
+		// others are ignored.
+		if addr.addr[0] != 0xfc {
+			return ErrSkippedNetworkID
+		}
 	}
 
 	return nil
 }
 
-// networkID represents the network that a given address is in. CJDNS and I2P
-// addresses are not included.
+// networkID represents the network that a given address is in.
 type networkID uint8
 
 const (
@@ -448,8 +525,9 @@ const (
 	// TorV3Size is the size of a torv3 address in bytes.
 	TorV3Size = 32
 
-	// i2pSize is the size of an i2p address.
-	i2pSize = 32
+	// I2PSize is the size of an i2p address in bytes.  It is the SHA256
+	// hash of the destination.
+	I2PSize = 32
 
 	// cjdnsSize is the size of a cjdns address.
 	cjdnsSize = 16
@@ -463,6 +541,10 @@ const (
 	// TorV3EncodedSize is the size of a torv3 address encoded in base32
 	// with the ".onion" suffix.
 	TorV3EncodedSize = 62
+
+	// I2PEncodedSize is the size of an i2p address encoded in unpadded
+	// base32 with the ".b32.i2p" suffix.
+	I2PEncodedSize = 60
 )
 
 // isKnownNetworkID returns true if the networkID is one listed above and false
@@ -578,11 +660,43 @@ func (a *torv3Addr) Network() string {
 var _ net.Addr = (*torv3Addr)(nil)
 
 type i2pAddr struct {
-	addr  [i2pSize]byte
+	addr  [I2PSize]byte
 	netID networkID
 }
 
+// Part of the net.Addr interface.
+func (a *i2pAddr) String() string {
+	// BIP-155 describes the i2p address format as the unpadded base32
+	// encoding of the destination hash with the ".b32.i2p" suffix.
+	base32Hash := base32.StdEncoding.WithPadding(base32.NoPadding).
+		EncodeToString(a.addr[:])
+	return strings.ToLower(base32Hash) + ".b32.i2p"
+}
+
+// Part of the net.Addr interface.
+func (a *i2pAddr) Network() string {
+	return string(a.netID)
+}
+
+// Compile-time constraints to check that i2pAddr meets the net.Addr
+// interface.
+var _ net.Addr = (*i2pAddr)(nil)
+
 type cjdnsAddr struct {
 	addr  [cjdnsSize]byte
 	netID networkID
 }
+
+// Part of the net.Addr interface.
+func (a *cjdnsAddr) String() string {
+	return net.IP(a.addr[:]).String()
+}
+
+// Part of the net.Addr interface.
+func (a *cjdnsAddr) Network() string {
+	return string(a.netID)
+}
+
+// Compile-time constraints to check that cjdnsAddr meets the net.Addr
+// interface.
+var _ net.Addr = (*cjdnsAddr)(nil)
@@ -3,6 +3,7 @@ package wire
 import (
 	"bytes"
 	"io"
+	"net"
 	"testing"
 	"time"
 )
@@ -99,6 +100,78 @@ func TestNetAddressV2FromBytes(t *testing.T) {
 	}
 }
 
+// TestNetAddressV2FromI2P tests that i2p addresses are encoded as expected.
+func TestNetAddressV2FromI2P(t *testing.T) {
+	var hash [I2PSize]byte
+	for i := range hash {
+		hash[i] = byte(i)
+	}
+	na := NetAddressV2FromI2P(time.Time{}, 0, hash, 0)
+
+	if !na.IsI2P() || na.IsTorV3() {
+		t.Fatalf("address is not an i2p address")
+	}
+	if na.ToLegacy() != nil {
+		t.Fatalf("i2p address has a legacy encoding")
+	}
+
+	want := "aaaqeayeaudaocajbifqydiob4ibceqtcqkrmfyydenbwha5dypq.b32.i2p"
+	if na.Addr.String() != want {
+		t.Fatalf("got %s, want %s", na.Addr.String(), want)
+	}
+	if len(want) != I2PEncodedSize {
+		t.Fatalf("encoded size %d, want %d", len(want), I2PEncodedSize)
+	}
+
+	var b bytes.Buffer
+	if err := writeNetAddressV2(&b, 0, na); err != nil {
+		t.Fatalf("failed writing address %v", err)
+	}
+	var decoded NetAddressV2
+	if err := readNetAddressV2(&b, 0, &decoded); err != nil {
+		t.Fatalf("failed reading address %v", err)
+	}
+	if decoded.Addr.String() != want {
+		t.Fatalf("decoded %s, want %s", decoded.Addr.String(), want)
+	}
+}
+
+// TestNetAddressV2FromCJDNS tests that cjdns addresses are encoded as
+// expected.
+func TestNetAddressV2FromCJDNS(t *testing.T) {
+	ip := net.ParseIP("fc32:17ea:e415:c3bf:9808:149d:b5a2:c9aa")
+	na := NetAddressV2FromCJDNS(time.Time{}, 0, ip, 15212)
+
+	if !na.IsCJDNS() || na.IsI2P() || na.IsTorV3() {
+		t.Fatalf("address is not a cjdns address")
+	}
+	if na.ToLegacy() != nil {
+		t.Fatalf("cjdns address has a legacy encoding")
+	}
+	if na.Addr.String() != ip.String() {
+		t.Fatalf("got %s, want %s", na.Addr.String(), ip)
+	}
+	if na.CJDNSKey() != 0x32 {
+		t.Fatalf("got key %x, want 32", na.CJDNSKey())
+	}
+
+	var b bytes.Buffer
+	if err := writeNetAddressV2(&b, 0, na); err != nil {
+		t.Fatalf("failed writing address %v", err)
+	}
+	if b.Bytes()[5] != byte(cjdns) {
+		t.Fatalf("unexpected network id %d", b.Bytes()[5])
+	}
+	var decoded NetAddressV2
+	if err := readNetAddressV2(&b, 0, &decoded); err != nil {
+		t.Fatalf("failed reading address %v", err)
+	}
+	if !decoded.IsCJDNS() || decoded.Port != 15212 {
+		t.Fatalf("unexpected decoded address %v:%d", decoded.Addr,
+			decoded.Port)
+	}
+}
+
 // TestReadNetAddressV2 tests that readNetAddressV2 behaves as expected in
 // different scenarios.
 func TestReadNetAddressV2(t *testing.T) {
@@ -236,7 +309,7 @@ func TestReadNetAddressV2(t *testing.T) {
 				0x22,
 			},
 			string(i2p),
-			ErrSkippedNetworkID,
+			nil,
 		},
 
 		// Invalid cjdns size.
@@ -246,7 +319,7 @@ func TestReadNetAddressV2(t *testing.T) {
 			ErrInvalidAddressSize,
 		},
 
-		// Valid cjdns encoding.
+		// Cjdns address outside of fc00::/8.
 		{
 			[]byte{
 				0x00, 0x00, 0x00, 0x00, 0x00, 0x06, 0x10, 0x20,
@@ -254,9 +327,21 @@ func TestReadNetAddressV2(t *testing.T) {
 				0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x22,
 				0x22,
 			},
-			string(cjdns),
+			"",
 			ErrSkippedNetworkID,
 		},
+
+		// Valid cjdns encoding.
+		{
+			[]byte{
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x06, 0x10, 0xfc,
+				0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+				0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x22,
+				0x22,
+			},
+			string(cjdns),
+			nil,
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))